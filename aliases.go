@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// tagPattern is the set of valid Docker tags.
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// tagValues builds the data available to tag templates: everything
+// ecr.repository_template sees plus .GitSHA (also .GitShortSHA), .Branch (the
+// git branch with the characters a tag cannot have replaced by "-"), .Date
+// and .Timestamp (UTC, when the profile was resolved, so every tag of a run
+// agrees), .Version and .Tag (the image_tag). .Version comes from
+// PUSHECR_VERSION or the latest git tag, without a leading "v".
+func tagValues(profile string, config *ProfileConfig) map[string]string {
+	data := repositoryValues(profile, config.ECR.RepositoryValues)
+	data["GitSHA"] = git("rev-parse", "--short", "HEAD")
+	data["GitShortSHA"] = data["GitSHA"]
+	data["Branch"] = tagUnsafe.ReplaceAllString(data["GitBranch"], "-")
+	resolved := config.resolvedAt
+	if resolved.IsZero() {
+		resolved = time.Now().UTC()
+	}
+	data["Date"] = resolved.Format("20060102")
+	data["Timestamp"] = resolved.Format("20060102150405")
+	data["Version"] = strings.TrimPrefix(orDefault(os.Getenv("PUSHECR_VERSION"), git("describe", "--tags", "--abbrev=0")), "v")
+	data["Tag"] = config.ECR.ImageTag
+	return data
+}
+
+// tagUnsafe matches the characters a tag cannot contain.
+var tagUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// tagFuncs are the functions available to tag templates: {{env "NAME"}}
+// reads an environment variable, e.g. the CI build number.
+var tagFuncs = template.FuncMap{"env": os.Getenv}
+
+// renderTag renders a tag template and checks the result is a valid tag.
+func renderTag(name, text string, data map[string]string) (string, error) {
+	tmpl, err := template.New(name).Funcs(tagFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errorf(KeyAliasTemplateInvalid, name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	tag := out.String()
+	if !tagPattern.MatchString(tag) {
+		return "", errorf(KeyAliasTagInvalid, name, tag)
+	}
+	return tag, nil
+}
+
+// aliasTags resolves ecr.tag_aliases into alias name → tag.
+func (ecr *ECR) aliasTags() (map[string]string, error) {
+	aliases := ecr.Config.ECR.TagAliases
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+	data := tagValues(ecr.Profile, ecr.Config)
+	tags := map[string]string{}
+	for _, alias := range sortedKeys(aliases) {
+		tag, err := renderTag("ecr.tag_aliases."+alias, aliases[alias], data)
+		if err != nil {
+			return nil, withCode(ErrCodeConfigInvalid, err)
+		}
+		tags[alias] = tag
+	}
+	return tags, nil
+}
+
+// pushAliases points every alias tag at the pushed image.
+func (ecr *ECR) pushAliases(tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	digest := ecr.Digest
+	if digest == "" {
+		var err error
+		if digest, err = ecr.imageDigest(ecr.Config.ECR.ImageTag); err != nil {
+			return err
+		}
+	}
+	for _, alias := range sortedKeys(tags) {
+		if err := ecr.putImageTag(digest, tags[alias]); err != nil {
+			return errorf(KeyAliasFailed, alias, tags[alias], err)
+		}
+		fmt.Printf(ColorGreen+"Alias %s: %s → %s"+ColorReset+"\n", alias, tags[alias], shortDigest(digest))
+	}
+	return nil
+}
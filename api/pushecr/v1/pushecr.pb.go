@@ -0,0 +1,924 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: pushecr/v1/pushecr.proto
+
+package pushecrv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type RunStatus int32
+
+const (
+	RunStatus_RUN_STATUS_UNSPECIFIED RunStatus = 0
+	RunStatus_RUN_STATUS_RUNNING     RunStatus = 1
+	RunStatus_RUN_STATUS_SUCCEEDED   RunStatus = 2
+	RunStatus_RUN_STATUS_FAILED      RunStatus = 3
+)
+
+// Enum value maps for RunStatus.
+var (
+	RunStatus_name = map[int32]string{
+		0: "RUN_STATUS_UNSPECIFIED",
+		1: "RUN_STATUS_RUNNING",
+		2: "RUN_STATUS_SUCCEEDED",
+		3: "RUN_STATUS_FAILED",
+	}
+	RunStatus_value = map[string]int32{
+		"RUN_STATUS_UNSPECIFIED": 0,
+		"RUN_STATUS_RUNNING":     1,
+		"RUN_STATUS_SUCCEEDED":   2,
+		"RUN_STATUS_FAILED":      3,
+	}
+)
+
+func (x RunStatus) Enum() *RunStatus {
+	p := new(RunStatus)
+	*p = x
+	return p
+}
+
+func (x RunStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (RunStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_pushecr_v1_pushecr_proto_enumTypes[0].Descriptor()
+}
+
+func (RunStatus) Type() protoreflect.EnumType {
+	return &file_pushecr_v1_pushecr_proto_enumTypes[0]
+}
+
+func (x RunStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use RunStatus.Descriptor instead.
+func (RunStatus) EnumDescriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{0}
+}
+
+// Overrides are per-run changes to the selected profile.
+type Overrides struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageTag      string                 `protobuf:"bytes,1,opt,name=image_tag,json=imageTag,proto3" json:"image_tag,omitempty"`
+	Repository    string                 `protobuf:"bytes,2,opt,name=repository,proto3" json:"repository,omitempty"`
+	Region        string                 `protobuf:"bytes,3,opt,name=region,proto3" json:"region,omitempty"`
+	ImageName     string                 `protobuf:"bytes,4,opt,name=image_name,json=imageName,proto3" json:"image_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Overrides) Reset() {
+	*x = Overrides{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Overrides) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Overrides) ProtoMessage() {}
+
+func (x *Overrides) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Overrides.ProtoReflect.Descriptor instead.
+func (*Overrides) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Overrides) GetImageTag() string {
+	if x != nil {
+		return x.ImageTag
+	}
+	return ""
+}
+
+func (x *Overrides) GetRepository() string {
+	if x != nil {
+		return x.Repository
+	}
+	return ""
+}
+
+func (x *Overrides) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *Overrides) GetImageName() string {
+	if x != nil {
+		return x.ImageName
+	}
+	return ""
+}
+
+type StageEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stage         string                 `protobuf:"bytes,1,opt,name=stage,proto3" json:"stage,omitempty"`
+	Status        RunStatus              `protobuf:"varint,2,opt,name=status,proto3,enum=pushecr.v1.RunStatus" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=time,proto3" json:"time,omitempty"`
+	ErrorCode     string                 `protobuf:"bytes,5,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+	ErrorKey      string                 `protobuf:"bytes,6,opt,name=error_key,json=errorKey,proto3" json:"error_key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StageEvent) Reset() {
+	*x = StageEvent{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StageEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StageEvent) ProtoMessage() {}
+
+func (x *StageEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StageEvent.ProtoReflect.Descriptor instead.
+func (*StageEvent) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StageEvent) GetStage() string {
+	if x != nil {
+		return x.Stage
+	}
+	return ""
+}
+
+func (x *StageEvent) GetStatus() RunStatus {
+	if x != nil {
+		return x.Status
+	}
+	return RunStatus_RUN_STATUS_UNSPECIFIED
+}
+
+func (x *StageEvent) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *StageEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *StageEvent) GetErrorCode() string {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ""
+}
+
+func (x *StageEvent) GetErrorKey() string {
+	if x != nil {
+		return x.ErrorKey
+	}
+	return ""
+}
+
+type Run struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Job           string                 `protobuf:"bytes,2,opt,name=job,proto3" json:"job,omitempty"`
+	Profile       string                 `protobuf:"bytes,3,opt,name=profile,proto3" json:"profile,omitempty"`
+	Trigger       string                 `protobuf:"bytes,4,opt,name=trigger,proto3" json:"trigger,omitempty"`
+	Status        RunStatus              `protobuf:"varint,5,opt,name=status,proto3,enum=pushecr.v1.RunStatus" json:"status,omitempty"`
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt    *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	ErrorCode     string                 `protobuf:"bytes,8,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+	Error         string                 `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	Overrides     *Overrides             `protobuf:"bytes,10,opt,name=overrides,proto3" json:"overrides,omitempty"`
+	Stages        []*StageEvent          `protobuf:"bytes,11,rep,name=stages,proto3" json:"stages,omitempty"`
+	ErrorKey      string                 `protobuf:"bytes,12,opt,name=error_key,json=errorKey,proto3" json:"error_key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Run) Reset() {
+	*x = Run{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Run) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Run) ProtoMessage() {}
+
+func (x *Run) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Run.ProtoReflect.Descriptor instead.
+func (*Run) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Run) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Run) GetJob() string {
+	if x != nil {
+		return x.Job
+	}
+	return ""
+}
+
+func (x *Run) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *Run) GetTrigger() string {
+	if x != nil {
+		return x.Trigger
+	}
+	return ""
+}
+
+func (x *Run) GetStatus() RunStatus {
+	if x != nil {
+		return x.Status
+	}
+	return RunStatus_RUN_STATUS_UNSPECIFIED
+}
+
+func (x *Run) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Run) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Run) GetErrorCode() string {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ""
+}
+
+func (x *Run) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Run) GetOverrides() *Overrides {
+	if x != nil {
+		return x.Overrides
+	}
+	return nil
+}
+
+func (x *Run) GetStages() []*StageEvent {
+	if x != nil {
+		return x.Stages
+	}
+	return nil
+}
+
+func (x *Run) GetErrorKey() string {
+	if x != nil {
+		return x.ErrorKey
+	}
+	return ""
+}
+
+type SubmitBuildRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Profile       string                 `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	Overrides     *Overrides             `protobuf:"bytes,2,opt,name=overrides,proto3" json:"overrides,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitBuildRequest) Reset() {
+	*x = SubmitBuildRequest{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitBuildRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitBuildRequest) ProtoMessage() {}
+
+func (x *SubmitBuildRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitBuildRequest.ProtoReflect.Descriptor instead.
+func (*SubmitBuildRequest) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubmitBuildRequest) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *SubmitBuildRequest) GetOverrides() *Overrides {
+	if x != nil {
+		return x.Overrides
+	}
+	return nil
+}
+
+type SubmitBuildResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Run           *Run                   `protobuf:"bytes,1,opt,name=run,proto3" json:"run,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitBuildResponse) Reset() {
+	*x = SubmitBuildResponse{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitBuildResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitBuildResponse) ProtoMessage() {}
+
+func (x *SubmitBuildResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitBuildResponse.ProtoReflect.Descriptor instead.
+func (*SubmitBuildResponse) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubmitBuildResponse) GetRun() *Run {
+	if x != nil {
+		return x.Run
+	}
+	return nil
+}
+
+type GetRunRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRunRequest) Reset() {
+	*x = GetRunRequest{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRunRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRunRequest) ProtoMessage() {}
+
+func (x *GetRunRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRunRequest.ProtoReflect.Descriptor instead.
+func (*GetRunRequest) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetRunRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetRunResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Run           *Run                   `protobuf:"bytes,1,opt,name=run,proto3" json:"run,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRunResponse) Reset() {
+	*x = GetRunResponse{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRunResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRunResponse) ProtoMessage() {}
+
+func (x *GetRunResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRunResponse.ProtoReflect.Descriptor instead.
+func (*GetRunResponse) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetRunResponse) GetRun() *Run {
+	if x != nil {
+		return x.Run
+	}
+	return nil
+}
+
+type ListRunsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRunsRequest) Reset() {
+	*x = ListRunsRequest{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRunsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRunsRequest) ProtoMessage() {}
+
+func (x *ListRunsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRunsRequest.ProtoReflect.Descriptor instead.
+func (*ListRunsRequest) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{7}
+}
+
+type ListRunsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Runs          []*Run                 `protobuf:"bytes,1,rep,name=runs,proto3" json:"runs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRunsResponse) Reset() {
+	*x = ListRunsResponse{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRunsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRunsResponse) ProtoMessage() {}
+
+func (x *ListRunsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRunsResponse.ProtoReflect.Descriptor instead.
+func (*ListRunsResponse) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListRunsResponse) GetRuns() []*Run {
+	if x != nil {
+		return x.Runs
+	}
+	return nil
+}
+
+type StreamRunEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamRunEventsRequest) Reset() {
+	*x = StreamRunEventsRequest{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamRunEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamRunEventsRequest) ProtoMessage() {}
+
+func (x *StreamRunEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamRunEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamRunEventsRequest) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StreamRunEventsRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type StreamRunEventsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*StreamRunEventsResponse_Stage
+	//	*StreamRunEventsResponse_Log
+	//	*StreamRunEventsResponse_Result
+	Event         isStreamRunEventsResponse_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamRunEventsResponse) Reset() {
+	*x = StreamRunEventsResponse{}
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamRunEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamRunEventsResponse) ProtoMessage() {}
+
+func (x *StreamRunEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pushecr_v1_pushecr_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamRunEventsResponse.ProtoReflect.Descriptor instead.
+func (*StreamRunEventsResponse) Descriptor() ([]byte, []int) {
+	return file_pushecr_v1_pushecr_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StreamRunEventsResponse) GetEvent() isStreamRunEventsResponse_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *StreamRunEventsResponse) GetStage() *StageEvent {
+	if x != nil {
+		if x, ok := x.Event.(*StreamRunEventsResponse_Stage); ok {
+			return x.Stage
+		}
+	}
+	return nil
+}
+
+func (x *StreamRunEventsResponse) GetLog() []byte {
+	if x != nil {
+		if x, ok := x.Event.(*StreamRunEventsResponse_Log); ok {
+			return x.Log
+		}
+	}
+	return nil
+}
+
+func (x *StreamRunEventsResponse) GetResult() *Run {
+	if x != nil {
+		if x, ok := x.Event.(*StreamRunEventsResponse_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isStreamRunEventsResponse_Event interface {
+	isStreamRunEventsResponse_Event()
+}
+
+type StreamRunEventsResponse_Stage struct {
+	Stage *StageEvent `protobuf:"bytes,1,opt,name=stage,proto3,oneof"`
+}
+
+type StreamRunEventsResponse_Log struct {
+	Log []byte `protobuf:"bytes,2,opt,name=log,proto3,oneof"`
+}
+
+type StreamRunEventsResponse_Result struct {
+	Result *Run `protobuf:"bytes,3,opt,name=result,proto3,oneof"`
+}
+
+func (*StreamRunEventsResponse_Stage) isStreamRunEventsResponse_Event() {}
+
+func (*StreamRunEventsResponse_Log) isStreamRunEventsResponse_Event() {}
+
+func (*StreamRunEventsResponse_Result) isStreamRunEventsResponse_Event() {}
+
+var File_pushecr_v1_pushecr_proto protoreflect.FileDescriptor
+
+const file_pushecr_v1_pushecr_proto_rawDesc = "" +
+	"\n" +
+	"\x18pushecr/v1/pushecr.proto\x12\n" +
+	"pushecr.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x7f\n" +
+	"\tOverrides\x12\x1b\n" +
+	"\timage_tag\x18\x01 \x01(\tR\bimageTag\x12\x1e\n" +
+	"\n" +
+	"repository\x18\x02 \x01(\tR\n" +
+	"repository\x12\x16\n" +
+	"\x06region\x18\x03 \x01(\tR\x06region\x12\x1d\n" +
+	"\n" +
+	"image_name\x18\x04 \x01(\tR\timageName\"\xd3\x01\n" +
+	"\n" +
+	"StageEvent\x12\x14\n" +
+	"\x05stage\x18\x01 \x01(\tR\x05stage\x12-\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x15.pushecr.v1.RunStatusR\x06status\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12.\n" +
+	"\x04time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1d\n" +
+	"\n" +
+	"error_code\x18\x05 \x01(\tR\terrorCode\x12\x1b\n" +
+	"\terror_key\x18\x06 \x01(\tR\berrorKey\"\xb9\x03\n" +
+	"\x03Run\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03job\x18\x02 \x01(\tR\x03job\x12\x18\n" +
+	"\aprofile\x18\x03 \x01(\tR\aprofile\x12\x18\n" +
+	"\atrigger\x18\x04 \x01(\tR\atrigger\x12-\n" +
+	"\x06status\x18\x05 \x01(\x0e2\x15.pushecr.v1.RunStatusR\x06status\x129\n" +
+	"\n" +
+	"started_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x1d\n" +
+	"\n" +
+	"error_code\x18\b \x01(\tR\terrorCode\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\x123\n" +
+	"\toverrides\x18\n" +
+	" \x01(\v2\x15.pushecr.v1.OverridesR\toverrides\x12.\n" +
+	"\x06stages\x18\v \x03(\v2\x16.pushecr.v1.StageEventR\x06stages\x12\x1b\n" +
+	"\terror_key\x18\f \x01(\tR\berrorKey\"c\n" +
+	"\x12SubmitBuildRequest\x12\x18\n" +
+	"\aprofile\x18\x01 \x01(\tR\aprofile\x123\n" +
+	"\toverrides\x18\x02 \x01(\v2\x15.pushecr.v1.OverridesR\toverrides\"8\n" +
+	"\x13SubmitBuildResponse\x12!\n" +
+	"\x03run\x18\x01 \x01(\v2\x0f.pushecr.v1.RunR\x03run\"\x1f\n" +
+	"\rGetRunRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"3\n" +
+	"\x0eGetRunResponse\x12!\n" +
+	"\x03run\x18\x01 \x01(\v2\x0f.pushecr.v1.RunR\x03run\"\x11\n" +
+	"\x0fListRunsRequest\"7\n" +
+	"\x10ListRunsResponse\x12#\n" +
+	"\x04runs\x18\x01 \x03(\v2\x0f.pushecr.v1.RunR\x04runs\"(\n" +
+	"\x16StreamRunEventsRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x91\x01\n" +
+	"\x17StreamRunEventsResponse\x12.\n" +
+	"\x05stage\x18\x01 \x01(\v2\x16.pushecr.v1.StageEventH\x00R\x05stage\x12\x12\n" +
+	"\x03log\x18\x02 \x01(\fH\x00R\x03log\x12)\n" +
+	"\x06result\x18\x03 \x01(\v2\x0f.pushecr.v1.RunH\x00R\x06resultB\a\n" +
+	"\x05event*p\n" +
+	"\tRunStatus\x12\x1a\n" +
+	"\x16RUN_STATUS_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12RUN_STATUS_RUNNING\x10\x01\x12\x18\n" +
+	"\x14RUN_STATUS_SUCCEEDED\x10\x02\x12\x15\n" +
+	"\x11RUN_STATUS_FAILED\x10\x032\xc6\x02\n" +
+	"\x0ePushECRService\x12N\n" +
+	"\vSubmitBuild\x12\x1e.pushecr.v1.SubmitBuildRequest\x1a\x1f.pushecr.v1.SubmitBuildResponse\x12?\n" +
+	"\x06GetRun\x12\x19.pushecr.v1.GetRunRequest\x1a\x1a.pushecr.v1.GetRunResponse\x12E\n" +
+	"\bListRuns\x12\x1b.pushecr.v1.ListRunsRequest\x1a\x1c.pushecr.v1.ListRunsResponse\x12\\\n" +
+	"\x0fStreamRunEvents\x12\".pushecr.v1.StreamRunEventsRequest\x1a#.pushecr.v1.StreamRunEventsResponse0\x01B-Z+lpmg.xyz/goscripts/api/pushecr/v1;pushecrv1b\x06proto3"
+
+var (
+	file_pushecr_v1_pushecr_proto_rawDescOnce sync.Once
+	file_pushecr_v1_pushecr_proto_rawDescData []byte
+)
+
+func file_pushecr_v1_pushecr_proto_rawDescGZIP() []byte {
+	file_pushecr_v1_pushecr_proto_rawDescOnce.Do(func() {
+		file_pushecr_v1_pushecr_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pushecr_v1_pushecr_proto_rawDesc), len(file_pushecr_v1_pushecr_proto_rawDesc)))
+	})
+	return file_pushecr_v1_pushecr_proto_rawDescData
+}
+
+var file_pushecr_v1_pushecr_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_pushecr_v1_pushecr_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_pushecr_v1_pushecr_proto_goTypes = []any{
+	(RunStatus)(0),                  // 0: pushecr.v1.RunStatus
+	(*Overrides)(nil),               // 1: pushecr.v1.Overrides
+	(*StageEvent)(nil),              // 2: pushecr.v1.StageEvent
+	(*Run)(nil),                     // 3: pushecr.v1.Run
+	(*SubmitBuildRequest)(nil),      // 4: pushecr.v1.SubmitBuildRequest
+	(*SubmitBuildResponse)(nil),     // 5: pushecr.v1.SubmitBuildResponse
+	(*GetRunRequest)(nil),           // 6: pushecr.v1.GetRunRequest
+	(*GetRunResponse)(nil),          // 7: pushecr.v1.GetRunResponse
+	(*ListRunsRequest)(nil),         // 8: pushecr.v1.ListRunsRequest
+	(*ListRunsResponse)(nil),        // 9: pushecr.v1.ListRunsResponse
+	(*StreamRunEventsRequest)(nil),  // 10: pushecr.v1.StreamRunEventsRequest
+	(*StreamRunEventsResponse)(nil), // 11: pushecr.v1.StreamRunEventsResponse
+	(*timestamppb.Timestamp)(nil),   // 12: google.protobuf.Timestamp
+}
+var file_pushecr_v1_pushecr_proto_depIdxs = []int32{
+	0,  // 0: pushecr.v1.StageEvent.status:type_name -> pushecr.v1.RunStatus
+	12, // 1: pushecr.v1.StageEvent.time:type_name -> google.protobuf.Timestamp
+	0,  // 2: pushecr.v1.Run.status:type_name -> pushecr.v1.RunStatus
+	12, // 3: pushecr.v1.Run.started_at:type_name -> google.protobuf.Timestamp
+	12, // 4: pushecr.v1.Run.finished_at:type_name -> google.protobuf.Timestamp
+	1,  // 5: pushecr.v1.Run.overrides:type_name -> pushecr.v1.Overrides
+	2,  // 6: pushecr.v1.Run.stages:type_name -> pushecr.v1.StageEvent
+	1,  // 7: pushecr.v1.SubmitBuildRequest.overrides:type_name -> pushecr.v1.Overrides
+	3,  // 8: pushecr.v1.SubmitBuildResponse.run:type_name -> pushecr.v1.Run
+	3,  // 9: pushecr.v1.GetRunResponse.run:type_name -> pushecr.v1.Run
+	3,  // 10: pushecr.v1.ListRunsResponse.runs:type_name -> pushecr.v1.Run
+	2,  // 11: pushecr.v1.StreamRunEventsResponse.stage:type_name -> pushecr.v1.StageEvent
+	3,  // 12: pushecr.v1.StreamRunEventsResponse.result:type_name -> pushecr.v1.Run
+	4,  // 13: pushecr.v1.PushECRService.SubmitBuild:input_type -> pushecr.v1.SubmitBuildRequest
+	6,  // 14: pushecr.v1.PushECRService.GetRun:input_type -> pushecr.v1.GetRunRequest
+	8,  // 15: pushecr.v1.PushECRService.ListRuns:input_type -> pushecr.v1.ListRunsRequest
+	10, // 16: pushecr.v1.PushECRService.StreamRunEvents:input_type -> pushecr.v1.StreamRunEventsRequest
+	5,  // 17: pushecr.v1.PushECRService.SubmitBuild:output_type -> pushecr.v1.SubmitBuildResponse
+	7,  // 18: pushecr.v1.PushECRService.GetRun:output_type -> pushecr.v1.GetRunResponse
+	9,  // 19: pushecr.v1.PushECRService.ListRuns:output_type -> pushecr.v1.ListRunsResponse
+	11, // 20: pushecr.v1.PushECRService.StreamRunEvents:output_type -> pushecr.v1.StreamRunEventsResponse
+	17, // [17:21] is the sub-list for method output_type
+	13, // [13:17] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_pushecr_v1_pushecr_proto_init() }
+func file_pushecr_v1_pushecr_proto_init() {
+	if File_pushecr_v1_pushecr_proto != nil {
+		return
+	}
+	file_pushecr_v1_pushecr_proto_msgTypes[10].OneofWrappers = []any{
+		(*StreamRunEventsResponse_Stage)(nil),
+		(*StreamRunEventsResponse_Log)(nil),
+		(*StreamRunEventsResponse_Result)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pushecr_v1_pushecr_proto_rawDesc), len(file_pushecr_v1_pushecr_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pushecr_v1_pushecr_proto_goTypes,
+		DependencyIndexes: file_pushecr_v1_pushecr_proto_depIdxs,
+		EnumInfos:         file_pushecr_v1_pushecr_proto_enumTypes,
+		MessageInfos:      file_pushecr_v1_pushecr_proto_msgTypes,
+	}.Build()
+	File_pushecr_v1_pushecr_proto = out.File
+	file_pushecr_v1_pushecr_proto_goTypes = nil
+	file_pushecr_v1_pushecr_proto_depIdxs = nil
+}
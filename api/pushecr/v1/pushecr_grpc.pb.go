@@ -0,0 +1,257 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: pushecr/v1/pushecr.proto
+
+package pushecrv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PushECRService_SubmitBuild_FullMethodName     = "/pushecr.v1.PushECRService/SubmitBuild"
+	PushECRService_GetRun_FullMethodName          = "/pushecr.v1.PushECRService/GetRun"
+	PushECRService_ListRuns_FullMethodName        = "/pushecr.v1.PushECRService/ListRuns"
+	PushECRService_StreamRunEvents_FullMethodName = "/pushecr.v1.PushECRService/StreamRunEvents"
+)
+
+// PushECRServiceClient is the client API for PushECRService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PushECRService exposes the serve daemon to orchestration systems. It
+// mirrors the HTTP API: submit a build of a profile, follow its stage events
+// and logs, and fetch the result.
+type PushECRServiceClient interface {
+	// SubmitBuild queues a run of a profile and returns immediately.
+	SubmitBuild(ctx context.Context, in *SubmitBuildRequest, opts ...grpc.CallOption) (*SubmitBuildResponse, error)
+	// GetRun returns the current state of a run.
+	GetRun(ctx context.Context, in *GetRunRequest, opts ...grpc.CallOption) (*GetRunResponse, error)
+	// ListRuns returns the runs kept in history, most recent first.
+	ListRuns(ctx context.Context, in *ListRunsRequest, opts ...grpc.CallOption) (*ListRunsResponse, error)
+	// StreamRunEvents streams stage events and log output of a run and ends
+	// with the final run once it has finished.
+	StreamRunEvents(ctx context.Context, in *StreamRunEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamRunEventsResponse], error)
+}
+
+type pushECRServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPushECRServiceClient(cc grpc.ClientConnInterface) PushECRServiceClient {
+	return &pushECRServiceClient{cc}
+}
+
+func (c *pushECRServiceClient) SubmitBuild(ctx context.Context, in *SubmitBuildRequest, opts ...grpc.CallOption) (*SubmitBuildResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitBuildResponse)
+	err := c.cc.Invoke(ctx, PushECRService_SubmitBuild_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pushECRServiceClient) GetRun(ctx context.Context, in *GetRunRequest, opts ...grpc.CallOption) (*GetRunResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetRunResponse)
+	err := c.cc.Invoke(ctx, PushECRService_GetRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pushECRServiceClient) ListRuns(ctx context.Context, in *ListRunsRequest, opts ...grpc.CallOption) (*ListRunsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRunsResponse)
+	err := c.cc.Invoke(ctx, PushECRService_ListRuns_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pushECRServiceClient) StreamRunEvents(ctx context.Context, in *StreamRunEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamRunEventsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PushECRService_ServiceDesc.Streams[0], PushECRService_StreamRunEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRunEventsRequest, StreamRunEventsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PushECRService_StreamRunEventsClient = grpc.ServerStreamingClient[StreamRunEventsResponse]
+
+// PushECRServiceServer is the server API for PushECRService service.
+// All implementations must embed UnimplementedPushECRServiceServer
+// for forward compatibility.
+//
+// PushECRService exposes the serve daemon to orchestration systems. It
+// mirrors the HTTP API: submit a build of a profile, follow its stage events
+// and logs, and fetch the result.
+type PushECRServiceServer interface {
+	// SubmitBuild queues a run of a profile and returns immediately.
+	SubmitBuild(context.Context, *SubmitBuildRequest) (*SubmitBuildResponse, error)
+	// GetRun returns the current state of a run.
+	GetRun(context.Context, *GetRunRequest) (*GetRunResponse, error)
+	// ListRuns returns the runs kept in history, most recent first.
+	ListRuns(context.Context, *ListRunsRequest) (*ListRunsResponse, error)
+	// StreamRunEvents streams stage events and log output of a run and ends
+	// with the final run once it has finished.
+	StreamRunEvents(*StreamRunEventsRequest, grpc.ServerStreamingServer[StreamRunEventsResponse]) error
+	mustEmbedUnimplementedPushECRServiceServer()
+}
+
+// UnimplementedPushECRServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPushECRServiceServer struct{}
+
+func (UnimplementedPushECRServiceServer) SubmitBuild(context.Context, *SubmitBuildRequest) (*SubmitBuildResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SubmitBuild not implemented")
+}
+func (UnimplementedPushECRServiceServer) GetRun(context.Context, *GetRunRequest) (*GetRunResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRun not implemented")
+}
+func (UnimplementedPushECRServiceServer) ListRuns(context.Context, *ListRunsRequest) (*ListRunsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListRuns not implemented")
+}
+func (UnimplementedPushECRServiceServer) StreamRunEvents(*StreamRunEventsRequest, grpc.ServerStreamingServer[StreamRunEventsResponse]) error {
+	return status.Error(codes.Unimplemented, "method StreamRunEvents not implemented")
+}
+func (UnimplementedPushECRServiceServer) mustEmbedUnimplementedPushECRServiceServer() {}
+func (UnimplementedPushECRServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafePushECRServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PushECRServiceServer will
+// result in compilation errors.
+type UnsafePushECRServiceServer interface {
+	mustEmbedUnimplementedPushECRServiceServer()
+}
+
+func RegisterPushECRServiceServer(s grpc.ServiceRegistrar, srv PushECRServiceServer) {
+	// If the following call panics, it indicates UnimplementedPushECRServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PushECRService_ServiceDesc, srv)
+}
+
+func _PushECRService_SubmitBuild_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitBuildRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PushECRServiceServer).SubmitBuild(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PushECRService_SubmitBuild_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PushECRServiceServer).SubmitBuild(ctx, req.(*SubmitBuildRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PushECRService_GetRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PushECRServiceServer).GetRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PushECRService_GetRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PushECRServiceServer).GetRun(ctx, req.(*GetRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PushECRService_ListRuns_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRunsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PushECRServiceServer).ListRuns(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PushECRService_ListRuns_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PushECRServiceServer).ListRuns(ctx, req.(*ListRunsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PushECRService_StreamRunEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRunEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PushECRServiceServer).StreamRunEvents(m, &grpc.GenericServerStream[StreamRunEventsRequest, StreamRunEventsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PushECRService_StreamRunEventsServer = grpc.ServerStreamingServer[StreamRunEventsResponse]
+
+// PushECRService_ServiceDesc is the grpc.ServiceDesc for PushECRService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PushECRService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pushecr.v1.PushECRService",
+	HandlerType: (*PushECRServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitBuild",
+			Handler:    _PushECRService_SubmitBuild_Handler,
+		},
+		{
+			MethodName: "GetRun",
+			Handler:    _PushECRService_GetRun_Handler,
+		},
+		{
+			MethodName: "ListRuns",
+			Handler:    _PushECRService_ListRuns_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRunEvents",
+			Handler:       _PushECRService_StreamRunEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pushecr/v1/pushecr.proto",
+}
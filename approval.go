@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// ApprovalConfig makes a profile wait for a human before anything is pushed.
+// Interactive CLI runs ask on the terminal; other runs (CI, serve, worker)
+// print a request ID and poll SSM or S3 until someone approves or rejects it.
+type ApprovalConfig struct {
+	Required  bool   `mapstructure:"required"`
+	Method    string `mapstructure:"method"`    // ssm or s3
+	Parameter string `mapstructure:"parameter"` // ssm: parameter set to the request ID
+	Bucket    string `mapstructure:"bucket"`    // s3: bucket where <prefix><id>/approve is written
+	Prefix    string `mapstructure:"prefix"`
+	Timeout   string `mapstructure:"timeout"`  // default 30m
+	Interval  string `mapstructure:"interval"` // default 15s
+}
+
+func (a ApprovalConfig) validate() error {
+	if !a.Required {
+		return nil
+	}
+	switch a.Method {
+	case "ssm":
+		if a.Parameter == "" {
+			return fmt.Errorf("approval.parameter is required with approval.method ssm")
+		}
+	case "s3":
+		if a.Bucket == "" {
+			return fmt.Errorf("approval.bucket is required with approval.method s3")
+		}
+	default:
+		return fmt.Errorf("approval.method '%s' is not supported (ssm, s3)", a.Method)
+	}
+	for name, value := range map[string]string{"approval.timeout": a.Timeout, "approval.interval": a.Interval} {
+		if d, err := time.ParseDuration(orDefault(value, "1s")); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s '%s'", name, value)
+		}
+	}
+	return nil
+}
+
+// approve waits for the push to be approved when approval.required is set.
+func (ecr *ECR) approve() error {
+	approval := ecr.Config.Approval
+	if !approval.Required {
+		return nil
+	}
+	image := ecr.imageURI(ecr.Config.ECR.ImageTag)
+	if ecr.interactive {
+		fmt.Printf(ColorYellow+"Profile %s requires approval to push %s. Approve? [y/N] "+ColorReset, ecr.Profile, image)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return withCode(ErrCodeApprovalDenied, fmt.Errorf("push of %s was not approved", image))
+		}
+		return nil
+	}
+
+	timeout, _ := time.ParseDuration(orDefault(approval.Timeout, "30m"))
+	interval, _ := time.ParseDuration(orDefault(approval.Interval, "15s"))
+	id := newRunID()
+	ecr.stage(ColorYellow, "Waiting for approval to push "+image)
+	switch approval.Method {
+	case "ssm":
+		fmt.Printf("Approve:  aws ssm put-parameter --overwrite --name %s --type String --value %s\n", approval.Parameter, id)
+		fmt.Printf("Reject:   aws ssm put-parameter --overwrite --name %s --type String --value reject:%s\n", approval.Parameter, id)
+	case "s3":
+		fmt.Printf("Approve:  aws s3api put-object --bucket %s --key %s%s/approve\n", approval.Bucket, approval.Prefix, id)
+		fmt.Printf("Reject:   aws s3api put-object --bucket %s --key %s%s/reject\n", approval.Bucket, approval.Prefix, id)
+	}
+	fmt.Printf("Request %s expires in %s\n", id, timeout)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		decision, err := ecr.approvalDecision(id)
+		if err != nil {
+			return errorf(KeyApprovalLookupFailed, id, err)
+		}
+		switch decision {
+		case "approve":
+			fmt.Println(ColorGreen + "Push approved" + ColorReset)
+			return nil
+		case "reject":
+			return withCode(ErrCodeApprovalDenied, fmt.Errorf("push of %s was rejected (request %s)", image, id))
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return withCode(ErrCodeApprovalDenied, fmt.Errorf("push of %s was not approved within %s (request %s)", image, timeout, id))
+		}
+		if err := sleepContext(ecr.context(), interval); err != nil {
+			return err
+		}
+	}
+}
+
+// approvalDecision returns "approve", "reject" or "" while the request is
+// still pending.
+func (ecr *ECR) approvalDecision(id string) (string, error) {
+	approval := ecr.Config.Approval
+	if approval.Method == "ssm" {
+		client, err := ecr.ssmClient()
+		if err != nil {
+			return "", err
+		}
+		var out *ssm.GetParameterOutput
+		err = ecr.callAWS("ssm get-parameter", func(ctx context.Context) (err error) {
+			out, err = client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(approval.Parameter)})
+			return err
+		})
+		if isAWSError(err, "ParameterNotFound") {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if out.Parameter == nil {
+			return "", errorf(KeyApprovalBadResponse)
+		}
+		switch strings.TrimSpace(aws.ToString(out.Parameter.Value)) {
+		case id:
+			return "approve", nil
+		case "reject:" + id:
+			return "reject", nil
+		}
+		return "", nil
+	}
+
+	for _, decision := range []string{"reject", "approve"} {
+		_, err := ecr.awsCLI("s3api", "head-object", "--bucket", approval.Bucket, "--key", approval.Prefix+id+"/"+decision)
+		if isAWSError(err, "(404)") {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return decision, nil
+	}
+	return "", nil
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
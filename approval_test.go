@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSSM starts an SSM endpoint for the test that answers GetParameter with
+// the content of the returned file, and fails with ParameterNotFound until it
+// exists.
+func fakeSSM(t *testing.T) string {
+	t.Helper()
+	value := filepath.Join(t.TempDir(), "value")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if r.Header.Get("X-Amz-Target") != "AmazonSSM.GetParameter" {
+			w.Write([]byte("{}"))
+			return
+		}
+		var input struct{ Name string }
+		json.NewDecoder(r.Body).Decode(&input)
+		data, err := os.ReadFile(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "ParameterNotFound", "message": "Parameter not found."})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Parameter": map[string]string{"Name": input.Name, "Value": string(data)}})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ENDPOINT_URL_SSM", srv.URL)
+	return value
+}
+
+// answerApproval reads the approval request the run prints and sets the
+// parameter to the approver's answer, the printed --value of the Approve or
+// Reject command.
+func answerApproval(t *testing.T, value, command string) {
+	t.Helper()
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			fmt.Fprintln(stdout, line)
+			if fields := strings.Fields(line); strings.HasPrefix(line, command+":") && len(fields) > 0 {
+				os.WriteFile(value, []byte(fields[len(fields)-1]), 0o644)
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		w.Close()
+		<-done
+	})
+}
+
+func TestSSMApproval(t *testing.T) {
+	for _, test := range []struct {
+		command string
+		code    ErrorCode
+	}{
+		{"Approve", ""},
+		{"Reject", ErrCodeApprovalDenied},
+	} {
+		t.Run(test.command, func(t *testing.T) {
+			startECR(t)
+			value := fakeSSM(t)
+			ecr := testRun(t, "auth,approval", func(c *ProfileConfig) {
+				c.Approval = ApprovalConfig{Required: true, Method: "ssm", Parameter: "/pushecr/approval", Interval: "10ms", Timeout: "10s"}
+			})
+			answerApproval(t, value, test.command)
+
+			err := ecr.runPipeline()
+			switch {
+			case test.code == "" && err != nil:
+				t.Fatalf("run failed: %v", err)
+			case test.code != "" && errorCode(err) != test.code:
+				t.Fatalf("run ended with %v, want %s", err, test.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+var roleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/.+$`)
+
+// awsCredentials are temporary credentials of an assumed role.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// AWSConfig selects the credentials of a profile. Profile is a named
+// profile (keys, SSO session or role) from ~/.aws/config; without it the
+// usual chain is used, starting with the environment.
+type AWSConfig struct {
+	Profile string `mapstructure:"profile"`
+}
+
+// awsEnv returns the environment of the aws CLI commands of the profile, or
+// nil to inherit pushecr's. With aws.profile the credential variables are
+// left out, since the CLI prefers them to AWS_PROFILE; with
+// ecr.assume_role_arn they are the temporary credentials of the role.
+func (ecr *ECR) awsEnv() ([]string, error) {
+	creds, err := ecr.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		return append(withoutCredentials(os.Environ()),
+			"AWS_ACCESS_KEY_ID="+creds.AccessKeyID,
+			"AWS_SECRET_ACCESS_KEY="+creds.SecretAccessKey,
+			"AWS_SESSION_TOKEN="+creds.SessionToken,
+		), nil
+	}
+	return ecr.profileEnv(), nil
+}
+
+// profileEnv returns the environment selecting aws.profile, or nil.
+func (ecr *ECR) profileEnv() []string {
+	if ecr.Config.AWS.Profile == "" {
+		return nil
+	}
+	return append(withoutCredentials(os.Environ()), "AWS_PROFILE="+ecr.Config.AWS.Profile)
+}
+
+func withoutCredentials(environ []string) []string {
+	var env []string
+	for _, variable := range environ {
+		name, _, _ := strings.Cut(variable, "=")
+		if !contains(credentialVariables, name) && name != "AWS_PROFILE" {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
+
+// assumeRole assumes roleARN through the STS API with the credentials of
+// aws.profile, or of the usual chain when profile is empty, so it does not
+// need the aws CLI. externalID is optional.
+func assumeRole(ctx context.Context, profile, region, roleARN, sessionName, externalID string) (*awsCredentials, error) {
+	cfg, err := loadAWSConfig(ctx, profile, region)
+	if err != nil {
+		return nil, err
+	}
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if externalID != "" {
+			o.ExternalID = aws.String(externalID)
+		}
+	})
+	if err := awsLimiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	creds, err := provider.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	awsLimiter.succeeded()
+	return &awsCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expires,
+	}, nil
+}
+
+// loadAWSConfig loads the AWS SDK configuration of region from the usual
+// chain, or from the named profile of ~/.aws/config.
+func loadAWSConfig(ctx context.Context, profile, region string) (aws.Config, error) {
+	options := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if profile != "" {
+		options = append(options, config.WithSharedConfigProfile(profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return aws.Config{}, withCode(ErrCodeCredentialsMissing, errorf(KeyAWSConfigFailed, err))
+	}
+	return cfg, nil
+}
+
+// roleCredentials caches the credentials of ecr.assume_role_arn by role,
+// external ID, session name and aws.profile, so the profiles of a multi-profile run that
+// share a role assume it once.
+var roleCredentials = struct {
+	sync.Mutex
+	entries map[string]*awsCredentials
+}{entries: map[string]*awsCredentials{}}
+
+// credentials returns the temporary credentials of the profile's
+// ecr.assume_role_arn, or nil when the profile uses the caller's own.
+// Credentials are reused until five minutes before they expire.
+func (ecr *ECR) credentials() (*awsCredentials, error) {
+	c := ecr.Config.ECR
+	if c.AssumeRoleARN == "" {
+		return nil, nil
+	}
+	session := orDefault(c.RoleSessionName, "pushecr-"+ecr.Profile)
+	key := strings.Join([]string{c.AssumeRoleARN, c.ExternalID, session, ecr.Config.AWS.Profile}, "\x00")
+
+	roleCredentials.Lock()
+	defer roleCredentials.Unlock()
+	if creds, ok := roleCredentials.entries[key]; ok && time.Until(creds.Expiration) > 5*time.Minute {
+		return creds, nil
+	}
+	creds, err := assumeRole(ecr.context(), ecr.Config.AWS.Profile, c.Region, c.AssumeRoleARN, session, c.ExternalID)
+	if err != nil {
+		return nil, classify(ErrCodeAccessDenied, err.Error(), errorf(KeyAssumeRoleFailed, c.AssumeRoleARN, err))
+	}
+	roleCredentials.entries[key] = creds
+	return creds, nil
+}
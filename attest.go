@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// attestationTypePrefix builds the predicate type of custom attestations that
+// have no entry in verify.attestation_types.
+const attestationTypePrefix = "https://lpmg.xyz/pushecr/attestation/"
+
+// attestationType returns the predicate type URI for a custom attestation
+// name such as "tests".
+func (v VerifyConfig) attestationType(name string) string {
+	if t, ok := v.AttestationTypes[name]; ok && t != "" {
+		return t
+	}
+	return attestationTypePrefix + name + "/v1"
+}
+
+func runAttest(args []string) {
+	fs, configPath, profile := commandFlags("attest", "attest [-config deploy.yml] [-profile dev] -name tests -predicate results.json [-key cosign.key] [tag]")
+	name := fs.String("name", "", "Attestation name, later required with verify -require attestation:<name>")
+	predicate := fs.String("predicate", "", "JSON file with the attestation content (test results, coverage, sign-off...)")
+	key := fs.String("key", "", "Cosign private key to sign with (default: keyless signing)")
+	fs.Parse(args)
+
+	if *name == "" || *predicate == "" {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("-name and -predicate are required")))
+	}
+	if strings.ContainsAny(*name, ",: ") {
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("attestation name '%s' cannot contain commas, colons or spaces", *name)))
+	}
+	data, err := os.ReadFile(*predicate)
+	exitOnError("Could not read predicate", err)
+	if !json.Valid(data) {
+		exitOnError("Invalid predicate", withCode(ErrCodeConfigInvalid, fmt.Errorf("%s is not valid JSON", *predicate)))
+	}
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	tag := profileConfig.ECR.ImageTag
+	if fs.NArg() > 0 {
+		tag = fs.Arg(0)
+	}
+
+	exitOnError("Authentication failed", ecr.dockerLogin())
+	digest, err := ecr.resolveRef(tag)
+	exitOnError("Could not resolve tag", err)
+	ref := ecr.repositoryURI() + "@" + digest
+
+	exitOnError("Attestation refused", checkWritable("cosign attest "+ref))
+	exitOnError("Attestation failed", ecr.attest(ref, *name, *predicate, *key))
+	fmt.Println(ColorGreen + "Attestation " + *name + " attached to " + ref + ColorReset)
+}
+
+// attest signs the predicate file with cosign and attaches it to ref as the
+// named attestation. An empty key means keyless signing.
+func (ecr *ECR) attest(ref, name, predicate, key string) error {
+	predicateType := ecr.Config.Verify.attestationType(name)
+	ecr.stage(ColorCyan, "Attaching "+name+" attestation ("+predicateType+") to "+ref)
+	cosignArgs := []string{"attest", "--yes", "--type", predicateType, "--predicate", predicate}
+	if key != "" {
+		cosignArgs = append(cosignArgs, "--key", key)
+	}
+	cmd := exec.CommandContext(ecr.context(), "cosign", append(cosignArgs, ref)...)
+	cmd.Stdout = ecr.output(os.Stdout)
+	cmd.Stderr = ecr.output(os.Stderr)
+	if err := cmd.Run(); err != nil {
+		return errorf(KeyAttestFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// awsError is returned when an aws CLI command fails. Stderr holds the CLI's
+// message, which carries the AWS exception name.
+type awsError struct {
+	Command string
+	Stderr  string
+	Err     error
+}
+
+func (e *awsError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("aws %s: %s", e.Command, e.Stderr)
+	}
+	return fmt.Sprintf("aws %s: %v", e.Command, e.Err)
+}
+
+func (e *awsError) Unwrap() error {
+	return e.Err
+}
+
+// isAWSError reports whether err is an aws CLI failure caused by the given
+// AWS exception (e.g. "ImageNotFoundException").
+func isAWSError(err error, exception string) bool {
+	var awsErr *awsError
+	return errors.As(err, &awsErr) && strings.Contains(awsErr.Stderr, exception)
+}
+
+// awsCLI runs an aws CLI command against the profile's region and returns its
+// JSON output. Stderr is kept in the run log and used to classify errors.
+func (ecr *ECR) awsCLI(args ...string) ([]byte, error) {
+	env, err := ecr.awsEnv()
+	if err != nil {
+		return nil, err
+	}
+	region := ecr.Config.ECR.Region
+	if ecr.Config.ECR.Public && len(args) > 0 && args[0] == "ecr" {
+		// ECR Public has its own API, with the same operation names for
+		// the ones pushecr uses on public repositories.
+		args = append([]string{"ecr-public"}, args[1:]...)
+	}
+	if len(args) > 0 && args[0] == "ecr-public" {
+		region = publicRegion
+	}
+	return runAWSWith(ecr.context(), env, region, &ecr.logs, args...)
+}
+
+// runAWS runs an aws CLI command in region and returns its JSON output,
+// copying stderr to log. Calls are paced by awsLimiter and retried with
+// jittered backoff when AWS throttles them.
+func runAWS(region string, log io.Writer, args ...string) ([]byte, error) {
+	return runAWSWith(context.Background(), nil, region, log, args...)
+}
+
+// runAWSWith is runAWS with env, when not nil, as the environment of the
+// command (see ECR.awsEnv), killing the command when ctx is done.
+func runAWSWith(ctx context.Context, env []string, region string, log io.Writer, args ...string) ([]byte, error) {
+	command := strings.Join(args[:min(2, len(args))], " ")
+	if err := checkAWSWritable(args); err != nil {
+		return nil, err
+	}
+	args = append(args, "--region", region, "--output", "json")
+	for attempt := 1; ; attempt++ {
+		if err := awsLimiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		cmd := exec.CommandContext(ctx, "aws", args...)
+		cmd.Env = env
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = io.MultiWriter(&stderr, log)
+		err := cmd.Run()
+		if err == nil {
+			awsLimiter.succeeded()
+			return stdout.Bytes(), nil
+		}
+
+		message := strings.TrimSpace(stderr.String())
+		err = classify(ErrCodeUnknown, message, &awsError{Command: command, Stderr: message, Err: err})
+		if errorCode(err) != ErrCodeThrottled || attempt > awsMaxRetries {
+			return nil, err
+		}
+		awsLimiter.throttled()
+		wait := backoff(attempt)
+		fmt.Fprintf(log, "aws %s throttled, retrying in %s (%d/%d)\n", command, wait.Round(time.Millisecond), attempt, awsMaxRetries)
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleepContext waits for d, or returns ctx's error if it is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	ecrapi "github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// The ECR, ECR Public, STS and SSM calls of a run go through the SDK with
+// the profile's credentials (see awsConfig), so the pipeline does not need
+// the aws CLI. Clients are created per call: loading the configuration is
+// cheap next to the call, and the credentials of ecr.assume_role_arn are
+// cached on their own.
+
+// ecrClient returns an ECR API client for the profile's region.
+func (ecr *ECR) ecrClient() (*ecrapi.Client, error) {
+	cfg, err := ecr.awsConfig(ecr.context(), ecr.Config.ECR.Region)
+	if err != nil {
+		return nil, err
+	}
+	return ecrapi.NewFromConfig(cfg), nil
+}
+
+// ecrPublicClient returns an ECR Public API client, in us-east-1.
+func (ecr *ECR) ecrPublicClient() (*ecrpublic.Client, error) {
+	cfg, err := ecr.awsConfig(ecr.context(), publicRegion)
+	if err != nil {
+		return nil, err
+	}
+	return ecrpublic.NewFromConfig(cfg), nil
+}
+
+// stsClient returns an STS client for the profile's region.
+func (ecr *ECR) stsClient() (*sts.Client, error) {
+	cfg, err := ecr.awsConfig(ecr.context(), ecr.Config.ECR.Region)
+	if err != nil {
+		return nil, err
+	}
+	return sts.NewFromConfig(cfg), nil
+}
+
+// ssmClient returns an SSM client for the profile's region.
+func (ecr *ECR) ssmClient() (*ssm.Client, error) {
+	cfg, err := ecr.awsConfig(ecr.context(), ecr.Config.ECR.Region)
+	if err != nil {
+		return nil, err
+	}
+	return ssm.NewFromConfig(cfg), nil
+}
+
+// callAWS makes an SDK call in the running stage's context, named like the
+// aws CLI command it replaces (e.g. "ecr put-image"). See callAWSWith.
+func (ecr *ECR) callAWS(operation string, call func(context.Context) error) error {
+	return callAWSWith(ecr.context(), &ecr.logs, operation, call)
+}
+
+// callAWSWith makes an SDK call the way runAWSWith runs the CLI: refused in
+// read-only mode unless it is a read, paced by awsLimiter and retried with
+// jittered backoff when AWS throttles it. A failure is an awsError holding
+// the SDK's message, which names the AWS exception, so isAWSError and
+// classify treat it as they treat the CLI's stderr.
+func callAWSWith(ctx context.Context, log io.Writer, operation string, call func(context.Context) error) error {
+	if err := checkAWSWritable(strings.Fields(operation)); err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		if err := awsLimiter.wait(ctx); err != nil {
+			return err
+		}
+		err := call(ctx)
+		if err == nil {
+			awsLimiter.succeeded()
+			return nil
+		}
+
+		message := err.Error()
+		fmt.Fprintln(log, message)
+		err = classify(ErrCodeUnknown, message, &awsError{Command: operation, Stderr: message, Err: err})
+		if errorCode(err) != ErrCodeThrottled || attempt > awsMaxRetries {
+			return err
+		}
+		awsLimiter.throttled()
+		wait := backoff(attempt)
+		fmt.Fprintf(log, "aws %s throttled, retrying in %s (%d/%d)\n", operation, wait.Round(time.Millisecond), attempt, awsMaxRetries)
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
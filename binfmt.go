@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// binfmtImage registers QEMU emulators in the Docker host's kernel.
+const binfmtImage = "tonistiigi/binfmt"
+
+// checkEmulation makes sure the builder supports every platform in
+// docker.platforms before a cross-platform build. Platforms the builder
+// cannot run natively need QEMU registered through binfmt_misc; without it
+// the build fails deep inside a RUN step with "exec format error".
+func (ecr *ECR) checkEmulation() error {
+	platforms := ecr.Config.Docker.Platforms
+	if len(platforms) == 0 {
+		return nil
+	}
+	missing, err := ecr.unsupportedPlatforms(platforms)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+
+	if ecr.Config.Docker.InstallEmulators {
+		ecr.stage(ColorYellow, "Registering QEMU emulators for "+strings.Join(missing, ", "))
+		cmd := exec.CommandContext(ecr.context(), "docker", "run", "--privileged", "--rm", binfmtImage, "--install", strings.Join(platformArchs(missing), ","))
+		var stderr bytes.Buffer
+		cmd.Stdout = &ecr.logs
+		cmd.Stderr = ecr.output(&stderr)
+		if err := cmd.Run(); err != nil {
+			return classify(ErrCodeEmulationMissing, stderr.String(), errorf(KeyEmulatorInstallFailed, err))
+		}
+		// Builders read the supported platforms when they start.
+		if name := ecr.Config.Docker.Builder.Name; name != "" {
+			if err := ecr.buildx("stop", name); err != nil {
+				return err
+			}
+		}
+		if missing, err = ecr.unsupportedPlatforms(platforms); err != nil || len(missing) == 0 {
+			return err
+		}
+	}
+
+	return withCode(ErrCodeEmulationMissing, fmt.Errorf(
+		"the builder cannot build for %s: no native node and no QEMU emulator registered. Register the emulators with "+
+			"'docker run --privileged --rm %s --install %s', set docker.install_emulators: true, "+
+			"or add a native node for them to docker.builder.nodes",
+		strings.Join(missing, ", "), binfmtImage, strings.Join(platformArchs(missing), ",")))
+}
+
+// unsupportedPlatforms returns the platforms the builder does not list as
+// supported, natively or through emulation.
+func (ecr *ECR) unsupportedPlatforms(platforms []string) ([]string, error) {
+	args := []string{"buildx", "inspect", "--bootstrap"}
+	if name := ecr.Config.Docker.Builder.Name; name != "" {
+		args = append(args, name)
+	}
+	cmd := exec.CommandContext(ecr.context(), "docker", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = ecr.output(&stderr)
+	if err := cmd.Run(); err != nil {
+		return nil, classify(ErrCodeDockerUnavailable, stderr.String(), errorf(KeyBuilderInspectFailed, err))
+	}
+
+	supported := map[string]bool{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		list, ok := strings.CutPrefix(strings.TrimSpace(line), "Platforms:")
+		if !ok {
+			continue
+		}
+		for _, platform := range strings.Split(list, ",") {
+			supported[strings.TrimSuffix(strings.TrimSpace(platform), "*")] = true
+		}
+	}
+	var missing []string
+	for _, platform := range platforms {
+		if !supported[platform] {
+			missing = append(missing, platform)
+		}
+	}
+	return missing, nil
+}
+
+// platformArchs turns linux/arm64 into arm64, the names binfmt expects.
+func platformArchs(platforms []string) []string {
+	archs := make([]string, len(platforms))
+	for i, platform := range platforms {
+		parts := strings.Split(platform, "/")
+		archs[i] = parts[min(1, len(parts)-1)]
+	}
+	return archs
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envReference matches the ${NAME} references expanded in build arguments.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} in text with the environment variable NAME. An
+// unset variable is an error, so a build never starts with an empty value
+// by accident; a variable set to "" is fine.
+func expandEnv(name, text string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(text, func(ref string) string {
+		variable := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(variable)
+		if !ok {
+			missing = append(missing, variable)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", errorf(KeyConfigEnvMissing, name, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// expandBuildArgs returns a copy of args with the environment references in
+// the values expanded. field names the map in error messages.
+func expandBuildArgs(field string, args map[string]string) (map[string]string, error) {
+	if len(args) == 0 {
+		return args, nil
+	}
+	expanded := make(map[string]string, len(args))
+	for key, value := range args {
+		value, err := expandEnv(field+"."+key, value)
+		if err != nil {
+			return nil, err
+		}
+		expanded[key] = value
+	}
+	return expanded, nil
+}
+
+// resolveBuildArgs expands docker.build_args and the build_args of every
+// variant. The variants are copied so the loaded configuration keeps its
+// templates for the next run of a long-lived server.
+func (c *ProfileConfig) resolveBuildArgs() error {
+	args, err := expandBuildArgs("docker.build_args", c.Docker.BuildArgs)
+	if err != nil {
+		return err
+	}
+	c.Docker.BuildArgs = args
+	variants := make([]VariantConfig, len(c.Variants))
+	for i, v := range c.Variants {
+		if v.BuildArgs, err = expandBuildArgs("variants."+v.Name+".build_args", v.BuildArgs); err != nil {
+			return err
+		}
+		variants[i] = v
+	}
+	c.Variants = variants
+	return nil
+}
+
+// masked returns a copy of the profile to print, with the values of its
+// build args masked as in a diagnostics bundle: once expanded they routinely
+// hold registry and package tokens.
+func (c *ProfileConfig) masked() *ProfileConfig {
+	masked := *c
+	masked.Docker.BuildArgs = maskBuildArgs(c.Docker.BuildArgs)
+	masked.Variants = make([]VariantConfig, len(c.Variants))
+	for i, v := range c.Variants {
+		v.BuildArgs = maskBuildArgs(v.BuildArgs)
+		masked.Variants[i] = v
+	}
+	return &masked
+}
+
+func maskBuildArgs(args map[string]string) map[string]string {
+	if len(args) == 0 {
+		return args
+	}
+	return maskSecret("build_args", args).(map[string]string)
+}
+
+// maskBuildArgOptions returns a copy of a docker build command line with the
+// values of its --build-arg options masked.
+func maskBuildArgOptions(args []string) []string {
+	masked := append([]string(nil), args...)
+	for i := 1; i < len(masked); i++ {
+		if masked[i-1] != "--build-arg" {
+			continue
+		}
+		if name, value, ok := strings.Cut(masked[i], "="); ok && value != "" {
+			masked[i] = name + "=" + maskValue(value)
+		}
+	}
+	return masked
+}
+
+// buildArgs returns the --build-arg options of the image being built:
+// docker.build_args, overridden by those of the variant. Configuration keys
+// are case-insensitive, so each name takes the case of the ARG the
+// Dockerfile declares, or is upper-cased when it declares none.
+func (ecr *ECR) buildArgs() []string {
+	values := ecr.buildArgValues()
+	if len(values) == 0 {
+		return nil
+	}
+
+	names := map[string]string{}
+	if !ecr.remoteContext() && !ecr.Config.Build.Prebuilt.enabled() {
+		if d, err := readDockerfile(ecr.dockerfilePath()); err == nil {
+			for _, arg := range d.args() {
+				names[strings.ToLower(arg.Name)] = arg.Name
+			}
+		}
+	}
+	var args []string
+	for _, key := range sortedKeys(values) {
+		args = append(args, "--build-arg", orDefault(names[key], strings.ToUpper(key))+"="+values[key])
+	}
+	return args
+}
+
+// buildArgValues returns the build arguments of the image being built by
+// lower-case name.
+func (ecr *ECR) buildArgValues() map[string]string {
+	values := map[string]string{}
+	for key, value := range ecr.Config.Docker.BuildArgs {
+		values[strings.ToLower(key)] = value
+	}
+	if ecr.variant != nil {
+		for key, value := range ecr.variant.BuildArgs {
+			values[strings.ToLower(key)] = value
+		}
+	}
+	return values
+}
+
+// automaticArgs are set by BuildKit on every build.
+var automaticArgs = []string{
+	"TARGETPLATFORM", "TARGETOS", "TARGETARCH", "TARGETVARIANT",
+	"BUILDPLATFORM", "BUILDOS", "BUILDARCH", "BUILDVARIANT",
+}
+
+// dockerfileArg is an ARG instruction of a Dockerfile.
+type dockerfileArg struct {
+	Name       string
+	Default    string
+	HasDefault bool
+	Line       int
+}
+
+var argPattern = regexp.MustCompile(`(?i)^\s*ARG\s+(.+)$`)
+
+// args returns the ARG instructions of the Dockerfile in order; an
+// instruction declaring several arguments yields one entry per argument.
+func (d *dockerfile) args() []dockerfileArg {
+	var args []dockerfileArg
+	for i, line := range d.Lines {
+		m := argPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for _, field := range strings.Fields(m[1]) {
+			name, value, found := strings.Cut(field, "=")
+			args = append(args, dockerfileArg{Name: name, Default: strings.Trim(value, `"'`), HasDefault: found, Line: i})
+		}
+	}
+	return args
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuildArgsAreMaskedWhenPrinted(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "supersecretvalue123")
+	c := &ProfileConfig{}
+	c.Docker.BuildArgs = map[string]string{"npm_token": "${NPM_TOKEN}"}
+	c.Variants = []VariantConfig{{Name: "slim", BuildArgs: map[string]string{"base": "alpine:${NPM_TOKEN}"}}}
+	if err := c.resolveBuildArgs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := fmt.Sprintf("%+v", c.masked()); strings.Contains(out, "supersecret") {
+		t.Errorf("printed profile holds the build arg: %s", out)
+	}
+	if c.Docker.BuildArgs["npm_token"] != "supersecretvalue123" {
+		t.Errorf("masking changed the profile's build args: %v", c.Docker.BuildArgs)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"build", "--build-arg", "NPM_TOKEN=supersecretvalue123", "."}, "build --build-arg NPM_TOKEN=***************e123 ."},
+		{[]string{"build", "--build-arg", "EMPTY=", "-t", "app"}, "build --build-arg EMPTY= -t app"},
+		{[]string{"build", "--label", "a=secret"}, "build --label a=secret"},
+	} {
+		if got := strings.Join(maskBuildArgOptions(test.args), " "); got != test.want {
+			t.Errorf("maskBuildArgOptions(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cacheOptions returns the --cache-from and --cache-to options of
+// docker.cache_from and docker.cache_to, so CI runners without a local layer
+// cache reuse the layers of earlier builds through BuildKit's remote cache.
+func (ecr *ECR) cacheOptions() []string {
+	var args []string
+	for _, from := range ecr.Config.Docker.CacheFrom {
+		args = append(args, "--cache-from", ecr.cacheSpec(from, false))
+	}
+	if to := ecr.Config.Docker.CacheTo; to != "" {
+		args = append(args, "--cache-to", ecr.cacheSpec(to, true))
+	}
+	return args
+}
+
+// cacheSpec expands a cache_from or cache_to entry into a buildx cache spec.
+// inline is type=inline; an entry with = is a spec already; anything else is a
+// registry cache ref, with a ref starting with : being a tag of the profile's
+// repository. Caches are exported in full (mode=max) unless the spec says
+// otherwise, and to ECR as an OCI image manifest, the only cache format ECR
+// accepts.
+func (ecr *ECR) cacheSpec(entry string, export bool) string {
+	if entry == "inline" {
+		return "type=inline"
+	}
+	options := parseCacheSpec(entry)
+	if options == nil {
+		ref := entry
+		if strings.HasPrefix(ref, ":") {
+			ref = ecr.repositoryURI() + ref
+		}
+		options = [][2]string{{"type", "registry"}, {"ref", ref}}
+	}
+	if !export || cacheOption(options, "type") != "registry" {
+		return formatCacheSpec(options)
+	}
+	if cacheOption(options, "mode") == "" {
+		options = append(options, [2]string{"mode", "max"})
+	}
+	if isECRRef(cacheOption(options, "ref")) {
+		for _, option := range []string{"image-manifest", "oci-mediatypes"} {
+			if cacheOption(options, option) == "" {
+				options = append(options, [2]string{option, "true"})
+			}
+		}
+	}
+	return formatCacheSpec(options)
+}
+
+// parseCacheSpec splits a key=value,... spec, or returns nil if entry is not
+// one.
+func parseCacheSpec(entry string) [][2]string {
+	if !strings.Contains(entry, "=") {
+		return nil
+	}
+	var options [][2]string
+	for _, part := range strings.Split(entry, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		options = append(options, [2]string{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+	return options
+}
+
+func cacheOption(options [][2]string, key string) string {
+	for _, option := range options {
+		if option[0] == key {
+			return option[1]
+		}
+	}
+	return ""
+}
+
+func formatCacheSpec(options [][2]string) string {
+	parts := make([]string, len(options))
+	for i, option := range options {
+		parts[i] = option[0] + "=" + option[1]
+	}
+	return strings.Join(parts, ",")
+}
+
+// isECRRef reports whether ref is in a private ECR registry or the registry
+// of PUSHECR_REGISTRY.
+func isECRRef(ref string) bool {
+	host, _, _ := strings.Cut(ref, "/")
+	return strings.Contains(host, ".dkr.ecr.") || registryOverride != "" && host == registryOverride
+}
+
+// validateCache checks docker.cache_to: the docker driver of a plain docker
+// build can only export the inline cache, other types need a buildx builder.
+func (c DockerConfig) validateCache() error {
+	for _, entry := range append(append([]string{}, c.CacheFrom...), c.CacheTo) {
+		if entry == "" || entry == "inline" {
+			continue
+		}
+		if options := parseCacheSpec(entry); options != nil && cacheOption(options, "type") == "" {
+			return fmt.Errorf("docker cache spec '%s' needs a type (e.g. type=registry,ref=...)", entry)
+		}
+	}
+	to := c.CacheTo
+	if to == "" || to == "inline" || c.Builder.Name != "" {
+		return nil
+	}
+	if options := parseCacheSpec(to); options != nil && cacheOption(options, "type") == "inline" {
+		return nil
+	}
+	return fmt.Errorf("docker.cache_to '%s' needs docker.builder: the default docker driver can only export the inline cache", to)
+}
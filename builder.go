@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// BuilderConfig declares the buildx builder the build runs on. pushecr
+// creates and bootstraps it when it does not exist, so multi-arch setups work
+// on fresh machines.
+type BuilderConfig struct {
+	Name       string            `mapstructure:"name"`
+	Driver     string            `mapstructure:"driver"` // docker-container (default), kubernetes, remote
+	Platforms  []string          `mapstructure:"platforms"`
+	DriverOpts map[string]string `mapstructure:"driver_opts"`
+	Nodes      []BuilderNode     `mapstructure:"nodes"`
+}
+
+// BuilderNode is an extra node appended to the builder, typically a native
+// builder for another architecture.
+type BuilderNode struct {
+	Name      string   `mapstructure:"name"`
+	Endpoint  string   `mapstructure:"endpoint"` // docker context, ssh://host or tcp://host:1234
+	Platforms []string `mapstructure:"platforms"`
+}
+
+// ensureBuilder creates the configured builder if it is missing and starts
+// its nodes.
+func (ecr *ECR) ensureBuilder() error {
+	builder := ecr.Config.Docker.Builder
+	if builder.Name == "" {
+		return nil
+	}
+	if err := ecr.buildx("inspect", builder.Name); err == nil {
+		return nil
+	}
+
+	ecr.stage(ColorCyan, "Creating buildx builder "+builder.Name)
+	args := []string{"create", "--name", builder.Name, "--driver", orDefault(builder.Driver, "docker-container")}
+	for _, key := range sortedKeys(builder.DriverOpts) {
+		args = append(args, "--driver-opt", key+"="+builder.DriverOpts[key])
+	}
+	if len(builder.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(builder.Platforms, ","))
+	}
+	if err := ecr.buildx(args...); err != nil {
+		return err
+	}
+	for _, node := range builder.Nodes {
+		args := []string{"create", "--append", "--name", builder.Name}
+		if node.Name != "" {
+			args = append(args, "--node", node.Name)
+		}
+		if len(node.Platforms) > 0 {
+			args = append(args, "--platform", strings.Join(node.Platforms, ","))
+		}
+		if err := ecr.buildx(append(args, node.Endpoint)...); err != nil {
+			return err
+		}
+	}
+	return ecr.buildx("inspect", "--bootstrap", builder.Name)
+}
+
+func (ecr *ECR) buildx(args ...string) error {
+	cmd := exec.CommandContext(ecr.context(), "docker", append([]string{"buildx"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stdout = &ecr.logs
+	cmd.Stderr = ecr.output(&stderr)
+	if err := cmd.Run(); err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return classify(ErrCodeDockerUnavailable, stderr.String(), errorf(KeyBuildxFailed, args[0], errors.New(line)))
+		}
+		return classify(ErrCodeDockerUnavailable, stderr.String(), errorf(KeyBuildxFailed, args[0], err))
+	}
+	return nil
+}
+
+// buildCommand returns the docker arguments that start a build: docker build,
+// or docker buildx build on the configured builder, loading the result into
+// the local image store so it can be tagged and pushed. Multi-platform builds
+// stay in the build cache until the push stage pushes them with buildx.
+func (ecr *ECR) buildCommand() []string {
+	if ecr.multiPlatform() {
+		return append([]string{"buildx", "build"}, ecr.buildOptions()...)
+	}
+	if ecr.Config.Docker.Builder.Name != "" {
+		return append([]string{"buildx", "build", "--load"}, ecr.buildOptions()...)
+	}
+	return append([]string{"build"}, ecr.buildOptions()...)
+}
+
+// multiPlatform reports whether the image is built for several platforms and
+// pushed as a manifest list.
+func (ecr *ECR) multiPlatform() bool {
+	return len(ecr.Config.Docker.Platforms) > 1
+}
+
+// buildOptions returns the options shared by every build of the image:
+// configured or generated Dockerfile, builder, platforms, remote caches, build
+// arguments and the variant's target.
+func (ecr *ECR) buildOptions() []string {
+	var args []string
+	if ecr.pinnedDockerfile != "" {
+		args = append(args, "-f", ecr.pinnedDockerfile)
+	} else if ecr.Config.Build.Prebuilt.enabled() || ecr.Config.Docker.Dockerfile != "" {
+		args = append(args, "-f", ecr.dockerfilePath())
+	}
+	if name := ecr.Config.Docker.Builder.Name; name != "" {
+		args = append(args, "--builder", name)
+	}
+	if platforms := ecr.Config.Docker.Platforms; len(platforms) > 0 {
+		args = append(args, "--platform", strings.Join(platforms, ","))
+	}
+	args = append(args, ecr.cacheOptions()...)
+	args = append(args, sourceLabelArgs()...)
+	args = append(args, ecr.buildArgs()...)
+	return append(args, ecr.variantArgs()...)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// CacheConfig controls pruning of the Docker build cache on long-lived
+// runners. With AutoPrune the cache is pruned after every run.
+type CacheConfig struct {
+	AutoPrune   bool   `mapstructure:"auto_prune"`
+	KeepLast    int    `mapstructure:"keep_last"`    // keep the cache used by the last N runs
+	OlderThan   string `mapstructure:"older_than"`   // prune cache unused for this long, e.g. 72h
+	KeepStorage string `mapstructure:"keep_storage"` // keep at most this much, e.g. 20GB
+}
+
+func runCache(args []string) {
+	if len(args) == 0 || args[0] != "prune" {
+		fmt.Fprintf(os.Stderr, "Uso: %s cache prune [-config deploy.yml] [-keep-last N] [-older-than 72h] [-keep-storage 20GB]\n", os.Args[0])
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	keepLast := fs.Int("keep-last", 0, "Keep the build cache used by the last N runs in the run history (default cache.keep_last)")
+	olderThan := fs.String("older-than", "", "Prune build cache not used for this long, e.g. 72h (default cache.older_than)")
+	keepStorage := fs.String("keep-storage", "", "Keep at most this much build cache, e.g. 20GB (default cache.keep_storage)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s cache prune [-config deploy.yml] [-keep-last N] [-older-than 72h] [-keep-storage 20GB]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	config, err := loadConfig(*configPath)
+	exitOnError("Error loading configuration", err)
+	settings := config.Cache
+	if *keepLast > 0 {
+		settings.KeepLast = *keepLast
+	}
+	settings.OlderThan = orDefault(*olderThan, settings.OlderThan)
+	settings.KeepStorage = orDefault(*keepStorage, settings.KeepStorage)
+	if settings.KeepLast == 0 && settings.OlderThan == "" && settings.KeepStorage == "" {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("cache prune needs -keep-last, -older-than or -keep-storage")))
+	}
+	exitOnError("Prune failed", settings.prune(config.History))
+}
+
+// pruneArgs returns the docker buildx prune filters for the settings. Cache
+// records are pruned by the time they were last used, so keeping the last N
+// runs means keeping everything used since the Nth most recent run started.
+func (c CacheConfig) pruneArgs(history HistoryConfig) ([]string, error) {
+	var keep time.Duration
+	if c.OlderThan != "" {
+		d, err := time.ParseDuration(c.OlderThan)
+		if err != nil || d <= 0 {
+			return nil, withCode(ErrCodeConfigInvalid, fmt.Errorf("invalid cache.older_than '%s'", c.OlderThan))
+		}
+		keep = d
+	}
+	if c.KeepLast > 0 {
+		entries, err := history.list(c.KeepLast)
+		if err != nil {
+			return nil, errorf(KeyHistoryReadFailed, err)
+		}
+		if len(entries) < c.KeepLast {
+			// Fewer runs than requested: keep the whole cache.
+			return nil, nil
+		}
+		keep = max(keep, time.Since(entries[len(entries)-1].StartedAt).Round(time.Minute)+time.Minute)
+	}
+
+	args := []string{"buildx", "prune", "--force", "--all"}
+	if keep > 0 {
+		args = append(args, "--filter", "until="+keep.String())
+	}
+	if c.KeepStorage != "" {
+		args = append(args, "--keep-storage", c.KeepStorage)
+	}
+	return args, nil
+}
+
+// prune removes build cache according to the settings.
+func (c CacheConfig) prune(history HistoryConfig) error {
+	args, err := c.pruneArgs(history)
+	if err != nil {
+		return err
+	}
+	if args == nil {
+		fmt.Printf("Fewer than %d runs recorded, keeping the build cache\n", c.KeepLast)
+		return nil
+	}
+	if err := checkWritable("docker buildx prune"); err != nil {
+		return err
+	}
+	fmt.Println(ColorCyan + "Pruning build cache" + ColorReset)
+	cmd := exec.Command("docker", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return classify(ErrCodeDockerUnavailable, stderr.String(), errorf(KeyBuildCachePruneFailed, err))
+	}
+	if line := lastLine(stdout.String()); line != "" {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// autoPrune prunes the build cache after a run when cache.auto_prune is set.
+// Failures only warn: the run itself already finished.
+func (c *Config) autoPrune() {
+	if !c.Cache.AutoPrune {
+		return
+	}
+	if err := c.Cache.prune(c.History); err != nil {
+		fmt.Println(ColorYellow + "Could not prune build cache: " + err.Error() + ColorReset)
+	}
+}
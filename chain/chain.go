@@ -0,0 +1,50 @@
+// Package chain runs named stages through middleware, like http.Handler
+// middleware: a Middleware returns a Stage whose Run does its work around the
+// wrapped stage's Run. pushecr's pipeline is built on it, and programs that
+// embed a pipeline add their own logging, metrics or checks with Use instead
+// of changing how stages are run:
+//
+//	var c chain.Chain[*Run]
+//	c.Use(logStages, countFailures)
+//	err := c.Wrap(chain.Stage[*Run]{Name: "push", Run: push}).Run(ctx, run)
+//
+// A stage gets a context that middleware can cancel, for example at a
+// timeout, and must stop the commands and calls it started when it is.
+package chain
+
+import "context"
+
+// Stage is one named step of a pipeline run on a T, the state of the run.
+type Stage[T any] struct {
+	Name    string
+	Failure string // message shown when Run fails, e.g. "Push failed"
+	Run     func(ctx context.Context, t T) error
+}
+
+// Middleware wraps a stage with behaviour shared by every stage.
+type Middleware[T any] func(Stage[T]) Stage[T]
+
+// Func returns s with Run replaced by run, which receives the original Run as
+// next. It is the usual way to write a Middleware.
+func Func[T any](s Stage[T], run func(ctx context.Context, t T, next func(context.Context, T) error) error) Stage[T] {
+	next := s.Run
+	s.Run = func(ctx context.Context, t T) error { return run(ctx, t, next) }
+	return s
+}
+
+// Chain is a list of middleware, outermost first.
+type Chain[T any] []Middleware[T]
+
+// Use adds m to c, inside the middleware added before.
+func (c *Chain[T]) Use(m ...Middleware[T]) {
+	*c = append(*c, m...)
+}
+
+// Wrap applies c to s. The first middleware is the outermost, so it sees the
+// stage start first and end last.
+func (c Chain[T]) Wrap(s Stage[T]) Stage[T] {
+	for i := len(c) - 1; i >= 0; i-- {
+		s = c[i](s)
+	}
+	return s
+}
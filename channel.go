@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ChannelsConfig declares the release channels of a profile. Each channel is
+// an alias tag with the channel's name that moves between digests.
+type ChannelsConfig struct {
+	Names    []string `mapstructure:"names"`
+	Push     string   `mapstructure:"push"`      // channel assigned to every push
+	AuditLog string   `mapstructure:"audit_log"` // default .pushecr/channels.jsonl
+}
+
+func (c ChannelsConfig) auditLog() string {
+	return orDefault(c.AuditLog, statePath("channels.jsonl"))
+}
+
+func (c ChannelsConfig) check(channel string) error {
+	if len(c.Names) == 0 {
+		return withCode(ErrCodeConfigInvalid, fmt.Errorf("the profile declares no channels (channels.names)"))
+	}
+	if !contains(c.Names, channel) {
+		return withCode(ErrCodeConfigInvalid, fmt.Errorf("unknown channel '%s' (expected one of %s)", channel, strings.Join(c.Names, ", ")))
+	}
+	return nil
+}
+
+// channelEntry is one line of the channel audit log.
+type channelEntry struct {
+	Time           time.Time `json:"time"`
+	User           string    `json:"user"`
+	Profile        string    `json:"profile"`
+	Repository     string    `json:"repository"`
+	Channel        string    `json:"channel"`
+	Digest         string    `json:"digest"`
+	PreviousDigest string    `json:"previous_digest,omitempty"`
+	Source         string    `json:"source"` // "push" or the channel promoted from
+}
+
+// moveChannel points the channel tag at digest and records the move.
+func (ecr *ECR) moveChannel(channel, digest, source string) error {
+	previous, err := ecr.imageDigest(channel)
+	if err != nil {
+		return errorf(KeyChannelLookupFailed, channel, err)
+	}
+	if previous == digest {
+		fmt.Printf("Channel '%s' already points to %s\n", channel, shortDigest(digest))
+		return nil
+	}
+	if err := ecr.putImageTag(digest, channel); err != nil {
+		return errorf(KeyChannelMoveFailed, channel, err)
+	}
+	fmt.Printf(ColorGreen+"Channel '%s' → %s"+ColorReset+"\n", channel, shortDigest(digest))
+
+	path := ecr.Config.Channels.auditLog()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	entry := channelEntry{
+		Time:           time.Now().UTC(),
+		User:           orDefault(ecr.actor, currentUser()),
+		Profile:        ecr.Profile,
+		Repository:     ecr.Config.ECR.Repository,
+		Channel:        channel,
+		Digest:         digest,
+		PreviousDigest: previous,
+		Source:         source,
+	}
+	if err := appendJSONLine(path, entry); err != nil {
+		return errorf(KeyChannelLogFailed, err)
+	}
+	return nil
+}
+
+// assignPushChannel moves channels.push to the image just pushed.
+func (ecr *ECR) assignPushChannel() error {
+	channel := ecr.Config.Channels.Push
+	if channel == "" {
+		return nil
+	}
+	digest := ecr.Digest
+	if digest == "" {
+		var err error
+		if digest, err = ecr.imageDigest(ecr.Config.ECR.ImageTag); err != nil {
+			return err
+		}
+	}
+	return ecr.moveChannel(channel, digest, "push")
+}
+
+// promote points channel to at the image channel from points to.
+func (ecr *ECR) promote(from, to string) error {
+	channels := ecr.Config.Channels
+	if err := channels.check(from); err != nil {
+		return err
+	}
+	if err := channels.check(to); err != nil {
+		return err
+	}
+	if err := ecr.authorizeCommand("channel promote", to); err != nil {
+		return err
+	}
+	digest, err := ecr.imageDigest(from)
+	if err != nil {
+		return errorf(KeyChannelLookupFailed, from, err)
+	}
+	if digest == "" {
+		return withCode(ErrCodeImageNotFound, fmt.Errorf("channel '%s' has no image in %s", from, ecr.Config.ECR.Repository))
+	}
+	return ecr.moveChannel(to, digest, from)
+}
+
+func runChannel(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s channel promote [-config deploy.yml] [-profile dev] <from> <to>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "     %s channel list [-config deploy.yml] [-profile dev]\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	action := args[0]
+	var fs *flag.FlagSet
+	var configPath, profile *string
+	switch action {
+	case "promote":
+		fs, configPath, profile = commandFlags("channel promote", "channel promote [-config deploy.yml] [-profile dev] <from> <to>")
+	case "list":
+		fs, configPath, profile = commandFlags("channel list", "channel list [-config deploy.yml] [-profile dev]")
+	default:
+		usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+	if action == "promote" && fs.NArg() != 2 {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("channel promote needs the source and target channels")))
+	}
+
+	config, profileConfig, err := loadConfigProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+	channels := profileConfig.Channels
+
+	switch action {
+	case "promote":
+		exitOnError("Promotion failed", ecr.promote(fs.Arg(0), fs.Arg(1)))
+		if err := recordPromotion(config.Manifest, ecr, fs.Arg(0), fs.Arg(1)); err != nil {
+			fmt.Println(ColorYellow + "Could not update the promotion manifest: " + err.Error() + ColorReset)
+		}
+
+	case "list":
+		if len(channels.Names) == 0 {
+			exitOnError("Invalid configuration", channels.check(""))
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHANNEL\tDIGEST")
+		for _, channel := range channels.Names {
+			digest, err := ecr.imageDigest(channel)
+			exitOnError("Could not resolve channel "+channel, err)
+			fmt.Fprintf(w, "%s\t%s\n", channel, orDefault(digest, "-"))
+		}
+		w.Flush()
+	}
+}
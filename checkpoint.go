@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// checkpoint is the state of one stage, written to
+// .pushecr/checkpoints/<profile>/<stage>.json when checkpoints are enabled so
+// CI pipelines (Jenkins in particular) can retry or resume single stages
+// around pushecr. The file is rewritten when the stage starts and when it
+// ends; run_id tells runs apart.
+type checkpoint struct {
+	RunID      string            `json:"run_id"`
+	Profile    string            `json:"profile"`
+	Stage      string            `json:"stage"`
+	Variant    string            `json:"variant,omitempty"`
+	Status     string            `json:"status"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	ErrorCode  ErrorCode         `json:"error_code,omitempty"`
+	ErrorKey   ErrorKey          `json:"error_key,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Outputs    map[string]string `json:"outputs,omitempty"`
+}
+
+// checkpointPath returns the checkpoint file of a stage.
+func (ecr *ECR) checkpointPath(stage string) string {
+	return statePath("checkpoints", ecr.Profile, strings.ReplaceAll(ecr.stageLabel(stage), ":", "-")+".json")
+}
+
+// writeCheckpoint records the state of stage when checkpoints are enabled.
+// Like the run history, failing to write one never fails the run.
+func (ecr *ECR) writeCheckpoint(stage string, started time.Time, status string, err error) {
+	if !ecr.checkpoints {
+		return
+	}
+	c := checkpoint{
+		RunID:     ecr.runID,
+		Profile:   ecr.Profile,
+		Stage:     stage,
+		Status:    status,
+		StartedAt: started.UTC(),
+	}
+	if ecr.variant != nil {
+		c.Variant = ecr.variant.Name
+	}
+	if status != runRunning {
+		finished := time.Now().UTC()
+		c.FinishedAt = &finished
+	}
+	if err != nil {
+		c.Error = err.Error()
+		c.ErrorCode = errorCode(err)
+		c.ErrorKey = errorKey(err)
+	}
+	if status == runSucceeded {
+		c.Outputs = ecr.stageOutputs(stage)
+	}
+	data, marshalErr := json.MarshalIndent(c, "", "  ")
+	if marshalErr == nil {
+		marshalErr = writeFileAtomic(ecr.checkpointPath(stage), append(data, '\n'))
+	}
+	if marshalErr != nil {
+		fmt.Println(ColorYellow + "Could not write checkpoint: " + marshalErr.Error() + ColorReset)
+	}
+}
+
+// stageOutputs returns what a finished stage produced that later stages, or
+// a pipeline resuming them, need.
+func (ecr *ECR) stageOutputs(stage string) map[string]string {
+	c := ecr.Config
+	switch stage {
+	case "auth":
+		return map[string]string{"registry": ecr.registry()}
+	case "build":
+		return map[string]string{"local_image": c.Docker.ImageName, "dockerfile": ecr.dockerfilePath()}
+	case "tag":
+		return map[string]string{"image": ecr.imageURI(c.ECR.ImageTag)}
+	case "push":
+		outputs := map[string]string{"image": ecr.pushedImageURI()}
+		if ecr.Digest != "" {
+			outputs["digest"] = ecr.Digest
+		}
+		return outputs
+	}
+	return nil
+}
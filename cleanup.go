@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// CleanupConfig removes what a run leaves in the local image store.
+type CleanupConfig struct {
+	// LocalImages removes the registry tags created for the push once it
+	// succeeds. The image stays under docker.image_name for the build cache.
+	LocalImages bool `mapstructure:"local_images"`
+
+	// RemoveImage also removes the docker.image_name tags, which deletes the
+	// image itself unless something else still refers to it.
+	RemoveImage bool `mapstructure:"remove_image"`
+
+	// AutoPruneThreshold, e.g. "90%", prunes before the build when the Docker
+	// data root is fuller than this.
+	AutoPruneThreshold string `mapstructure:"auto_prune_threshold"`
+}
+
+// cleanupRefs returns the local references cleanup removes after a push.
+func (ecr *ECR) cleanupRefs() []string {
+	cleanup := ecr.Config.Cleanup
+	if !cleanup.LocalImages && !cleanup.RemoveImage {
+		return nil
+	}
+	refs := []string{ecr.imageURI(ecr.Config.ECR.ImageTag)}
+	if cleanup.RemoveImage {
+		name := ecr.Config.Docker.ImageName
+		refs = append(refs, name+":"+ecr.Config.ECR.ImageTag, name)
+	}
+	return refs
+}
+
+// cleanupLocalImages removes the local tags of the pushed image according to
+// cleanup. Only pushes of a local image call it: multi-platform and
+// by-digest pushes never load one. Failing to clean up only warns, the push
+// itself succeeded.
+func (ecr *ECR) cleanupLocalImages() {
+	refs := ecr.cleanupRefs()
+	if len(refs) == 0 {
+		return
+	}
+	removed, err := removeImageTags(refs...)
+	if len(removed) > 0 {
+		fmt.Println("Removed local tags: " + strings.Join(removed, ", "))
+	}
+	if err != nil {
+		fmt.Println(ColorYellow + "Could not clean up local images: " + err.Error() + ColorReset)
+	}
+}
+
+// pruneCacheAge is how long build cache must be unused to be pruned when the
+// disk threshold is crossed.
+const pruneCacheAge = "24h"
+
+// parseThreshold parses a disk usage threshold such as "90%" or "90".
+func parseThreshold(text string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "%")), 64)
+	if err != nil || value <= 0 || value > 100 {
+		return 0, fmt.Errorf("cleanup.auto_prune_threshold must be a percentage between 0 and 100, got '%s'", text)
+	}
+	return value / 100, nil
+}
+
+// checkDiskSpace runs before the build. When the Docker data root is fuller
+// than cleanup.auto_prune_threshold it prunes dangling images and build
+// cache unused for pruneCacheAge, and fails with what else to try if that
+// is not enough, instead of letting the build fail halfway with ENOSPC.
+func (ecr *ECR) checkDiskSpace() error {
+	if ecr.Config.Cleanup.AutoPruneThreshold == "" {
+		return nil
+	}
+	threshold, err := parseThreshold(ecr.Config.Cleanup.AutoPruneThreshold)
+	if err != nil {
+		return withCode(ErrCodeConfigInvalid, err)
+	}
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	ctx := ecr.context()
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return classify(ErrCodeDockerUnavailable, "", errorf(KeyDockerQueryFailed, err))
+	}
+	root := info.DockerRootDir
+	usage, supported, err := diskUsage(root)
+	if !supported || err != nil {
+		// A remote daemon's data root is not on this machine.
+		fmt.Println(ColorYellow + "Skipping disk check: cannot measure " + root + ColorReset)
+		return nil
+	}
+	if usage < threshold {
+		return nil
+	}
+
+	ecr.stage(ColorYellow, fmt.Sprintf("Docker data root %s is %.0f%% full, pruning", root, usage*100))
+	if err := checkWritable("docker prune"); err != nil {
+		return err
+	}
+	images, err := cli.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", "true")))
+	if err != nil {
+		return classify(ErrCodeDockerUnavailable, "", errorf(KeyDanglingPruneFailed, err))
+	}
+	cache, err := cli.BuildCachePrune(ctx, types.BuildCachePruneOptions{Filters: filters.NewArgs(filters.Arg("until", pruneCacheAge))})
+	if err != nil {
+		return classify(ErrCodeDockerUnavailable, "", errorf(KeyBuildCachePruneFailed, err))
+	}
+	fmt.Printf("Reclaimed %s from dangling images and %s from build cache\n", formatBytes(int64(images.SpaceReclaimed)), formatBytes(int64(cache.SpaceReclaimed)))
+
+	if usage, _, err = diskUsage(root); err != nil || usage < threshold {
+		return nil
+	}
+	return withCode(ErrCodeDiskFull, fmt.Errorf("%s is still %.0f%% full after pruning (threshold %.0f%%): "+
+		"remove unused images with docker image prune -a, prune more build cache with pushecr cache prune -keep-storage 10GB, "+
+		"or free space on the runner", root, usage*100, threshold*100))
+}
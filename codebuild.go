@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CodeBuildConfig sets up the outputs written for AWS CodeBuild and
+// CodePipeline after a push. They are written when pushecr runs inside
+// CodeBuild (CODEBUILD_BUILD_ID is set), or always with Always.
+type CodeBuildConfig struct {
+	Always           bool   `mapstructure:"always"`
+	ContainerName    string `mapstructure:"container_name"`    // default docker.image_name
+	ImageDefinitions string `mapstructure:"image_definitions"` // default imagedefinitions.json
+	EnvFile          string `mapstructure:"env_file"`          // default .pushecr/outputs.env
+}
+
+var defaultOutputsEnvFile = statePath("outputs.env")
+
+// pushedImageURI returns the reference of the image pushed in this run: by
+// digest when it was pushed without a tag, by image_tag otherwise.
+func (ecr *ECR) pushedImageURI() string {
+	if ecr.Config.ECR.PushByDigest && ecr.Digest != "" {
+		return ecr.repositoryURI() + "@" + ecr.Digest
+	}
+	return ecr.imageURI(ecr.Config.ECR.ImageTag)
+}
+
+// writeDigestFile writes the pushed image, pinned by digest, to path for
+// deploy tooling that must not follow a tag.
+func (ecr *ECR) writeDigestFile(path string) error {
+	ref, err := ecr.pushedDigestURI()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, []byte(ref+"\n")); err != nil {
+		return errorf(KeyFileWriteFailed, path, err)
+	}
+	fmt.Println("Wrote " + path)
+	return nil
+}
+
+// writeCodeBuildOutputs writes imagedefinitions.json, the artifact the ECS
+// deploy action of CodePipeline reads, and a shell file exporting the image
+// details for the buildspec to source and list in exported-variables.
+func (ecr *ECR) writeCodeBuildOutputs() error {
+	c := ecr.Config.CodeBuild
+	if !c.Always && os.Getenv("CODEBUILD_BUILD_ID") == "" {
+		return nil
+	}
+
+	image := ecr.pushedImageURI()
+	definitions, err := json.MarshalIndent([]map[string]string{{
+		"name":     orDefault(c.ContainerName, ecr.Config.Docker.ImageName),
+		"imageUri": image,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := orDefault(c.ImageDefinitions, "imagedefinitions.json")
+	if err := writeFileAtomic(path, append(definitions, '\n')); err != nil {
+		return errorf(KeyFileWriteFailed, path, err)
+	}
+
+	variables := map[string]string{
+		"PUSHECR_IMAGE_URI":      image,
+		"PUSHECR_REPOSITORY_URI": ecr.repositoryURI(),
+		"PUSHECR_IMAGE_TAG":      ecr.Config.ECR.ImageTag,
+		"PUSHECR_IMAGE_DIGEST":   ecr.Digest,
+	}
+	var env strings.Builder
+	for _, name := range sortedKeys(variables) {
+		fmt.Fprintf(&env, "export %s='%s'\n", name, variables[name])
+	}
+	envFile := orDefault(c.EnvFile, defaultOutputsEnvFile)
+	if err := writeFileAtomic(envFile, []byte(env.String())); err != nil {
+		return errorf(KeyFileWriteFailed, envFile, err)
+	}
+	fmt.Printf("Wrote %s and %s\n", path, envFile)
+	return nil
+}
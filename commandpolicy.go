@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// CommandPolicy limits a subcommand to callers whose AWS identity matches
+// one of Principals. The check runs client-side with the caller's STS
+// identity before the command changes anything.
+type CommandPolicy struct {
+	Command    string   `mapstructure:"command"`    // e.g. "channel promote", "lifecycle apply"
+	Channels   []string `mapstructure:"channels"`   // channel promote: only when promoting to these
+	Principals []string `mapstructure:"principals"` // IAM user or role ARNs, * wildcards allowed
+}
+
+// guardedCommands are the subcommands policy.commands can restrict.
+var guardedCommands = []string{"channel promote", "deprecate", "hold remove", "lifecycle apply"}
+
+// commandAuditEntry is one line of the command policy audit log.
+type commandAuditEntry struct {
+	Time      time.Time `json:"time"`
+	Profile   string    `json:"profile"`
+	Command   string    `json:"command"`
+	Channel   string    `json:"channel,omitempty"`
+	Caller    string    `json:"caller"`
+	User      string    `json:"user"`
+	Allowed   bool      `json:"allowed"`
+	Principal string    `json:"principal,omitempty"` // the principal that allowed the call
+}
+
+func (p PolicyConfig) auditLog() string {
+	return orDefault(p.AuditLog, statePath("audit.jsonl"))
+}
+
+// authorizeCommand checks the caller's identity against the policy.commands
+// rules for command (and the target channel, for promotions) and records the
+// decision in the audit log.
+func (ecr *ECR) authorizeCommand(command, channel string) error {
+	var rules []CommandPolicy
+	for _, rule := range ecr.Config.Policy.Commands {
+		if rule.Command == command && (len(rule.Channels) == 0 || contains(rule.Channels, channel)) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	caller, err := ecr.callerARN()
+	if err != nil {
+		return errorf(KeyCallerIdentityFailed, err)
+	}
+	entry := commandAuditEntry{
+		Time:    time.Now().UTC(),
+		Profile: ecr.Profile,
+		Command: command,
+		Channel: channel,
+		Caller:  caller,
+		User:    orDefault(ecr.actor, currentUser()),
+	}
+	// Every matching rule must allow the caller.
+	var denied *CommandPolicy
+	for i, rule := range rules {
+		principal, ok := matchPrincipal(caller, rule.Principals)
+		if !ok {
+			denied = &rules[i]
+			break
+		}
+		entry.Principal = principal
+	}
+	entry.Allowed = denied == nil
+	if !entry.Allowed {
+		entry.Principal = ""
+	}
+
+	path := ecr.Config.Policy.auditLog()
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = appendJSONLine(path, entry)
+	}
+	if err != nil {
+		fmt.Println(ColorYellow + "Could not write the command audit log: " + err.Error() + ColorReset)
+	}
+
+	if denied != nil {
+		target := "profile " + ecr.Profile
+		if channel != "" {
+			target = fmt.Sprintf("channel %s of profile %s", channel, ecr.Profile)
+		}
+		return withCode(ErrCodePolicyViolation, fmt.Errorf("%s is not allowed to run '%s' on %s (allowed: %s)", caller, command, target, strings.Join(denied.Principals, ", ")))
+	}
+	return nil
+}
+
+// callerARN returns the ARN of the AWS identity running pushecr.
+func (ecr *ECR) callerARN() (string, error) {
+	client, err := ecr.stsClient()
+	if err != nil {
+		return "", err
+	}
+	var out *sts.GetCallerIdentityOutput
+	if err := ecr.callAWS("sts get-caller-identity", func(ctx context.Context) (err error) {
+		out, err = client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	}); err != nil {
+		return "", err
+	}
+	if aws.ToString(out.Arn) == "" {
+		return "", errorf(KeyCallerBadResponse)
+	}
+	return aws.ToString(out.Arn), nil
+}
+
+var assumedRoleARN = regexp.MustCompile(`^arn:([^:]+):sts::(\d+):assumed-role/([^/]+)/`)
+
+// matchPrincipal returns the first principal pattern matching caller. An
+// assumed-role session also matches the ARN of its role.
+func matchPrincipal(caller string, principals []string) (string, bool) {
+	candidates := []string{caller}
+	if m := assumedRoleARN.FindStringSubmatch(caller); m != nil {
+		candidates = append(candidates, fmt.Sprintf("arn:%s:iam::%s:role/%s", m[1], m[2], m[3]))
+	}
+	for _, principal := range principals {
+		for _, candidate := range candidates {
+			if matchesAny(candidate, []string{principal}) {
+				return principal, true
+			}
+		}
+	}
+	return "", false
+}
+
+// validateCommandPolicies checks policy.commands.
+func validateCommandPolicies(rules []CommandPolicy) error {
+	for _, rule := range rules {
+		if !contains(guardedCommands, rule.Command) {
+			return fmt.Errorf("policy.commands: command '%s' cannot be restricted (expected one of %s)", rule.Command, strings.Join(guardedCommands, ", "))
+		}
+		if len(rule.Principals) == 0 {
+			return fmt.Errorf("policy.commands: '%s' needs at least one principal", rule.Command)
+		}
+		if len(rule.Channels) > 0 && rule.Command != "channel promote" {
+			return fmt.Errorf("policy.commands: channels only apply to 'channel promote'")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// commands maps subcommand names to their entry points. Running pushecr
+// without a subcommand executes the full build and push pipeline.
+var commands = map[string]func(args []string){
+	"attest":           runAttest,
+	"build":            runBuild,
+	"cache":            runCache,
+	"channel":          runChannel,
+	"compare":          runCompare,
+	"deploy":           runDeploy,
+	"deprecate":        runDeprecate,
+	"e2e":              runE2E,
+	"explain":          runExplain,
+	"gen-dockerignore": runGenDockerignore,
+	"hold":             runHold,
+	"layers":           runLayers,
+	"lifecycle":        runLifecycle,
+	"lint":             runLint,
+	"login":            runLogin,
+	"migrate-repo":     runMigrateRepo,
+	"pin-bases":        runPinBases,
+	"pull":             runPull,
+	"push":             runPush,
+	"run":              runRun,
+	"runs":             runRuns,
+	"serve":            runServe,
+	"status":           runStatus,
+	"sync":             runSync,
+	"validate":         runValidate,
+	"verify":           runVerify,
+	"worker":           runWorker,
+}
+
+// pipelineCommands are the subcommands that run part of the pipeline, with
+// their stages. deploy runs every stage, like pushecr without a subcommand.
+var pipelineCommands = map[string][]string{
+	"login":  {"auth"},
+	"build":  {"policy", "build"},
+	"push":   {"tag", "approval", "guard", "mount", "push", "scan", "sign"},
+	"deploy": nil,
+}
+
+func runLogin(args []string)  { runPipelineCommand("login", args, nil) }
+func runBuild(args []string)  { runPipelineCommand("build", args, nil) }
+func runPush(args []string)   { runPipelineCommand("push", args, nil) }
+func runDeploy(args []string) { runPipelineCommand("deploy", args, nil) }
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandFlags returns a flag set for a subcommand with the -config and
+// -profile flags every subcommand shares.
+func commandFlags(name, usage string) (fs *flag.FlagSet, configPath, profile *string) {
+	fs = flag.NewFlagSet(name, flag.ExitOnError)
+	configPath = fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	profile = fs.String("profile", "dev", "Configuration profile to use (e.g., dev, prod)")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s %s\n", os.Args[0], usage)
+		fs.PrintDefaults()
+	}
+	return fs, configPath, profile
+}
+
+// loadProfile loads the configuration file and returns the validated profile.
+func loadProfile(configPath, profile string) (*ProfileConfig, error) {
+	_, profileConfig, err := loadConfigProfile(configPath, profile)
+	return profileConfig, err
+}
+
+// loadConfigProfile is loadProfile for commands that also need the
+// top-level settings.
+func loadConfigProfile(configPath, profile string) (*Config, *ProfileConfig, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	profileConfig, err := config.profile(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateConfig(profileConfig); err != nil {
+		return nil, nil, withCode(ErrCodeConfigInvalid, err)
+	}
+	if err := config.Tools.check(); err != nil {
+		return nil, nil, err
+	}
+	if err := config.assumeWorkspaceRole(); err != nil {
+		return nil, nil, err
+	}
+	return config, profileConfig, nil
+}
+
+// exitOnError prints err with its error code and exits when err is not nil.
+func exitOnError(message string, err error) {
+	if err == nil {
+		return
+	}
+	fmt.Println(ColorRed + message + ": " + err.Error() + ColorReset)
+	fmt.Println("error-code: " + string(errorCode(err)))
+	fmt.Println("error-key: " + string(errorKey(err)))
+	os.Exit(1)
+}
+
+// printDefaults prints the flags of fs like fs.PrintDefaults, leaving out the
+// hidden ones, such as -fault-inject, which is only meant for testing pushecr.
+func printDefaults(fs *flag.FlagSet, hidden ...string) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !contains(hidden, f.Name) {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+func runCompare(args []string) {
+	fs, configPath, profile := commandFlags("compare", "compare [-config deploy.yml] [-profile dev] [-platform linux/amd64] [-sbom] <tagA> <tagB>")
+	platform := fs.String("platform", "linux/amd64", "Platform to compare when the tags are multi-arch manifest lists")
+	withSBOM := fs.Bool("sbom", false, "Also diff packages from the SBOM attestations of both images (requires cosign)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("compare needs exactly two tags")))
+	}
+	tagA, tagB := fs.Arg(0), fs.Arg(1)
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	a, digestA, err := ecr.resolveManifest(tagA, *platform)
+	exitOnError("Could not read "+tagA, err)
+	b, digestB, err := ecr.resolveManifest(tagB, *platform)
+	exitOnError("Could not read "+tagB, err)
+
+	repo := profileConfig.ECR.Repository
+	fmt.Printf(ColorCyan+"Comparing %s:%s (%s) → %s:%s (%s)"+ColorReset+"\n", repo, tagA, shortDigest(digestA), repo, tagB, shortDigest(digestB))
+	if digestA == digestB {
+		fmt.Println(ColorGreen + "Both tags point to the same image" + ColorReset)
+		return
+	}
+
+	compareLayers(a, b)
+
+	configA, err := ecr.fetchConfig(a)
+	exitOnError("Could not read image config of "+tagA, err)
+	configB, err := ecr.fetchConfig(b)
+	exitOnError("Could not read image config of "+tagB, err)
+	compareLabels(configA.Config.Labels, configB.Config.Labels)
+
+	if *withSBOM {
+		sbomType := orDefault(profileConfig.Verify.SBOMType, "spdxjson")
+		exitOnError("Authentication failed", ecr.dockerLogin())
+		refA := ecr.repositoryURI() + "@" + digestA
+		refB := ecr.repositoryURI() + "@" + digestB
+		packagesA, err := ecr.downloadSBOM(refA, sbomType)
+		exitOnError("Could not read SBOM of "+tagA, err)
+		packagesB, err := ecr.downloadSBOM(refB, sbomType)
+		exitOnError("Could not read SBOM of "+tagB, err)
+		comparePackages(packagesA, packagesB)
+	}
+}
+
+func compareLayers(a, b *manifest) {
+	var sizeA, sizeB int64
+	inA := map[string]bool{}
+	for _, layer := range a.Layers {
+		sizeA += layer.Size
+		inA[layer.Digest] = true
+	}
+	inB := map[string]bool{}
+	for _, layer := range b.Layers {
+		sizeB += layer.Size
+		inB[layer.Digest] = true
+	}
+
+	delta := formatBytes(sizeB - sizeA)
+	if sizeB >= sizeA {
+		delta = "+" + delta
+	}
+	fmt.Printf("\nSize: %s → %s (%s)\n", formatBytes(sizeA), formatBytes(sizeB), delta)
+
+	shared := 0
+	for digest := range inA {
+		if inB[digest] {
+			shared++
+		}
+	}
+	fmt.Printf("Layers: %d shared, %d removed, %d added\n", shared, len(a.Layers)-shared, len(b.Layers)-shared)
+	for _, layer := range a.Layers {
+		if !inB[layer.Digest] {
+			fmt.Printf(ColorRed+"  - %s (%s)"+ColorReset+"\n", shortDigest(layer.Digest), formatBytes(layer.Size))
+		}
+	}
+	for _, layer := range b.Layers {
+		if !inA[layer.Digest] {
+			fmt.Printf(ColorGreen+"  + %s (%s)"+ColorReset+"\n", shortDigest(layer.Digest), formatBytes(layer.Size))
+		}
+	}
+}
+
+func compareLabels(a, b map[string]string) {
+	fmt.Println("\nLabels:")
+	changed := 0
+	for _, key := range sortedKeys(a, b) {
+		valueA, okA := a[key]
+		valueB, okB := b[key]
+		switch {
+		case !okB:
+			fmt.Printf(ColorRed+"  - %s: %s"+ColorReset+"\n", key, valueA)
+		case !okA:
+			fmt.Printf(ColorGreen+"  + %s: %s"+ColorReset+"\n", key, valueB)
+		case valueA != valueB:
+			fmt.Printf(ColorYellow+"  ~ %s: %s → %s"+ColorReset+"\n", key, valueA, valueB)
+		default:
+			continue
+		}
+		changed++
+	}
+	if changed == 0 {
+		fmt.Println("  (no changes)")
+	}
+}
+
+func comparePackages(a, b []sbomPackage) {
+	versionsA := map[string]string{}
+	for _, p := range a {
+		versionsA[p.Name] = p.Version
+	}
+	versionsB := map[string]string{}
+	for _, p := range b {
+		versionsB[p.Name] = p.Version
+	}
+
+	var added, removed, updated int
+	fmt.Println("\nPackages (SBOM):")
+	for _, name := range sortedKeys(versionsA, versionsB) {
+		versionA, okA := versionsA[name]
+		versionB, okB := versionsB[name]
+		switch {
+		case !okB:
+			removed++
+			fmt.Printf(ColorRed+"  - %s %s"+ColorReset+"\n", name, versionA)
+		case !okA:
+			added++
+			fmt.Printf(ColorGreen+"  + %s %s"+ColorReset+"\n", name, versionB)
+		case versionA != versionB:
+			updated++
+			fmt.Printf(ColorYellow+"  ~ %s %s → %s"+ColorReset+"\n", name, versionA, versionB)
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d updated\n", added, removed, updated)
+}
+
+func sortedKeys(maps ...map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shortDigest abbreviates sha256:<64 hex> to its first 12 hex characters.
+func shortDigest(digest string) string {
+	const prefix = len("sha256:")
+	if len(digest) > prefix+12 {
+		return digest[:prefix+12]
+	}
+	return digest
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configSource keeps the parsed YAML of the configuration file, to point
+// errors at the line and column of the offending value; viper only keeps the
+// decoded values.
+type configSource struct {
+	name string // as given to -config
+	root *yaml.Node
+}
+
+// readConfigSource parses the file at path. A file that does not parse gives
+// a source without positions; viper reports its syntax error.
+func readConfigSource(name, path string) *configSource {
+	s := &configSource{name: name}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s
+	}
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) == nil && len(doc.Content) > 0 {
+		s.root = doc.Content[0]
+	}
+	return s
+}
+
+// lookup returns the node at path, or the deepest node found along it when a
+// key is missing (e.g. a value a profile inherits with extends). Keys are
+// matched ignoring case, as viper lowercases them.
+func (s *configSource) lookup(path []string) *yaml.Node {
+	n := s.root
+	for _, key := range path {
+		next := child(n, key)
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n
+}
+
+func child(n *yaml.Node, key string) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n == nil {
+		return nil
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if strings.EqualFold(n.Content[i].Value, key) {
+				return n.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(n.Content) {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
+
+func (s *configSource) position(n *yaml.Node) string {
+	if n == nil || n.Line == 0 {
+		return s.name
+	}
+	return fmt.Sprintf("%s:%d:%d", s.name, n.Line, n.Column)
+}
+
+// describe names the YAML type of n, with its value when it is a scalar.
+func describe(n *yaml.Node) string {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n == nil {
+		return "nothing"
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	switch n.Tag {
+	case "!!int", "!!float":
+		return "the number " + n.Value
+	case "!!bool":
+		return "the boolean " + n.Value
+	case "!!null":
+		return "null"
+	}
+	return "the string " + strconv.Quote(n.Value)
+}
+
+// accountIDPattern matches a numeric account ID as written in the file.
+var accountIDPattern = regexp.MustCompile(`^\d+$`)
+
+// normalizeAccountIDs makes every account_id written as an unquoted number a
+// 12-digit string: YAML reads 012345678901 as a number, and viper would decode
+// it without the leading zero. Numbers shorter than 12 digits are padded with
+// zeros, with a warning pointing at the value to quote. With strict, set by
+// strict_account_ids, any unquoted account ID is an error instead.
+func (s *configSource) normalizeAccountIDs(strict bool) error {
+	var unquoted []string
+	var walk func(n *yaml.Node, path []string)
+	walk = func(n *yaml.Node, path []string) {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			keyPath := append(append([]string{}, path...), strings.ToLower(key.Value))
+			if !strings.EqualFold(key.Value, "account_id") || value.Kind != yaml.ScalarNode ||
+				value.Tag != "!!int" && value.Tag != "!!float" || !accountIDPattern.MatchString(value.Value) {
+				walk(value, keyPath)
+				continue
+			}
+			field := strings.Join(keyPath, ".")
+			if strict {
+				unquoted = append(unquoted, fmt.Sprintf("%s: %s %s must be quoted (strict_account_ids)", s.position(value), field, value.Value))
+				continue
+			}
+			if strings.Count(field, ".") != len(keyPath)-1 {
+				continue // a key with a dot cannot be set through viper
+			}
+			id := value.Value
+			if len(id) < 12 {
+				id = strings.Repeat("0", 12-len(id)) + id
+			}
+			viper.Set(field, id)
+			if id != value.Value || strings.HasPrefix(id, "0") {
+				fmt.Fprintf(os.Stderr, ColorYellow+"%s: %s is an unquoted number, read as \"%s\"; quote it to be sure of the leading zeros"+ColorReset+"\n",
+					s.position(value), field, id)
+			}
+		}
+	}
+	walk(s.root, nil)
+	if len(unquoted) > 0 {
+		return fmt.Errorf("account IDs written as numbers can lose their leading zeros:\n  %s", strings.Join(unquoted, "\n  "))
+	}
+	return nil
+}
+
+var (
+	// decodeFieldPattern finds the field in a mapstructure error, e.g.
+	// 'profiles[dev].ecr.image_tags[0]'.
+	decodeFieldPattern = regexp.MustCompile(`'([^']+)'`)
+	// decodeExpectedPattern finds the type the field expected.
+	decodeExpectedPattern = regexp.MustCompile(`expected type '([^']+)'|as (\w+):|expected a (\w+)`)
+)
+
+// decodeError rewrites a decoding error from viper with the position of each
+// offending value, what the field expected and what the file has there:
+//
+//	deploy.yml:9:18: profiles.dev.ecr.tag_guard.enabled expects a boolean, found the string "maybe"
+func (s *configSource) decodeError(err error) error {
+	var decodeErr *mapstructure.Error
+	if s.root == nil || !errors.As(err, &decodeErr) {
+		return err
+	}
+	type located struct {
+		line, column int
+		text         string
+	}
+	var found []located
+	for _, message := range decodeErr.Errors {
+		match := decodeFieldPattern.FindStringSubmatch(message)
+		if match == nil {
+			found = append(found, located{text: message})
+			continue
+		}
+		// profiles[dev].ecr.image_tags[0] is written profiles.dev.ecr.image_tags[0].
+		path := strings.FieldsFunc(match[1], func(r rune) bool { return r == '.' || r == '[' || r == ']' })
+		field := path[0]
+		for _, key := range path[1:] {
+			if _, err := strconv.Atoi(key); err == nil {
+				field += "[" + key + "]"
+			} else {
+				field += "." + key
+			}
+		}
+		n := s.lookup(path)
+		text := fmt.Sprintf("%s: %s: %s", s.position(n), field, message)
+		if m := decodeExpectedPattern.FindStringSubmatch(message); m != nil {
+			text = fmt.Sprintf("%s: %s expects %s, found %s", s.position(n), field, goTypeName(m[1]+m[2]+m[3]), describe(n))
+		}
+		found = append(found, located{n.Line, n.Column, text})
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].line != found[j].line {
+			return found[i].line < found[j].line
+		}
+		return found[i].column < found[j].column
+	})
+	lines := make([]string, len(found))
+	for i, f := range found {
+		lines[i] = f.text
+	}
+	return fmt.Errorf("%d error(s) decoding %s:\n  %s", len(lines), s.name, strings.Join(lines, "\n  "))
+}
+
+// goTypeName names a Go type the way the YAML of the configuration writes it.
+func goTypeName(t string) string {
+	switch {
+	case strings.HasPrefix(t, "[]"):
+		return "a list"
+	case strings.HasPrefix(t, "map["), strings.Contains(t, "."), t == "struct":
+		return "a mapping"
+	case t == "bool":
+		return "a boolean"
+	case strings.HasPrefix(t, "int"), strings.HasPrefix(t, "uint"), strings.HasPrefix(t, "float"):
+		return "a number"
+	case t == "string":
+		return "a string"
+	}
+	return t
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestAccountIDNormalization(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		accountID string // as written in the YAML
+		strict    bool
+		want      string
+		err       string
+	}{
+		{"quoted", `"012345678901"`, false, "012345678901", ""},
+		{"unquoted", "123456789012", false, "123456789012", ""},
+		{"leading zero lost by YAML", "012345678901", false, "012345678901", ""},
+		{"short number padded", "12345678901", false, "012345678901", ""},
+		{"quoted in strict mode", `"012345678901"`, true, "012345678901", ""},
+		{"unquoted in strict mode", "123456789012", true, "", "deploy.yml:5:19: profiles.dev.ecr.account_id 123456789012 must be quoted"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "deploy.yml")
+			yaml := "strict_account_ids: " + map[bool]string{false: "false", true: "true"}[test.strict] + `
+profiles:
+  dev:
+    ecr:
+      account_id: ` + test.accountID + `
+      region: us-east-1
+      repository: api
+    docker:
+      image_name: api
+`
+			if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			wd, _ := os.Getwd()
+			os.Chdir(dir)
+			t.Cleanup(func() { os.Chdir(wd) })
+
+			config, err := loadConfig("deploy.yml")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) || errorCode(err) != ErrCodeConfigInvalid {
+					t.Fatalf("loadConfig() error = %v, want %s containing %q", err, ErrCodeConfigInvalid, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			profile, err := config.profile("dev")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile.ECR.AccountID != test.want {
+				t.Errorf("account_id = %q, want %q", profile.ECR.AccountID, test.want)
+			}
+			if err := validateConfig(profile); err != nil {
+				t.Errorf("validateConfig() = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateAccountID(t *testing.T) {
+	for _, test := range []struct {
+		accountID string
+		ok        bool
+	}{
+		{"012345678901", true},
+		{"12345678901", false},
+		{"1234567890123", false},
+		{"01234567890a", false},
+		{" 012345678901", false},
+	} {
+		profile := &ProfileConfig{}
+		profile.ECR.AccountID, profile.ECR.Region, profile.ECR.Repository = test.accountID, "us-east-1", "api"
+		profile.Docker.ImageName = "api"
+		err := validateConfig(profile)
+		if (err == nil) != test.ok {
+			t.Errorf("validateConfig() with account_id %q = %v, want ok %v", test.accountID, err, test.ok)
+		}
+		if err != nil && errorKey(err) != KeyAccountIDInvalid {
+			t.Errorf("validateConfig() with account_id %q has key %s, want %s", test.accountID, errorKey(err), KeyAccountIDInvalid)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The dashboard is a few server-rendered pages over the same data as the
+// JSON API. It shares the API's authentication; browsers can log in with
+// HTTP Basic auth using any user name and an API token as the password.
+
+var dashboardTemplates = template.Must(template.New("layout").Funcs(template.FuncMap{
+	"shortDigest": shortDigest,
+	"formatBytes": formatBytes,
+	"formatTime": func(t time.Time) string {
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"duration": func(run runRecord) string {
+		end := time.Now()
+		if run.FinishedAt != nil {
+			end = *run.FinishedAt
+		}
+		return end.Sub(run.StartedAt).Round(time.Second).String()
+	},
+}).Parse(`{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pushecr</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+nav a { margin-right: 1em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; }
+code, pre { font-family: monospace; }
+pre { background: #111; color: #eee; padding: 1em; overflow-x: auto; }
+.running { color: #b80; } .succeeded { color: #080; } .failed { color: #c00; }
+</style>
+</head>
+<body>
+<nav><a href="/">Runs</a><a href="/ui/repositories">Repositories</a></nav>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "runs"}}{{template "header"}}
+<h1>Recent runs</h1>
+<table>
+<tr><th>ID</th><th>Started</th><th>Profile</th><th>Job</th><th>Trigger</th><th>Status</th><th>Duration</th></tr>
+{{range .}}<tr>
+<td><a href="/ui/runs/{{.ID}}">{{.ID}}</a></td>
+<td>{{formatTime .StartedAt}}</td>
+<td>{{.Profile}}</td>
+<td>{{.Job}}</td>
+<td>{{.Trigger}}</td>
+<td class="{{.Status}}">{{.Status}}{{with .ErrorCode}} ({{.}}){{end}}</td>
+<td>{{duration .}}</td>
+</tr>
+{{else}}<tr><td colspan="7">No runs yet.</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "run"}}{{template "header"}}
+<h1>Run {{.ID}}</h1>
+<p>Profile <b>{{.Profile}}</b>{{with .Job}}, job <b>{{.}}</b>{{end}}, triggered by {{.Trigger}} at {{formatTime .StartedAt}}.
+Status: <span class="{{.Status}}">{{.Status}}</span>{{with .ErrorCode}} ({{.}}){{end}}</p>
+{{with .Error}}<p class="failed">{{.}}</p>{{end}}
+<table>
+<tr><th>Stage</th><th>Status</th><th>Time</th></tr>
+{{range .Stages}}<tr><td>{{.Stage}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{formatTime .Time}}</td></tr>
+{{end}}</table>
+<pre id="log"></pre>
+<script>
+(async () => {
+  const log = document.getElementById("log");
+  const response = await fetch("/runs/{{.ID}}/logs");
+  const reader = response.body.getReader();
+  const decoder = new TextDecoder();
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) break;
+    log.textContent += decoder.decode(value, { stream: true });
+    window.scrollTo(0, document.body.scrollHeight);
+  }
+  {{if eq .Status "running"}}location.reload();{{end}}
+})();
+</script>
+{{template "footer"}}{{end}}
+
+{{define "repositories"}}{{template "header"}}
+<h1>Repositories</h1>
+{{range .}}<h2>{{.Repository}} <small>({{.Region}}, profiles: {{range $i, $p := .Profiles}}{{if $i}}, {{end}}{{$p}}{{end}})</small></h2>
+{{if .Error}}<p class="failed">{{.Error}}</p>
+{{else}}<table>
+<tr><th>Tags</th><th>Digest</th><th>Size</th><th>Pushed</th></tr>
+{{range .Images}}<tr>
+<td>{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{else}}<i>untagged</i>{{end}}</td>
+<td><code>{{shortDigest .Digest}}</code></td>
+<td>{{formatBytes .Size}}</td>
+<td>{{formatTime .PushedAt}}</td>
+</tr>
+{{else}}<tr><td colspan="4">No images.</td></tr>
+{{end}}</table>
+{{end}}{{end}}
+{{template "footer"}}{{end}}
+`))
+
+// dashboardImages is the number of images listed per repository.
+const dashboardImages = 20
+
+type repositoryListing struct {
+	Repository string
+	Region     string
+	Profiles   []string
+	Images     []imageDetail
+	Error      string
+}
+
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	s.render(w, "runs", s.list())
+}
+
+func (s *server) handleDashboardRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.run(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	s.render(w, "run", run)
+}
+
+// handleDashboardRepositories lists the latest images of every repository
+// referenced by a profile. Profiles sharing a repository are listed once.
+func (s *server) handleDashboardRepositories(w http.ResponseWriter, r *http.Request) {
+	if err := s.config.assumeWorkspaceRole(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	names := make([]string, 0, len(s.config.Profiles))
+	for name := range s.config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listings := map[string]*repositoryListing{}
+	for _, name := range names {
+		profile, err := s.config.profile(name)
+		if err != nil {
+			continue
+		}
+		key := profile.ECR.Region + "/" + profile.ECR.AccountID + "/" + profile.ECR.Repository
+		if listing, ok := listings[key]; ok {
+			listing.Profiles = append(listing.Profiles, name)
+			continue
+		}
+		listing := &repositoryListing{Repository: profile.ECR.Repository, Region: profile.ECR.Region, Profiles: []string{name}}
+		ecr := &ECR{Profile: name, Config: profile}
+		images, err := ecr.listImages()
+		if err != nil {
+			listing.Error = err.Error()
+		}
+		listing.Images = images[:min(len(images), dashboardImages)]
+		listings[key] = listing
+	}
+
+	result := make([]*repositoryListing, 0, len(listings))
+	for _, listing := range listings {
+		result = append(result, listing)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Repository < result[j].Repository })
+	s.render(w, "repositories", result)
+}
+
+func (s *server) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DeployConfig rolls the pushed image out after a successful push, in the
+// deploy stage. Variants are never deployed.
+type DeployConfig struct {
+	ECS    ECSDeployConfig    `mapstructure:"ecs"`
+	Lambda LambdaDeployConfig `mapstructure:"lambda"`
+}
+
+func (c DeployConfig) validate() error {
+	if err := c.ECS.validate(); err != nil {
+		return err
+	}
+	return c.Lambda.validate()
+}
+
+// ECSDeployConfig registers a revision of the service's task definition with
+// the container's image set to the pushed digest, and updates the service.
+type ECSDeployConfig struct {
+	Cluster   string `mapstructure:"cluster"`
+	Service   string `mapstructure:"service"`
+	Container string `mapstructure:"container"` // default docker.image_name
+	Region    string `mapstructure:"region"`    // default ecr.region
+	Wait      bool   `mapstructure:"wait"`      // wait for the deployment to complete
+	Timeout   string `mapstructure:"timeout"`   // default 15m
+	Interval  string `mapstructure:"interval"`  // default 15s
+}
+
+func (c ECSDeployConfig) enabled() bool {
+	return c.Cluster != "" || c.Service != ""
+}
+
+func (c ECSDeployConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	if c.Cluster == "" || c.Service == "" {
+		return fmt.Errorf("deploy.ecs needs both cluster and service")
+	}
+	for name, value := range map[string]string{"deploy.ecs.timeout": c.Timeout, "deploy.ecs.interval": c.Interval} {
+		if d, err := time.ParseDuration(orDefault(value, "1s")); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s '%s'", name, value)
+		}
+	}
+	return nil
+}
+
+// deploy runs the configured deployments of the pushed image.
+func (ecr *ECR) deploy() error {
+	if ecr.Config.Deploy.ECS.enabled() {
+		if err := ecr.deployECS(); err != nil {
+			return err
+		}
+	}
+	if ecr.Config.Deploy.Lambda.enabled() {
+		return ecr.deployLambda()
+	}
+	return nil
+}
+
+// deployCLI runs an aws CLI command in region, ecr.region when empty, with
+// the run's credentials.
+func (ecr *ECR) deployCLI(region string, args ...string) ([]byte, error) {
+	env, err := ecr.awsEnv()
+	if err != nil {
+		return nil, err
+	}
+	return runAWSWith(ecr.context(), env, orDefault(region, ecr.Config.ECR.Region), &ecr.logs, args...)
+}
+
+// ecsCLI runs an ecs command in the deployment's region.
+func (ecr *ECR) ecsCLI(args ...string) ([]byte, error) {
+	return ecr.deployCLI(ecr.Config.Deploy.ECS.Region, append([]string{"ecs"}, args...)...)
+}
+
+// pushedDigestURI returns the image pushed in this run by digest, which
+// deployments pin instead of a tag that may move.
+func (ecr *ECR) pushedDigestURI() (string, error) {
+	digest := ecr.Digest
+	if digest == "" {
+		var err error
+		if digest, err = ecr.imageDigest(ecr.Config.ECR.ImageTag); err != nil {
+			return "", classify(ErrCodeDeployFailed, err.Error(), errorf(KeyPushDigestFailed, err))
+		}
+		if digest == "" {
+			return "", withCode(ErrCodeImageNotFound, fmt.Errorf("%s is not in the repository", ecr.imageURI(ecr.Config.ECR.ImageTag)))
+		}
+	}
+	return ecr.repositoryURI() + "@" + digest, nil
+}
+
+// ecsService is the part of an ECS service deploy reads.
+type ecsService struct {
+	Status         string `json:"status"`
+	TaskDefinition string `json:"taskDefinition"`
+	Deployments    []struct {
+		Status         string `json:"status"`
+		TaskDefinition string `json:"taskDefinition"`
+		RolloutState   string `json:"rolloutState"`
+		RolloutReason  string `json:"rolloutStateReason"`
+		DesiredCount   int    `json:"desiredCount"`
+		RunningCount   int    `json:"runningCount"`
+	} `json:"deployments"`
+}
+
+// taskDefinitionOutputFields are returned by describe-task-definition but
+// rejected by register-task-definition.
+var taskDefinitionOutputFields = []string{
+	"taskDefinitionArn", "revision", "status", "requiresAttributes", "compatibilities",
+	"registeredAt", "registeredBy", "deregisteredAt",
+}
+
+func (ecr *ECR) deployECS() error {
+	c := ecr.Config.Deploy.ECS
+	container := orDefault(c.Container, ecr.Config.Docker.ImageName)
+	image, err := ecr.pushedDigestURI()
+	if err != nil {
+		return err
+	}
+	ecr.stage(ColorCyan, "Deploying "+image+" to ECS service "+c.Service)
+
+	service, err := ecr.describeECSService()
+	if err != nil {
+		return err
+	}
+	_, definition, err := ecr.nextTaskDefinition(service.TaskDefinition, container, image)
+	if err != nil {
+		return err
+	}
+	input, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
+
+	out, err := ecr.ecsCLI("register-task-definition", "--cli-input-json", string(input))
+	if err != nil {
+		return classify(ErrCodeDeployFailed, err.Error(), errorf(KeyTaskDefRegisterFailed, err))
+	}
+	var registered struct {
+		TaskDefinition struct {
+			TaskDefinitionArn string `json:"taskDefinitionArn"`
+		} `json:"taskDefinition"`
+	}
+	if err := json.Unmarshal(out, &registered); err != nil {
+		return errorf(KeyAWSBadResponse, "register-task-definition", err)
+	}
+	arn := registered.TaskDefinition.TaskDefinitionArn
+	fmt.Println("Registered task definition " + arn)
+
+	if _, err := ecr.ecsCLI("update-service", "--cluster", c.Cluster, "--service", c.Service, "--task-definition", arn); err != nil {
+		return classify(ErrCodeDeployFailed, err.Error(), errorf(KeyServiceUpdateFailed, c.Service, err))
+	}
+	fmt.Fprintf(&ecr.logs, "ecs service %s/%s updated to %s\n", c.Cluster, c.Service, arn)
+	if !c.Wait {
+		fmt.Println(ColorGreen + "Service " + c.Service + " updated to " + arn + ColorReset)
+		return nil
+	}
+	return ecr.waitECSDeployment(arn)
+}
+
+// nextTaskDefinition reads the task definition arn and returns it as
+// register-task-definition takes it, before and after setting the image of
+// container to image.
+func (ecr *ECR) nextTaskDefinition(arn, container, image string) (map[string]json.RawMessage, map[string]json.RawMessage, error) {
+	out, err := ecr.ecsCLI("describe-task-definition", "--task-definition", arn, "--include", "TAGS")
+	if err != nil {
+		return nil, nil, classify(ErrCodeDeployFailed, err.Error(), errorf(KeyTaskDefReadFailed, arn, err))
+	}
+	var described struct {
+		TaskDefinition map[string]json.RawMessage `json:"taskDefinition"`
+		Tags           json.RawMessage            `json:"tags"`
+	}
+	if err := json.Unmarshal(out, &described); err != nil {
+		return nil, nil, errorf(KeyAWSBadResponse, "describe-task-definition", err)
+	}
+	current := described.TaskDefinition
+	for _, field := range taskDefinitionOutputFields {
+		delete(current, field)
+	}
+	if len(described.Tags) > 0 && string(described.Tags) != "[]" && string(described.Tags) != "null" {
+		current["tags"] = described.Tags
+	}
+
+	// Only the container's image changes; the rest of the definition, unknown
+	// fields included, is registered as it is.
+	definition := make(map[string]json.RawMessage, len(current))
+	for field, value := range current {
+		definition[field] = value
+	}
+	var containers []map[string]json.RawMessage
+	if err := json.Unmarshal(definition["containerDefinitions"], &containers); err != nil {
+		return nil, nil, errorf(KeyAWSBadResponse, "describe-task-definition", err)
+	}
+	var names []string
+	found := false
+	for _, def := range containers {
+		var name string
+		json.Unmarshal(def["name"], &name)
+		names = append(names, name)
+		if name == container {
+			def["image"], _ = json.Marshal(image)
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil, withCode(ErrCodeConfigInvalid, fmt.Errorf("task definition %s has no container '%s' (containers: %s); set deploy.ecs.container",
+			arn, container, strings.Join(names, ", ")))
+	}
+	if definition["containerDefinitions"], err = json.Marshal(containers); err != nil {
+		return nil, nil, err
+	}
+	return current, definition, nil
+}
+
+func (ecr *ECR) describeECSService() (*ecsService, error) {
+	c := ecr.Config.Deploy.ECS
+	out, err := ecr.ecsCLI("describe-services", "--cluster", c.Cluster, "--services", c.Service)
+	if err != nil {
+		return nil, classify(ErrCodeDeployFailed, err.Error(), errorf(KeyServiceReadFailed, c.Service, err))
+	}
+	var result struct {
+		Services []ecsService `json:"services"`
+		Failures []struct {
+			Reason string `json:"reason"`
+		} `json:"failures"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, errorf(KeyAWSBadResponse, "describe-services", err)
+	}
+	if len(result.Services) == 0 || result.Services[0].Status != "ACTIVE" {
+		reason := "INACTIVE"
+		if len(result.Failures) > 0 {
+			reason = result.Failures[0].Reason
+		}
+		return nil, withCode(ErrCodeDeployFailed, fmt.Errorf("service %s in cluster %s is not available (%s)", c.Service, c.Cluster, reason))
+	}
+	return &result.Services[0], nil
+}
+
+// waitECSDeployment polls the service until the deployment of arn completes,
+// fails, or deploy.ecs.timeout passes. Services without the deployment
+// circuit breaker report no rollout state; they are stable once the primary
+// deployment runs the desired count and is the only one left.
+func (ecr *ECR) waitECSDeployment(arn string) error {
+	c := ecr.Config.Deploy.ECS
+	timeout, _ := time.ParseDuration(orDefault(c.Timeout, "15m"))
+	interval, _ := time.ParseDuration(orDefault(c.Interval, "15s"))
+	fmt.Printf("Waiting up to %s for service %s to be stable\n", timeout, c.Service)
+	deadline := time.Now().Add(timeout)
+	for {
+		service, err := ecr.describeECSService()
+		if err != nil {
+			return err
+		}
+		for _, d := range service.Deployments {
+			if d.Status != "PRIMARY" {
+				continue
+			}
+			if d.TaskDefinition != arn {
+				return withCode(ErrCodeDeployFailed, fmt.Errorf("service %s was updated to %s while waiting", c.Service, d.TaskDefinition))
+			}
+			switch {
+			case d.RolloutState == "FAILED":
+				return withCode(ErrCodeDeployFailed, fmt.Errorf("deployment of %s failed: %s", c.Service, d.RolloutReason))
+			case d.RolloutState == "COMPLETED",
+				d.RolloutState == "" && len(service.Deployments) == 1 && d.RunningCount == d.DesiredCount:
+				fmt.Println(ColorGreen + "Service " + c.Service + " is stable on " + arn + ColorReset)
+				return nil
+			}
+			fmt.Printf("%d/%d tasks running\n", d.RunningCount, d.DesiredCount)
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return withCode(ErrCodeDeployFailed, fmt.Errorf("service %s did not become stable within %s", c.Service, timeout))
+		}
+		if err := sleepContext(ecr.context(), interval); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// deprecationAttestation is the attestation name that marks an image as
+// deprecated.
+const deprecationAttestation = "deprecation"
+
+// deprecationNotice is the predicate of a deprecation attestation.
+type deprecationNotice struct {
+	Reason       string    `json:"reason"`
+	Replacement  string    `json:"replacement,omitempty"`
+	DeprecatedAt time.Time `json:"deprecated_at"`
+	DeprecatedBy string    `json:"deprecated_by"`
+}
+
+func (d *deprecationNotice) warn(image string) {
+	fmt.Printf(ColorYellow+"Warning: %s was deprecated on %s by %s: %s"+ColorReset+"\n", image, d.DeprecatedAt.Local().Format("2006-01-02"), d.DeprecatedBy, d.Reason)
+	if d.Replacement != "" {
+		fmt.Println(ColorYellow + "  use " + d.Replacement + " instead" + ColorReset)
+	}
+}
+
+func runDeprecate(args []string) {
+	fs, configPath, profile := commandFlags("deprecate", "deprecate [-config deploy.yml] [-profile dev] -reason 'CVE-2024-1234' [-replacement v2.1.0] [-key cosign.key] <tag|digest>")
+	reason := fs.String("reason", "", "Why the image should no longer be used")
+	replacement := fs.String("replacement", "", "Tag or digest to use instead")
+	key := fs.String("key", "", "Cosign private key to sign with (default: keyless signing)")
+	fs.Parse(args)
+	if *reason == "" || fs.NArg() != 1 {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("deprecate needs -reason and the tag or digest to deprecate")))
+	}
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	exitOnError("Deprecation refused", ecr.authorizeCommand("deprecate", ""))
+	exitOnError("Authentication failed", ecr.dockerLogin())
+	digest, err := ecr.resolveRef(fs.Arg(0))
+	exitOnError("Could not resolve "+fs.Arg(0), err)
+	ref := ecr.repositoryURI() + "@" + digest
+	exitOnError("Deprecation refused", checkWritable("cosign attest "+ref))
+
+	notice := deprecationNotice{Reason: *reason, Replacement: *replacement, DeprecatedAt: time.Now().UTC(), DeprecatedBy: currentUser()}
+	predicate, err := os.CreateTemp("", "pushecr-deprecation-*.json")
+	exitOnError("Could not write predicate", err)
+	defer os.Remove(predicate.Name())
+	err = json.NewEncoder(predicate).Encode(notice)
+	predicate.Close()
+	exitOnError("Could not write predicate", err)
+
+	exitOnError("Deprecation failed", ecr.attest(ref, deprecationAttestation, predicate.Name(), *key))
+	fmt.Println(ColorGreen + "Marked " + ref + " as deprecated" + ColorReset)
+}
+
+// deprecation returns the newest deprecation notice attached to ref, or nil
+// if there is none. The attestation is read without verifying its signature:
+// it only drives warnings, never decisions.
+func (ecr *ECR) deprecation(ref string) *deprecationNotice {
+	predicateType := ecr.Config.Verify.attestationType(deprecationAttestation)
+	cmd := exec.CommandContext(ecr.context(), "cosign", "download", "attestation", "--predicate-type", predicateType, ref)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &ecr.logs
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+
+	var newest *deprecationNotice
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var envelope struct {
+			Payload string `json:"payload"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &envelope) != nil {
+			continue
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			continue
+		}
+		var statement struct {
+			PredicateType string            `json:"predicateType"`
+			Predicate     deprecationNotice `json:"predicate"`
+		}
+		if json.Unmarshal(payload, &statement) != nil || statement.PredicateType != predicateType {
+			continue
+		}
+		if newest == nil || statement.Predicate.DeprecatedAt.After(newest.DeprecatedAt) {
+			notice := statement.Predicate
+			newest = &notice
+		}
+	}
+	return newest
+}
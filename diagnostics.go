@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+// daemonLogLines is how much of the Docker daemon log is kept in a bundle.
+const daemonLogLines = 200
+
+// diagnosticsEnv lists the environment variables worth reporting. Values of
+// anything that looks like a credential are never collected.
+var diagnosticsEnv = []string{
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+	"AWS_PROFILE",
+	"DOCKER_HOST",
+	"DOCKER_CONTEXT",
+	"DOCKER_BUILDKIT",
+	"CI",
+}
+
+// diagnosticsReport holds everything known about a failed run.
+type diagnosticsReport struct {
+	ConfigPath string
+	Profile    string
+	Config     *ProfileConfig
+	Logs       []byte
+	Err        error
+}
+
+// write packs the report into a gzipped tarball at path.
+func (r diagnosticsReport) write(path string) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"error.txt", []byte(fmt.Sprintf("%s\n%s\n", errorCode(r.Err), r.Err))},
+		{"config.yml", r.sanitizedConfig()},
+		{"environment.txt", r.environment()},
+		{"stages.log", r.Logs},
+		{"versions.txt", toolVersions()},
+		{"daemon.log", daemonLogs()},
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    filepath.Join("pushecr-diagnostics", f.name),
+			Mode:    0o644,
+			Size:    int64(len(f.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errorf(KeyDiagnosticsWriteFailed, err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return errorf(KeyDiagnosticsWriteFailed, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errorf(KeyDiagnosticsWriteFailed, err)
+	}
+	if err := gz.Close(); err != nil {
+		return errorf(KeyDiagnosticsWriteFailed, err)
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0o600)
+}
+
+// sanitizedConfig renders the resolved profile with account IDs and anything
+// resembling a secret masked.
+func (r diagnosticsReport) sanitizedConfig() []byte {
+	if r.Config == nil {
+		return []byte("# configuration could not be loaded\n")
+	}
+	var values map[string]interface{}
+	if err := mapstructure.Decode(r.Config, &values); err != nil {
+		return []byte(fmt.Sprintf("# could not render configuration: %v\n", err))
+	}
+	maskSecrets(values)
+	out, err := yaml.Marshal(map[string]interface{}{r.Profile: values})
+	if err != nil {
+		return []byte(fmt.Sprintf("# could not render configuration: %v\n", err))
+	}
+	return out
+}
+
+func (r diagnosticsReport) environment() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "time: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "os/arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "go: %s\n", runtime.Version())
+	fmt.Fprintf(&b, "args: %s\n", strings.Join(os.Args[1:], " "))
+	fmt.Fprintf(&b, "config: %s\n", r.ConfigPath)
+	fmt.Fprintf(&b, "profile: %s\n", r.Profile)
+	for _, name := range diagnosticsEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(&b, "%s=%s\n", name, value)
+		}
+	}
+	return []byte(b.String())
+}
+
+// maskSecrets walks a decoded config and replaces sensitive values in place.
+func maskSecrets(values map[string]interface{}) {
+	for key, value := range values {
+		values[key] = maskSecret(key, value)
+	}
+}
+
+// maskSecret returns value with its secrets masked. Build args are masked
+// whole, whatever their name, since they routinely carry registry and
+// package tokens. Slices still hold the structs mapstructure left undecoded,
+// such as variants and hooks, and are decoded and walked element by element.
+func maskSecret(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		maskSecrets(v)
+		return v
+	case map[string]string:
+		masked := make(map[string]string, len(v))
+		for name, arg := range v {
+			if arg != "" && (key == "build_args" || isSensitiveKey(name)) {
+				arg = maskValue(arg)
+			}
+			masked[name] = arg
+		}
+		return masked
+	case string:
+		if v != "" && isSensitiveKey(key) {
+			return maskValue(v)
+		}
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Struct:
+		var decoded map[string]interface{}
+		if err := mapstructure.Decode(value, &decoded); err != nil {
+			return value
+		}
+		maskSecrets(decoded)
+		return decoded
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = maskSecret(key, rv.Index(i).Interface())
+		}
+		return items
+	}
+	return value
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"account", "secret", "token", "password", "key"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func maskValue(value string) string {
+	if len(value) <= 4 {
+		return "****"
+	}
+	return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
+}
+
+func toolVersions() []byte {
+	var b strings.Builder
+	for _, args := range [][]string{
+		{"docker", "version"},
+		{"aws", "--version"},
+	} {
+		fmt.Fprintf(&b, "$ %s\n", strings.Join(args, " "))
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		b.Write(out)
+		if err != nil {
+			fmt.Fprintf(&b, "(error: %v)\n", err)
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// daemonLogs returns the tail of the Docker daemon log from journald or the
+// usual log file locations, if any of them is readable.
+func daemonLogs() []byte {
+	out, err := exec.Command("journalctl", "-u", "docker", "--no-pager", "-n", fmt.Sprint(daemonLogLines)).Output()
+	if err == nil && len(bytes.TrimSpace(out)) > 0 {
+		return out
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, path := range []string{
+		"/var/log/docker.log",
+		"/var/log/upstart/docker.log",
+		filepath.Join(home, "Library/Containers/com.docker.docker/Data/log/vm/dockerd.log"),
+	} {
+		if lines, err := tailFile(path, daemonLogLines); err == nil {
+			return lines
+		}
+	}
+	return []byte("daemon logs not accessible\n")
+}
+
+func tailFile(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
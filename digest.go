@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pushByDigest pushes the image without any tag, for workflows where a
+// later promotion step assigns tags. docker push always needs a tag, so the
+// image goes through buildx's push-by-digest output instead, reusing the
+// build cache from the build stage.
+func (ecr *ECR) pushByDigest() error {
+	ecr.stage(ColorCyan, "Pushing container by digest")
+	repository := ecr.repositoryURI()
+	if err := checkWritable("push by digest to " + repository); err != nil {
+		return err
+	}
+	if err := ecr.buildxPush("--output", "type=image,name="+repository+",push-by-digest=true,name-canonical=true,push=true"); err != nil {
+		return err
+	}
+	fmt.Println(ColorGreen + "Pushed " + repository + "@" + ecr.Digest + ColorReset)
+	return nil
+}
+
+// pushMultiPlatform pushes a multi-platform image as a manifest list. Such
+// images cannot be loaded into the local image store to be tagged and pushed,
+// so buildx pushes them itself, reusing the build cache from the build stage.
+func (ecr *ECR) pushMultiPlatform() error {
+	ecr.stage(ColorCyan, "Pushing multi-platform container ("+strings.Join(ecr.Config.Docker.Platforms, ", ")+")")
+	ecrImage := ecr.imageURI(ecr.Config.ECR.ImageTag)
+	if err := checkWritable("docker buildx build --push " + ecrImage); err != nil {
+		return err
+	}
+	if err := ecr.buildxPush("--tag", ecrImage, "--push"); err != nil {
+		return err
+	}
+	fmt.Println(ColorGreen + "Pushed manifest list " + ecrImage + "@" + ecr.Digest + ColorReset)
+	return nil
+}
+
+// buildxPush runs the build again through buildx with the given output
+// options and records the digest buildx reports for what it pushed.
+func (ecr *ECR) buildxPush(output ...string) error {
+	if err := ecr.dockerLogin(); err != nil {
+		return err
+	}
+	metadata, err := os.CreateTemp("", "pushecr-metadata-*.json")
+	if err != nil {
+		return err
+	}
+	metadata.Close()
+	defer os.Remove(metadata.Name())
+
+	args := append([]string{"buildx", "build"}, ecr.buildOptions()...)
+	args = append(args, output...)
+	args = append(args, "--metadata-file", metadata.Name(), ecr.buildContext())
+	cmd := exec.CommandContext(ecr.context(), "docker", args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = ecr.output(os.Stdout)
+	cmd.Stderr = ecr.output(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		return classify(ErrCodePushFailed, stderr.String(), errorf(KeyPushBuildxFailed, err))
+	}
+
+	data, err := os.ReadFile(metadata.Name())
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Digest string `json:"containerimage.digest"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || !strings.HasPrefix(result.Digest, "sha256:") {
+		return withCode(ErrCodePushFailed, errorf(KeyPushNoDigest))
+	}
+	ecr.Digest = result.Digest
+	return nil
+}
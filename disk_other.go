@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+// diskUsage is not available on this platform; it reports false so the disk
+// threshold is skipped.
+func diskUsage(path string) (float64, bool, error) {
+	return 0, false, nil
+}
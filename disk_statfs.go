@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import "syscall"
+
+// diskUsage returns the fraction of the filesystem holding path that is in
+// use, counted like df: blocks reserved for root are not available.
+func diskUsage(path string) (float64, bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, true, err
+	}
+	used := uint64(st.Blocks) - uint64(st.Bfree)
+	total := used + uint64(st.Bavail)
+	if total == 0 {
+		return 0, true, nil
+	}
+	return float64(used) / float64(total), true, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// dockerClient returns a Docker Engine API client configured from DOCKER_HOST,
+// DOCKER_TLS_VERIFY and DOCKER_CERT_PATH, negotiating the API version with the
+// daemon.
+func dockerClient() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, withCode(ErrCodeDockerUnavailable, errorf(KeyDockerClientFailed, err))
+	}
+	return cli, nil
+}
+
+// registryAuth returns the registry token as the encoded credentials of the
+// Engine API's RegistryAuth options.
+func (ecr *ECR) registryAuth() (string, error) {
+	user, password, err := ecr.registryCredentials()
+	if err != nil {
+		return "", err
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{Username: user, Password: password, ServerAddress: ecr.registry()})
+}
+
+// tagImage points target at the local image source through the Engine API.
+func (ecr *ECR) tagImage(source, target string) error {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	if err := cli.ImageTag(ecr.context(), source, target); err != nil {
+		return classify(ErrCodeTagFailed, "", errorf(KeyTagFailed, err))
+	}
+	return nil
+}
+
+// pushImage pushes ref through the Engine API with credentials from ECR, so
+// it does not depend on what docker login stored. Progress is written to the
+// run output and the pushed digest is returned.
+func (ecr *ECR) pushImage(ref string) (string, error) {
+	auth, err := ecr.registryAuth()
+	if err != nil {
+		return "", err
+	}
+
+	cli, err := dockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+	progress, err := cli.ImagePush(ecr.context(), ref, image.PushOptions{RegistryAuth: auth})
+	if err != nil {
+		return "", classify(ErrCodePushFailed, "", errorf(KeyPushFailed, err))
+	}
+	defer progress.Close()
+
+	var digest string
+	err = jsonmessage.DisplayJSONMessagesStream(progress, ecr.output(os.Stdout), os.Stdout.Fd(), false, func(m jsonmessage.JSONMessage) {
+		var result struct {
+			Digest string `json:"Digest"`
+		}
+		if m.Aux != nil && json.Unmarshal(*m.Aux, &result) == nil && result.Digest != "" {
+			digest = result.Digest
+		}
+	})
+	if err != nil {
+		var streamErr *jsonmessage.JSONError
+		message := ""
+		if errors.As(err, &streamErr) {
+			message = streamErr.Message
+		}
+		return "", classify(ErrCodePushFailed, message, errorf(KeyPushFailed, err))
+	}
+	return digest, nil
+}
+
+// pullImage pulls ref through the Engine API, for platform if set, writing
+// the progress to the run output. Refs outside the profile's registry are
+// pulled anonymously.
+func (ecr *ECR) pullImage(ref, platform string) error {
+	options := image.PullOptions{Platform: platform}
+	if imageRegistry(ref) == ecr.registry() {
+		auth, err := ecr.registryAuth()
+		if err != nil {
+			return err
+		}
+		options.RegistryAuth = auth
+	}
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	progress, err := cli.ImagePull(ecr.context(), ref, options)
+	if err != nil {
+		return classify(ErrCodeImageNotFound, err.Error(), errorf(KeyPullFailed, ref, err))
+	}
+	defer progress.Close()
+	if err := jsonmessage.DisplayJSONMessagesStream(progress, ecr.output(os.Stdout), os.Stdout.Fd(), false, nil); err != nil {
+		return classify(ErrCodeImageNotFound, err.Error(), errorf(KeyPullFailed, ref, err))
+	}
+	return nil
+}
+
+// distributionDigest returns the manifest digest of ref in its registry
+// without pulling it; for multi-platform images, the index digest.
+func (ecr *ECR) distributionDigest(ref string) (string, error) {
+	var auth string
+	if imageRegistry(ref) == ecr.registry() {
+		var err error
+		if auth, err = ecr.registryAuth(); err != nil {
+			return "", err
+		}
+	}
+	cli, err := dockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+	inspect, err := cli.DistributionInspect(ecr.context(), ref, auth)
+	if err != nil {
+		return "", classify(ErrCodeImageNotFound, err.Error(), errorf(KeyDigestResolveFailed, ref, err))
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+// dockerDiskUsage returns the bytes used by Docker images and build cache,
+// or -1 if it cannot be read.
+func dockerDiskUsage() int64 {
+	cli, err := dockerClient()
+	if err != nil {
+		return -1
+	}
+	defer cli.Close()
+	usage, err := cli.DiskUsage(context.Background(), types.DiskUsageOptions{Types: []types.DiskUsageObject{types.ImageObject, types.BuildCacheObject}})
+	if err != nil {
+		return -1
+	}
+	total := usage.LayersSize
+	for _, record := range usage.BuildCache {
+		if !record.Shared {
+			total += record.Size
+		}
+	}
+	return total
+}
+
+// removeImageTags removes local references through the Engine API. Removing
+// the last reference of an image deletes it; references that do not exist
+// are skipped. The removed references are returned.
+func removeImageTags(refs ...string) ([]string, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	var removed []string
+	for _, ref := range refs {
+		_, err := cli.ImageRemove(context.Background(), ref, image.RemoveOptions{PruneChildren: true})
+		if client.IsErrNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return removed, classify(ErrCodeDockerUnavailable, "", errorf(KeyImageRemoveFailed, ref, err))
+		}
+		removed = append(removed, ref)
+	}
+	return removed, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fromPattern matches a FROM instruction: FROM [--platform=x] image [AS name].
+var fromPattern = regexp.MustCompile(`(?i)^(\s*FROM\s+(?:--\S+\s+)*)(\S+)(.*)$`)
+
+// dockerfileFrom is a FROM instruction referencing an external image.
+type dockerfileFrom struct {
+	Line  int
+	Image string
+	Ref   string // as written, when Image was expanded from ARGs
+}
+
+// dockerfile is a Dockerfile split into lines so FROM references can be
+// inspected and rewritten without touching anything else.
+type dockerfile struct {
+	Path  string
+	Lines []string
+}
+
+// dockerfilePath returns the path of the Dockerfile the build uses.
+func (ecr *ECR) dockerfilePath() string {
+	if ecr.Config.Build.Prebuilt.enabled() {
+		return ecr.prebuiltDockerfilePath()
+	}
+	if ecr.Config.Docker.Dockerfile != "" {
+		return ecr.Config.Docker.Dockerfile
+	}
+	return filepath.Join(ecr.buildContext(), "Dockerfile")
+}
+
+// buildContext returns docker.context: a local directory (default ".") or
+// a git repository or tarball URL that docker build fetches itself. Prebuilt
+// builds use the artifacts directory.
+func (ecr *ECR) buildContext() string {
+	if ecr.Config.Build.Prebuilt.enabled() {
+		return ecr.Config.Build.Prebuilt.Artifacts
+	}
+	return orDefault(ecr.Config.Docker.Context, ".")
+}
+
+// remoteContext reports whether the build context is a URL.
+func (ecr *ECR) remoteContext() bool {
+	context := ecr.buildContext()
+	for _, prefix := range []string{"http://", "https://", "git://", "git@", "github.com/"} {
+		if strings.HasPrefix(context, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// localDockerfile reads the Dockerfile of a local build context. With a
+// remote context the Dockerfile is only available to docker build.
+func (ecr *ECR) localDockerfile() (*dockerfile, error) {
+	if ecr.remoteContext() {
+		return nil, withCode(ErrCodeConfigInvalid, fmt.Errorf("docker.context %s is remote: its Dockerfile cannot be inspected before the build", ecr.buildContext()))
+	}
+	if ecr.Config.Build.Prebuilt.enabled() {
+		if err := ecr.writePrebuiltDockerfile(); err != nil {
+			return nil, err
+		}
+	}
+	return readDockerfile(ecr.dockerfilePath())
+}
+
+func readDockerfile(path string) (*dockerfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errorf(KeyFileReadFailed, path, err)
+	}
+	return &dockerfile{Path: path, Lines: strings.Split(string(data), "\n")}, nil
+}
+
+// bases returns the FROM instructions that pull an external image, skipping
+// scratch, references to earlier build stages and ARG-dependent images.
+func (d *dockerfile) bases() []dockerfileFrom {
+	stages := map[string]bool{}
+	var froms []dockerfileFrom
+	for i, line := range d.Lines {
+		m := fromPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		image := m[2]
+		external := image != "scratch" && !stages[strings.ToLower(image)] && !strings.Contains(image, "$")
+		if fields := strings.Fields(m[3]); len(fields) == 2 && strings.EqualFold(fields[0], "AS") {
+			stages[strings.ToLower(fields[1])] = true
+		}
+		if external {
+			froms = append(froms, dockerfileFrom{Line: i, Image: image})
+		}
+	}
+	return froms
+}
+
+// resolvedBases returns the FROM instructions that pull an external image
+// like bases, including those that reference ARGs, expanded as docker build
+// does: from args, the build args by lower-case name, or the defaults of the
+// ARGs declared before the first FROM. References it cannot expand are
+// returned in unresolved, since no policy can vouch for an image nobody knows
+// until the build.
+func (d *dockerfile) resolvedBases(args map[string]string) (froms []dockerfileFrom, unresolved []string) {
+	global := map[string]string{}
+	first := len(d.Lines)
+	if stages := d.stages(); len(stages) > 0 {
+		first = stages[0].Line
+	}
+	for _, arg := range d.args() {
+		if arg.Line > first {
+			break
+		}
+		key := strings.ToLower(arg.Name)
+		if value, ok := args[key]; ok {
+			global[key] = value
+		} else if arg.HasDefault {
+			if value, ok := expandArgs(arg.Default, global); ok {
+				global[key] = value
+			}
+		}
+	}
+
+	stages := map[string]bool{}
+	for i, line := range d.Lines {
+		m := fromPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ref := m[2]
+		image, ok := expandArgs(ref, global)
+		switch {
+		case !ok || image == "":
+			unresolved = append(unresolved, ref)
+		case image != "scratch" && !stages[strings.ToLower(image)]:
+			from := dockerfileFrom{Line: i, Image: image}
+			if image != ref {
+				from.Ref = ref
+			}
+			froms = append(froms, from)
+		}
+		if fields := strings.Fields(m[3]); len(fields) == 2 && strings.EqualFold(fields[0], "AS") {
+			stages[strings.ToLower(fields[1])] = true
+		}
+	}
+	return froms, unresolved
+}
+
+// expandArgs expands the $NAME and ${NAME} references in text from values,
+// keyed by lower-case name. It reports false if any of them has no value.
+func expandArgs(text string, values map[string]string) (string, bool) {
+	ok := true
+	expanded := os.Expand(text, func(name string) string {
+		value, set := values[strings.ToLower(name)]
+		ok = ok && set
+		return value
+	})
+	return expanded, ok
+}
+
+// setBase replaces the image of the FROM instruction at line.
+func (d *dockerfile) setBase(line int, image string) {
+	m := fromPattern.FindStringSubmatch(d.Lines[line])
+	if m == nil {
+		return
+	}
+	d.Lines[line] = m[1] + image + m[3]
+}
+
+func (d *dockerfile) String() string {
+	return strings.Join(d.Lines, "\n")
+}
+
+// writeTemp writes the Dockerfile to a temporary file and returns its path.
+func (d *dockerfile) writeTemp() (string, error) {
+	f, err := os.CreateTemp("", "pushecr-Dockerfile-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(d.String()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// imageRegistry returns the registry host of an image reference, normalizing
+// Docker Hub references to "docker.io".
+func imageRegistry(ref string) string {
+	first, _, found := strings.Cut(ref, "/")
+	if !found || !(strings.ContainsAny(first, ".:") || first == "localhost") {
+		return "docker.io"
+	}
+	if first == "index.docker.io" || first == "registry-1.docker.io" {
+		return "docker.io"
+	}
+	return first
+}
+
+// imagePath returns the repository path of an image reference without its
+// registry host, expanding official Docker Hub images to library/<name>.
+func imagePath(ref string) string {
+	registry := imageRegistry(ref)
+	path := ref
+	if first, rest, found := strings.Cut(ref, "/"); found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		path = rest
+	}
+	if registry == "docker.io" && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	return path
+}
+
+// dockerfileStage is a FROM instruction and the name it gives its stage.
+type dockerfileStage struct {
+	Image string
+	Name  string
+	Line  int
+}
+
+// stages returns every build stage of the Dockerfile in order.
+func (d *dockerfile) stages() []dockerfileStage {
+	var stages []dockerfileStage
+	for i, line := range d.Lines {
+		m := fromPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		s := dockerfileStage{Image: m[2], Line: i}
+		if fields := strings.Fields(m[3]); len(fields) == 2 && strings.EqualFold(fields[0], "AS") {
+			s.Name = fields[1]
+		}
+		stages = append(stages, s)
+	}
+	return stages
+}
+
+// stageChain returns the target stage (the last one if target is empty)
+// followed by the earlier stages it is built FROM, up to the one built on an
+// external image. It returns nil if there is no such stage.
+func (d *dockerfile) stageChain(target string) []dockerfileStage {
+	stages := d.stages()
+	var chain []dockerfileStage
+	for i := len(stages) - 1; i >= 0; i-- {
+		s := stages[i]
+		if len(chain) == 0 {
+			if target == "" || strings.EqualFold(s.Name, target) {
+				chain = append(chain, s)
+			}
+			continue
+		}
+		if s.Name != "" && strings.EqualFold(s.Name, chain[len(chain)-1].Image) {
+			chain = append(chain, s)
+		}
+	}
+	return chain
+}
+
+var exposePattern = regexp.MustCompile(`(?i)^\s*EXPOSE\s+(.+)$`)
+
+// exposedPorts returns the ports declared with EXPOSE in the stage starting
+// at line from, as written.
+func (d *dockerfile) exposedPorts(from int) []string {
+	var ports []string
+	for i := from; i < len(d.Lines); i++ {
+		if i > from && fromPattern.MatchString(d.Lines[i]) {
+			break
+		}
+		if m := exposePattern.FindStringSubmatch(d.Lines[i]); m != nil {
+			ports = append(ports, strings.Fields(m[1])...)
+		}
+	}
+	return ports
+}
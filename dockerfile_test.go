@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolvedBases(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		dockerfile string
+		args       map[string]string
+		bases      []string
+		unresolved []string
+	}{
+		{
+			name:       "literal",
+			dockerfile: "FROM alpine:3.19\nRUN true",
+			bases:      []string{"alpine:3.19"},
+		},
+		{
+			name:       "ARG default",
+			dockerfile: "ARG BASE=evil/unsigned:latest\nFROM ${BASE}",
+			bases:      []string{"evil/unsigned:latest"},
+		},
+		{
+			name:       "build arg over the default",
+			dockerfile: "ARG BASE=alpine:latest\nFROM $BASE",
+			args:       map[string]string{"base": "debian:12"},
+			bases:      []string{"debian:12"},
+		},
+		{
+			name:       "default from another ARG",
+			dockerfile: "ARG VERSION=3.19\nARG BASE=alpine:${VERSION}\nFROM ${BASE}",
+			bases:      []string{"alpine:3.19"},
+		},
+		{
+			name:       "ARG without a value",
+			dockerfile: "ARG BASE\nFROM ${BASE}",
+			unresolved: []string{"${BASE}"},
+		},
+		{
+			name:       "undeclared ARG",
+			dockerfile: "FROM ${BASE}",
+			args:       map[string]string{"base": "alpine"},
+			unresolved: []string{"${BASE}"},
+		},
+		{
+			name:       "ARG declared after the first FROM",
+			dockerfile: "FROM alpine\nARG BASE=debian\nFROM ${BASE}",
+			bases:      []string{"alpine"},
+			unresolved: []string{"${BASE}"},
+		},
+		{
+			name:       "stages and scratch",
+			dockerfile: "ARG STAGE=build\nFROM golang:1.23 AS build\nFROM ${STAGE}\nFROM scratch",
+			bases:      []string{"golang:1.23"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := &dockerfile{Lines: strings.Split(test.dockerfile, "\n")}
+			froms, unresolved := d.resolvedBases(test.args)
+			var bases []string
+			for _, from := range froms {
+				bases = append(bases, from.Image)
+			}
+			if !reflect.DeepEqual(bases, test.bases) || !reflect.DeepEqual(unresolved, test.unresolved) {
+				t.Errorf("resolvedBases() = %q, unresolved %q; want %q, unresolved %q", bases, unresolved, test.bases, test.unresolved)
+			}
+		})
+	}
+}
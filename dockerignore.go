@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// largeArtifactSize is the size from which gen-dockerignore proposes to
+// exclude a single file.
+const largeArtifactSize = 10 << 20
+
+// ignoreRules are the .dockerignore entries proposed when a marker file
+// identifies the project's language or tooling.
+var ignoreRules = []struct {
+	Marker  string
+	Comment string
+	Entries []string
+}{
+	{"", "Version control and editors", []string{".git", ".hg", ".svn", ".idea", ".vscode", "**/.DS_Store"}},
+	{"", "pushecr state, logs and secrets", []string{".pushecr", "*.log", ".env", ".env.*"}},
+	{"package.json", "Node.js", []string{"node_modules", "npm-debug.log*", "yarn-error.log", ".npm", "coverage", ".next/cache"}},
+	{"go.mod", "Go", []string{"bin", "*.test", "*.out"}},
+	{"requirements.txt", "Python", []string{"__pycache__", "**/*.pyc", ".venv", "venv", ".pytest_cache", ".mypy_cache", ".tox"}},
+	{"pyproject.toml", "Python", []string{"__pycache__", "**/*.pyc", ".venv", "venv", ".pytest_cache", ".mypy_cache", ".tox"}},
+	{"pom.xml", "Maven", []string{"target"}},
+	{"build.gradle", "Gradle", []string{"build", ".gradle"}},
+	{"build.gradle.kts", "Gradle", []string{"build", ".gradle"}},
+	{"Cargo.toml", "Rust", []string{"target"}},
+	{"Gemfile", "Ruby", []string{".bundle", "vendor/bundle", "log", "tmp"}},
+	{"composer.json", "PHP", []string{"vendor"}},
+	{".terraform.lock.hcl", "Terraform", []string{".terraform", "*.tfstate", "*.tfstate.*"}},
+}
+
+func runGenDockerignore(args []string) {
+	fs := flag.NewFlagSet("gen-dockerignore", flag.ExitOnError)
+	dir := fs.String("context", ".", "Build context directory to inspect")
+	write := fs.Bool("write", false, "Write the proposal to .dockerignore, appending only the missing entries if it exists")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s gen-dockerignore [-context .] [-write]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path := filepath.Join(*dir, ".dockerignore")
+	existing := readIgnoreEntries(path)
+	proposal := proposeDockerignore(*dir, existing)
+	if len(proposal) == 0 {
+		fmt.Println(ColorGreen + path + " already covers everything detected" + ColorReset)
+		return
+	}
+
+	var b strings.Builder
+	for _, section := range proposal {
+		fmt.Fprintf(&b, "# %s\n%s\n\n", section[0], strings.Join(section[1:], "\n"))
+	}
+	if !*write {
+		fmt.Print(b.String())
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	exitOnError("Could not write "+path, err)
+	defer f.Close()
+	if len(existing) > 0 {
+		_, err = f.WriteString("\n# Added by pushecr gen-dockerignore\n" + b.String())
+	} else {
+		_, err = f.WriteString(b.String())
+	}
+	exitOnError("Could not write "+path, err)
+	fmt.Println(ColorGreen + "Wrote " + path + ColorReset)
+}
+
+// proposeDockerignore returns sections (title followed by entries) of
+// entries missing from existing, for the tooling detected in dir and the
+// large files found in it.
+func proposeDockerignore(dir string, existing map[string]bool) [][]string {
+	var sections [][]string
+	added := map[string]bool{}
+	for _, rule := range ignoreRules {
+		if rule.Marker != "" {
+			if _, err := os.Stat(filepath.Join(dir, rule.Marker)); err != nil {
+				continue
+			}
+		}
+		section := []string{rule.Comment}
+		for _, entry := range rule.Entries {
+			if !existing[entry] && !added[entry] {
+				section = append(section, entry)
+				added[entry] = true
+			}
+		}
+		if len(section) > 1 {
+			sections = append(sections, section)
+		}
+	}
+
+	// Large files not covered by the entries above.
+	ignored := func(rel string) bool {
+		for entry := range existing {
+			if ignoreMatches(entry, rel) {
+				return true
+			}
+		}
+		for entry := range added {
+			if ignoreMatches(entry, rel) {
+				return true
+			}
+		}
+		return false
+	}
+	var large []string // paths, each preceded by a comment with its size
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if rel != "." && ignored(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() && info.Size() >= largeArtifactSize {
+			large = append(large, fmt.Sprintf("# %s: %s", rel, formatBytes(info.Size())), rel)
+		}
+		return nil
+	})
+	if len(large) > 0 {
+		sections = append(sections, append([]string{"Large files (review before excluding)"}, large...))
+	}
+	return sections
+}
+
+// ignoreMatches reports whether a .dockerignore entry excludes rel, or one
+// of its parent directories.
+func ignoreMatches(entry, rel string) bool {
+	entry = strings.TrimPrefix(strings.TrimSuffix(entry, "/"), "/")
+	for p := rel; p != "." && p != ""; p = filepath.ToSlash(filepath.Dir(p)) {
+		if ok, _ := filepath.Match(entry, p); ok {
+			return true
+		}
+		if pattern, ok := strings.CutPrefix(entry, "**/"); ok {
+			if ok, _ := filepath.Match(pattern, filepath.Base(p)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readIgnoreEntries returns the entries of a .dockerignore file.
+func readIgnoreEntries(path string) map[string]bool {
+	entries := map[string]bool{}
+	f, err := os.Open(path)
+	if err != nil {
+		return entries
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			entries[line] = true
+		}
+	}
+	return entries
+}
+
+// contextSize returns the total size of the files in dir.
+func contextSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
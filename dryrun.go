@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// printPlan prints what running stages would do, with the commands and API
+// calls fully resolved, without calling Docker or changing anything in AWS:
+// the deploy stage only reads the current deployment to show what it would
+// change. Variants are planned after the main image, like runPipeline runs
+// them.
+func (ecr *ECR) printPlan(stages []stage) error {
+	fmt.Println(ColorCyan + "Plan for profile " + ecr.Profile + " (dry run, nothing is executed)" + ColorReset)
+	if c := ecr.Config.ECR; !ecr.force && !c.PushByDigest && contains(stageNamesOf(stages), "push") {
+		fmt.Println(ColorYellow + "preflight" + ColorReset)
+		if ecr.skipIfExists {
+			fmt.Println("  skip the run if " + c.ImageTag + " already exists in ECR")
+		} else {
+			fmt.Println("  fail if " + c.Repository + " has immutable tags and a tag to push already exists")
+		}
+	}
+	if err := ecr.planStages(stages); err != nil {
+		return err
+	}
+	base := ecr.Config
+	defer func() { ecr.Config, ecr.variant = base, nil }()
+	for _, v := range base.Variants {
+		ecr.Config, ecr.variant = base.withVariant(v), &v
+		fmt.Println()
+		fmt.Println(ColorCyan + "Variant " + v.Name + ColorReset)
+		if err := ecr.planStages(stages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ecr *ECR) planStages(stages []stage) error {
+	c := ecr.Config
+	image := ecr.imageURI(c.ECR.ImageTag)
+	for _, s := range stages {
+		if ecr.variant != nil && mainImageOnly(s.Name) {
+			continue
+		}
+		var steps []string
+		switch s.Name {
+		case "auth":
+			if arn := c.ECR.AssumeRoleARN; arn != "" {
+				steps = append(steps, "sts:AssumeRole "+arn)
+			}
+			token := "ecr:GetAuthorizationToken in " + c.ECR.Region
+			if c.ECR.Public {
+				token = "ecr-public:GetAuthorizationToken in " + publicRegion
+			}
+			steps = append(steps, token)
+			for _, replica := range ecr.replicas() {
+				steps = append(steps, "ecr:GetAuthorizationToken in "+replica.Config.ECR.Region)
+			}
+		case "policy":
+			if pattern := c.Policy.Repository.Pattern; pattern != "" {
+				steps = append(steps, planCheck("repository "+c.ECR.Repository+" matches "+pattern, ecr.checkRepositoryPolicy()))
+			}
+			steps = append(steps, planCheck("tag policy", ecr.checkTagPolicy()))
+			if p := c.Policy.BaseImages; p.RequirePinned || p.RequireSignature {
+				steps = append(steps, ecr.planBaseImagePolicy()...)
+			}
+		case "build":
+			if threshold := c.Cleanup.AutoPruneThreshold; threshold != "" {
+				steps = append(steps, "prune dangling images and old build cache if the Docker data root is over "+threshold)
+			}
+			if name := c.Docker.Builder.Name; name != "" {
+				steps = append(steps, "ensure buildx builder "+name)
+			}
+			if c.Build.Prebuilt.enabled() {
+				steps = append(steps, "write "+ecr.prebuiltDockerfilePath())
+			}
+			args := append(ecr.buildCommand(), "-t", c.Docker.ImageName, ecr.buildContext())
+			steps = append(steps, shellJoin(append([]string{"docker"}, maskBuildArgOptions(args)...)))
+			steps = append(steps, ecr.planDockerfile()...)
+			if p := c.Policy.Secrets; p.Scan {
+				var scanners []string
+				for _, s := range p.scanners() {
+					scanners = append(scanners, s.name())
+				}
+				steps = append(steps, fmt.Sprintf("scan the image for secrets (%s), allowing %d finding(s)", strings.Join(scanners, ", "), p.MaxFindings))
+			}
+			if p := c.Policy.Licenses; p.enabled() {
+				steps = append(steps, "generate the SBOM with "+orDefault(p.SBOMCommand, "syft")+" and check its licenses")
+			}
+		case "tag":
+			if ecr.multiPlatform() {
+				steps = append(steps, "skipped: multi-platform images are tagged by buildx when pushed")
+				break
+			}
+			steps = append(steps, fmt.Sprintf("docker tag %s:%s %s", c.Docker.ImageName, c.ECR.ImageTag, image))
+		case "approval":
+			if !c.Approval.Required {
+				steps = append(steps, "skipped: approval.required is not set")
+				break
+			}
+			if ecr.interactive {
+				steps = append(steps, "ask for confirmation on the terminal")
+				break
+			}
+			target := "ssm parameter " + c.Approval.Parameter
+			if c.Approval.Method == "s3" {
+				target = "s3://" + c.Approval.Bucket + "/" + c.Approval.Prefix
+			}
+			steps = append(steps, fmt.Sprintf("wait up to %s for an approval in %s", orDefault(c.Approval.Timeout, "30m"), target))
+		case "guard":
+			guard := c.ECR.TagGuard
+			if !guard.Enabled && guard.SourceCheck == "" {
+				steps = append(steps, "skipped: tag_guard is not enabled")
+				break
+			}
+			tags, err := ecr.pushTags()
+			if err != nil {
+				return err
+			}
+			if len(tags) == 0 {
+				steps = append(steps, "skipped: the image is pushed by digest without aliases")
+			}
+			for _, tag := range tags {
+				steps = append(steps, "ecr:DescribeImages "+c.ECR.Repository+":"+tag)
+				if guard.SourceCheck != "" {
+					steps = append(steps, "compare the git source of the current image ("+guard.SourceCheck+")")
+				}
+				if guard.Backup {
+					steps = append(steps, "tag the current image as previous-"+tag)
+				}
+			}
+		case "mount":
+			noLocalImage := ecr.multiPlatform() || c.ECR.PushByDigest
+			if c.ECR.Public || noLocalImage && len(c.ECR.MountFrom) == 0 {
+				steps = append(steps, "skipped")
+				break
+			}
+			if !noLocalImage {
+				steps = append(steps, "ecr:BatchCheckLayerAvailability for the layers of "+ecr.imageURI(c.ECR.ImageTag)+" in "+c.ECR.Repository)
+			}
+			for _, ref := range c.ECR.MountFrom {
+				steps = append(steps, "mount the missing layers of "+ref+" into "+c.ECR.Repository)
+			}
+		case "push":
+			if c.ECR.CreateIfMissing {
+				steps = append(steps, "create repository "+c.ECR.Repository+" if it does not exist")
+			}
+			switch {
+			case c.ECR.PushByDigest:
+				steps = append(steps, "docker buildx build --push by digest to "+ecr.repositoryURI())
+			case ecr.multiPlatform():
+				steps = append(steps, "docker buildx build --push --tag "+image+" ("+strings.Join(c.Docker.Platforms, ", ")+")")
+			default:
+				if c.ECR.MetadataOnlyPush {
+					steps = append(steps, "if only labels changed since "+c.ECR.ImageTag+" was pushed: put a new config and manifest over its layers")
+				}
+				steps = append(steps, "docker push "+image)
+				if refs := ecr.cleanupRefs(); len(refs) > 0 {
+					steps = append(steps, "remove local tags "+strings.Join(refs, ", "))
+				}
+			}
+			if !c.ECR.PushByDigest {
+				for _, tag := range ecr.extraTags() {
+					steps = append(steps, "tag the pushed image as "+tag)
+				}
+			}
+			aliases, err := ecr.aliasTags()
+			if err != nil {
+				return err
+			}
+			for _, alias := range sortedKeys(aliases) {
+				steps = append(steps, "tag the pushed image as "+aliases[alias]+" (alias "+alias+")")
+			}
+			if channel := c.Channels.Push; channel != "" {
+				steps = append(steps, "move channel "+channel+" to the pushed image")
+			}
+			if c.ECR.Public && c.ECR.CatalogData.enabled() {
+				steps = append(steps, "ecr-public:PutRepositoryCatalogData "+c.ECR.Repository)
+			}
+			for _, replica := range ecr.replicas() {
+				steps = append(steps, "copy the pushed image and its tags to "+replica.repositoryURI()+" (in parallel)")
+			}
+		case "scan":
+			if !c.Scan.enabled() {
+				steps = append(steps, "skipped: scan.fail_on is not set")
+				break
+			}
+			steps = append(steps, fmt.Sprintf("wait up to %s for ecr:DescribeImageScanFindings of the pushed image and fail on %s or above",
+				orDefault(c.Scan.Timeout, "15m"), c.Scan.FailOn))
+		case "sign":
+			sign := c.Sign.Cosign
+			if !sign.enabled() {
+				steps = append(steps, "skipped: sign.cosign is not set")
+				break
+			}
+			method := "keyless"
+			if key := sign.keyRef(); key != "" {
+				method = "--key " + key
+			}
+			steps = append(steps, "cosign sign "+method+" "+ecr.repositoryURI()+"@<pushed digest>")
+			for _, replica := range ecr.replicas() {
+				steps = append(steps, "cosign sign "+method+" "+replica.repositoryURI()+"@<pushed digest>")
+			}
+		case "deploy":
+			ecs, function := c.Deploy.ECS, c.Deploy.Lambda
+			if !ecs.enabled() && !function.enabled() {
+				steps = append(steps, "skipped: neither deploy.ecs nor deploy.lambda is set")
+				break
+			}
+			if ecs.enabled() {
+				steps = append(steps,
+					"ecs:RegisterTaskDefinition of "+ecs.Service+" with container "+orDefault(ecs.Container, c.Docker.ImageName)+" at the pushed digest",
+					"ecs:UpdateService "+ecs.Cluster+"/"+ecs.Service)
+				if ecs.Wait {
+					steps = append(steps, "wait up to "+orDefault(ecs.Timeout, "15m")+" for the deployment to complete")
+				}
+				steps = append(steps, ecr.planECSDiff()...)
+			}
+			if function.enabled() {
+				steps = append(steps,
+					"lambda:UpdateFunctionCode "+function.FunctionName+" to the pushed digest",
+					"wait up to "+orDefault(function.Timeout, "5m")+" for the function to be Active")
+				steps = append(steps, ecr.planLambdaDiff()...)
+			}
+		}
+		var pre []string
+		for _, command := range c.Hooks.commands(s.Name, "pre") {
+			pre = append(pre, "pre_"+s.Name+" hook: "+command)
+		}
+		steps = append(pre, steps...)
+		for _, command := range c.Hooks.commands(s.Name, "post") {
+			steps = append(steps, "post_"+s.Name+" hook: "+command)
+		}
+		fmt.Println(ColorYellow + s.Name + ColorReset)
+		for _, step := range steps {
+			fmt.Println("  " + step)
+		}
+	}
+	fmt.Println("Image: " + image)
+	return nil
+}
+
+// planDockerfile describes what the Dockerfile declares for the stage being
+// built: its base image, exposed ports and ARGs, flagging the ARGs that
+// neither the build arguments nor a default set, which usually fail late in
+// the build.
+func (ecr *ECR) planDockerfile() []string {
+	if ecr.remoteContext() {
+		return []string{"Dockerfile: not inspected, the build context is remote"}
+	}
+	d, err := readDockerfile(ecr.dockerfilePath())
+	if err != nil {
+		return []string{ColorYellow + "Dockerfile: " + err.Error() + ColorReset}
+	}
+	target := ""
+	if ecr.variant != nil {
+		target = ecr.variant.Target
+	}
+	chain := d.stageChain(target)
+	if len(chain) == 0 {
+		return []string{ColorYellow + "Dockerfile: no FROM instruction for the stage being built" + ColorReset}
+	}
+
+	values := ecr.buildArgValues()
+	defaults := map[string]string{}
+	anywhere := map[string]bool{}
+	for _, arg := range d.args() {
+		anywhere[strings.ToLower(arg.Name)] = true
+		if arg.HasDefault {
+			defaults[strings.ToLower(arg.Name)] = arg.Default
+		}
+	}
+	base := os.Expand(chain[len(chain)-1].Image, func(name string) string {
+		if value, ok := values[strings.ToLower(name)]; ok {
+			return value
+		}
+		return defaults[strings.ToLower(name)]
+	})
+	lines := []string{"base image: " + base}
+
+	var ports []string
+	for _, s := range chain {
+		ports = append(d.exposedPorts(s.Line), ports...)
+	}
+	if len(ports) > 0 {
+		lines = append(lines, "exposes: "+strings.Join(ports, ", "))
+	}
+
+	// The global ARGs and those of the stages the image is built from are
+	// listed; stages only copied from are not followed.
+	built := map[int]bool{}
+	for _, s := range chain {
+		built[s.Line] = true
+	}
+	stages := d.stages()
+	inBuild := func(line int) bool {
+		start := -1
+		for _, s := range stages {
+			if s.Line <= line {
+				start = s.Line
+			}
+		}
+		return start < 0 || built[start]
+	}
+
+	declared := map[string]bool{}
+	for _, arg := range d.args() {
+		key := strings.ToLower(arg.Name)
+		if declared[key] || !inBuild(arg.Line) || contains(automaticArgs, arg.Name) {
+			continue
+		}
+		declared[key] = true
+		value, set := values[key]
+		_, hasDefault := defaults[key]
+		switch {
+		case set:
+			if value != "" {
+				value = maskValue(value)
+			}
+			lines = append(lines, "ARG "+arg.Name+"="+value+" (build_args)")
+		case hasDefault:
+			lines = append(lines, "ARG "+arg.Name+"="+defaults[key]+" (default)")
+		default:
+			lines = append(lines, ColorYellow+"ARG "+arg.Name+" is not set"+ColorReset)
+		}
+	}
+	for _, key := range sortedKeys(values) {
+		if !anywhere[key] {
+			lines = append(lines, ColorYellow+"build arg "+strings.ToUpper(key)+" is not declared in the Dockerfile"+ColorReset)
+		}
+	}
+	return lines
+}
+
+// planCheck describes a check evaluated while planning.
+// plannedDigestURI stands for the image the push stage would push.
+func (ecr *ECR) plannedDigestURI() string {
+	return ecr.repositoryURI() + "@<pushed digest>"
+}
+
+// planECSDiff compares the service's current task definition with the
+// revision the deploy stage would register.
+func (ecr *ECR) planECSDiff() []string {
+	c := ecr.Config.Deploy.ECS
+	service, err := ecr.describeECSService()
+	if err != nil {
+		return []string{ColorYellow + "task definition diff: " + err.Error() + ColorReset}
+	}
+	current, next, err := ecr.nextTaskDefinition(service.TaskDefinition, orDefault(c.Container, ecr.Config.Docker.ImageName), ecr.plannedDigestURI())
+	if err != nil {
+		return []string{ColorYellow + "task definition diff: " + err.Error() + ColorReset}
+	}
+	return append([]string{"task definition " + service.TaskDefinition + " → new revision:"}, jsonDiff(current, next)...)
+}
+
+// planLambdaDiff compares the function's current configuration and code
+// with what the deploy stage would leave.
+func (ecr *ECR) planLambdaDiff() []string {
+	c := ecr.Config.Deploy.Lambda
+	out, err := ecr.deployCLI(c.Region, "lambda", "get-function", "--function-name", c.FunctionName)
+	if err != nil {
+		return []string{ColorYellow + "function diff: " + err.Error() + ColorReset}
+	}
+	var current struct {
+		Configuration map[string]interface{} `json:"Configuration"`
+		Code          map[string]interface{} `json:"Code"`
+	}
+	if err := json.Unmarshal(out, &current); err != nil {
+		return []string{ColorYellow + "function diff: unexpected lambda get-function response: " + err.Error() + ColorReset}
+	}
+	next := current
+	next.Code = map[string]interface{}{}
+	for field, value := range current.Code {
+		next.Code[field] = value
+	}
+	next.Code["ImageUri"] = ecr.plannedDigestURI()
+	return append([]string{"function " + c.FunctionName + ":"}, jsonDiff(current, next)...)
+}
+
+// jsonDiff lists the fields that differ between two JSON documents, one per
+// line with its path: ~ for a changed value, + for an added one and - for a
+// removed one. Array elements with a name, such as container definitions
+// and environment variables, are identified by it instead of their index.
+func jsonDiff(before, after interface{}) []string {
+	a, b := flattenJSON(before), flattenJSON(after)
+	var lines []string
+	for _, path := range sortedKeys(a, b) {
+		was, inA := a[path]
+		now, inB := b[path]
+		switch {
+		case !inA:
+			lines = append(lines, ColorGreen+"+ "+path+": "+now+ColorReset)
+		case !inB:
+			lines = append(lines, ColorRed+"- "+path+": "+was+ColorReset)
+		case was != now:
+			lines = append(lines, ColorYellow+"~ "+path+": "+was+" → "+now+ColorReset)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "no changes")
+	}
+	return lines
+}
+
+// flattenJSON maps the path of every scalar value of a JSON document to the
+// value, JSON-encoded.
+func flattenJSON(document interface{}) map[string]string {
+	var value interface{}
+	if data, err := json.Marshal(document); err == nil {
+		json.Unmarshal(data, &value)
+	}
+	leaves := map[string]string{}
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, field := range v {
+				if path != "" {
+					key = path + "." + key
+				}
+				walk(key, field)
+			}
+		case []interface{}:
+			for i, item := range v {
+				index := strconv.Itoa(i)
+				if object, ok := item.(map[string]interface{}); ok {
+					if name, ok := object["name"].(string); ok {
+						index = name
+					}
+				}
+				walk(path+"["+index+"]", item)
+			}
+		default:
+			var encoded strings.Builder
+			encoder := json.NewEncoder(&encoded)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(v)
+			leaves[path] = strings.TrimSpace(encoded.String())
+		}
+	}
+	walk("", value)
+	return leaves
+}
+
+// planBaseImagePolicy lists the base image checks of the policy stage, with
+// the outcome of those that need no registry: resolving and pinning.
+func (ecr *ECR) planBaseImagePolicy() []string {
+	p := ecr.Config.Policy.BaseImages
+	if ecr.remoteContext() {
+		_, err := ecr.localDockerfile()
+		return []string{planCheck("base images", err)}
+	}
+	d, err := readDockerfile(ecr.dockerfilePath())
+	if err != nil {
+		return []string{planCheck("base images", err)}
+	}
+	bases, unresolved := d.resolvedBases(ecr.buildArgValues())
+	if len(unresolved) > 0 {
+		return []string{planCheck("base images", withCode(ErrCodePolicyViolation, errorf(KeyPolicyBaseUnresolved, unresolved)))}
+	}
+	var steps []string
+	if p.RequirePinned {
+		steps = append(steps, planCheck("base images pinned to a digest", checkPinnedBases(bases, p.Exempt, false)))
+	}
+	if p.RequireSignature {
+		var images []string
+		for _, from := range bases {
+			if !matchesAny(from.Image, p.Exempt) {
+				images = append(images, from.Image)
+			}
+		}
+		steps = append(steps, "cosign verify "+strings.Join(images, " ")+" and build from the verified digests")
+	}
+	return steps
+}
+
+func planCheck(description string, err error) string {
+	if err != nil {
+		return ColorRed + "✘ " + description + ": " + err.Error() + ColorReset
+	}
+	return ColorGreen + "✔ " + description + ColorReset
+}
+
+// shellJoin joins a command line, quoting the arguments a shell would split.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'$`\\*?;&|<>()") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lpmg.xyz/goscripts/ecrtest"
+)
+
+// registryOverride is PUSHECR_REGISTRY: a registry host used instead of the
+// ECR registry of every profile, such as the local one of pushecr e2e.
+var registryOverride = os.Getenv("PUSHECR_REGISTRY")
+
+// registryURL returns the URL of path in the registry API. Registries on a
+// loopback address are reached over plain HTTP, like Docker does.
+func (ecr *ECR) registryURL(path string) string {
+	host := ecr.registry()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" || net.ParseIP(host).IsLoopback() {
+		return "http://" + ecr.registry() + path
+	}
+	return "https://" + ecr.registry() + path
+}
+
+// e2eRepository is the repository the scenarios push to.
+const e2eRepository = "pushecr-e2e"
+
+// e2eConfig is the configuration the scenarios run with. The repository is
+// created by the first run, with immutable tags.
+const e2eConfig = `profiles:
+  e2e:
+    ecr:
+      region: us-east-1
+      account_id: "000000000000"
+      repository: ` + e2eRepository + `
+      image_tag: v1
+      create_if_missing: true
+      create:
+        tag_immutability: true
+    docker:
+      image_name: ` + e2eRepository + `
+`
+
+// e2eHarness runs this pushecr binary against a local ECR-compatible registry
+// (see package ecrtest), from a directory with a configuration and a
+// Dockerfile that builds without pulling anything.
+type e2eHarness struct {
+	srv    *ecrtest.Server
+	binary string
+	dir    string
+}
+
+// e2eScenario is one end-to-end check. Scenarios run in order against the
+// same registry, so each starts from the state the previous one left.
+type e2eScenario struct {
+	name string
+	run  func(h *e2eHarness) error
+}
+
+var e2eScenarios = []e2eScenario{
+	{"push creates the repository and pushes the image", func(h *e2eHarness) error {
+		out, err := h.pushecr("-digest-file", "digest.txt")
+		if err != nil {
+			return err
+		}
+		digest := h.srv.Tags(e2eRepository)["v1"]
+		if digest == "" {
+			return fmt.Errorf("v1 is not in the registry after the push:\n%s", out)
+		}
+		ref, err := os.ReadFile(filepath.Join(h.dir, "digest.txt"))
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(strings.TrimSpace(string(ref)), "@"+digest) {
+			return fmt.Errorf("-digest-file wrote %s, the registry has %s", strings.TrimSpace(string(ref)), digest)
+		}
+		return nil
+	}},
+	{"-skip-if-exists skips a tag already pushed", func(h *e2eHarness) error {
+		before := h.srv.Tags(e2eRepository)["v1"]
+		out, err := h.pushecr("-skip-if-exists")
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(out, "already exists in ECR") {
+			return fmt.Errorf("the run was not skipped:\n%s", out)
+		}
+		if after := h.srv.Tags(e2eRepository)["v1"]; after != before {
+			return fmt.Errorf("v1 moved from %s to %s", before, after)
+		}
+		return nil
+	}},
+	{"an immutable tag is not overwritten", func(h *e2eHarness) error {
+		before := h.srv.Tags(e2eRepository)["v1"]
+		if err := h.writeImage("changed"); err != nil {
+			return err
+		}
+		out, err := h.pushecr()
+		if err == nil {
+			return fmt.Errorf("the run succeeded:\n%s", out)
+		}
+		if !strings.Contains(out, "error-code: "+string(ErrCodeTagImmutable)) {
+			return fmt.Errorf("the run did not fail with %s:\n%s", ErrCodeTagImmutable, out)
+		}
+		if after := h.srv.Tags(e2eRepository)["v1"]; after != before {
+			return fmt.Errorf("v1 moved from %s to %s", before, after)
+		}
+		return nil
+	}},
+}
+
+func runE2E(args []string) {
+	fs := flag.NewFlagSet("e2e", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:0", "Address of the local registry, on a loopback interface so Docker uses plain HTTP")
+	keep := fs.Bool("keep", false, "Keep the working directory of the scenarios")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s e2e [-addr 127.0.0.1:0] [-keep]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	binary, err := os.Executable()
+	exitOnError("Could not find the pushecr binary", err)
+	dir, err := os.MkdirTemp("", "pushecr-e2e-*")
+	exitOnError("Could not create the working directory", err)
+	if *keep {
+		fmt.Println("Working directory: " + dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	srv, err := ecrtest.Start(*addr)
+	exitOnError("Could not start the local registry", err)
+	defer srv.Close()
+
+	h := &e2eHarness{srv: srv, binary: binary, dir: dir}
+	err = os.WriteFile(filepath.Join(dir, "deploy.yml"), []byte(e2eConfig), 0o644)
+	if err == nil {
+		err = h.writeImage(time.Now().UTC().Format(time.RFC3339Nano))
+	}
+	exitOnError("Could not create the working directory", err)
+
+	fmt.Println(ColorCyan + "Running the end-to-end scenarios against the local registry at " + srv.Addr() + ColorReset)
+	for i, scenario := range e2eScenarios {
+		started := time.Now()
+		err := scenario.run(h)
+		if err == nil {
+			fmt.Printf(ColorGreen+"✔ %s (%s)"+ColorReset+"\n", scenario.name, time.Since(started).Round(time.Millisecond))
+			continue
+		}
+		fmt.Printf(ColorRed+"✘ %s: %v"+ColorReset+"\n", scenario.name, err)
+		if rest := len(e2eScenarios) - i - 1; rest > 0 {
+			fmt.Printf(ColorYellow+"%d later scenario(s) not run: they start from the state this one leaves"+ColorReset+"\n", rest)
+		}
+		srv.Close()
+		if !*keep {
+			os.RemoveAll(dir)
+		}
+		exitOnError("End-to-end tests failed", withCode(ErrCodeE2EFailed, fmt.Errorf("scenario '%s' failed", scenario.name)))
+	}
+	fmt.Println(ColorGreen + "All end-to-end scenarios passed" + ColorReset)
+}
+
+// writeImage writes the Dockerfile of the image the scenarios push, which
+// copies a file with content into an empty image.
+func (h *e2eHarness) writeImage(content string) error {
+	if err := os.WriteFile(filepath.Join(h.dir, "message.txt"), []byte(content+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(h.dir, "Dockerfile"), []byte("FROM scratch\nCOPY message.txt /message.txt\n"), 0o644)
+}
+
+// pushecr runs the pipeline of the e2e profile with args, pointed at the local
+// registry, and returns its output. A run that exits with an error returns it
+// with the output.
+func (h *e2eHarness) pushecr(args ...string) (string, error) {
+	cmd := exec.Command(h.binary, append([]string{"-config", "deploy.yml", "-profile", "e2e"}, args...)...)
+	cmd.Dir = h.dir
+	cmd.Env = append(os.Environ(), h.srv.Env()...)
+	cmd.Env = append(cmd.Env, "AWS_REGION=us-east-1", "AWS_PAGER=")
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out.String(), fmt.Errorf("pushecr exited with %d:\n%s", exitErr.ExitCode(), out.String())
+	}
+	return out.String(), err
+}
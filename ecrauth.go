@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	ecrapi "github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+// registryTokens caches registry tokens by registry and identity (see
+// tokenCacheKey) for the duration of the process, so the logins, pushes and
+// layer mounts of a run, and every destination of a fan-out, ask ECR for each
+// token only once.
+var registryTokens = struct {
+	sync.Mutex
+	entries map[string]cachedToken
+}{entries: map[string]cachedToken{}}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenRefreshMargin renews cached tokens this long before they expire, so a
+// push never starts with a token about to run out.
+const tokenRefreshMargin = 30 * time.Minute
+
+// registryToken returns the basic auth credentials for the registry API, the
+// base64 of "AWS:<password>". It calls ECR's GetAuthorizationToken through the
+// SDK, so logging in does not need the aws CLI. Credentials come from the
+// usual chain: environment (including an assumed workspace role), shared
+// config files, SSO and instance or task roles, or from aws.profile and
+// ecr.assume_role_arn. ECR Public tokens come from its own API the same way.
+func (ecr *ECR) registryToken() (string, error) {
+	key := ecr.tokenCacheKey()
+	registryTokens.Lock()
+	cached, ok := registryTokens.entries[key]
+	registryTokens.Unlock()
+	if ok && time.Until(cached.expires) > tokenRefreshMargin {
+		return cached.token, nil
+	}
+
+	var err error
+	if ecr.Config.ECR.Public {
+		cached, err = ecr.publicToken()
+	} else {
+		cached, err = ecr.privateToken()
+	}
+	if err != nil {
+		return "", err
+	}
+	registryTokens.Lock()
+	registryTokens.entries[key] = cached
+	registryTokens.Unlock()
+	return cached.token, nil
+}
+
+// awsConfig loads the AWS SDK configuration of the profile in region: the
+// credentials of ecr.assume_role_arn, or of aws.profile, or the usual chain.
+func (ecr *ECR) awsConfig(ctx context.Context, region string) (aws.Config, error) {
+	creds, err := ecr.credentials()
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if creds == nil {
+		return loadAWSConfig(ctx, ecr.Config.AWS.Profile, region)
+	}
+	cfg, err := loadAWSConfig(ctx, "", region)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	cfg.Credentials = credentials.NewStaticCredentialsProvider(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken)
+	return cfg, nil
+}
+
+// tokenCacheKey is the key of the profile's token in registryTokens: the
+// registry and the identity asking for it, since a token carries the
+// permissions of whoever got it and profiles with their own aws.profile or
+// role must not share one.
+func (ecr *ECR) tokenCacheKey() string {
+	c := ecr.Config.ECR
+	return strings.Join([]string{
+		ecr.registry(),
+		ecr.Config.AWS.Profile,
+		c.AssumeRoleARN, c.ExternalID, c.RoleSessionName,
+		os.Getenv("AWS_ACCESS_KEY_ID"),
+	}, "\x00")
+}
+
+// forgetRegistryToken drops the cached token of the profile's registry, which
+// the registry rejected as expired before the cache would have renewed it.
+func (ecr *ECR) forgetRegistryToken() {
+	registryTokens.Lock()
+	delete(registryTokens.entries, ecr.tokenCacheKey())
+	registryTokens.Unlock()
+}
+
+// privateToken calls GetAuthorizationToken of the private registry.
+func (ecr *ECR) privateToken() (cachedToken, error) {
+	ctx := ecr.context()
+	cfg, err := ecr.awsConfig(ctx, ecr.Config.ECR.Region)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	if err := awsLimiter.wait(ctx); err != nil {
+		return cachedToken{}, err
+	}
+	out, err := ecrapi.NewFromConfig(cfg).GetAuthorizationToken(ctx, &ecrapi.GetAuthorizationTokenInput{})
+	if err != nil {
+		return cachedToken{}, classify(ErrCodeAuthFailed, "", errorf(KeyTokenFailed, err))
+	}
+	awsLimiter.succeeded()
+	if len(out.AuthorizationData) == 0 || out.AuthorizationData[0].AuthorizationToken == nil {
+		return cachedToken{}, errorf(KeyTokenBadResponse)
+	}
+	data := out.AuthorizationData[0]
+	token := cachedToken{token: *data.AuthorizationToken, expires: time.Now().Add(12 * time.Hour)}
+	if data.ExpiresAt != nil {
+		token.expires = *data.ExpiresAt
+	}
+	return token, nil
+}
+
+// prefetchRegistryTokens fetches the tokens of every distinct registry of
+// ecrs concurrently, so fanning out to several accounts or regions does not
+// wait for one token after another. It returns the first error.
+func prefetchRegistryTokens(ecrs ...*ECR) error {
+	seen := map[string]bool{}
+	errs := make(chan error, len(ecrs))
+	var wg sync.WaitGroup
+	for _, ecr := range ecrs {
+		if seen[ecr.tokenCacheKey()] {
+			continue
+		}
+		seen[ecr.tokenCacheKey()] = true
+		wg.Add(1)
+		go func(ecr *ECR) {
+			defer wg.Done()
+			if _, err := ecr.registryToken(); err != nil {
+				errs <- fmt.Errorf("%s: %w", ecr.registry(), err)
+			}
+		}(ecr)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// registryCredentials decodes the registry token into user and password.
+func (ecr *ECR) registryCredentials() (string, string, error) {
+	token, err := ecr.registryToken()
+	if err != nil {
+		return "", "", err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", errorf(KeyTokenDecodeFailed, err)
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", errorf(KeyTokenBadResponse)
+	}
+	return user, password, nil
+}
@@ -0,0 +1,413 @@
+package ecrtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiPrefix prefixes the X-Amz-Target header of the ECR API operations.
+const apiPrefix = "AmazonEC2ContainerRegistry_V20150921."
+
+// apiInput holds the parameters of every operation served; each reads the
+// ones it takes.
+type apiInput struct {
+	RepositoryName         string    `json:"repositoryName"`
+	RepositoryNames        []string  `json:"repositoryNames"`
+	ImageTagMutability     string    `json:"imageTagMutability"`
+	ImageIDs               []imageID `json:"imageIds"`
+	ImageManifest          string    `json:"imageManifest"`
+	ImageManifestMediaType string    `json:"imageManifestMediaType"`
+	ImageTag               string    `json:"imageTag"`
+	ImageDigest            string    `json:"imageDigest"`
+	LayerDigests           []string  `json:"layerDigests"`
+	LayerDigest            string    `json:"layerDigest"`
+}
+
+type imageID struct {
+	ImageDigest string `json:"imageDigest,omitempty"`
+	ImageTag    string `json:"imageTag,omitempty"`
+}
+
+// apiError is an error of the ECR API, reported by the aws CLI as
+// "An error occurred (<Type>) when calling the <Operation> operation".
+type apiError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string { return e.Type + ": " + e.Message }
+
+// serveAPI serves the ECR API operations pushecr calls, in the awsJson1_1
+// protocol of the aws CLI and the SDK. Requests must be signed, but the
+// signature is not checked.
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	operation, ok := strings.CutPrefix(r.Header.Get("X-Amz-Target"), apiPrefix)
+	if !ok {
+		writeAPIError(w, &apiError{"UnknownOperationException", "unknown target " + r.Header.Get("X-Amz-Target")})
+		return
+	}
+	if r.Header.Get("Authorization") == "" {
+		writeAPIError(w, &apiError{"MissingAuthenticationTokenException", "Missing Authentication Token"})
+		return
+	}
+	var input apiInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeAPIError(w, &apiError{"SerializationException", err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var output any
+	var err *apiError
+	switch operation {
+	case "GetAuthorizationToken":
+		output = s.getAuthorizationToken()
+	case "CreateRepository":
+		output, err = s.apiCreateRepository(input)
+	case "DescribeRepositories":
+		output, err = s.describeRepositories(input)
+	case "DescribeImages":
+		output, err = s.describeImages(input)
+	case "ListImages":
+		output, err = s.listImages(input)
+	case "BatchGetImage":
+		output, err = s.batchGetImage(input)
+	case "PutImage":
+		output, err = s.putImage(input)
+	case "BatchDeleteImage":
+		output, err = s.batchDeleteImage(input)
+	case "BatchCheckLayerAvailability":
+		output, err = s.batchCheckLayerAvailability(input)
+	case "GetDownloadUrlForLayer":
+		output, err = s.getDownloadURLForLayer(input)
+	default:
+		err = &apiError{"UnknownOperationException", "ecrtest does not implement " + operation}
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(output)
+}
+
+func writeAPIError(w http.ResponseWriter, err *apiError) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(err)
+}
+
+// epoch formats t as the API does, in seconds since the epoch.
+func epoch(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+func (s *Server) getAuthorizationToken() any {
+	password := randomID()
+	expires := time.Now().Add(s.TokenTTL)
+	s.tokens[password] = expires
+	return map[string]any{
+		"authorizationData": []map[string]any{{
+			"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:" + password)),
+			"expiresAt":          epoch(expires),
+			"proxyEndpoint":      s.URL(),
+		}},
+	}
+}
+
+// lookup returns a repository or the RepositoryNotFoundException ECR returns.
+func (s *Server) lookup(name string) (*repository, *apiError) {
+	repo, ok := s.repos[name]
+	if !ok {
+		return nil, &apiError{"RepositoryNotFoundException",
+			fmt.Sprintf("The repository with name '%s' does not exist in the registry with id '%s'", name, s.AccountID)}
+	}
+	return repo, nil
+}
+
+func (s *Server) repositoryOutput(repo *repository) map[string]any {
+	mutability := "MUTABLE"
+	if repo.immutable {
+		mutability = "IMMUTABLE"
+	}
+	return map[string]any{
+		"repositoryArn":              fmt.Sprintf("arn:aws:ecr:%s:%s:repository/%s", s.Region, s.AccountID, repo.name),
+		"registryId":                 s.AccountID,
+		"repositoryName":             repo.name,
+		"repositoryUri":              s.Addr() + "/" + repo.name,
+		"createdAt":                  epoch(repo.createdAt),
+		"imageTagMutability":         mutability,
+		"imageScanningConfiguration": map[string]bool{"scanOnPush": false},
+		"encryptionConfiguration":    map[string]string{"encryptionType": "AES256"},
+	}
+}
+
+func (s *Server) apiCreateRepository(input apiInput) (any, *apiError) {
+	if _, ok := s.repos[input.RepositoryName]; ok {
+		return nil, &apiError{"RepositoryAlreadyExistsException",
+			fmt.Sprintf("The repository with name '%s' already exists in the registry with id '%s'", input.RepositoryName, s.AccountID)}
+	}
+	if input.RepositoryName == "" {
+		return nil, &apiError{"InvalidParameterException", "repositoryName is required"}
+	}
+	repo := s.createRepository(input.RepositoryName, input.ImageTagMutability == "IMMUTABLE")
+	return map[string]any{"repository": s.repositoryOutput(repo)}, nil
+}
+
+func (s *Server) describeRepositories(input apiInput) (any, *apiError) {
+	names := input.RepositoryNames
+	if len(names) == 0 {
+		for name := range s.repos {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	repositories := []map[string]any{}
+	for _, name := range names {
+		repo, err := s.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, s.repositoryOutput(repo))
+	}
+	return map[string]any{"repositories": repositories}, nil
+}
+
+// images returns the images ids select, or every image of repo when ids is
+// empty, most recently pushed first.
+func (s *Server) images(repo *repository, ids []imageID) ([]*image, *apiError) {
+	var images []*image
+	if len(ids) == 0 {
+		for _, img := range repo.images {
+			images = append(images, img)
+		}
+		sort.Slice(images, func(i, j int) bool { return images[i].pushedAt.After(images[j].pushedAt) })
+		return images, nil
+	}
+	for _, id := range ids {
+		img := repo.resolveID(id)
+		if img == nil {
+			return nil, &apiError{"ImageNotFoundException", fmt.Sprintf(
+				"The image with imageId {imageDigest:'%s', imageTag:'%s'} does not exist within the repository with name '%s' in the registry with id '%s'",
+				orNull(id.ImageDigest), orNull(id.ImageTag), repo.name, s.AccountID)}
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func (s *Server) describeImages(input apiInput) (any, *apiError) {
+	repo, err := s.lookup(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	images, err := s.images(repo, input.ImageIDs)
+	if err != nil {
+		return nil, err
+	}
+	details := []map[string]any{}
+	for _, img := range images {
+		detail := map[string]any{
+			"registryId":             s.AccountID,
+			"repositoryName":         repo.name,
+			"imageDigest":            img.digest,
+			"imageSizeInBytes":       img.size(),
+			"imagePushedAt":          epoch(img.pushedAt),
+			"imageManifestMediaType": img.mediaType,
+		}
+		if tags := repo.tagsOf(img.digest); len(tags) > 0 {
+			detail["imageTags"] = tags
+		}
+		details = append(details, detail)
+	}
+	return map[string]any{"imageDetails": details}, nil
+}
+
+func (s *Server) listImages(input apiInput) (any, *apiError) {
+	repo, err := s.lookup(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	ids := []imageID{}
+	for digest := range repo.images {
+		tags := repo.tagsOf(digest)
+		if len(tags) == 0 {
+			ids = append(ids, imageID{ImageDigest: digest})
+		}
+		for _, tag := range tags {
+			ids = append(ids, imageID{ImageDigest: digest, ImageTag: tag})
+		}
+	}
+	return map[string]any{"imageIds": ids}, nil
+}
+
+func (s *Server) batchGetImage(input apiInput) (any, *apiError) {
+	repo, err := s.lookup(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	images := []map[string]any{}
+	failures := []map[string]any{}
+	for _, id := range input.ImageIDs {
+		img := repo.resolveID(id)
+		if img == nil {
+			failures = append(failures, map[string]any{"imageId": id, "failureCode": "ImageNotFound", "failureReason": "Requested image not found"})
+			continue
+		}
+		images = append(images, s.imageOutput(repo, img, id.ImageTag))
+	}
+	return map[string]any{"images": images, "failures": failures}, nil
+}
+
+func (s *Server) putImage(input apiInput) (any, *apiError) {
+	repo, err := s.lookup(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(input.ImageManifest)
+	digest := digestOf(data)
+	if input.ImageDigest != "" && input.ImageDigest != digest {
+		return nil, &apiError{"ImageDigestDoesNotMatchException", "The specified image digest does not match the digest that Amazon ECR calculated for the image."}
+	}
+	if current, ok := repo.tags[input.ImageTag]; ok && current == digest || input.ImageTag == "" && repo.images[digest] != nil {
+		return nil, &apiError{"ImageAlreadyExistsException", fmt.Sprintf(
+			"Image with digest '%s' and tag '%s' already exists in the repository with name '%s' in registry with id '%s'",
+			digest, input.ImageTag, repo.name, s.AccountID)}
+	}
+	if missing := repo.missingReferences(data); missing != "" {
+		return nil, &apiError{"LayersNotFoundException", "The image contains layers or manifests that are not in the repository: " + missing}
+	}
+	img, putErr := repo.put(data, input.ImageManifestMediaType, input.ImageTag)
+	if putErr != nil {
+		return nil, &apiError{"ImageTagAlreadyExistsException", putErr.Error()}
+	}
+	return map[string]any{"image": s.imageOutput(repo, img, input.ImageTag)}, nil
+}
+
+func (s *Server) batchDeleteImage(input apiInput) (any, *apiError) {
+	repo, err := s.lookup(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []imageID{}
+	failures := []map[string]any{}
+	for _, id := range input.ImageIDs {
+		img := repo.resolveID(id)
+		if img == nil {
+			failures = append(failures, map[string]any{"imageId": id, "failureCode": "ImageNotFound", "failureReason": "Requested image not found"})
+			continue
+		}
+		if id.ImageTag != "" {
+			// Deleting a tag leaves the image untagged, like ECR.
+			delete(repo.tags, id.ImageTag)
+			deleted = append(deleted, imageID{ImageDigest: img.digest, ImageTag: id.ImageTag})
+			continue
+		}
+		for _, tag := range repo.tagsOf(img.digest) {
+			delete(repo.tags, tag)
+		}
+		delete(repo.images, img.digest)
+		deleted = append(deleted, imageID{ImageDigest: img.digest})
+	}
+	return map[string]any{"imageIds": deleted, "failures": failures}, nil
+}
+
+// batchCheckLayerAvailability reports the layers pushed or mounted into the
+// repository as available and the others as failures, like ECR.
+func (s *Server) batchCheckLayerAvailability(input apiInput) (any, *apiError) {
+	repo, err := s.lookup(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	layers, failures := []map[string]any{}, []map[string]any{}
+	for _, digest := range input.LayerDigests {
+		if !repo.blobs[digest] {
+			failures = append(failures, map[string]any{
+				"layerDigest":   digest,
+				"failureCode":   "MissingLayerDigest",
+				"failureReason": "Could not find layer",
+			})
+			continue
+		}
+		layers = append(layers, map[string]any{
+			"layerDigest":       digest,
+			"layerAvailability": "AVAILABLE",
+			"layerSize":         len(s.blobs[digest]),
+		})
+	}
+	return map[string]any{"layers": layers, "failures": failures}, nil
+}
+
+// getDownloadURLForLayer returns the URL of a blob under /layers/, which
+// stands in for the pre-signed S3 URL ECR hands out and needs no auth.
+func (s *Server) getDownloadURLForLayer(input apiInput) (any, *apiError) {
+	repo, err := s.lookup(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	if !repo.blobs[input.LayerDigest] {
+		return nil, &apiError{"LayersNotFoundException", fmt.Sprintf(
+			"The layer with digest '%s' does not exist in the repository with name '%s' in the registry with id '%s'",
+			input.LayerDigest, repo.name, s.AccountID)}
+	}
+	return map[string]any{
+		"downloadUrl": s.URL() + "/layers/" + input.LayerDigest,
+		"layerDigest": input.LayerDigest,
+	}, nil
+}
+
+func (s *Server) imageOutput(repo *repository, img *image, tag string) map[string]any {
+	return map[string]any{
+		"registryId":             s.AccountID,
+		"repositoryName":         repo.name,
+		"imageId":                imageID{ImageDigest: img.digest, ImageTag: tag},
+		"imageManifest":          string(img.data),
+		"imageManifestMediaType": img.mediaType,
+	}
+}
+
+// resolveID returns the image an API image ID selects, or nil. With both a
+// digest and a tag, the tag must point to the digest.
+func (r *repository) resolveID(id imageID) *image {
+	switch {
+	case id.ImageTag != "" && id.ImageDigest != "":
+		if r.tags[id.ImageTag] != id.ImageDigest {
+			return nil
+		}
+		return r.images[id.ImageDigest]
+	case id.ImageTag != "":
+		return r.resolve(id.ImageTag)
+	case id.ImageDigest != "":
+		return r.images[id.ImageDigest]
+	}
+	return nil
+}
+
+// size returns the compressed size of the image's layers, the size ECR
+// reports.
+func (img *image) size() int64 {
+	var m struct {
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+	}
+	json.Unmarshal(img.data, &m)
+	var size int64
+	for _, layer := range m.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+func orNull(value string) string {
+	if value == "" {
+		return "null"
+	}
+	return value
+}
@@ -0,0 +1,265 @@
+// Package ecrtest runs an in-memory registry that behaves like Amazon ECR for
+// the calls pushecr makes: the OCI distribution API behind ECR's basic auth,
+// and the ECR API operations for authorization tokens, repositories, images
+// and layers. It backs pushecr e2e, and lets programs that drive pushecr run a
+// full pipeline in CI without an AWS account:
+//
+//	srv, err := ecrtest.Start("127.0.0.1:0")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer srv.Close()
+//	srv.CreateRepository("app", false)
+//	cmd := exec.Command("pushecr", "-config", "deploy.yml", "-profile", "ci")
+//	cmd.Env = append(os.Environ(), srv.Env()...)
+//
+// The aws CLI and the AWS SDK reach the ECR API through AWS_ENDPOINT_URL_ECR,
+// and pushecr uses the registry host instead of the profile's
+// <account>.dkr.ecr.<region>.amazonaws.com through PUSHECR_REGISTRY. Docker
+// talks plain HTTP to registries on loopback addresses, so the server must
+// listen on one for docker login and docker push to work.
+package ecrtest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a running fake ECR. Its fields must be set before the first
+// request.
+type Server struct {
+	// AccountID is the registry ID the API reports, 000000000000 by default.
+	AccountID string
+	// Region is the region of the repository ARNs, us-east-1 by default.
+	Region string
+	// TokenTTL is how long the tokens of GetAuthorizationToken are valid,
+	// 12 hours by default, like ECR's.
+	TokenTTL time.Duration
+
+	listener net.Listener
+	server   *http.Server
+
+	mu      sync.Mutex
+	repos   map[string]*repository
+	blobs   map[string][]byte // by digest, shared by every repository
+	uploads map[string]*upload
+	tokens  map[string]time.Time // expiry by password
+}
+
+type repository struct {
+	name      string
+	immutable bool
+	createdAt time.Time
+	blobs     map[string]bool   // digests pushed or mounted into the repository
+	images    map[string]*image // by digest
+	tags      map[string]string // digest by tag
+}
+
+type image struct {
+	digest    string
+	mediaType string
+	data      []byte
+	pushedAt  time.Time
+}
+
+// Start listens on addr, such as 127.0.0.1:0 for a free port, and serves
+// until Close.
+func Start(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		AccountID: "000000000000",
+		Region:    "us-east-1",
+		TokenTTL:  12 * time.Hour,
+		listener:  listener,
+		repos:     map[string]*repository{},
+		blobs:     map[string][]byte{},
+		uploads:   map[string]*upload{},
+		tokens:    map[string]time.Time{},
+	}
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 30 * time.Second}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// ServeHTTP sends requests with an X-Amz-Target header to the ECR API,
+// those under /v2/ to the registry and those under /layers/ to the blob
+// downloads of GetDownloadUrlForLayer.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Header.Get("X-Amz-Target") != "":
+		s.serveAPI(w, r)
+	case r.URL.Path == "/v2" || strings.HasPrefix(r.URL.Path, "/v2/"):
+		s.serveRegistry(w, r)
+	case strings.HasPrefix(r.URL.Path, "/layers/"):
+		s.mu.Lock()
+		data, ok := s.blobs[strings.TrimPrefix(r.URL.Path, "/layers/")]
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Addr returns the host:port of the registry, the host of its image
+// references.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return "http://" + s.Addr()
+}
+
+// Env returns the environment that points pushecr, the aws CLI and the AWS
+// SDK at the server, with placeholder credentials.
+func (s *Server) Env() []string {
+	return []string{
+		"AWS_ENDPOINT_URL_ECR=" + s.URL(),
+		"PUSHECR_REGISTRY=" + s.Addr(),
+		"AWS_ACCESS_KEY_ID=ecrtest",
+		"AWS_SECRET_ACCESS_KEY=ecrtest",
+		"AWS_EC2_METADATA_DISABLED=true",
+	}
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// CreateRepository creates a repository, like ecr create-repository. It does
+// nothing if the repository exists.
+func (s *Server) CreateRepository(name string, immutable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createRepository(name, immutable)
+}
+
+func (s *Server) createRepository(name string, immutable bool) *repository {
+	if repo, ok := s.repos[name]; ok {
+		return repo
+	}
+	repo := &repository{
+		name:      name,
+		immutable: immutable,
+		createdAt: time.Now().UTC(),
+		blobs:     map[string]bool{},
+		images:    map[string]*image{},
+		tags:      map[string]string{},
+	}
+	s.repos[name] = repo
+	return repo
+}
+
+// PutImage stores blobs in repository and puts manifest, which references
+// them, with tag if not empty, like a docker push. It returns the manifest
+// digest.
+func (s *Server) PutImage(repository, tag string, manifest []byte, blobs ...[]byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo, apiErr := s.lookup(repository)
+	if apiErr != nil {
+		return "", apiErr
+	}
+	for _, data := range blobs {
+		digest := digestOf(data)
+		s.blobs[digest] = bytes.Clone(data)
+		repo.blobs[digest] = true
+	}
+	if missing := repo.missingReferences(manifest); missing != "" {
+		return "", fmt.Errorf("manifest references %s, which is not in %s", missing, repository)
+	}
+	img, err := repo.put(manifest, "", tag)
+	if err != nil {
+		return "", err
+	}
+	return img.digest, nil
+}
+
+// Repositories returns the names of the repositories, sorted.
+func (s *Server) Repositories() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.repos))
+	for name := range s.repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tags returns the digest each tag of repository points to.
+func (s *Server) Tags(repository string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tags := map[string]string{}
+	if repo, ok := s.repos[repository]; ok {
+		for tag, digest := range repo.tags {
+			tags[tag] = digest
+		}
+	}
+	return tags
+}
+
+// Manifest returns the manifest a tag or digest of repository points to, with
+// its media type.
+func (s *Server) Manifest(repository, reference string) (data []byte, mediaType string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo, ok := s.repos[repository]
+	if !ok {
+		return nil, "", false
+	}
+	img := repo.resolve(reference)
+	if img == nil {
+		return nil, "", false
+	}
+	return img.data, img.mediaType, true
+}
+
+// ExpireTokens makes every token issued so far expire, so the next registry
+// request fails like it does with ECR once a docker login is 12 hours old.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for password := range s.tokens {
+		s.tokens[password] = time.Now().Add(-time.Second)
+	}
+}
+
+// resolve returns the image a tag or digest points to, or nil.
+func (r *repository) resolve(reference string) *image {
+	if strings.HasPrefix(reference, "sha256:") {
+		return r.images[reference]
+	}
+	if digest, ok := r.tags[reference]; ok {
+		return r.images[digest]
+	}
+	return nil
+}
+
+// tagsOf returns the tags pointing to digest, sorted.
+func (r *repository) tagsOf(digest string) []string {
+	var tags []string
+	for tag, d := range r.tags {
+		if d == digest {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
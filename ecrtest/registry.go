@@ -0,0 +1,351 @@
+package ecrtest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxManifestSize is the largest manifest accepted, like ECR's limit.
+const maxManifestSize = 4 << 20
+
+// upload is a blob upload in progress.
+type upload struct {
+	repository string
+	data       bytes.Buffer
+}
+
+// serveRegistry serves the OCI distribution API, with ECR's semantics: basic
+// auth with the user AWS and a token from GetAuthorizationToken, pushes only
+// to existing repositories and immutable tags that cannot be overwritten.
+func (s *Server) serveRegistry(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v2")
+	if path == "" || path == "/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	path = strings.TrimPrefix(path, "/")
+	if name, id, ok := cutLast(path, "/blobs/uploads"); ok {
+		s.serveUpload(w, r, name, strings.TrimPrefix(id, "/"))
+		return
+	}
+	if name, digest, ok := cutLast(path, "/blobs/"); ok {
+		s.serveBlob(w, r, name, digest)
+		return
+	}
+	if name, reference, ok := cutLast(path, "/manifests/"); ok {
+		s.serveManifest(w, r, name, reference)
+		return
+	}
+	if name, ok := strings.CutSuffix(path, "/tags/list"); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		repo := s.repository(w, name)
+		if repo == nil {
+			return
+		}
+		tags := []string{}
+		for tag := range repo.tags {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		writeJSON(w, http.StatusOK, map[string]any{"name": name, "tags": tags})
+		return
+	}
+	registryError(w, http.StatusNotFound, "UNSUPPORTED", "The operation is unsupported.")
+}
+
+// authorized checks the basic auth of a registry request, answering it when
+// the credentials are missing, unknown or expired.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	s.mu.Lock()
+	expires, known := s.tokens[password]
+	s.mu.Unlock()
+	switch {
+	case !ok || user != "AWS" || !known:
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s/",service="ecr.amazonaws.com"`, s.URL()))
+		registryError(w, http.StatusUnauthorized, "DENIED", "Not Authorized")
+		return false
+	case time.Now().After(expires):
+		registryError(w, http.StatusForbidden, "DENIED", "Your authorization token has expired. Reauthenticate and try again.")
+		return false
+	}
+	return true
+}
+
+// repository returns the repository name, answering the request when it does
+// not exist. s.mu must be held.
+func (s *Server) repository(w http.ResponseWriter, name string) *repository {
+	repo, ok := s.repos[name]
+	if !ok {
+		registryError(w, http.StatusNotFound, "NAME_UNKNOWN",
+			fmt.Sprintf("The repository with name '%s' does not exist in the registry with id '%s'", name, s.AccountID))
+	}
+	return repo
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, name, id string) {
+	// The body is read before taking the lock, so uploads of several layers
+	// do not wait for each other.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		registryError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo := s.repository(w, name)
+	if repo == nil {
+		return
+	}
+	query := r.URL.Query()
+
+	if id == "" {
+		if r.Method != http.MethodPost {
+			registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "The operation is unsupported.")
+			return
+		}
+		if digest, from := query.Get("mount"), query.Get("from"); digest != "" {
+			if source, ok := s.repos[from]; ok && source.blobs[digest] {
+				repo.blobs[digest] = true
+				blobCreated(w, name, digest)
+				return
+			}
+		}
+		if digest := query.Get("digest"); digest != "" {
+			s.storeBlob(w, repo, digest, body)
+			return
+		}
+		id = randomID()
+		s.uploads[id] = &upload{repository: name}
+		uploadStatus(w, http.StatusAccepted, name, id, 0)
+		return
+	}
+
+	u, ok := s.uploads[id]
+	if !ok || u.repository != name {
+		registryError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		uploadStatus(w, http.StatusNoContent, name, id, u.data.Len())
+	case http.MethodPatch:
+		u.data.Write(body)
+		uploadStatus(w, http.StatusAccepted, name, id, u.data.Len())
+	case http.MethodPut:
+		u.data.Write(body)
+		delete(s.uploads, id)
+		s.storeBlob(w, repo, query.Get("digest"), u.data.Bytes())
+	case http.MethodDelete:
+		delete(s.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "The operation is unsupported.")
+	}
+}
+
+// storeBlob stores data as digest in repo after checking it.
+func (s *Server) storeBlob(w http.ResponseWriter, repo *repository, digest string, data []byte) {
+	if digest != digestOf(data) {
+		registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+		return
+	}
+	s.blobs[digest] = bytes.Clone(data)
+	repo.blobs[digest] = true
+	blobCreated(w, repo.name, digest)
+}
+
+func (s *Server) serveBlob(w http.ResponseWriter, r *http.Request, name, digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo := s.repository(w, name)
+	if repo == nil {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "The operation is unsupported.")
+		return
+	}
+	if !repo.blobs[digest] {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	data := s.blobs[digest]
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+func (s *Server) serveManifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo := s.repository(w, name)
+	if repo == nil {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		img := repo.resolve(reference)
+		if img == nil {
+			registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "Requested image not found")
+			return
+		}
+		w.Header().Set("Content-Type", img.mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(img.data)))
+		w.Header().Set("Docker-Content-Digest", img.digest)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(img.data)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+		if err != nil || len(data) > maxManifestSize {
+			registryError(w, http.StatusBadRequest, "MANIFEST_INVALID", "manifest invalid")
+			return
+		}
+		mediaType := r.Header.Get("Content-Type")
+		if missing := repo.missingReferences(data); missing != "" {
+			registryError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "blob unknown to registry: "+missing)
+			return
+		}
+		tag := reference
+		if strings.HasPrefix(reference, "sha256:") {
+			if reference != digestOf(data) {
+				registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+				return
+			}
+			tag = ""
+		}
+		img, err := repo.put(data, mediaType, tag)
+		if err != nil {
+			registryError(w, http.StatusBadRequest, "TAG_INVALID", err.Error())
+			return
+		}
+		w.Header().Set("Location", "/v2/"+name+"/manifests/"+img.digest)
+		w.Header().Set("Docker-Content-Digest", img.digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "The operation is unsupported.")
+	}
+}
+
+// missingReferences returns the first blob or manifest data references that
+// is not in r, or "".
+func (r *repository) missingReferences(data []byte) string {
+	var m struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "manifest is not valid JSON"
+	}
+	if d := m.Config.Digest; d != "" && !r.blobs[d] {
+		return d
+	}
+	for _, layer := range m.Layers {
+		if !r.blobs[layer.Digest] {
+			return layer.Digest
+		}
+	}
+	for _, child := range m.Manifests {
+		if r.images[child.Digest] == nil {
+			return child.Digest
+		}
+	}
+	return ""
+}
+
+// put stores a manifest and points tag, if not empty, to it. In an immutable
+// repository an existing tag cannot be moved to another image.
+func (r *repository) put(data []byte, mediaType, tag string) (*image, error) {
+	digest := digestOf(data)
+	if current, ok := r.tags[tag]; ok && r.immutable && current != digest {
+		return nil, fmt.Errorf("The image tag '%s' already exists in the '%s' repository and cannot be overwritten because the repository is immutable.", tag, r.name)
+	}
+	if mediaType == "" {
+		var m struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal(data, &m)
+		mediaType = m.MediaType
+	}
+	img, ok := r.images[digest]
+	if !ok {
+		img = &image{digest: digest, mediaType: mediaType, data: bytes.Clone(data), pushedAt: time.Now().UTC()}
+		r.images[digest] = img
+	}
+	if tag != "" {
+		r.tags[tag] = digest
+	}
+	return img, nil
+}
+
+func blobCreated(w http.ResponseWriter, name, digest string) {
+	w.Header().Set("Location", "/v2/"+name+"/blobs/"+digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func uploadStatus(w http.ResponseWriter, status int, name, id string, size int) {
+	w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+id)
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", max(size-1, 0)))
+	w.WriteHeader(status)
+}
+
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// cutLast splits path around the last occurrence of sep.
+func cutLast(path, sep string) (before, after string, ok bool) {
+	i := strings.LastIndex(path, sep)
+	if i <= 0 {
+		return "", "", false
+	}
+	return path[:i], path[i+len(sep):], true
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorCode is a stable identifier for a class of failure. Codes are part of
+// the public interface: wrappers match on them to decide whether to retry or
+// alert, so existing values must never be renamed.
+type ErrorCode string
+
+const (
+	ErrCodeUnknown            ErrorCode = "PUSHECR_UNKNOWN"
+	ErrCodeConfigNotFound     ErrorCode = "PUSHECR_CONFIG_NOT_FOUND"
+	ErrCodeConfigInvalid      ErrorCode = "PUSHECR_CONFIG_INVALID"
+	ErrCodeProfileNotFound    ErrorCode = "PUSHECR_PROFILE_NOT_FOUND"
+	ErrCodeAWSCLIMissing      ErrorCode = "PUSHECR_AWS_CLI_MISSING"
+	ErrCodeCredentialsMissing ErrorCode = "PUSHECR_CREDENTIALS_MISSING"
+	ErrCodeAuthFailed         ErrorCode = "PUSHECR_AUTH_FAILED"
+	ErrCodeAuthExpired        ErrorCode = "PUSHECR_AUTH_EXPIRED"
+	ErrCodeAccessDenied       ErrorCode = "PUSHECR_ACCESS_DENIED"
+	ErrCodeRepoNotFound       ErrorCode = "PUSHECR_REPO_NOT_FOUND"
+	ErrCodeTagImmutable       ErrorCode = "PUSHECR_TAG_IMMUTABLE"
+	ErrCodeThrottled          ErrorCode = "PUSHECR_THROTTLED"
+	ErrCodeDockerUnavailable  ErrorCode = "PUSHECR_DOCKER_UNAVAILABLE"
+	ErrCodeDiskFull           ErrorCode = "PUSHECR_DISK_FULL"
+	ErrCodeImageNotFound      ErrorCode = "PUSHECR_IMAGE_NOT_FOUND"
+	ErrCodeBuildFailed        ErrorCode = "PUSHECR_BUILD_FAILED"
+	ErrCodeTagFailed          ErrorCode = "PUSHECR_TAG_FAILED"
+	ErrCodePushFailed         ErrorCode = "PUSHECR_PUSH_FAILED"
+	ErrCodeVerifyFailed       ErrorCode = "PUSHECR_VERIFY_FAILED"
+	ErrCodePolicyViolation    ErrorCode = "PUSHECR_POLICY_VIOLATION"
+	ErrCodeToolRequirement    ErrorCode = "PUSHECR_TOOL_REQUIREMENT"
+	ErrCodeReadOnly           ErrorCode = "PUSHECR_READ_ONLY"
+	ErrCodeEmulationMissing   ErrorCode = "PUSHECR_EMULATION_MISSING"
+	ErrCodeApprovalDenied     ErrorCode = "PUSHECR_APPROVAL_DENIED"
+	ErrCodeHookFailed         ErrorCode = "PUSHECR_HOOK_FAILED"
+	ErrCodeDeployFailed       ErrorCode = "PUSHECR_DEPLOY_FAILED"
+	ErrCodeE2EFailed          ErrorCode = "PUSHECR_E2E_FAILED"
+	ErrCodeFaultInjected      ErrorCode = "PUSHECR_FAULT_INJECTED"
+	ErrCodeStageTimeout       ErrorCode = "PUSHECR_STAGE_TIMEOUT"
+	ErrCodeScanFailed         ErrorCode = "PUSHECR_SCAN_FAILED"
+	ErrCodeVulnerabilities    ErrorCode = "PUSHECR_VULNERABILITIES"
+	ErrCodeSignFailed         ErrorCode = "PUSHECR_SIGN_FAILED"
+)
+
+// errorCatalog documents every code. Keep it in sync with the readme.
+var errorCatalog = []struct {
+	Code        ErrorCode
+	Retryable   bool
+	Description string
+}{
+	{ErrCodeUnknown, false, "Unclassified failure"},
+	{ErrCodeConfigNotFound, false, "The configuration file does not exist or cannot be read"},
+	{ErrCodeConfigInvalid, false, "The configuration file or the selected profile is invalid"},
+	{ErrCodeProfileNotFound, false, "The requested profile is not defined in the configuration"},
+	{ErrCodeAWSCLIMissing, false, "The aws CLI is not installed or not in PATH"},
+	{ErrCodeCredentialsMissing, false, "No AWS credentials could be found"},
+	{ErrCodeAuthFailed, false, "Docker could not log in to the ECR registry"},
+	{ErrCodeAuthExpired, true, "The AWS session or the ECR authorization token has expired"},
+	{ErrCodeAccessDenied, false, "The AWS identity is not allowed to perform the operation"},
+	{ErrCodeRepoNotFound, false, "The ECR repository does not exist"},
+	{ErrCodeTagImmutable, false, "The tag already exists in a repository with immutable tags"},
+	{ErrCodeThrottled, true, "The registry or AWS API throttled the request"},
+	{ErrCodeDockerUnavailable, true, "The docker CLI is missing or the daemon is not reachable"},
+	{ErrCodeDiskFull, false, "The Docker host ran out of disk space"},
+	{ErrCodeImageNotFound, false, "The local image to tag or push does not exist"},
+	{ErrCodeBuildFailed, false, "docker build failed"},
+	{ErrCodeTagFailed, false, "docker tag failed"},
+	{ErrCodePushFailed, true, "docker push failed"},
+	{ErrCodeVerifyFailed, false, "A required signature or attestation check failed"},
+	{ErrCodePolicyViolation, false, "The build or push violates a configured policy"},
+	{ErrCodeToolRequirement, false, "A required tool is missing, too old or does not match its pinned checksum"},
+	{ErrCodeReadOnly, false, "A modifying operation was refused because pushecr runs in read-only mode"},
+	{ErrCodeEmulationMissing, false, "The builder cannot run a target platform: no native node and no QEMU emulator registered"},
+	{ErrCodeApprovalDenied, false, "A push that requires approval was rejected or not approved in time"},
+	{ErrCodeHookFailed, false, "A command under hooks exited with an error"},
+	{ErrCodeDeployFailed, false, "The pushed image could not be deployed, or its deployment did not complete"},
+	{ErrCodeE2EFailed, false, "A pushecr e2e scenario did not behave as expected"},
+	{ErrCodeFaultInjected, false, "A stage was failed on purpose by -fault-inject"},
+	{ErrCodeStageTimeout, false, "A stage ran past its hard timeout under timeouts"},
+	{ErrCodeScanFailed, false, "The ECR scan of the pushed image failed or did not complete in time"},
+	{ErrCodeVulnerabilities, false, "The ECR scan found vulnerabilities of scan.fail_on or above"},
+	{ErrCodeSignFailed, false, "cosign could not sign the pushed image under sign.cosign"},
+}
+
+// retryable reports whether err has a code the catalog marks as retryable.
+func retryable(err error) bool {
+	code := errorCode(err)
+	for _, entry := range errorCatalog {
+		if entry.Code == code {
+			return entry.Retryable
+		}
+	}
+	return false
+}
+
+// codedError attaches an ErrorCode to an error.
+type codedError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *codedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.Err
+}
+
+// withCode tags err with code. A nil error stays nil.
+func withCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{Code: code, Err: err}
+}
+
+// errorCode returns the code attached to err, or ErrCodeUnknown.
+func errorCode(err error) ErrorCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return ErrCodeUnknown
+}
+
+// outputPatterns maps well-known fragments of aws/docker output to codes.
+// More specific patterns must come first.
+var outputPatterns = []struct {
+	fragment string
+	code     ErrorCode
+}{
+	{"aws: not found", ErrCodeAWSCLIMissing},
+	{"aws: command not found", ErrCodeAWSCLIMissing},
+	{"Unable to locate credentials", ErrCodeCredentialsMissing},
+	{"failed to refresh cached credentials", ErrCodeCredentialsMissing},
+	{"ExpiredToken", ErrCodeAuthExpired},
+	{"authorization token has expired", ErrCodeAuthExpired},
+	{"security token included in the request is expired", ErrCodeAuthExpired},
+	{"Token has expired", ErrCodeAuthExpired},
+	{"InvalidClientTokenId", ErrCodeCredentialsMissing},
+	{"UnrecognizedClientException", ErrCodeCredentialsMissing},
+	{"no basic auth credentials", ErrCodeAuthFailed},
+	{"AccessDenied", ErrCodeAccessDenied},
+	{"not authorized to perform", ErrCodeAccessDenied},
+	{"RepositoryNotFoundException", ErrCodeRepoNotFound},
+	{"does not exist in the registry", ErrCodeRepoNotFound},
+	{"name unknown", ErrCodeRepoNotFound},
+	{"ImageTagAlreadyExistsException", ErrCodeTagImmutable},
+	{"cannot be overwritten because the repository is immutable", ErrCodeTagImmutable},
+	{"toomanyrequests", ErrCodeThrottled},
+	{"ThrottlingException", ErrCodeThrottled},
+	{"Rate exceeded", ErrCodeThrottled},
+	{"Cannot connect to the Docker daemon", ErrCodeDockerUnavailable},
+	{"docker: not found", ErrCodeDockerUnavailable},
+	{"\"docker\": executable file not found", ErrCodeDockerUnavailable},
+	{"no space left on device", ErrCodeDiskFull},
+	{"exec format error", ErrCodeEmulationMissing},
+	{"An image does not exist locally", ErrCodeImageNotFound},
+	{"No such image", ErrCodeImageNotFound},
+}
+
+// classify tags err with the code matching the command output, falling back
+// to the stage's generic code when nothing specific is recognized.
+func classify(fallback ErrorCode, output string, err error) error {
+	text := output + "\n" + err.Error()
+	for _, p := range outputPatterns {
+		if strings.Contains(text, p.fragment) {
+			return withCode(p.code, err)
+		}
+	}
+	return withCode(fallback, err)
+}
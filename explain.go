@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// explanation is the troubleshooting text pushecr explain prints for a code.
+type explanation struct {
+	Causes      []string
+	Fixes       []string
+	Permissions []string // IAM actions the failing operation may need
+	Links       []string
+}
+
+const (
+	ecrIAMDocs  = "https://docs.aws.amazon.com/AmazonECR/latest/userguide/security-iam-awsmanpol.html"
+	ecrAuthDocs = "https://docs.aws.amazon.com/AmazonECR/latest/userguide/registry_auth.html"
+	cliAuthDocs = "https://docs.aws.amazon.com/cli/latest/userguide/cli-chap-configure.html"
+)
+
+// errorExplanations extends errorCatalog with causes and fixes. Every code in
+// the catalog should have an entry.
+var errorExplanations = map[ErrorCode]explanation{
+	ErrCodeUnknown: {
+		Causes: []string{"The failing command printed output pushecr does not recognize."},
+		Fixes: []string{
+			"Read the error message and the output above it; the aws or docker message is usually included.",
+			"Rerun with -diagnostics bundle.tar.gz to collect the run log, configuration and tool versions.",
+		},
+	},
+	ErrCodeConfigNotFound: {
+		Causes: []string{"The file given with -config does not exist, or it is not readable by the current user."},
+		Fixes:  []string{"Check the path passed to -config (deploy.yml in the current directory by default)."},
+	},
+	ErrCodeConfigInvalid: {
+		Causes: []string{
+			"The YAML cannot be parsed or has a value of the wrong type.",
+			"A required key is missing (ecr.region, ecr.account_id, ecr.repository, docker.image_name).",
+			"A template in repository_template, image_tags or tag_aliases does not render.",
+		},
+		Fixes: []string{"Run pushecr validate -config deploy.yml -all to check every profile without building."},
+	},
+	ErrCodeProfileNotFound: {
+		Causes: []string{"The profile given with -profile is not defined under profiles."},
+		Fixes:  []string{"Check the spelling of -profile (dev by default) or add the profile to the configuration."},
+	},
+	ErrCodeAWSCLIMissing: {
+		Causes: []string{"The aws CLI is not installed or not in PATH."},
+		Fixes:  []string{"Install the AWS CLI v2 and make sure aws --version works in the same shell."},
+		Links:  []string{"https://docs.aws.amazon.com/cli/latest/userguide/getting-started-install.html"},
+	},
+	ErrCodeCredentialsMissing: {
+		Causes: []string{
+			"No credentials in the environment, shared config files, SSO cache or instance role.",
+			"The access key does not exist or was deactivated.",
+		},
+		Fixes: []string{
+			"Run aws sts get-caller-identity to see which identity, if any, is found.",
+			"Set AWS_PROFILE, run aws sso login, or configure keys with aws configure.",
+		},
+		Permissions: []string{"sts:GetCallerIdentity"},
+		Links:       []string{cliAuthDocs},
+	},
+	ErrCodeAuthFailed: {
+		Causes: []string{
+			"Docker could not log in to the registry with the ECR authorization token.",
+			"A credential helper in ~/.docker/config.json overrides the login.",
+		},
+		Fixes: []string{
+			"Check that the identity can call ecr:GetAuthorizationToken.",
+			"Remove stale credsStore or credHelpers entries for the registry from ~/.docker/config.json.",
+		},
+		Permissions: []string{"ecr:GetAuthorizationToken"},
+		Links:       []string{ecrAuthDocs},
+	},
+	ErrCodeAuthExpired: {
+		Causes: []string{
+			"The AWS session (SSO, assumed role or temporary keys) expired.",
+			"The ECR authorization token, valid for 12 hours, expired during a long run.",
+		},
+		Fixes:       []string{"Refresh the session (aws sso login, or assume the role again) and rerun; the run is safe to retry."},
+		Permissions: []string{"ecr:GetAuthorizationToken"},
+		Links:       []string{ecrAuthDocs},
+	},
+	ErrCodeAccessDenied: {
+		Causes: []string{
+			"The IAM identity lacks a permission for the repository or the operation.",
+			"A repository policy or service control policy denies the action.",
+			"The trust policy of ecr.assume_role_arn or of the workspace role does not allow the caller, or the external ID differs.",
+		},
+		Fixes: []string{
+			"Run aws sts get-caller-identity to confirm which identity is used.",
+			"Grant the actions below on the repository, e.g. with the AmazonEC2ContainerRegistryPowerUser managed policy.",
+		},
+		Permissions: []string{
+			"sts:AssumeRole (with ecr.assume_role_arn)",
+			"ecr:GetAuthorizationToken",
+			"ecr:BatchCheckLayerAvailability",
+			"ecr:InitiateLayerUpload",
+			"ecr:UploadLayerPart",
+			"ecr:CompleteLayerUpload",
+			"ecr:PutImage",
+			"ecr:BatchGetImage",
+			"ecr:DescribeImages",
+		},
+		Links: []string{ecrIAMDocs, "https://docs.aws.amazon.com/AmazonECR/latest/userguide/repository-policies.html"},
+	},
+	ErrCodeRepoNotFound: {
+		Causes: []string{
+			"ecr.repository does not exist in ecr.account_id and ecr.region.",
+			"repository_template rendered a different name than expected.",
+		},
+		Fixes: []string{
+			"Create the repository, or set ecr.create_if_missing: true to create it on the first push.",
+			"Check the rendered name with pushecr validate.",
+		},
+		Permissions: []string{"ecr:DescribeRepositories", "ecr:CreateRepository"},
+		Links:       []string{"https://docs.aws.amazon.com/AmazonECR/latest/userguide/repository-create.html"},
+	},
+	ErrCodeTagImmutable: {
+		Causes: []string{"The repository has immutable tags and the tag already exists."},
+		Fixes: []string{
+			"Push a unique tag, e.g. image_tags: [\"{{.GitSHA}}\"], instead of reusing one.",
+			"If the existing image is the one to push, as with commit tags rerun in CI, use -skip-if-exists.",
+			"Or make the repository tags mutable if overwriting is intended.",
+		},
+		Permissions: []string{"ecr:PutImageTagMutability", "ecr:DescribeRepositories", "ecr:DescribeImages"},
+		Links:       []string{"https://docs.aws.amazon.com/AmazonECR/latest/userguide/image-tag-mutability.html"},
+	},
+	ErrCodeThrottled: {
+		Causes: []string{"Too many API calls in the account and region, often from parallel pipelines."},
+		Fixes: []string{
+			"Rerun later; pushecr already retries with backoff.",
+			"Lower aws_api.requests_per_second to pace calls, or request a quota increase.",
+		},
+		Links: []string{"https://docs.aws.amazon.com/AmazonECR/latest/userguide/service-quotas.html"},
+	},
+	ErrCodeDockerUnavailable: {
+		Causes: []string{
+			"The docker CLI is not installed.",
+			"The daemon is not running, or DOCKER_HOST points to an unreachable host.",
+		},
+		Fixes: []string{
+			"Run docker info to check the daemon.",
+			"Add the user to the docker group or use a rootless daemon if permission is denied on the socket.",
+		},
+	},
+	ErrCodeDiskFull: {
+		Causes: []string{"The Docker host ran out of space for images, layers or build cache."},
+		Fixes: []string{
+			"Run pushecr cache prune or docker system prune to reclaim space.",
+			"Set cache.auto_prune to prune after every run on long-lived runners.",
+		},
+	},
+	ErrCodeImageNotFound: {
+		Causes: []string{"The local image docker.image_name does not exist, usually because the build stage was skipped."},
+		Fixes:  []string{"Run the build stage first (pushecr build), or drop build from -skip."},
+	},
+	ErrCodeBuildFailed: {
+		Causes: []string{"A Dockerfile instruction failed, or the build context or a base image is not available."},
+		Fixes: []string{
+			"Read the build output above the error for the failing step.",
+			"Run pushecr lint to check the Dockerfile and the build context.",
+		},
+	},
+	ErrCodeTagFailed: {
+		Causes: []string{"The Docker daemon refused to tag the local image."},
+		Fixes:  []string{"Check that the local image exists and that the target name is a valid reference."},
+	},
+	ErrCodePushFailed: {
+		Causes: []string{"The upload was interrupted or the registry rejected a layer or the manifest."},
+		Fixes:  []string{"Rerun; the layers already uploaded are not sent again."},
+		Permissions: []string{
+			"ecr:BatchCheckLayerAvailability",
+			"ecr:InitiateLayerUpload",
+			"ecr:UploadLayerPart",
+			"ecr:CompleteLayerUpload",
+			"ecr:PutImage",
+		},
+		Links: []string{ecrIAMDocs},
+	},
+	ErrCodeVerifyFailed: {
+		Causes: []string{"A base or pushed image has no valid signature or attestation for the configured key or identity."},
+		Fixes:  []string{"Run pushecr verify with the same profile to see which image and check failed."},
+	},
+	ErrCodePolicyViolation: {
+		Causes: []string{
+			"The build or push breaks a rule under policy (repository names, tags, base images).",
+			"The caller is not allowed to run a restricted command.",
+			"The tag guard found an image from another git repository.",
+		},
+		Fixes: []string{"The message names the rule; fix the configuration or ask an owner of the policy to allow it."},
+	},
+	ErrCodeToolRequirement: {
+		Causes: []string{"A tool under tools is missing, older than the minimum version or does not match its pinned checksum."},
+		Fixes:  []string{"Install the required version, or update the tools section if the change is intended."},
+	},
+	ErrCodeReadOnly: {
+		Causes: []string{"A modifying operation ran with -read-only or PUSHECR_READ_ONLY set."},
+		Fixes:  []string{"Drop -read-only, or use a command that only reads (lint, compare, layers, runs)."},
+	},
+	ErrCodeEmulationMissing: {
+		Causes: []string{"The builder has no native node and no QEMU emulator for a platform in docker.platforms."},
+		Fixes: []string{
+			"Set docker.install_emulators: true, or register them with docker run --privileged --rm tonistiigi/binfmt --install all.",
+			"Or add a native node for the platform to the buildx builder.",
+		},
+		Links: []string{"https://docs.docker.com/build/building/multi-platform/"},
+	},
+	ErrCodeApprovalDenied: {
+		Causes: []string{"The push was rejected, or nobody approved it before approval.timeout."},
+		Fixes:  []string{"Ask an approver to run the approve command printed by the run, or raise approval.timeout."},
+		Permissions: []string{
+			"ssm:GetParameter",
+			"ssm:PutParameter",
+			"s3:GetObject",
+			"s3:PutObject",
+		},
+	},
+	ErrCodeHookFailed: {
+		Causes: []string{"A pre_build, post_build, pre_push or post_push command exited with a non-zero status; its output is printed above."},
+		Fixes:  []string{"Run the command by hand with the PUSHECR_* variables the run exported, or remove it from hooks."},
+	},
+	ErrCodeDeployFailed: {
+		Causes: []string{
+			"The ECS service or cluster in deploy.ecs does not exist or is not active.",
+			"The new tasks failed to start and the deployment circuit breaker rolled it back, or it did not finish before deploy.ecs.timeout.",
+			"The Lambda function in deploy.lambda does not exist, is not a container image function, or failed to become Active with the new image.",
+		},
+		Fixes: []string{
+			"Check the service events with aws ecs describe-services; the image is already pushed, so retry with -only deploy.",
+			"Raise deploy.ecs.timeout for services that take longer to drain.",
+			"For Lambda, check LastUpdateStatusReason with aws lambda get-function-configuration; the function's role needs to pull from the repository.",
+		},
+		Permissions: []string{
+			"ecs:DescribeServices",
+			"ecs:DescribeTaskDefinition",
+			"ecs:RegisterTaskDefinition",
+			"ecs:UpdateService",
+			"ecs:TagResource",
+			"iam:PassRole",
+			"lambda:GetFunctionConfiguration",
+			"lambda:UpdateFunctionCode",
+		},
+	},
+	ErrCodeE2EFailed: {
+		Causes: []string{
+			"Docker is not running, or its daemon cannot reach the local registry (a remote DOCKER_HOST does not see the loopback address).",
+			"The aws CLI is older than 2.13 and ignores AWS_ENDPOINT_URL_ECR, so it called the real ECR.",
+			"A change in pushecr broke the behaviour a scenario checks; the output of the failing run is printed above.",
+		},
+		Fixes: []string{"Run pushecr e2e -keep and repeat the failing run from the printed working directory with the PUSHECR_REGISTRY and AWS_ENDPOINT_URL_ECR it used."},
+	},
+	ErrCodeFaultInjected: {
+		Causes: []string{"The run was started with -fault-inject, which fails stages on purpose to test retries, checkpoints and cleanup."},
+		Fixes:  []string{"Run without -fault-inject; with -checkpoints, a run without it resumes from the failed stage."},
+	},
+	ErrCodeStageTimeout: {
+		Causes: []string{
+			"The Docker daemon or the buildx builder is stuck; the docker ps and docker buildx ls output in the error shows what was running.",
+			"A registry, package mirror or base image pull is slow or unreachable from the runner.",
+			"The stage really needs longer than timeouts.<stage>.hard, e.g. a cold build without a cache.",
+		},
+		Fixes: []string{
+			"Check the diagnostics in the error, or in stages.log of a -diagnostics bundle, for the container or builder that hung.",
+			"The stage's commands and API calls are canceled at the timeout; a build canceled halfway may leave a dangling buildx session.",
+			"Raise timeouts.<stage>.hard if the stage is just slow.",
+		},
+	},
+	ErrCodeScanFailed: {
+		Causes: []string{
+			"The repository has neither scan on push nor enhanced scanning, and the basic scan could not be started (one per image per day).",
+			"ECR cannot scan the image: an unsupported OS or base image, or an image older than the enhanced scanning window.",
+			"The scan did not complete within scan.timeout.",
+		},
+		Fixes: []string{
+			"Enable scan on push (ecr.create.scan_on_push) or enhanced scanning in the registry's scanning configuration.",
+			"Raise scan.timeout; enhanced scans of large images can take several minutes.",
+		},
+		Permissions: []string{"ecr:DescribeImageScanFindings", "ecr:StartImageScan", "inspector2:ListFindings (enhanced scanning)"},
+	},
+	ErrCodeVulnerabilities: {
+		Causes: []string{"The pushed image has vulnerabilities of scan.fail_on or above; the output lists the worst ones with their package."},
+		Fixes: []string{
+			"Update the base image or the listed packages and push again.",
+			"Add vulnerability IDs that do not apply to scan.ignore, after reviewing them.",
+		},
+	},
+	ErrCodeSignFailed: {
+		Causes: []string{
+			"The key file of sign.cosign.key is missing, or COSIGN_PASSWORD does not decrypt it.",
+			"The profile's AWS credentials cannot sign with the key of sign.cosign.kms_key_arn.",
+			"Keyless signing found no OIDC token: outside a CI with id-token permissions cosign cannot get a certificate.",
+			"Docker's ECR credentials expired before the signature was uploaded.",
+		},
+		Fixes: []string{
+			"Export COSIGN_PASSWORD, or check the key path relative to the working directory.",
+			"On GitHub Actions grant the job permissions: id-token: write for keyless signing.",
+			"Run pushecr -only auth,sign to sign again without pushing.",
+		},
+		Permissions: []string{"kms:Sign", "kms:GetPublicKey", "ecr:PutImage", "ecr:InitiateLayerUpload", "ecr:UploadLayerPart", "ecr:CompleteLayerUpload"},
+	},
+}
+
+func runExplain(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Uso: %s explain <error-code>\n\n", os.Args[0])
+		w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+		for _, entry := range errorCatalog {
+			fmt.Fprintf(w, "  %s\t%s\n", entry.Code, entry.Description)
+		}
+		w.Flush()
+		os.Exit(2)
+	}
+
+	// Codes are accepted without the prefix and in any case: auth_failed.
+	code := ErrorCode(strings.ToUpper(args[0]))
+	if !strings.HasPrefix(string(code), "PUSHECR_") {
+		code = "PUSHECR_" + code
+	}
+	for _, entry := range errorCatalog {
+		if entry.Code != code {
+			continue
+		}
+		fmt.Println(ColorCyan + string(entry.Code) + ColorReset)
+		fmt.Println(entry.Description + ".")
+		if entry.Retryable {
+			fmt.Println("Retryable: yes, the same run may succeed if repeated.")
+		} else {
+			fmt.Println("Retryable: no, rerunning will fail the same way until the cause is fixed.")
+		}
+		e := errorExplanations[entry.Code]
+		printSection("Possible causes", e.Causes)
+		printSection("How to fix", e.Fixes)
+		printSection("IAM permissions involved", e.Permissions)
+		printSection("See also", e.Links)
+		return
+	}
+	exitOnError("Unknown error code", fmt.Errorf("'%s' is not a pushecr error code (run %s explain to list them)", args[0], os.Args[0]))
+}
+
+func printSection(title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Println("\n" + ColorYellow + title + ":" + ColorReset)
+	for _, line := range lines {
+		fmt.Println("  - " + line)
+	}
+}
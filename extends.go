@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// resolveExtends applies the extends key of the profiles in settings (as
+// returned by viper.AllSettings): a profile with extends: base starts from
+// base, itself resolved first, and its own keys are merged on top. Nested
+// maps are merged key by key; lists and scalars replace the inherited value.
+// It reports whether any profile extends another.
+func resolveExtends(settings map[string]interface{}) (map[string]interface{}, bool, error) {
+	profiles, _ := settings["profiles"].(map[string]interface{})
+	resolved := map[string]map[string]interface{}{}
+	extended := false
+
+	var resolve func(name string, chain []string) (map[string]interface{}, error)
+	resolve = func(name string, chain []string) (map[string]interface{}, error) {
+		if r, ok := resolved[name]; ok {
+			return r, nil
+		}
+		if contains(chain, name) {
+			return nil, fmt.Errorf("profiles extend each other in a cycle: %s", strings.Join(append(chain, name), " → "))
+		}
+		profile, ok := profiles[name].(map[string]interface{})
+		if !ok {
+			if len(chain) > 0 {
+				return nil, fmt.Errorf("profile '%s' extends '%s', which is not defined", chain[len(chain)-1], name)
+			}
+			return map[string]interface{}{}, nil
+		}
+		r := profile
+		if base, ok := profile["extends"]; ok {
+			extended = true
+			baseName, ok := base.(string)
+			if !ok || baseName == "" {
+				return nil, fmt.Errorf("profiles.%s.extends must be a profile name", name)
+			}
+			parent, err := resolve(baseName, append(chain, name))
+			if err != nil {
+				return nil, err
+			}
+			r = mergeSettings(parent, profile)
+		}
+		delete(r, "extends")
+		resolved[name] = r
+		return r, nil
+	}
+
+	out := map[string]interface{}{}
+	for name := range profiles {
+		r, err := resolve(name, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		out[name] = r
+	}
+	return out, extended, nil
+}
+
+// mergeSettings returns a deep copy of base with override merged on top.
+func mergeSettings(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		if m, ok := value.(map[string]interface{}); ok {
+			value = mergeSettings(m, nil)
+		}
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeSettings(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// applyExtends decodes the profiles again with their extends resolved. Values
+// a profile inherits are reported at the profile in decoding errors.
+func (c *Config) applyExtends(source *configSource) error {
+	profiles, extended, err := resolveExtends(viper.AllSettings())
+	if err != nil || !extended {
+		return err
+	}
+	v := viper.New()
+	if err := v.MergeConfigMap(map[string]interface{}{"profiles": profiles}); err != nil {
+		return err
+	}
+	var decoded struct {
+		Profiles map[string]ProfileConfig `mapstructure:"profiles"`
+	}
+	if err := v.Unmarshal(&decoded); err != nil {
+		return source.decodeError(err)
+	}
+	c.Profiles = decoded.Profiles
+	return nil
+}
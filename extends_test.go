@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type settings = map[string]interface{}
+
+func TestResolveExtends(t *testing.T) {
+	base := func() settings {
+		return settings{
+			"ecr":    settings{"region": "us-east-1", "repository": "api", "image_tags": []interface{}{"latest", "stable"}},
+			"docker": settings{"image_name": "api", "build_args": settings{"A": "1", "B": "2"}},
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		profiles settings
+		want     settings
+		extended bool
+		err      string
+	}{
+		{
+			name:     "no extends",
+			profiles: settings{"base": base()},
+			want:     settings{"base": base()},
+		},
+		{
+			name: "nested maps merge, lists and scalars replace",
+			profiles: settings{
+				"base": base(),
+				"prod": settings{
+					"extends": "base",
+					"ecr":     settings{"region": "eu-west-1", "image_tags": []interface{}{"prod"}},
+					"docker":  settings{"build_args": settings{"B": "3"}},
+				},
+			},
+			want: settings{
+				"base": base(),
+				"prod": settings{
+					"ecr":    settings{"region": "eu-west-1", "repository": "api", "image_tags": []interface{}{"prod"}},
+					"docker": settings{"image_name": "api", "build_args": settings{"A": "1", "B": "3"}},
+				},
+			},
+			extended: true,
+		},
+		{
+			name: "chain",
+			profiles: settings{
+				"base":    base(),
+				"staging": settings{"extends": "base", "ecr": settings{"repository": "api-staging"}},
+				"canary":  settings{"extends": "staging", "ecr": settings{"region": "us-west-2"}},
+			},
+			want: settings{
+				"base": base(),
+				"staging": settings{
+					"ecr":    settings{"region": "us-east-1", "repository": "api-staging", "image_tags": []interface{}{"latest", "stable"}},
+					"docker": base()["docker"],
+				},
+				"canary": settings{
+					"ecr":    settings{"region": "us-west-2", "repository": "api-staging", "image_tags": []interface{}{"latest", "stable"}},
+					"docker": base()["docker"],
+				},
+			},
+			extended: true,
+		},
+		{
+			name:     "cycle",
+			profiles: settings{"a": settings{"extends": "b"}, "b": settings{"extends": "a"}},
+			err:      "cycle",
+		},
+		{
+			name:     "self",
+			profiles: settings{"a": settings{"extends": "a"}},
+			err:      "cycle: a → a",
+		},
+		{
+			name:     "undefined base",
+			profiles: settings{"prod": settings{"extends": "missing"}},
+			err:      "profile 'prod' extends 'missing', which is not defined",
+		},
+		{
+			name:     "not a name",
+			profiles: settings{"prod": settings{"extends": []interface{}{"base"}}},
+			err:      "profiles.prod.extends must be a profile name",
+		},
+	} {
+		got, extended, err := resolveExtends(settings{"profiles": test.profiles})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if extended != test.extended {
+			t.Errorf("%s: extended = %v, want %v", test.name, extended, test.extended)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\n got %v\nwant %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMergeSettingsCopiesBase(t *testing.T) {
+	base := settings{"ecr": settings{"region": "us-east-1"}}
+	merged := mergeSettings(base, settings{"ecr": settings{"region": "eu-west-1"}})
+	merged["ecr"].(settings)["repository"] = "api"
+	if want := (settings{"ecr": settings{"region": "us-east-1"}}); !reflect.DeepEqual(base, want) {
+		t.Errorf("base changed to %v, want %v", base, want)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault injection, with the -fault-inject flag left out of the help, makes
+// stages fail on purpose to check that retries, checkpoints and cleanup
+// behave when something goes wrong. The spec is a comma-separated list of
+//
+//	<stage>=<fault>[:<probability>[:<count>]]
+//	seed=<n>
+//
+// where the stage is a pipeline stage or * for all of them, and the fault is
+// one of:
+//
+//   - fail: the stage fails with PUSHECR_FAULT_INJECTED, which is never
+//     retried, as a crash halfway through the pipeline would;
+//   - expire: the registry token expires, and the stage fails with
+//     PUSHECR_AUTH_EXPIRED;
+//   - reset: the connection is reset, and the stage fails with its usual
+//     error code, such as PUSHECR_PUSH_FAILED for push.
+//
+// Each attempt of the stage fails with the probability, 1 by default, up to
+// count times, unlimited by default. The seed makes the random choices
+// repeatable; without it one is picked and printed.
+
+// faultKinds are the faults -fault-inject knows.
+var faultKinds = []string{"fail", "expire", "reset"}
+
+// stageErrorCodes are the codes stages usually fail with, used by reset.
+var stageErrorCodes = map[string]ErrorCode{
+	"auth":   ErrCodeAuthFailed,
+	"build":  ErrCodeBuildFailed,
+	"tag":    ErrCodeTagFailed,
+	"push":   ErrCodePushFailed,
+	"scan":   ErrCodeScanFailed,
+	"sign":   ErrCodeSignFailed,
+	"deploy": ErrCodeDeployFailed,
+}
+
+type fault struct {
+	stage       string
+	kind        string
+	probability float64
+	count       int // 0 for unlimited
+	injected    int
+}
+
+// faultInjector holds the faults of a -fault-inject spec. It is shared by
+// every profile of the run.
+type faultInjector struct {
+	mu     sync.Mutex
+	seed   int64
+	random *rand.Rand
+	faults []*fault
+}
+
+// parseFaults parses a -fault-inject spec; an empty one returns nil.
+func parseFaults(spec string) (*faultInjector, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	f := &faultInjector{seed: time.Now().UnixNano()}
+	stages := stageNamesOf(pipeline)
+	for _, entry := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("-fault-inject entry '%s' is not <stage>=<fault> or seed=<n>", entry)
+		}
+		if key == "seed" {
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("-fault-inject seed '%s' is not a number", value)
+			}
+			f.seed = seed
+			continue
+		}
+		if key != "*" && !contains(stages, key) {
+			return nil, fmt.Errorf("-fault-inject stage '%s' is not one of %s or *", key, strings.Join(stages, ", "))
+		}
+		parts := strings.Split(value, ":")
+		if len(parts) > 3 || !contains(faultKinds, parts[0]) {
+			return nil, fmt.Errorf("-fault-inject '%s' is not <fault>[:<probability>[:<count>]] with a fault of %s", value, strings.Join(faultKinds, ", "))
+		}
+		ft := &fault{stage: key, kind: parts[0], probability: 1}
+		if len(parts) > 1 {
+			p, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil || p <= 0 || p > 1 {
+				return nil, fmt.Errorf("-fault-inject probability '%s' must be over 0 and at most 1", parts[1])
+			}
+			ft.probability = p
+		}
+		if len(parts) > 2 {
+			n, err := strconv.Atoi(parts[2])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("-fault-inject count '%s' must be a positive number", parts[2])
+			}
+			ft.count = n
+		}
+		f.faults = append(f.faults, ft)
+	}
+	f.random = rand.New(rand.NewSource(f.seed))
+	return f, nil
+}
+
+// String describes the faults for the banner printed when the run starts.
+func (f *faultInjector) String() string {
+	var faults []string
+	for _, ft := range f.faults {
+		description := fmt.Sprintf("%s=%s:%g", ft.stage, ft.kind, ft.probability)
+		if ft.count > 0 {
+			description += ":" + strconv.Itoa(ft.count)
+		}
+		faults = append(faults, description)
+	}
+	return fmt.Sprintf("%s (seed %d)", strings.Join(faults, ", "), f.seed)
+}
+
+// next returns the fault to inject in an attempt of stage, if any.
+func (f *faultInjector) next(stage string) *fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ft := range f.faults {
+		if ft.stage != stage && ft.stage != "*" || ft.count > 0 && ft.injected >= ft.count {
+			continue
+		}
+		if f.random.Float64() < ft.probability {
+			ft.injected++
+			return ft
+		}
+	}
+	return nil
+}
+
+// middleware fails attempts of a stage instead of running them. It is added
+// to ecr.middleware, inside withRetries, so every retry can fail too.
+func (f *faultInjector) middleware(s stage) stage {
+	return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+		ft := f.next(s.Name)
+		if ft == nil {
+			return next(ctx, ecr)
+		}
+		fmt.Printf(ColorYellow+"Injecting fault %s in %s (-fault-inject)"+ColorReset+"\n", ft.kind, s.Name)
+		fmt.Fprintf(&ecr.logs, "fault-inject: %s in %s\n", ft.kind, s.Name)
+		code, ok := stageErrorCodes[s.Name]
+		if !ok {
+			code = ErrCodeUnknown
+		}
+		switch ft.kind {
+		case "expire":
+			// Only the registry's answer: the cached token stays, as when
+			// ECR rejects a token before its reported expiry.
+			return classify(code, "", fmt.Errorf("denied: Your authorization token has expired. Reauthenticate and try again. (-fault-inject)"))
+		case "reset":
+			return withCode(code, fmt.Errorf("read tcp: connection reset by peer (-fault-inject)"))
+		}
+		return withCode(ErrCodeFaultInjected, errorf(KeyFaultInjected, s.Name))
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// baseDigestsPath stores, per pushed image, the base image digests of its
+// last successful build.
+var baseDigestsPath = statePath("bases.json")
+
+// baseDigests resolves the current digest of every base image in the
+// Dockerfile. Pinned bases use their pinned digest without a registry call.
+func (ecr *ECR) baseDigests() (map[string]string, error) {
+	d, err := ecr.localDockerfile()
+	if err != nil {
+		return nil, err
+	}
+	digests := map[string]string{}
+	for _, from := range d.bases() {
+		name, digest := splitDigest(from.Image)
+		if digest == "" {
+			if digest, err = ecr.resolveDigest(name); err != nil {
+				return nil, err
+			}
+		}
+		digests[from.Image] = digest
+	}
+	return digests, nil
+}
+
+// basesUpdated reports whether any base image changed since the last
+// successful build of the image, and returns the current digests.
+func (ecr *ECR) basesUpdated() (bool, map[string]string, error) {
+	ecr.stage(ColorCyan, "Checking base images for updates")
+	current, err := ecr.baseDigests()
+	if err != nil {
+		return false, nil, err
+	}
+	state, err := readBaseDigests()
+	if err != nil {
+		return false, nil, err
+	}
+	previous, ok := state[ecr.imageURI(ecr.Config.ECR.ImageTag)]
+	if !ok {
+		fmt.Println(ColorYellow + "  no previous build recorded" + ColorReset)
+		return true, current, nil
+	}
+
+	updated := len(previous) != len(current)
+	for image, digest := range current {
+		if previous[image] != digest {
+			fmt.Printf(ColorYellow+"  %s: %s → %s"+ColorReset+"\n", image, shortDigest(orDefault(previous[image], "(none)")), shortDigest(digest))
+			updated = true
+		}
+	}
+	return updated, current, nil
+}
+
+// saveBaseDigests records the base digests the image was just built from.
+func (ecr *ECR) saveBaseDigests(digests map[string]string) error {
+	return withStateLock("bases", func() error {
+		state, err := readBaseDigests()
+		if err != nil {
+			return err
+		}
+		state[ecr.imageURI(ecr.Config.ECR.ImageTag)] = digests
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(baseDigestsPath, data)
+	})
+}
+
+func readBaseDigests() (map[string]map[string]string, error) {
+	state := map[string]map[string]string{}
+	data, err := os.ReadFile(baseDigestsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errorf(KeyFileReadFailed, baseDigestsPath, err)
+	}
+	return state, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	pushecrv1 "lpmg.xyz/goscripts/api/pushecr/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcAPI implements pushecrv1.PushECRServiceServer on top of the serve
+// daemon, with the same runs and authentication as the HTTP API.
+type grpcAPI struct {
+	pushecrv1.UnimplementedPushECRServiceServer
+	s *server
+}
+
+func (s *server) grpcServer() *grpc.Server {
+	g := grpc.NewServer(
+		grpc.UnaryInterceptor(s.grpcUnaryAuth),
+		grpc.StreamInterceptor(s.grpcStreamAuth),
+	)
+	pushecrv1.RegisterPushECRServiceServer(g, &grpcAPI{s: s})
+	return g
+}
+
+func (s *server) grpcAuthorize(ctx context.Context, method string) error {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	mutating := strings.HasSuffix(method, "/SubmitBuild")
+	switch err := s.checkToken(authorization, mutating); err {
+	case nil:
+		return nil
+	case errAPIDisabled:
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+}
+
+func (s *server) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.grpcAuthorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *server) grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.grpcAuthorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (a *grpcAPI) SubmitBuild(ctx context.Context, req *pushecrv1.SubmitBuildRequest) (*pushecrv1.SubmitBuildResponse, error) {
+	if _, ok := a.s.config.Profiles[req.GetProfile()]; !ok {
+		return nil, status.Errorf(codes.NotFound, "profile '%s' not found in configuration", req.GetProfile())
+	}
+	var o *overrides
+	if po := req.GetOverrides(); po != nil {
+		o = &overrides{
+			ImageTag:   po.GetImageTag(),
+			Repository: po.GetRepository(),
+			Region:     po.GetRegion(),
+			ImageName:  po.GetImageName(),
+		}
+	}
+	run := a.s.trigger("", req.GetProfile(), "grpc", "", o)
+	return &pushecrv1.SubmitBuildResponse{Run: run.proto()}, nil
+}
+
+func (a *grpcAPI) GetRun(ctx context.Context, req *pushecrv1.GetRunRequest) (*pushecrv1.GetRunResponse, error) {
+	run, ok := a.s.run(req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "run '%s' not found", req.GetId())
+	}
+	return &pushecrv1.GetRunResponse{Run: run.proto()}, nil
+}
+
+func (a *grpcAPI) ListRuns(ctx context.Context, req *pushecrv1.ListRunsRequest) (*pushecrv1.ListRunsResponse, error) {
+	resp := &pushecrv1.ListRunsResponse{}
+	for _, run := range a.s.list() {
+		resp.Runs = append(resp.Runs, run.proto())
+	}
+	return resp, nil
+}
+
+func (a *grpcAPI) StreamRunEvents(req *pushecrv1.StreamRunEventsRequest, stream grpc.ServerStreamingServer[pushecrv1.StreamRunEventsResponse]) error {
+	logs := a.s.logs(req.GetId())
+	if logs == nil {
+		return status.Errorf(codes.NotFound, "run '%s' not found", req.GetId())
+	}
+
+	offset, stages := 0, 0
+	for {
+		data, done, changed := logs.next(offset)
+		run, _ := a.s.run(req.GetId())
+		for ; stages < len(run.Stages); stages++ {
+			event := &pushecrv1.StreamRunEventsResponse_Stage{Stage: run.Stages[stages].proto()}
+			if err := stream.Send(&pushecrv1.StreamRunEventsResponse{Event: event}); err != nil {
+				return err
+			}
+		}
+		if len(data) > 0 {
+			event := &pushecrv1.StreamRunEventsResponse_Log{Log: data}
+			if err := stream.Send(&pushecrv1.StreamRunEventsResponse{Event: event}); err != nil {
+				return err
+			}
+			offset += len(data)
+		}
+		if done {
+			event := &pushecrv1.StreamRunEventsResponse_Result{Result: run.proto()}
+			return stream.Send(&pushecrv1.StreamRunEventsResponse{Event: event})
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func runStatusProto(s string) pushecrv1.RunStatus {
+	switch s {
+	case runRunning:
+		return pushecrv1.RunStatus_RUN_STATUS_RUNNING
+	case runSucceeded:
+		return pushecrv1.RunStatus_RUN_STATUS_SUCCEEDED
+	case runFailed:
+		return pushecrv1.RunStatus_RUN_STATUS_FAILED
+	}
+	return pushecrv1.RunStatus_RUN_STATUS_UNSPECIFIED
+}
+
+func (e stageEvent) proto() *pushecrv1.StageEvent {
+	return &pushecrv1.StageEvent{
+		Stage:     e.Stage,
+		Status:    runStatusProto(e.Status),
+		Error:     e.Error,
+		ErrorCode: string(e.ErrorCode),
+		ErrorKey:  string(e.ErrorKey),
+		Time:      timestamppb.New(e.Time),
+	}
+}
+
+func (r runRecord) proto() *pushecrv1.Run {
+	run := &pushecrv1.Run{
+		Id:        r.ID,
+		Job:       r.Job,
+		Profile:   r.Profile,
+		Trigger:   r.Trigger,
+		Status:    runStatusProto(r.Status),
+		StartedAt: timestamppb.New(r.StartedAt),
+		ErrorCode: string(r.ErrorCode),
+		ErrorKey:  string(r.ErrorKey),
+		Error:     r.Error,
+	}
+	if r.FinishedAt != nil {
+		run.FinishedAt = timestamppb.New(*r.FinishedAt)
+	}
+	if r.Overrides != nil {
+		run.Overrides = &pushecrv1.Overrides{
+			ImageTag:   r.Overrides.ImageTag,
+			Repository: r.Overrides.Repository,
+			Region:     r.Overrides.Region,
+			ImageName:  r.Overrides.ImageName,
+		}
+	}
+	for _, event := range r.Stages {
+		run.Stages = append(run.Stages, event.proto())
+	}
+	return run
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+type HistoryConfig struct {
+	Backend string `mapstructure:"backend"`
+	Path    string `mapstructure:"path"`
+	Table   string `mapstructure:"table"`
+	Region  string `mapstructure:"region"`
+}
+
+var defaultHistoryPath = statePath("runs.jsonl")
+
+// runEntry is one run as stored in the history.
+type runEntry struct {
+	ID         string    `json:"id"`
+	Source     string    `json:"source"`
+	Profile    string    `json:"profile"`
+	User       string    `json:"user"`
+	Host       string    `json:"host,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	Duration   float64   `json:"duration_seconds"`
+	Status     string    `json:"status"`
+	Image      string    `json:"image,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	FailedStep string    `json:"failed_stage,omitempty"`
+	ErrorCode  ErrorCode `json:"error_code,omitempty"`
+	ErrorKey   ErrorKey  `json:"error_key,omitempty"`
+	Error      string    `json:"error,omitempty"`
+
+	Stages   []stageUsage    `json:"stages,omitempty"`
+	Variants []variantResult `json:"variants,omitempty"`
+}
+
+func newRunEntry(id, source string, ecr *ECR, started time.Time, err error) runEntry {
+	host, _ := os.Hostname()
+	entry := runEntry{
+		ID:        id,
+		Source:    source,
+		Profile:   ecr.Profile,
+		User:      orDefault(ecr.actor, currentUser()),
+		Host:      host,
+		StartedAt: started.UTC(),
+		Duration:  time.Since(started).Round(time.Millisecond).Seconds(),
+		Status:    runSucceeded,
+		Digest:    ecr.Digest,
+		Stages:    ecr.usage,
+		Variants:  ecr.variants,
+	}
+	if ecr.Config != nil {
+		entry.Image = ecr.pushedImageURI()
+	}
+	if err != nil {
+		entry.Status = runFailed
+		entry.Error = err.Error()
+		entry.ErrorCode = errorCode(err)
+		entry.ErrorKey = errorKey(err)
+		var failed *stageError
+		if errors.As(err, &failed) {
+			entry.FailedStep = failed.Stage.Name
+		}
+	}
+	return entry
+}
+
+// currentUser identifies who started a run, preferring the CI actor.
+func currentUser() string {
+	for _, name := range []string{"PUSHECR_USER", "GITHUB_ACTOR", "GITLAB_USER_LOGIN", "BUILD_USER_ID", "CODEBUILD_INITIATOR", "USER", "USERNAME"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// recordRun stores entry in the configured history. Failing to record a run
+// never fails the run itself.
+func recordRun(h HistoryConfig, entry runEntry) {
+	if err := h.record(entry); err != nil {
+		fmt.Println(ColorYellow + "Could not record run history: " + err.Error() + ColorReset)
+	}
+}
+
+func (h HistoryConfig) record(entry runEntry) error {
+	switch h.Backend {
+	case "", "local":
+		return h.recordLocal(entry)
+	case "dynamodb":
+		return h.recordDynamoDB(entry)
+	case "none":
+		return nil
+	}
+	return fmt.Errorf("history.backend '%s' is not supported (local, dynamodb, none)", h.Backend)
+}
+
+// list returns the most recent entries first, up to limit (0 for all).
+func (h HistoryConfig) list(limit int) ([]runEntry, error) {
+	var entries []runEntry
+	var err error
+	switch h.Backend {
+	case "", "local":
+		entries, err = h.listLocal()
+	case "dynamodb":
+		entries, err = h.listDynamoDB()
+	default:
+		return nil, fmt.Errorf("history.backend '%s' does not support listing", h.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedAt.After(entries[j].StartedAt)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (h HistoryConfig) path() string {
+	return orDefault(h.Path, defaultHistoryPath)
+}
+
+func (h HistoryConfig) recordLocal(entry runEntry) error {
+	if err := os.MkdirAll(filepath.Dir(h.path()), 0o755); err != nil {
+		return err
+	}
+	return appendJSONLine(h.path(), entry)
+}
+
+func (h HistoryConfig) listLocal() ([]runEntry, error) {
+	f, err := os.Open(h.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []runEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry runEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// DynamoDB items keep the entry as a JSON document next to the keys, so the
+// table only needs a string partition key named "id".
+func (h HistoryConfig) recordDynamoDB(entry runEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	item, err := json.Marshal(map[string]map[string]string{
+		"id":         {"S": entry.ID},
+		"profile":    {"S": entry.Profile},
+		"started_at": {"S": entry.StartedAt.Format(time.RFC3339Nano)},
+		"entry":      {"S": string(data)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = runAWS(h.Region, io.Discard, "dynamodb", "put-item", "--table-name", h.Table, "--item", string(item))
+	return err
+}
+
+func (h HistoryConfig) listDynamoDB() ([]runEntry, error) {
+	out, err := runAWS(h.Region, io.Discard, "dynamodb", "scan", "--table-name", h.Table, "--projection-expression", "entry")
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Items []struct {
+			Entry struct {
+				S string `json:"S"`
+			} `json:"entry"`
+		} `json:"Items"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, errorf(KeyAWSBadResponse, "dynamodb scan", err)
+	}
+	var entries []runEntry
+	for _, item := range result.Items {
+		var entry runEntry
+		if err := json.Unmarshal([]byte(item.Entry.S), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func runRuns(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s runs list [-config deploy.yml] [-profile dev] [-limit 20]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "     %s runs show [-config deploy.yml] <id>\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		fs, configPath, profile := commandFlags("runs list", "runs list [-config deploy.yml] [-profile dev] [-limit 20]")
+		limit := fs.Int("limit", 20, "Number of runs to show (0 for all)")
+		fs.Parse(args[1:])
+		// Runs of every profile are listed unless -profile is given.
+		filter := false
+		fs.Visit(func(f *flag.Flag) { filter = filter || f.Name == "profile" })
+
+		config, err := loadConfig(*configPath)
+		exitOnError("Error loading configuration", err)
+		entries, err := config.History.list(0)
+		exitOnError("Could not read run history", err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTARTED\tPROFILE\tUSER\tSTATUS\tDURATION\tDIGEST")
+		shown := 0
+		for _, entry := range entries {
+			if filter && entry.Profile != *profile {
+				continue
+			}
+			if *limit > 0 && shown == *limit {
+				break
+			}
+			shown++
+			status := entry.Status
+			if entry.ErrorCode != "" {
+				status += " (" + string(entry.ErrorCode) + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.ID,
+				entry.StartedAt.Local().Format("2006-01-02 15:04:05"),
+				entry.Profile,
+				entry.User,
+				status,
+				formatSeconds(entry.Duration),
+				shortDigest(entry.Digest),
+			)
+		}
+		w.Flush()
+
+	case "show":
+		fs := flag.NewFlagSet("runs show", flag.ExitOnError)
+		configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+		fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+		fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			os.Exit(2)
+		}
+
+		config, err := loadConfig(*configPath)
+		exitOnError("Error loading configuration", err)
+		entries, err := config.History.list(0)
+		exitOnError("Could not read run history", err)
+		for _, entry := range entries {
+			if entry.ID != fs.Arg(0) {
+				continue
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, field := range [][2]string{
+				{"ID", entry.ID},
+				{"Source", entry.Source},
+				{"Profile", entry.Profile},
+				{"User", entry.User},
+				{"Host", entry.Host},
+				{"Started", entry.StartedAt.Local().Format(time.RFC3339)},
+				{"Duration", formatSeconds(entry.Duration)},
+				{"Status", entry.Status},
+				{"Image", entry.Image},
+				{"Digest", entry.Digest},
+				{"Failed stage", entry.FailedStep},
+				{"Error code", string(entry.ErrorCode)},
+				{"Error", entry.Error},
+			} {
+				if field[1] != "" {
+					fmt.Fprintf(w, "%s:\t%s\n", field[0], field[1])
+				}
+			}
+			w.Flush()
+			printUsage(entry.Stages)
+			return
+		}
+		exitOnError("Run not found", fmt.Errorf("no run with id '%s' in history", fs.Arg(0)))
+
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 1, 64) + "s"
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// holdTagPrefix marks images under retention hold. A held image keeps a
+// "hold-<digest>" tag, so it is never untagged and commands that delete
+// images (and ECR lifecycle rules on untagged images) leave it alone.
+const holdTagPrefix = "hold-"
+
+func holdTag(digest string) string {
+	return holdTagPrefix + strings.TrimPrefix(shortDigest(digest), "sha256:")
+}
+
+func runHold(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s hold add [-config deploy.yml] [-profile dev] <tag|digest>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "     %s hold remove [-config deploy.yml] [-profile dev] [-force] <tag|digest>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "     %s hold list [-config deploy.yml] [-profile dev]\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	action := args[0]
+	var fs *flag.FlagSet
+	var configPath, profile *string
+	var force *bool
+	switch action {
+	case "add":
+		fs, configPath, profile = commandFlags("hold add", "hold add [-config deploy.yml] [-profile dev] <tag|digest>...")
+	case "list":
+		fs, configPath, profile = commandFlags("hold list", "hold list [-config deploy.yml] [-profile dev]")
+	case "remove":
+		fs, configPath, profile = commandFlags("hold remove", "hold remove [-config deploy.yml] [-profile dev] [-force] <tag|digest>...")
+		force = fs.Bool("force", false, "Remove the hold even if it is the image's only tag, which deletes the image")
+	default:
+		usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+	if action != "list" && fs.NArg() == 0 {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("hold %s needs at least one tag or digest", action)))
+	}
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	switch action {
+	case "add":
+		for _, ref := range fs.Args() {
+			digest, err := ecr.resolveRef(ref)
+			exitOnError("Could not resolve "+ref, err)
+			exitOnError("Could not hold "+ref, ecr.putImageTag(digest, holdTag(digest)))
+			fmt.Println(ColorGreen + "Held " + digest + " as " + holdTag(digest) + ColorReset)
+		}
+
+	case "remove":
+		exitOnError("Release refused", ecr.authorizeCommand("hold remove", ""))
+		for _, ref := range fs.Args() {
+			digest, err := ecr.resolveRef(ref)
+			exitOnError("Could not resolve "+ref, err)
+			exitOnError("Could not release "+ref, ecr.releaseHold(digest, *force))
+			fmt.Println(ColorGreen + "Released hold on " + digest + ColorReset)
+		}
+
+	case "list":
+		held, err := ecr.heldImages()
+		exitOnError("Could not list held images", err)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DIGEST\tTAGS\tPUSHED")
+		for _, image := range held {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", image.Digest, strings.Join(image.Tags, ", "), image.PushedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	}
+}
+
+// resolveRef returns the digest of a tag, or ref itself if it is a digest.
+func (ecr *ECR) resolveRef(ref string) (string, error) {
+	if strings.HasPrefix(ref, "sha256:") {
+		return ref, nil
+	}
+	digest, err := ecr.imageDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		return "", withCode(ErrCodeImageNotFound, fmt.Errorf("tag '%s' not found in %s", ref, ecr.Config.ECR.Repository))
+	}
+	return digest, nil
+}
+
+// heldImages returns the images of the repository that are under hold.
+func (ecr *ECR) heldImages() ([]imageDetail, error) {
+	images, err := ecr.listImages()
+	if err != nil {
+		return nil, err
+	}
+	var held []imageDetail
+	for _, image := range images {
+		if isHeld(image) {
+			held = append(held, image)
+		}
+	}
+	return held, nil
+}
+
+// isHeld reports whether image carries its hold tag. Anything that deletes
+// images must skip held ones.
+func isHeld(image imageDetail) bool {
+	return contains(image.Tags, holdTag(image.Digest))
+}
+
+// releaseHold removes the hold tag of digest. ECR deletes an image when its
+// last tag is removed, so that requires force.
+func (ecr *ECR) releaseHold(digest string, force bool) error {
+	images, err := ecr.listImages()
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if image.Digest != digest {
+			continue
+		}
+		if !isHeld(image) {
+			return fmt.Errorf("%s is not held", digest)
+		}
+		if len(image.Tags) == 1 && !force {
+			return fmt.Errorf("%s is the only tag of the image; removing it deletes the image (use -force)", holdTag(digest))
+		}
+		return ecr.batchDeleteImage(holdTag(digest))
+	}
+	return withCode(ErrCodeImageNotFound, fmt.Errorf("image %s not found in %s", digest, ecr.Config.ECR.Repository))
+}
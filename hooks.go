@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// HooksConfig lists shell commands run around the build and push stages.
+// A failing pre_ hook fails the stage before it starts; a failing post_ hook
+// fails it after the work is done, so later stages do not run.
+type HooksConfig struct {
+	PreBuild  []string `mapstructure:"pre_build"`
+	PostBuild []string `mapstructure:"post_build"`
+	PrePush   []string `mapstructure:"pre_push"`
+	PostPush  []string `mapstructure:"post_push"`
+}
+
+// commands returns the hooks of stage ("build" or "push") for when ("pre"
+// or "post").
+func (h HooksConfig) commands(stage, when string) []string {
+	switch stage + "/" + when {
+	case "build/pre":
+		return h.PreBuild
+	case "build/post":
+		return h.PostBuild
+	case "push/pre":
+		return h.PrePush
+	case "push/post":
+		return h.PostPush
+	}
+	return nil
+}
+
+// runHooks runs the hooks of stage for when, in order, stopping at the first
+// that fails or when ctx is done.
+func (ecr *ECR) runHooks(ctx context.Context, stage, when string) error {
+	commands := ecr.Config.Hooks.commands(stage, when)
+	if len(commands) == 0 {
+		return nil
+	}
+	env := append(os.Environ(), ecr.hookEnv()...)
+	for _, command := range commands {
+		fmt.Println(ColorCyan + "Running " + when + "_" + stage + " hook: " + command + ColorReset)
+		cmd := shellCommand(ctx, command)
+		cmd.Env = env
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = ecr.output(os.Stdout)
+		cmd.Stderr = ecr.output(os.Stderr)
+		if err := cmd.Run(); err != nil {
+			return withCode(ErrCodeHookFailed, errorf(KeyHookFailed, when, stage, command, err))
+		}
+	}
+	return nil
+}
+
+// shellCommand runs command with the system shell, killed when ctx is done.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// hookEnv describes the image being built or pushed to the hooks.
+func (ecr *ECR) hookEnv() []string {
+	c := ecr.Config
+	env := []string{
+		"PUSHECR_PROFILE=" + ecr.Profile,
+		"PUSHECR_RUN_ID=" + ecr.runID,
+		"PUSHECR_LOCAL_IMAGE=" + c.Docker.ImageName + ":" + c.ECR.ImageTag,
+		"PUSHECR_REPOSITORY_URI=" + ecr.repositoryURI(),
+		"PUSHECR_IMAGE_TAG=" + c.ECR.ImageTag,
+		"PUSHECR_IMAGE_URI=" + ecr.pushedImageURI(),
+	}
+	if ecr.Digest != "" {
+		env = append(env, "PUSHECR_IMAGE_DIGEST="+ecr.Digest)
+	}
+	if ecr.variant != nil {
+		env = append(env, "PUSHECR_VARIANT="+ecr.variant.Name)
+	}
+	return env
+}
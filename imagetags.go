@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resolveImageTags renders ecr.image_tags, which accept the same templates as
+// ecr.tag_aliases. The first tag replaces image_tag as the tag the image is
+// built and pushed with; the others point at the same image after the push.
+func (c *ProfileConfig) resolveImageTags(profile string) error {
+	if len(c.ECR.ImageTags) == 0 {
+		return nil
+	}
+	data := tagValues(profile, c)
+	tags := make([]string, 0, len(c.ECR.ImageTags))
+	for i, text := range c.ECR.ImageTags {
+		tag, err := renderTag(fmt.Sprintf("ecr.image_tags[%d]", i), text, data)
+		if err != nil {
+			return err
+		}
+		if !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	c.ECR.ImageTag, c.ECR.ImageTags = tags[0], tags
+	return nil
+}
+
+// decorateTags composes tag_prefix and tag_suffix with the image_tag and
+// image_tags templates, before they are rendered.
+func (c *ECRConfig) decorateTags() {
+	if c.TagPrefix == "" && c.TagSuffix == "" {
+		return
+	}
+	c.ImageTag = c.TagPrefix + c.ImageTag + c.TagSuffix
+	tags := make([]string, len(c.ImageTags))
+	for i, tag := range c.ImageTags {
+		tags[i] = c.TagPrefix + tag + c.TagSuffix
+	}
+	c.ImageTags = tags
+}
+
+// extraTags returns the tags pushed besides image_tag.
+func (ecr *ECR) extraTags() []string {
+	var tags []string
+	for _, tag := range ecr.Config.ECR.ImageTags {
+		if tag != ecr.Config.ECR.ImageTag {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// pushTags returns every tag the push writes: image_tag and the extra
+// image_tags, unless the image is pushed by digest, and the resolved aliases,
+// without repetitions.
+func (ecr *ECR) pushTags() ([]string, error) {
+	var tags []string
+	if !ecr.Config.ECR.PushByDigest {
+		tags = append(tags, ecr.Config.ECR.ImageTag)
+		tags = append(tags, ecr.extraTags()...)
+	}
+	aliases, err := ecr.aliasTags()
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range sortedKeys(aliases) {
+		if !contains(tags, aliases[alias]) {
+			tags = append(tags, aliases[alias])
+		}
+	}
+	return tags, nil
+}
+
+// pushExtraTags points every extra tag at the pushed image. A failing tag
+// does not stop the others; the result of each one is reported and the push
+// fails if any of them did.
+func (ecr *ECR) pushExtraTags() error {
+	tags := ecr.extraTags()
+	if len(tags) == 0 || ecr.Config.ECR.PushByDigest {
+		return nil
+	}
+	digest := ecr.Digest
+	if digest == "" {
+		var err error
+		if digest, err = ecr.imageDigest(ecr.Config.ECR.ImageTag); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(ColorGreen + "✔ " + ecr.Config.ECR.ImageTag + ColorReset)
+	var failed []string
+	var first error
+	for _, tag := range tags {
+		if err := ecr.putImageTag(digest, tag); err != nil {
+			fmt.Println(ColorRed + "✘ " + tag + ": " + err.Error() + ColorReset)
+			failed = append(failed, tag)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		fmt.Println(ColorGreen + "✔ " + tag + ColorReset)
+	}
+	if first != nil {
+		return withCode(errorCode(first), fmt.Errorf("%d of %d tags could not be pushed (%s): %w", len(failed), len(tags)+1, strings.Join(failed, ", "), first))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jsonOutput implements -output json: stdout carries one JSON object per
+// line, a "stage" event when a stage starts or ends and a "summary" when a
+// profile's run ends, and the human output goes to stderr.
+type jsonOutput struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	tracker stageTracker
+}
+
+// jsonStageEvent is a stage event as printed by -output json.
+type jsonStageEvent struct {
+	Type    string `json:"type"` // "stage"
+	Profile string `json:"profile"`
+	stageEvent
+	Seconds float64 `json:"duration_seconds,omitempty"`
+}
+
+// stageSummary is the outcome of one stage in a run summary.
+type stageSummary struct {
+	Stage     string    `json:"stage"`
+	Status    string    `json:"status"`
+	Seconds   float64   `json:"duration_seconds"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+	ErrorKey  ErrorKey  `json:"error_key,omitempty"`
+}
+
+// runSummary is the last object printed for a profile. It extends the run
+// history entry with the pushed tags and the status of each stage.
+type runSummary struct {
+	Type string `json:"type"` // "summary"
+	runEntry
+	Tags        []string       `json:"tags,omitempty"`
+	StageStatus []stageSummary `json:"stage_status,omitempty"`
+}
+
+// startJSONOutput moves the human output to stderr and returns the writer of
+// the JSON events on the original stdout.
+func startJSONOutput() *jsonOutput {
+	j := &jsonOutput{enc: json.NewEncoder(os.Stdout), tracker: newStageTracker()}
+	os.Stdout = os.Stderr
+	return j
+}
+
+// attach makes j report the stages of ecr.
+func (j *jsonOutput) attach(ecr *ECR) {
+	profile := ecr.Profile
+	ecr.onStage = func(event stageEvent) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		line := jsonStageEvent{Type: "stage", Profile: profile, stageEvent: event}
+		line.Seconds = j.tracker.record(profile, event)
+		j.enc.Encode(line)
+	}
+}
+
+// summary prints the summary of ecr's run, started at started, which ended
+// with err.
+func (j *jsonOutput) summary(ecr *ECR, started time.Time, err error) {
+	summary := runSummary{Type: "summary", runEntry: newRunEntry(ecr.runID, "cli", ecr, started, err)}
+	if ecr.upToDate {
+		summary.Status = "up to date"
+	}
+	if ecr.Config != nil && err == nil && !ecr.upToDate {
+		summary.Tags = ecr.pushedTags()
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	summary.StageStatus = j.tracker.stages[ecr.Profile]
+	j.enc.Encode(summary)
+}
+
+func (j *jsonOutput) finish() {}
+
+// pushedTags returns the tags of the pushed image: image_tag, the other
+// image_tags and the aliases.
+func (ecr *ECR) pushedTags() []string {
+	if ecr.Config.ECR.PushByDigest {
+		return nil
+	}
+	tags := append([]string{ecr.Config.ECR.ImageTag}, ecr.extraTags()...)
+	aliases, _ := ecr.aliasTags()
+	var aliased []string
+	for _, tag := range aliases {
+		if !contains(tags, tag) && !contains(aliased, tag) {
+			aliased = append(aliased, tag)
+		}
+	}
+	sort.Strings(aliased)
+	return append(tags, aliased...)
+}
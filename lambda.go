@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LambdaDeployConfig points a container image Lambda function at the pushed
+// digest and waits until the update is done and the function is Active.
+type LambdaDeployConfig struct {
+	FunctionName string `mapstructure:"function_name"` // name or ARN
+	Region       string `mapstructure:"region"`        // default ecr.region
+	Publish      bool   `mapstructure:"publish"`       // publish a version with the update
+	Timeout      string `mapstructure:"timeout"`       // default 5m
+	Interval     string `mapstructure:"interval"`      // default 5s
+}
+
+func (c LambdaDeployConfig) enabled() bool {
+	return c.FunctionName != ""
+}
+
+func (c LambdaDeployConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	for name, value := range map[string]string{"deploy.lambda.timeout": c.Timeout, "deploy.lambda.interval": c.Interval} {
+		if d, err := time.ParseDuration(orDefault(value, "1s")); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s '%s'", name, value)
+		}
+	}
+	return nil
+}
+
+// lambdaFunction is the part of a function's configuration deployLambda reads.
+type lambdaFunction struct {
+	FunctionArn          string `json:"FunctionArn"`
+	Version              string `json:"Version"`
+	PackageType          string `json:"PackageType"`
+	State                string `json:"State"`
+	StateReason          string `json:"StateReason"`
+	LastUpdateStatus     string `json:"LastUpdateStatus"`
+	LastUpdateStatusText string `json:"LastUpdateStatusReason"`
+}
+
+func (ecr *ECR) lambdaCLI(args ...string) (*lambdaFunction, error) {
+	out, err := ecr.deployCLI(ecr.Config.Deploy.Lambda.Region, append([]string{"lambda"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	var function lambdaFunction
+	if err := json.Unmarshal(out, &function); err != nil {
+		return nil, errorf(KeyAWSBadResponse, "lambda "+args[0], err)
+	}
+	return &function, nil
+}
+
+func (ecr *ECR) deployLambda() error {
+	c := ecr.Config.Deploy.Lambda
+	image, err := ecr.pushedDigestURI()
+	if err != nil {
+		return err
+	}
+	ecr.stage(ColorCyan, "Deploying "+image+" to Lambda function "+c.FunctionName)
+
+	function, err := ecr.lambdaCLI("get-function-configuration", "--function-name", c.FunctionName)
+	if isAWSError(err, "ResourceNotFoundException") {
+		return withCode(ErrCodeDeployFailed, fmt.Errorf("Lambda function %s does not exist", c.FunctionName))
+	}
+	if err != nil {
+		return classify(ErrCodeDeployFailed, err.Error(), errorf(KeyLambdaReadFailed, c.FunctionName, err))
+	}
+	if function.PackageType != "Image" {
+		return withCode(ErrCodeConfigInvalid, fmt.Errorf("Lambda function %s is a %s function, not a container image one", c.FunctionName, function.PackageType))
+	}
+	// A function still applying a previous update rejects a new one.
+	if function.LastUpdateStatus == "InProgress" {
+		if _, err := ecr.waitLambda(); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"update-function-code", "--function-name", c.FunctionName, "--image-uri", image}
+	if c.Publish {
+		args = append(args, "--publish")
+	}
+	updated, err := ecr.lambdaCLI(args...)
+	if err != nil {
+		return classify(ErrCodeDeployFailed, err.Error(), errorf(KeyLambdaUpdateFailed, c.FunctionName, err))
+	}
+	fmt.Fprintf(&ecr.logs, "lambda function %s updated to %s\n", c.FunctionName, image)
+
+	if _, err := ecr.waitLambda(); err != nil {
+		return err
+	}
+	message := "Function " + c.FunctionName + " is Active on " + image
+	if c.Publish {
+		message += " (version " + updated.Version + ")"
+	}
+	fmt.Println(ColorGreen + message + ColorReset)
+	return nil
+}
+
+// waitLambda polls the function until its last update finished and it is
+// Active, or deploy.lambda.timeout passes.
+func (ecr *ECR) waitLambda() (*lambdaFunction, error) {
+	c := ecr.Config.Deploy.Lambda
+	timeout, _ := time.ParseDuration(orDefault(c.Timeout, "5m"))
+	interval, _ := time.ParseDuration(orDefault(c.Interval, "5s"))
+	deadline := time.Now().Add(timeout)
+	for {
+		function, err := ecr.lambdaCLI("get-function-configuration", "--function-name", c.FunctionName)
+		if err != nil {
+			return nil, classify(ErrCodeDeployFailed, err.Error(), errorf(KeyLambdaReadFailed, c.FunctionName, err))
+		}
+		switch {
+		case function.LastUpdateStatus == "Failed":
+			return nil, withCode(ErrCodeDeployFailed, fmt.Errorf("update of %s failed: %s", c.FunctionName, function.LastUpdateStatusText))
+		case function.State == "Failed":
+			return nil, withCode(ErrCodeDeployFailed, fmt.Errorf("Lambda function %s failed: %s", c.FunctionName, function.StateReason))
+		case function.LastUpdateStatus != "InProgress" && function.State == "Active":
+			return function, nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return nil, withCode(ErrCodeDeployFailed, fmt.Errorf("Lambda function %s was not Active within %s (state %s, update %s)",
+				c.FunctionName, timeout, function.State, function.LastUpdateStatus))
+		}
+		if err := sleepContext(ecr.context(), interval); err != nil {
+			return nil, err
+		}
+	}
+}
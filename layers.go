@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// layerImage is the resolved manifest of one profile's image.
+type layerImage struct {
+	Profile  string
+	Image    string
+	Manifest *manifest
+}
+
+func runLayers(args []string) {
+	fs := flag.NewFlagSet("layers", flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	profiles := fs.String("profiles", "", "Comma-separated profiles to analyze (default: every profile)")
+	platform := fs.String("platform", "linux/amd64", "Platform to analyze when images are multi-arch manifest lists")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s layers [-config deploy.yml] [-profiles api,worker,web] [-platform linux/amd64]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	exitOnError("Error loading configuration", err)
+	var names []string
+	if *profiles != "" {
+		names = strings.Split(*profiles, ",")
+	} else {
+		for name := range config.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var images []layerImage
+	for _, name := range names {
+		profileConfig, err := loadProfile(*configPath, name)
+		exitOnError("Invalid configuration", err)
+		ecr := &ECR{Profile: name, Config: profileConfig}
+		m, _, err := ecr.resolveManifest(profileConfig.ECR.ImageTag, *platform)
+		exitOnError("Could not read the image of profile "+name, err)
+		images = append(images, layerImage{Profile: name, Image: profileConfig.ECR.Repository + ":" + profileConfig.ECR.ImageTag, Manifest: m})
+	}
+	if len(images) < 2 {
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("layer sharing needs at least two profiles")))
+	}
+	reportLayerSharing(images)
+}
+
+// reportLayerSharing prints the size of each image, the layers several
+// images share and the bytes a registry stores once for all of them, then
+// suggests consolidating images that start from different base layers.
+func reportLayerSharing(images []layerImage) {
+	users := map[string][]string{}
+	sizes := map[string]int64{}
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tIMAGE\tLAYERS\tSIZE")
+	for _, image := range images {
+		var size int64
+		for _, layer := range image.Manifest.Layers {
+			size += layer.Size
+			sizes[layer.Digest] = layer.Size
+			if !contains(users[layer.Digest], image.Profile) {
+				users[layer.Digest] = append(users[layer.Digest], image.Profile)
+			}
+		}
+		total += size
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", image.Profile, image.Image, len(image.Manifest.Layers), formatBytes(size))
+	}
+	w.Flush()
+
+	var unique, sharedBytes int64
+	var shared []string
+	for digest, profiles := range users {
+		unique += sizes[digest]
+		if len(profiles) > 1 {
+			shared = append(shared, digest)
+			sharedBytes += sizes[digest]
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool { return sizes[shared[i]] > sizes[shared[j]] })
+
+	fmt.Printf("\nShared layers: %d (%s)\n", len(shared), formatBytes(sharedBytes))
+	for _, digest := range shared {
+		fmt.Printf("  %s %s: %s\n", shortDigest(digest), formatBytes(sizes[digest]), strings.Join(users[digest], ", "))
+	}
+	fmt.Printf("Unique bytes stored: %s of %s total (%s saved by sharing)\n", formatBytes(unique), formatBytes(total), formatBytes(total-unique))
+
+	// Images whose first layer differs come from different base images.
+	bases := map[string][]layerImage{}
+	for _, image := range images {
+		if len(image.Manifest.Layers) > 0 {
+			first := image.Manifest.Layers[0].Digest
+			bases[first] = append(bases[first], image)
+		}
+	}
+	if len(bases) < 2 {
+		return
+	}
+	digests := make([]string, 0, len(bases))
+	for digest := range bases {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+	common := digests[0]
+	for _, digest := range digests {
+		if len(bases[digest]) > len(bases[common]) {
+			common = digest
+		}
+	}
+	fmt.Printf("\n%d different base layers. Moving these images to the base of %s would let them share it:\n", len(bases), strings.Join(layerProfiles(bases[common]), ", "))
+	for _, digest := range digests {
+		if digest != common {
+			fmt.Printf(ColorYellow+"  %s (base layer %s, %s)"+ColorReset+"\n", strings.Join(layerProfiles(bases[digest]), ", "), shortDigest(digest), formatBytes(sizes[digest]))
+		}
+	}
+}
+
+func layerProfiles(images []layerImage) []string {
+	names := make([]string, len(images))
+	for i, image := range images {
+		names[i] = image.Profile
+	}
+	return names
+}
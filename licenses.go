@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+)
+
+// LicensePolicy checks the licenses in the SBOM of the built image before it
+// is pushed. A license matching Deny, or any license outside Allow when it is
+// set, is a violation. Patterns are SPDX IDs with path.Match wildcards, e.g.
+// "GPL-*" or "AGPL-3.0-*", compared ignoring case.
+type LicensePolicy struct {
+	Deny          []string `mapstructure:"deny"`
+	Allow         []string `mapstructure:"allow"`
+	Exempt        []string `mapstructure:"exempt"`          // package name patterns not checked
+	FailOnUnknown bool     `mapstructure:"fail_on_unknown"` // packages without license information
+	SBOMCommand   string   `mapstructure:"sbom_command"`    // prints an SPDX or CycloneDX JSON SBOM; default syft
+	Report        string   `mapstructure:"report"`          // default .pushecr/license-report.json
+}
+
+func (p LicensePolicy) enabled() bool {
+	return len(p.Deny) > 0 || len(p.Allow) > 0
+}
+
+// licenseViolation is a package of the report.
+type licenseViolation struct {
+	Package string `json:"package"`
+	Version string `json:"version,omitempty"`
+	License string `json:"license"`
+	Reason  string `json:"reason"`
+}
+
+// checkLicensePolicy generates the SBOM of the image just built and fails
+// with PUSHECR_POLICY_VIOLATION, after printing and writing the report, when
+// a package's license is not allowed.
+func (ecr *ECR) checkLicensePolicy() error {
+	policy := ecr.Config.Policy.Licenses
+	if !policy.enabled() {
+		return nil
+	}
+	if ecr.multiPlatform() {
+		fmt.Println(ColorYellow + "Skipping the license check: multi-platform images are not loaded into the local image store" + ColorReset)
+		return nil
+	}
+	image := ecr.Config.Docker.ImageName + ":" + ecr.Config.ECR.ImageTag
+	ecr.stage(ColorCyan, "Checking the licenses of "+image)
+	packages, err := ecr.generateSBOM(image)
+	if err != nil {
+		return err
+	}
+
+	var violations []licenseViolation
+	for _, pkg := range packages {
+		if matchesAny(pkg.Name, policy.Exempt) {
+			continue
+		}
+		if len(pkg.Licenses) == 0 {
+			if policy.FailOnUnknown {
+				violations = append(violations, licenseViolation{pkg.Name, pkg.Version, "-", "no license information"})
+			}
+			continue
+		}
+		for _, license := range pkg.Licenses {
+			if reason := policy.check(license); reason != "" {
+				violations = append(violations, licenseViolation{pkg.Name, pkg.Version, license, reason})
+				break
+			}
+		}
+	}
+
+	report := orDefault(policy.Report, statePath("license-report.json"))
+	data, _ := json.MarshalIndent(map[string]interface{}{
+		"image":      image,
+		"packages":   len(packages),
+		"violations": violations,
+	}, "", "  ")
+	if err := writeFileAtomic(report, append(data, '\n')); err != nil {
+		return errorf(KeyFileWriteFailed, report, err)
+	}
+	if len(violations) == 0 {
+		fmt.Printf(ColorGreen+"License check passed (%d packages)"+ColorReset+"\n", len(packages))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tVERSION\tLICENSE\tREASON")
+	for _, v := range violations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Package, orDefault(v.Version, "-"), v.License, v.Reason)
+	}
+	w.Flush()
+	return withCode(ErrCodePolicyViolation, fmt.Errorf("%d of %d packages have licenses the policy does not allow (report in %s)", len(violations), len(packages), report))
+}
+
+// generateSBOM runs policy.licenses.sbom_command, or syft, on image.
+func (ecr *ECR) generateSBOM(image string) ([]sbomPackage, error) {
+	command := ecr.Config.Policy.Licenses.SBOMCommand
+	cmd := exec.CommandContext(ecr.context(), "syft", "scan", "docker:"+image, "-o", "spdx-json", "-q")
+	if command != "" {
+		cmd = shellCommand(ecr.context(), command)
+		cmd.Env = append(os.Environ(), "PUSHECR_LOCAL_IMAGE="+image)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = ecr.output(&stderr)
+	if err := cmd.Run(); err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return nil, errorf(KeySBOMFailed, errors.New(line))
+		}
+		return nil, errorf(KeySBOMFailed, err)
+	}
+	return parseSBOM(stdout.Bytes())
+}
+
+// check returns why expression, an SPDX license expression, is not allowed,
+// or "" when it is. With OR one allowed choice is enough; with AND every
+// license must be allowed. WITH exceptions are checked as their license.
+func (p LicensePolicy) check(expression string) string {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+	deny, allow := upperAll(p.Deny), upperAll(p.Allow)
+	var denied, notAllowed []string
+	allowed := func(id string) bool {
+		switch upper := strings.ToUpper(id); {
+		case matchesAny(upper, deny):
+			denied = append(denied, id)
+			return false
+		case len(allow) > 0 && !matchesAny(upper, allow):
+			notAllowed = append(notAllowed, id)
+			return false
+		}
+		return true
+	}
+
+	// or := and {OR and}; and := term {AND term}; term := ( or ) | id [WITH id]
+	pos := 0
+	var or func() bool
+	term := func() bool {
+		if pos >= len(tokens) {
+			return true
+		}
+		token := tokens[pos]
+		pos++
+		if token == "(" {
+			ok := or()
+			if pos < len(tokens) && tokens[pos] == ")" {
+				pos++
+			}
+			return ok
+		}
+		if pos+1 < len(tokens) && strings.EqualFold(tokens[pos], "WITH") {
+			pos += 2
+		}
+		return allowed(token)
+	}
+	and := func() bool {
+		ok := term()
+		for pos < len(tokens) && strings.EqualFold(tokens[pos], "AND") {
+			pos++
+			ok = term() && ok
+		}
+		return ok
+	}
+	or = func() bool {
+		ok := and()
+		for pos < len(tokens) && strings.EqualFold(tokens[pos], "OR") {
+			pos++
+			ok = and() || ok
+		}
+		return ok
+	}
+	if or() {
+		return ""
+	}
+	if len(denied) > 0 {
+		return "denied: " + strings.Join(denied, ", ")
+	}
+	return "not in allow: " + strings.Join(notAllowed, ", ")
+}
+
+func upperAll(values []string) []string {
+	upper := make([]string, len(values))
+	for i, value := range values {
+		upper[i] = strings.ToUpper(value)
+	}
+	return upper
+}
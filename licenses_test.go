@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestLicensePolicyCheck(t *testing.T) {
+	deny := LicensePolicy{Deny: []string{"GPL-*", "AGPL-3.0-*"}}
+	allow := LicensePolicy{Allow: []string{"MIT", "Apache-2.0", "BSD-*"}}
+	both := LicensePolicy{Deny: []string{"GPL-*"}, Allow: []string{"MIT", "GPL-*"}}
+
+	for _, test := range []struct {
+		name       string
+		policy     LicensePolicy
+		expression string
+		want       string
+	}{
+		{"not denied", deny, "MIT", ""},
+		{"denied", deny, "GPL-3.0-only", "denied: GPL-3.0-only"},
+		{"denied ignoring case", deny, "gpl-2.0-or-later", "denied: gpl-2.0-or-later"},
+		{"LGPL is not GPL-*", deny, "LGPL-2.1-only", ""},
+		{"allowed", allow, "Apache-2.0", ""},
+		{"allowed by pattern", allow, "BSD-3-Clause", ""},
+		{"not allowed", allow, "MPL-2.0", "not in allow: MPL-2.0"},
+		{"OR with an allowed choice", allow, "MIT OR GPL-2.0-only", ""},
+		{"OR with no allowed choice", deny, "GPL-2.0-only OR AGPL-3.0-only", "denied: GPL-2.0-only, AGPL-3.0-only"},
+		{"AND with a denied license", deny, "MIT AND GPL-3.0-only", "denied: GPL-3.0-only"},
+		{"AND of allowed licenses", allow, "MIT AND Apache-2.0", ""},
+		{"parentheses", allow, "(MIT OR MPL-2.0) AND BSD-2-Clause", ""},
+		{"parentheses with a violation", allow, "(MIT OR Apache-2.0) AND EPL-2.0", "not in allow: EPL-2.0"},
+		{"WITH exception", deny, "GPL-2.0-only WITH Classpath-exception-2.0", "denied: GPL-2.0-only"},
+		{"WITH exception allowed", allow, "Apache-2.0 WITH LLVM-exception", ""},
+		{"deny wins over allow", both, "GPL-3.0-only", "denied: GPL-3.0-only"},
+	} {
+		if got := test.policy.check(test.expression); got != test.want {
+			t.Errorf("%s: check(%q) = %q, want %q", test.name, test.expression, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// lifecycleExpiration is one image a lifecycle policy preview would expire.
+type lifecycleExpiration struct {
+	Digest   string    `json:"imageDigest"`
+	Tags     []string  `json:"imageTags"`
+	PushedAt time.Time `json:"imagePushedAt"`
+	Rule     int       `json:"appliedRulePriority"`
+}
+
+func runLifecycle(args []string) {
+	if len(args) == 0 || args[0] != "apply" {
+		fmt.Fprintf(os.Stderr, "Uso: %s lifecycle apply [-config deploy.yml] [-profile dev] -policy lifecycle.json [-preview] [-force]\n", os.Args[0])
+		os.Exit(2)
+	}
+	fs, configPath, profile := commandFlags("lifecycle apply", "lifecycle apply [-config deploy.yml] [-profile dev] -policy lifecycle.json [-preview] [-force]")
+	policyPath := fs.String("policy", "", "Lifecycle policy JSON file (default ecr.lifecycle_policy)")
+	preview := fs.Bool("preview", false, "Only show which images the policy would expire and the storage reclaimed")
+	force := fs.Bool("force", false, "Apply the policy even if it would expire held images")
+	fs.Parse(args[1:])
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	path := orDefault(*policyPath, profileConfig.ECR.LifecyclePolicy)
+	if path == "" {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("-policy or ecr.lifecycle_policy is required")))
+	}
+	policy, err := os.ReadFile(path)
+	exitOnError("Could not read lifecycle policy", err)
+	if !json.Valid(policy) {
+		exitOnError("Invalid lifecycle policy", withCode(ErrCodeConfigInvalid, fmt.Errorf("%s is not valid JSON", path)))
+	}
+
+	expired, err := ecr.previewLifecycle(string(policy))
+	exitOnError("Lifecycle preview failed", err)
+	held, err := ecr.printExpirations(expired)
+	exitOnError("Could not read repository images", err)
+	if *preview {
+		return
+	}
+
+	exitOnError("Lifecycle policy refused", ecr.authorizeCommand("lifecycle apply", ""))
+	if held > 0 && !*force {
+		exitOnError("Lifecycle policy refused", withCode(ErrCodePolicyViolation, fmt.Errorf("the policy would expire %d held image(s); exclude the %s tag prefix from its rules or use -force", held, holdTagPrefix)))
+	}
+	_, err = ecr.awsCLI("ecr", "put-lifecycle-policy",
+		"--repository-name", profileConfig.ECR.Repository,
+		"--lifecycle-policy-text", string(policy))
+	exitOnError("Could not apply lifecycle policy", err)
+	fmt.Println(ColorGreen + "Lifecycle policy applied to " + profileConfig.ECR.Repository + ColorReset)
+}
+
+// previewLifecycle runs ECR's lifecycle policy preview for policy and waits
+// for its result. The preview does not change the repository's policy.
+func (ecr *ECR) previewLifecycle(policy string) ([]lifecycleExpiration, error) {
+	ecr.stage(ColorCyan, "Previewing lifecycle policy on "+ecr.Config.ECR.Repository)
+	_, err := ecr.awsCLI("ecr", "start-lifecycle-policy-preview",
+		"--repository-name", ecr.Config.ECR.Repository,
+		"--lifecycle-policy-text", policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		out, err := ecr.awsCLI("ecr", "get-lifecycle-policy-preview", "--repository-name", ecr.Config.ECR.Repository)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Status         string                `json:"status"`
+			PreviewResults []lifecycleExpiration `json:"previewResults"`
+		}
+		if err := json.Unmarshal(out, &result); err != nil {
+			return nil, errorf(KeyAWSBadResponse, "get-lifecycle-policy-preview", err)
+		}
+		switch result.Status {
+		case "COMPLETE":
+			return result.PreviewResults, nil
+		case "FAILED", "EXPIRED":
+			return nil, errorf(KeyLifecyclePreviewFailed, result.Status)
+		}
+		if attempt >= 60 {
+			return nil, errorf(KeyLifecyclePreviewTimedOut)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// printExpirations lists the images that would expire with the storage
+// they use and returns how many of them are held.
+func (ecr *ECR) printExpirations(expired []lifecycleExpiration) (int, error) {
+	if len(expired) == 0 {
+		fmt.Println(ColorGreen + "The policy would not expire any image" + ColorReset)
+		return 0, nil
+	}
+	images, err := ecr.listImages()
+	if err != nil {
+		return 0, err
+	}
+	details := map[string]imageDetail{}
+	for _, image := range images {
+		details[image.Digest] = image
+	}
+
+	var reclaimed int64
+	held := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DIGEST\tTAGS\tPUSHED\tSIZE\tRULE")
+	for _, e := range expired {
+		image := details[e.Digest]
+		reclaimed += image.Size
+		tags := strings.Join(e.Tags, ", ")
+		if isHeld(image) {
+			held++
+			tags += ColorRed + " (HELD)" + ColorReset
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", shortDigest(e.Digest), orDefault(tags, "<untagged>"), e.PushedAt.Local().Format("2006-01-02 15:04"), formatBytes(image.Size), e.Rule)
+	}
+	w.Flush()
+	fmt.Printf("%d image(s) would expire, reclaiming %s\n", len(expired), formatBytes(reclaimed))
+	return held, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LintConfig tunes pushecr lint for a profile.
+type LintConfig struct {
+	// Production marks the profile as production; profiles whose name
+	// contains "prod" are treated as production too.
+	Production bool `mapstructure:"production"`
+	// Ignore lists the rules not reported for the profile.
+	Ignore []string `mapstructure:"ignore"`
+	// ContextSizeMB is the build context size above which a missing
+	// .dockerignore is reported (default 100).
+	ContextSizeMB int `mapstructure:"context_size_mb"`
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// lintRules are the rules pushecr lint knows, with their severity.
+var lintRules = map[string]string{
+	"mutable-latest":   severityError,
+	"wildcard-policy":  severityError,
+	"scan-on-push":     severityWarning,
+	"unpinned-base":    severityWarning,
+	"lifecycle-policy": severityWarning,
+	"dockerignore":     severityWarning,
+}
+
+type lintFinding struct {
+	Profile string
+	Rule    string
+	Message string
+}
+
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	profiles := fs.String("profiles", "", "Comma-separated profiles to lint (default: every profile)")
+	ignore := fs.String("ignore", "", "Comma-separated rules to ignore in every profile")
+	offline := fs.Bool("offline", false, "Only lint the configuration and Dockerfile, without calling AWS")
+	strict := fs.Bool("strict", false, "Fail on warnings too")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s lint [-config deploy.yml] [-profiles dev,prod] [-ignore rule,...] [-offline] [-strict]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	exitOnError("Error loading configuration", err)
+	var names []string
+	if *profiles != "" {
+		names = strings.Split(*profiles, ",")
+	} else {
+		for name := range config.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var ignored []string
+	if *ignore != "" {
+		ignored = strings.Split(*ignore, ",")
+	}
+	for _, rule := range ignored {
+		if _, ok := lintRules[rule]; !ok {
+			exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("unknown lint rule '%s'", rule)))
+		}
+	}
+	if !*offline {
+		exitOnError("Could not assume the workspace role", config.assumeWorkspaceRole())
+	}
+
+	var findings []lintFinding
+	for _, name := range names {
+		profileConfig, err := config.profile(name)
+		exitOnError("Invalid configuration", err)
+		if err := validateConfig(profileConfig); err != nil {
+			exitOnError("Invalid configuration", withCode(ErrCodeConfigInvalid, err))
+		}
+		ecr := &ECR{Profile: name, Config: profileConfig}
+		for _, f := range ecr.lint(!*offline) {
+			if !contains(ignored, f.Rule) && !contains(profileConfig.Lint.Ignore, f.Rule) {
+				findings = append(findings, f)
+			}
+		}
+	}
+
+	errs, warnings := 0, 0
+	for _, f := range findings {
+		color := ColorYellow
+		if lintRules[f.Rule] == severityError {
+			color = ColorRed
+			errs++
+		} else {
+			warnings++
+		}
+		fmt.Printf(color+"%-7s %s [%s] %s"+ColorReset+"\n", lintRules[f.Rule], f.Profile, f.Rule, f.Message)
+	}
+	fmt.Printf("%d error(s), %d warning(s) in %d profile(s)\n", errs, warnings, len(names))
+	if errs > 0 || *strict && warnings > 0 {
+		exitOnError("Lint failed", withCode(ErrCodePolicyViolation, fmt.Errorf("the configuration has %d error(s) and %d warning(s)", errs, warnings)))
+	}
+}
+
+// lint returns the findings for the profile. Remote checks read the
+// repository settings from ECR.
+func (ecr *ECR) lint(remote bool) []lintFinding {
+	var findings []lintFinding
+	report := func(rule, format string, args ...any) {
+		findings = append(findings, lintFinding{Profile: ecr.Profile, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	production := ecr.Config.Lint.Production || strings.Contains(strings.ToLower(ecr.Profile), "prod")
+	if production && ecr.Config.ECR.ImageTag == "latest" {
+		report("mutable-latest", "production profile pushes the mutable tag 'latest'; use a version or commit tag")
+	}
+
+	if d, err := ecr.localDockerfile(); err == nil {
+		for _, from := range d.bases() {
+			if _, digest := splitDigest(from.Image); digest == "" {
+				report("unpinned-base", "%s:%d: base image %s is not pinned to a digest (see pin-bases)", d.Path, from.Line+1, from.Image)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(ecr.buildContext(), ".dockerignore")); os.IsNotExist(err) && !ecr.remoteContext() {
+		limit := int64(100) << 20
+		if ecr.Config.Lint.ContextSizeMB > 0 {
+			limit = int64(ecr.Config.Lint.ContextSizeMB) << 20
+		}
+		if size := contextSize(ecr.buildContext()); size > limit {
+			report("dockerignore", "the build context is %s and has no .dockerignore (see gen-dockerignore)", formatBytes(size))
+		}
+	}
+
+	if !remote {
+		return findings
+	}
+	repository := ecr.Config.ECR.Repository
+
+	out, err := ecr.awsCLI("ecr", "describe-repositories", "--repository-names", repository)
+	if err == nil {
+		var result struct {
+			Repositories []struct {
+				ImageScanningConfiguration struct {
+					ScanOnPush bool `json:"scanOnPush"`
+				} `json:"imageScanningConfiguration"`
+			} `json:"repositories"`
+		}
+		if json.Unmarshal(out, &result) == nil && len(result.Repositories) > 0 && !result.Repositories[0].ImageScanningConfiguration.ScanOnPush {
+			report("scan-on-push", "%s does not scan images on push, so vulnerabilities are not gated", repository)
+		}
+	} else {
+		fmt.Println(ColorYellow + "  " + ecr.Profile + ": " + err.Error() + ColorReset)
+	}
+
+	if _, err := ecr.awsCLI("ecr", "get-lifecycle-policy", "--repository-name", repository); isAWSError(err, "LifecyclePolicyNotFoundException") {
+		report("lifecycle-policy", "%s has no lifecycle policy; old images are kept forever", repository)
+	}
+
+	out, err = ecr.awsCLI("ecr", "get-repository-policy", "--repository-name", repository)
+	if err == nil {
+		var result struct {
+			PolicyText string `json:"policyText"`
+		}
+		if json.Unmarshal(out, &result) == nil && hasWildcardPrincipal(result.PolicyText) {
+			report("wildcard-policy", "the repository policy of %s allows any principal without conditions", repository)
+		}
+	}
+	return findings
+}
+
+// hasWildcardPrincipal reports whether an IAM policy document has an Allow
+// statement for "*" without a Condition.
+func hasWildcardPrincipal(policy string) bool {
+	var document struct {
+		Statement []struct {
+			Effect    string          `json:"Effect"`
+			Principal json.RawMessage `json:"Principal"`
+			Condition json.RawMessage `json:"Condition"`
+		} `json:"Statement"`
+	}
+	if json.Unmarshal([]byte(policy), &document) != nil {
+		return false
+	}
+	for _, statement := range document.Statement {
+		if statement.Effect != "Allow" || len(statement.Condition) > 0 {
+			continue
+		}
+		var principal any
+		if json.Unmarshal(statement.Principal, &principal) != nil {
+			continue
+		}
+		switch p := principal.(type) {
+		case string:
+			if p == "*" {
+				return true
+			}
+		case map[string]any:
+			if aws, ok := p["AWS"]; ok && (aws == "*" || contains(anyStrings(aws), "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyStrings(value any) []string {
+	list, _ := value.([]any)
+	var values []string
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
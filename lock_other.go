@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// lockFile is not available on this platform: concurrent invocations in the
+// same directory are not serialized.
+func lockFile(f *os.File, wait bool) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) {}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/viper"
+	"lpmg.xyz/goscripts/chain"
 )
 
 const (
@@ -19,83 +28,498 @@ const (
 )
 
 type Config struct {
-	Profiles map[string]ProfileConfig `mapstructure:"profiles"`
+	Profiles   map[string]ProfileConfig   `mapstructure:"profiles"`
+	Workspaces map[string]WorkspaceConfig `mapstructure:"workspaces"`
+	Serve      ServeConfig                `mapstructure:"serve"`
+	Worker     WorkerConfig               `mapstructure:"worker"`
+	History    HistoryConfig              `mapstructure:"history"`
+	Manifest   ManifestConfig             `mapstructure:"manifest"`
+	AWSAPI     AWSAPIConfig               `mapstructure:"aws_api"`
+	Tools      ToolsConfig                `mapstructure:"tools"`
+	Cache      CacheConfig                `mapstructure:"cache"`
+
+	// StrictAccountIDs rejects account IDs written as unquoted numbers
+	// instead of normalizing them (see normalizeAccountIDs).
+	StrictAccountIDs bool `mapstructure:"strict_account_ids"`
+
+	role       string
+	roleRegion string
 }
 
 type ProfileConfig struct {
-	ECR    ECRConfig    `mapstructure:"ecr"`
-	Docker DockerConfig `mapstructure:"docker"`
+	ECR       ECRConfig       `mapstructure:"ecr"`
+	Docker    DockerConfig    `mapstructure:"docker"`
+	Verify    VerifyConfig    `mapstructure:"verify"`
+	Policy    PolicyConfig    `mapstructure:"policy"`
+	Run       RunConfig       `mapstructure:"run"`
+	Lint      LintConfig      `mapstructure:"lint"`
+	Channels  ChannelsConfig  `mapstructure:"channels"`
+	Variants  []VariantConfig `mapstructure:"variants"`
+	Build     BuildConfig     `mapstructure:"build"`
+	Approval  ApprovalConfig  `mapstructure:"approval"`
+	CodeBuild CodeBuildConfig `mapstructure:"codebuild"`
+	Cleanup   CleanupConfig   `mapstructure:"cleanup"`
+	AWS       AWSConfig       `mapstructure:"aws"`
+	Hooks     HooksConfig     `mapstructure:"hooks"`
+	Deploy    DeployConfig    `mapstructure:"deploy"`
+	Push      PushConfig      `mapstructure:"push"`
+	Scan      ScanConfig      `mapstructure:"scan"`
+	Sign      SignConfig      `mapstructure:"sign"`
+
+	// Timeouts limit stages by name (see withTimeouts).
+	Timeouts map[string]StageTimeout `mapstructure:"timeouts"`
+
+	resolvedAt time.Time // when profile() resolved the templates
 }
 
 type ECRConfig struct {
-	Region     string `mapstructure:"region"`
-	AccountID  string `mapstructure:"account_id"`
-	Repository string `mapstructure:"repository"`
-	ImageTag   string `mapstructure:"image_tag"`
+	Region     string         `mapstructure:"region"`
+	AccountID  string         `mapstructure:"account_id"`
+	Repository string         `mapstructure:"repository"`
+	ImageTag   string         `mapstructure:"image_tag"`
+	TagGuard   TagGuardConfig `mapstructure:"tag_guard"`
+
+	// Regions lists more regions the pushed image is copied to, into the
+	// repository of the same name and account (see pushRegions). Region
+	// defaults to the first one.
+	Regions []string `mapstructure:"regions"`
+
+	// ImageTags replaces ImageTag with several tags pushed for the same
+	// image; the first one is the primary tag. Templates as in TagAliases.
+	ImageTags []string `mapstructure:"image_tags"`
+
+	// TagPrefix and TagSuffix decorate ImageTag and every ImageTags entry,
+	// e.g. "dev-" or "-rc". They are templates too.
+	TagPrefix string `mapstructure:"tag_prefix"`
+	TagSuffix string `mapstructure:"tag_suffix"`
+
+	// TagAliases maps alias names to tag templates, e.g. {stable: "{{.GitSHA}}"};
+	// every push also points the rendered tags at the pushed image.
+	TagAliases map[string]string `mapstructure:"tag_aliases"`
+
+	RepositoryTemplate string            `mapstructure:"repository_template"`
+	RepositoryValues   map[string]string `mapstructure:"repository_values"`
+
+	// LifecyclePolicy is the JSON file applied by pushecr lifecycle apply.
+	LifecyclePolicy string `mapstructure:"lifecycle_policy"`
+
+	// PushByDigest pushes the image untagged; image_tag is only used for
+	// the local image.
+	PushByDigest bool `mapstructure:"push_by_digest"`
+
+	// CreateIfMissing creates Repository, with the Create settings, when it
+	// does not exist instead of failing the push.
+	CreateIfMissing bool                   `mapstructure:"create_if_missing"`
+	Create          CreateRepositoryConfig `mapstructure:"create"`
+
+	// MountFrom lists base images (repository:tag) in the same registry
+	// whose layers are mounted into Repository before pushing.
+	MountFrom []string `mapstructure:"mount_from"`
+
+	// MetadataOnlyPush puts a new manifest over the layers already in ECR
+	// when a rebuild only changed labels (see pushMetadataOnly).
+	MetadataOnlyPush bool `mapstructure:"metadata_only_push"`
+
+	// AssumeRoleARN is a role assumed with the caller's credentials before
+	// every call to ECR, for registries in another account.
+	AssumeRoleARN   string `mapstructure:"assume_role_arn"`
+	ExternalID      string `mapstructure:"external_id"`
+	RoleSessionName string `mapstructure:"role_session_name"`
+
+	// Public pushes to ECR Public, as public.ecr.aws/<PublicAlias>/<Repository>,
+	// instead of the account's private registry (see public.go).
+	Public      bool              `mapstructure:"public"`
+	PublicAlias string            `mapstructure:"public_alias"`
+	CatalogData CatalogDataConfig `mapstructure:"catalog_data"`
+}
+
+type TagGuardConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Backup  bool   `mapstructure:"backup"`
+	LogFile string `mapstructure:"log_file"`
+
+	// SourceCheck compares the git source recorded in the labels of the
+	// image being overwritten with this build: "warn" or "fail".
+	SourceCheck string `mapstructure:"source_check"`
 }
 
 type DockerConfig struct {
-	ImageName string `mapstructure:"image_name"`
+	ImageName string        `mapstructure:"image_name"`
+	Mirror    string        `mapstructure:"mirror"`
+	Builder   BuilderConfig `mapstructure:"builder"`
+
+	// Context is the build context: a directory, or a git repository
+	// (https://github.com/org/repo.git#ref:dir) or tarball URL.
+	Context string `mapstructure:"context"`
+
+	// Dockerfile is the Dockerfile to build, relative to the working
+	// directory (or to Context when it is remote); <context>/Dockerfile by
+	// default.
+	Dockerfile string `mapstructure:"dockerfile"`
+
+	// BuildArgs are passed as --build-arg; ${NAME} in a value is replaced
+	// with the environment variable NAME.
+	BuildArgs map[string]string `mapstructure:"build_args"`
+
+	// Platforms are passed to the build; the ones the host cannot run
+	// natively need QEMU emulation, installed when InstallEmulators is set.
+	Platforms        []string `mapstructure:"platforms"`
+	InstallEmulators bool     `mapstructure:"install_emulators"`
+
+	// CacheFrom and CacheTo are BuildKit caches the build imports from and
+	// exports to: inline, a registry ref (:tag for a tag of the repository)
+	// or a full buildx cache spec (see cacheSpec).
+	CacheFrom []string `mapstructure:"cache_from"`
+	CacheTo   string   `mapstructure:"cache_to"`
 }
 
 type ECR struct {
-	Config *ProfileConfig
+	Profile string
+	Config  *ProfileConfig
+	Digest  string
+	logs    runLog
+	onStage func(stageEvent)
+	stages  []stage
+	actor   string // who started the run when not the local user, e.g. a Slack user
+	apiMode bool   // run by pushecr serve, whose timeout diagnostics include goroutines
+	runID   string
+
+	checkpoints bool              // write a checkpoint file per stage (see checkpoint)
+	middleware  chain.Chain[*ECR] // wraps every stage inside the default ones
+	ctx         context.Context   // of the running stage (see context)
+
+	rebuildIfBaseUpdated bool
+	skipIfExists         bool // skip the run when image_tag is already in ECR
+	force                bool // skip the pre-flight check of existing tags
+	interactive          bool // run from a terminal that can answer prompts
+	upToDate             bool
+	repositoryReady      bool   // the repository exists or was created in this run
+	pinnedDockerfile     string // the Dockerfile with the base images verified by the policy stage pinned
+	usage                []stageUsage
+	variant              *VariantConfig
+	variants             []variantResult
 }
 
 func main() {
-	configPath := flag.String("config", "deploy.yml", "Path to the configuration YAML file")
-	profile := flag.String("profile", "dev", "Configuration profile to use (e.g., dev, prod)")
-	flag.Usage = func() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	// Without a subcommand pushecr deploys, running the whole pipeline.
+	runPipelineCommand("deploy", os.Args[1:], func() {
 		fmt.Fprintf(os.Stderr, "Uso: %s -config deploy.yml -profile dev [opciones]\n", os.Args[0])
-		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "     %s <comando> [opciones]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Comandos: %s\n\n", strings.Join(commandNames(), ", "))
+	})
+}
+
+// runPipelineCommand runs the stages of a pipeline command (see
+// pipelineCommands). Only deploy accepts -only and -skip. usage prints the
+// header of the help text, or nil for the default one.
+func runPipelineCommand(name string, args []string, usage func()) {
+	fixed := pipelineCommands[name]
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	profile := fs.String("profile", "dev", "Configuration profile to use (e.g., dev, prod), a comma-separated list or all")
+	concurrency := fs.Int("concurrency", 1, "Profiles to run at the same time when -profile names several")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	diagnostics := fs.String("diagnostics", "", "Write a diagnostics bundle (.tar.gz) to this path if the run fails")
+	only, skip := new(string), new(string)
+	if fixed == nil {
+		only = fs.String("only", "", "Comma-separated stages to run, skipping the rest (e.g. auth,push)")
+		skip = fs.String("skip", "", "Comma-separated stages to skip (e.g. policy,guard)")
+	}
+	digestOnly := fs.Bool("digest-only", false, "Push the image by digest without any tag (same as ecr.push_by_digest)")
+	rebuildIfBaseUpdated := fs.Bool("rebuild-if-base-updated", false, "Only build and push when a base image digest changed since the last successful build")
+	statusLineMode := fs.Bool("status-line", false, "Show a single updating status line instead of the full output, which goes to a file in -log-dir")
+	logDir := fs.String("log-dir", statePath("logs"), "Directory for the run logs written in -status-line mode")
+	dockerfile := fs.String("dockerfile", "", "Dockerfile to build (overrides docker.dockerfile)")
+	buildContext := fs.String("context", "", "Build context directory or URL (overrides docker.context)")
+	awsProfile := fs.String("aws-profile", "", "Named profile from ~/.aws/config to use (overrides aws.profile)")
+	checkpoints := fs.Bool("checkpoints", false, "Write a JSON checkpoint per stage to .pushecr/checkpoints/<profile> for CI retries")
+	dryRun := fs.Bool("dry-run", false, "Print the resolved plan (commands, API calls and image URI) and exit without calling Docker or AWS")
+	skipIfExists := fs.Bool("skip-if-exists", false, "Skip the run, build included, when image_tag already exists in ECR")
+	force := fs.Bool("force", false, "Build and push without checking whether the tags already exist in ECR")
+	digestFile := fs.String("digest-file", "", "Write the pushed image as repository@sha256:... to this path")
+	output := fs.String("output", "text", "Output format: text; json or tap on stdout, with the human output on stderr; or github for GitHub Actions groups, annotations and job summary")
+	faultSpec := fs.String("fault-inject", "", "Fail stages on purpose to test retries, checkpoints and cleanup (see faults.go)")
+	fs.Usage = func() {
+		if usage != nil {
+			usage()
+		} else {
+			fmt.Fprintf(os.Stderr, "Uso: %s %s [-config deploy.yml] [-profile dev] [opciones]\n", os.Args[0], name)
+		}
+		printDefaults(fs, "fault-inject")
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if fixed != nil {
+		*only = strings.Join(fixed, ",")
+	}
+	if _, ok := renderers[*output]; !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *skipIfExists && *force {
+		fmt.Fprintln(os.Stderr, "-skip-if-exists and -force cannot be used together")
+		os.Exit(2)
+	}
+
+	ecr := &ECR{
+		Profile:              *profile,
+		runID:                newRunID(),
+		checkpoints:          *checkpoints,
+		rebuildIfBaseUpdated: *rebuildIfBaseUpdated,
+		skipIfExists:         *skipIfExists,
+		force:                *force,
+		interactive:          !*statusLineMode && *output == "text" && isTerminal(os.Stdin) && isTerminal(os.Stdout),
+	}
+	render := renderers[*output]()
+	defer render.finish()
+	summaries := 0
+	summarize := func(ecr *ECR, started time.Time, err error) {
+		summaries++
+		render.summary(ecr, started, err)
+	}
+	started := time.Now()
+
+	fail := func(message string, err error) {
+		fmt.Println(ColorRed + message + ": " + err.Error() + ColorReset)
+		fmt.Println("error-code: " + string(errorCode(err)))
+		fmt.Println("error-key: " + string(errorKey(err)))
+		if summaries == 0 {
+			summarize(ecr, started, err)
+		}
+		render.finish()
+		if *diagnostics != "" {
+			report := diagnosticsReport{
+				ConfigPath: *configPath,
+				Profile:    ecr.Profile,
+				Config:     ecr.Config,
+				Logs:       ecr.logs.Bytes(),
+				Err:        err,
+			}
+			if err := report.write(*diagnostics); err != nil {
+				fmt.Println(ColorRed + "Could not write diagnostics bundle: " + err.Error() + ColorReset)
+			} else {
+				fmt.Println(ColorYellow + "Diagnostics bundle written to " + *diagnostics + ColorReset)
+			}
+		}
+		os.Exit(1)
+	}
+
+	stages, err := selectStages(*only, *skip)
+	if err != nil {
+		fail("Invalid arguments", withCode(ErrCodeConfigInvalid, err))
+	}
+	ecr.stages = stages
+	faults, err := parseFaults(*faultSpec)
+	if err != nil {
+		fail("Invalid arguments", withCode(ErrCodeConfigInvalid, err))
+	}
+	if faults != nil && !*dryRun {
+		fmt.Println(ColorYellow + "Fault injection enabled: " + faults.String() + ColorReset)
+		ecr.middleware.Use(faults.middleware)
 	}
-	flag.Parse()
 
 	config, err := loadConfig(*configPath)
 	if err != nil {
-		fmt.Println(ColorRed + "Error loading configuration: " + err.Error() + ColorReset)
-		os.Exit(1)
+		fail("Error loading configuration", err)
+	}
+	if contains(stdoutRenderers, *output) && (*statusLineMode || *dryRun) {
+		fail("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("-output %s cannot be used with -status-line or -dry-run", *output)))
+	}
+	if !*dryRun {
+		if err := config.Tools.check(); err != nil {
+			fail("Tool requirements not met", err)
+		}
 	}
 
-	profileConfig, exists := config.Profiles[*profile]
-	if !exists {
-		fmt.Printf(ColorRed+"Profile '%s' not found in configuration"+ColorReset+"\n", *profile)
-		os.Exit(1)
+	// applyFlags applies the flags that change a profile's settings.
+	applyFlags := func(profileConfig *ProfileConfig) {
+		if *digestOnly {
+			profileConfig.ECR.PushByDigest = true
+		}
+		profileConfig.Docker.Dockerfile = orDefault(*dockerfile, profileConfig.Docker.Dockerfile)
+		profileConfig.Docker.Context = orDefault(*buildContext, profileConfig.Docker.Context)
+		profileConfig.AWS.Profile = orDefault(*awsProfile, profileConfig.AWS.Profile)
 	}
 
-	fmt.Printf(ColorYellow+"Loaded Configuration for profile '%s': %+v"+ColorReset+"\n", *profile, profileConfig)
+	names, err := config.profileNames(*profile)
+	if err != nil {
+		fail("Invalid profile", err)
+	}
+	if len(names) > 1 {
+		if *statusLineMode || *diagnostics != "" || *digestFile != "" {
+			fail("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("-status-line, -diagnostics and -digest-file need a single profile")))
+		}
+		prepare := func(name string) (*ECR, error) {
+			profileConfig, err := config.profile(name)
+			if err != nil {
+				return nil, err
+			}
+			applyFlags(profileConfig)
+			if err := validateConfig(profileConfig); err != nil {
+				return nil, withCode(ErrCodeConfigInvalid, err)
+			}
+			run := &ECR{
+				Profile:              name,
+				Config:               profileConfig,
+				runID:                newRunID(),
+				stages:               stages,
+				checkpoints:          *checkpoints,
+				rebuildIfBaseUpdated: *rebuildIfBaseUpdated,
+				skipIfExists:         *skipIfExists,
+				force:                *force,
+				// Prompts of parallel runs would compete for the terminal.
+				interactive: ecr.interactive && *concurrency <= 1,
+			}
+			if faults != nil {
+				run.middleware.Use(faults.middleware)
+			}
+			render.attach(run)
+			return run, nil
+		}
+		if *dryRun {
+			for _, name := range names {
+				run, err := prepare(name)
+				if err == nil {
+					err = run.printPlan(stages)
+				}
+				if err != nil {
+					fail("Could not plan profile "+name, err)
+				}
+				fmt.Println()
+			}
+			return
+		}
+		if err := config.assumeWorkspaceRole(); err != nil {
+			fail("Could not assume workspace role", err)
+		}
+		results := runProfiles(config, names, *concurrency, prepare)
+		config.autoPrune()
+		for _, r := range results {
+			run := r.run
+			if run == nil {
+				run = &ECR{Profile: r.Profile}
+			}
+			summarize(run, time.Now().Add(-r.Duration), r.Err)
+		}
+		if err := printProfileResults(results); err != nil {
+			fail("Run failed", err)
+		}
+		return
+	}
+	ecr.Profile = names[0]
 
-	if err := validateConfig(&profileConfig); err != nil {
-		fmt.Println(ColorRed + "Invalid configuration: " + err.Error() + ColorReset)
-		os.Exit(1)
+	profileConfig, err := config.profile(ecr.Profile)
+	if err != nil {
+		fail("Invalid profile", err)
 	}
+	applyFlags(profileConfig)
+	ecr.Config = profileConfig
 
-	ecr := &ECR{Config: &profileConfig}
+	if !*statusLineMode && !*dryRun {
+		fmt.Printf(ColorYellow+"Loaded Configuration for profile '%s': %+v"+ColorReset+"\n", ecr.Profile, profileConfig.masked())
+	}
 
-	if err := ecr.authenticate(); err != nil {
-		fmt.Println(ColorRed + "Authentication failed: " + err.Error() + ColorReset)
-		os.Exit(1)
+	if err := validateConfig(profileConfig); err != nil {
+		fail("Invalid configuration", withCode(ErrCodeConfigInvalid, err))
 	}
 
-	if err := ecr.build(); err != nil {
-		fmt.Println(ColorRed + "Build failed: " + err.Error() + ColorReset)
-		os.Exit(1)
+	if *dryRun {
+		if err := ecr.printPlan(stages); err != nil {
+			fail("Could not plan the run", err)
+		}
+		return
 	}
 
-	if err := ecr.tag(); err != nil {
-		fmt.Println(ColorRed + "Tag failed: " + err.Error() + ColorReset)
-		os.Exit(1)
+	if err := config.assumeWorkspaceRole(); err != nil {
+		fail("Could not assume workspace role", err)
 	}
 
-	if err := ecr.push(); err != nil {
-		fmt.Println(ColorRed + "Push failed: " + err.Error() + ColorReset)
-		os.Exit(1)
+	var status *statusLine
+	if *statusLineMode {
+		if status, err = startStatusLine(ecr, *logDir); err != nil {
+			fail("Could not start status line", err)
+		}
+	}
+
+	render.attach(ecr)
+	started = time.Now()
+	err = ecr.runPipeline()
+	recordRun(config.History, newRunEntry(ecr.runID, "cli", ecr, started, err))
+	recordDeployment(config.Manifest, ecr, err)
+	if status != nil {
+		status.finish(err)
+	}
+	config.autoPrune()
+	if err != nil {
+		var failed *stageError
+		if errors.As(err, &failed) {
+			fail(failed.Stage.Failure, failed.Err)
+		}
+		fail("Run failed", err)
 	}
 
+	if ecr.upToDate {
+		summarize(ecr, started, nil)
+		fmt.Println(ColorGreen + "Image is up to date, nothing was pushed" + ColorReset)
+		return
+	}
+	if contains(stageNamesOf(stages), "push") {
+		if err := ecr.writeCodeBuildOutputs(); err != nil {
+			fail("Could not write CodeBuild outputs", err)
+		}
+		if *digestFile != "" {
+			if err := ecr.writeDigestFile(*digestFile); err != nil {
+				fail("Could not write the digest file", err)
+			}
+		}
+	}
+	summarize(ecr, started, nil)
+	switch name {
+	case "login":
+		fmt.Println(ColorGreen + "Logged in to " + ecr.registry() + ColorReset)
+		return
+	case "build":
+		fmt.Println(ColorGreen + "Container built" + ColorReset)
+		return
+	case "push":
+		fmt.Println(ColorGreen + "Container pushed to ECR" + ColorReset)
+		return
+	}
+	if len(stages) < len(pipeline) {
+		fmt.Println(ColorGreen + "Stages completed: " + strings.Join(stageNamesOf(stages), ", ") + ColorReset)
+		return
+	}
+	if len(ecr.variants) > 0 {
+		fmt.Println(ColorGreen + "Container built and pushed to ECR with variants: " + variantNames(ecr.variants) + ColorReset)
+		return
+	}
 	fmt.Println(ColorGreen + "Container built and pushed to ECR" + ColorReset)
 }
 
 func loadConfig(configPath string) (*Config, error) {
+	name := configPath
+	if isRemoteConfig(configPath) {
+		path, err := fetchConfig(configPath)
+		if err != nil {
+			err = errorf(KeyConfigFetchFailed, configPath, err)
+			if errorCode(err) == ErrCodeUnknown {
+				err = withCode(ErrCodeConfigNotFound, err)
+			}
+			return nil, err
+		}
+		configPath = path
+	}
 	viper.SetConfigFile(configPath)
 	viper.SetConfigType("yaml")
 
@@ -103,12 +527,35 @@ func loadConfig(configPath string) (*Config, error) {
 	viper.SetDefault("profiles.dev.ecr.image_tag", "latest")
 
 	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error leyendo el archivo de configuración: %w", err)
+		code := ErrCodeConfigInvalid
+		if errors.Is(err, fs.ErrNotExist) {
+			code = ErrCodeConfigNotFound
+		}
+		return nil, withCode(code, errorf(KeyConfigReadFailed, err))
+	}
+
+	source := readConfigSource(name, configPath)
+	if err := source.normalizeAccountIDs(viper.GetBool("strict_account_ids")); err != nil {
+		return nil, withCode(ErrCodeConfigInvalid, err)
 	}
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("error parseando la configuración: %w", err)
+		return nil, withCode(ErrCodeConfigInvalid, errorf(KeyConfigParseFailed, source.decodeError(err)))
+	}
+	if err := config.applyExtends(source); err != nil {
+		return nil, withCode(ErrCodeConfigInvalid, errorf(KeyConfigExtendsFailed, err))
+	}
+	if err := config.Manifest.validate(); err != nil {
+		return nil, withCode(ErrCodeConfigInvalid, err)
+	}
+
+	configureAWSAPI(config.AWSAPI)
+
+	if workspace != "" {
+		if err := config.useWorkspace(workspace); err != nil {
+			return nil, err
+		}
 	}
 
 	return &config, nil
@@ -118,12 +565,12 @@ func validateConfig(config *ProfileConfig) error {
 	if config.ECR.Region == "" {
 		return fmt.Errorf("ecr.region is required")
 	}
-	if config.ECR.AccountID == "" {
+	if config.ECR.AccountID == "" && !config.ECR.Public {
 		return fmt.Errorf("ecr.account_id is required")
 	}
 	matched, err := regexp.MatchString(`^\d{12}$`, config.ECR.AccountID)
-	if err != nil || !matched {
-		return fmt.Errorf("ecr.account_id debe ser una cadena de 12 dígitos")
+	if config.ECR.AccountID != "" && (err != nil || !matched) {
+		return errorf(KeyAccountIDInvalid)
 	}
 	if config.ECR.Repository == "" {
 		return fmt.Errorf("ecr.repository is required")
@@ -131,68 +578,306 @@ func validateConfig(config *ProfileConfig) error {
 	if config.Docker.ImageName == "" {
 		return fmt.Errorf("docker.image_name is required")
 	}
-	return nil
+	if threshold := config.Cleanup.AutoPruneThreshold; threshold != "" {
+		if _, err := parseThreshold(threshold); err != nil {
+			return err
+		}
+	}
+	if err := config.Docker.validateCache(); err != nil {
+		return err
+	}
+	if config.Docker.Dockerfile != "" && config.Build.Prebuilt.enabled() {
+		return fmt.Errorf("docker.dockerfile cannot be used with build.prebuilt, which generates its own Dockerfile")
+	}
+	if push := config.Channels.Push; push != "" && !contains(config.Channels.Names, push) {
+		return fmt.Errorf("channels.push '%s' is not one of channels.names", push)
+	}
+	if check := config.ECR.TagGuard.SourceCheck; check != "" && check != "warn" && check != "fail" {
+		return fmt.Errorf("ecr.tag_guard.source_check must be warn or fail, got '%s'", check)
+	}
+	if err := config.ECR.Create.validate(); err != nil {
+		return err
+	}
+	if err := config.ECR.validatePublic(); err != nil {
+		return err
+	}
+	if err := config.ECR.validateRegions(); err != nil {
+		return err
+	}
+	if arn := config.ECR.AssumeRoleARN; arn != "" && !roleARNPattern.MatchString(arn) {
+		return fmt.Errorf("ecr.assume_role_arn '%s' is not an IAM role ARN (arn:aws:iam::<account>:role/<name>)", arn)
+	}
+	if config.ECR.AssumeRoleARN == "" && (config.ECR.ExternalID != "" || config.ECR.RoleSessionName != "") {
+		return fmt.Errorf("ecr.external_id and ecr.role_session_name need ecr.assume_role_arn")
+	}
+	if err := validateCommandPolicies(config.Policy.Commands); err != nil {
+		return err
+	}
+	if err := config.Push.validate(); err != nil {
+		return err
+	}
+	if err := config.Scan.validate(config.ECR.Public); err != nil {
+		return err
+	}
+	if err := config.Sign.validate(config.ECR.Public); err != nil {
+		return err
+	}
+	if err := validateTimeouts(config.Timeouts); err != nil {
+		return err
+	}
+	if err := config.Deploy.validate(); err != nil {
+		return err
+	}
+	if err := config.Approval.validate(); err != nil {
+		return err
+	}
+	return validateVariants(config.Variants)
 }
 
+// authenticate fetches the registry token, failing early on bad credentials.
+// The Engine API calls send the token with each request; only the docker CLI
+// and cosign need it stored with docker login (see dockerLogin).
 func (ecr *ECR) authenticate() error {
-	fmt.Println(ColorCyan + "Authenticating Docker with ECR" + ColorReset)
-	ecrRepo := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", ecr.Config.ECR.AccountID, ecr.Config.ECR.Region)
-	cmd := exec.Command("sh", "-c",
-		fmt.Sprintf("aws ecr get-login-password --region %s | docker login --username AWS --password-stdin %s",
-			ecr.Config.ECR.Region,
-			ecrRepo,
-		),
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	ecr.stage(ColorCyan, "Authenticating with ECR")
+	if _, _, err := ecr.registryCredentials(); err != nil {
+		return errorf(KeyAuthFailed, err)
+	}
+	return nil
+}
+
+// dockerLogins remembers the token each registry and identity was last
+// logged in with, so docker login runs again only for a renewed token.
+var dockerLogins = struct {
+	sync.Mutex
+	tokens map[string]string
+}{tokens: map[string]string{}}
+
+// dockerLogin stores the registry token with docker login for the tools that
+// read the docker CLI's credentials: buildx, when it pulls from or pushes to
+// the registry, and cosign.
+func (ecr *ECR) dockerLogin() error {
+	token, err := ecr.registryToken()
+	if err != nil {
+		return errorf(KeyAuthFailed, err)
+	}
+	key := ecr.tokenCacheKey()
+	dockerLogins.Lock()
+	defer dockerLogins.Unlock()
+	if dockerLogins.tokens[key] == token {
+		return nil
+	}
+	user, password, err := ecr.registryCredentials()
+	if err != nil {
+		return errorf(KeyAuthFailed, err)
+	}
+	cmd := exec.CommandContext(ecr.context(), "docker", "login", "--username", user, "--password-stdin", ecr.registry())
+	cmd.Stdin = strings.NewReader(password)
+	var stderr bytes.Buffer
+	cmd.Stdout = ecr.output(os.Stdout)
+	cmd.Stderr = ecr.output(os.Stderr, &stderr)
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error durante la autenticación con ECR: %w", err)
+		return classify(ErrCodeAuthFailed, stderr.String(), errorf(KeyAuthFailed, err))
 	}
+	dockerLogins.tokens[key] = token
 	return nil
 }
 
 func (ecr *ECR) build() error {
-	fmt.Println(ColorCyan + "Building container" + ColorReset)
-	build := exec.Command("docker", "build", "-t", ecr.Config.Docker.ImageName, ".")
-	build.Stdout = os.Stdout
-	build.Stderr = os.Stderr
-	if err := build.Run(); err != nil {
-		return fmt.Errorf("error al construir la imagen Docker: %w", err)
+	if err := ecr.checkDiskSpace(); err != nil {
+		return err
 	}
-	return nil
+	if err := ecr.ensureBuilder(); err != nil {
+		return err
+	}
+	if err := ecr.checkEmulation(); err != nil {
+		return err
+	}
+	if ecr.Config.Build.Prebuilt.enabled() {
+		if err := ecr.writePrebuiltDockerfile(); err != nil {
+			return err
+		}
+	}
+	ecr.stage(ColorCyan, "Building container")
+	output, err := ecr.dockerBuild()
+	if err != nil && isRateLimited(output) && ecr.Config.Docker.Mirror != "" && !ecr.remoteContext() {
+		fmt.Println(ColorYellow + "Docker Hub rate limit hit, retrying with mirror " + ecr.Config.Docker.Mirror + ColorReset)
+		dockerfile, rewriteErr := ecr.mirrorDockerfile(orDefault(ecr.pinnedDockerfile, ecr.dockerfilePath()))
+		if rewriteErr != nil {
+			return errorf(KeyBuildMirrorFailed, rewriteErr)
+		}
+		defer os.Remove(dockerfile)
+		output, err = ecr.dockerBuild("-f", dockerfile)
+	}
+	if err != nil {
+		return classify(ErrCodeBuildFailed, output, errorf(KeyBuildFailed, err))
+	}
+	if err := ecr.scanSecrets(); err != nil {
+		return err
+	}
+	return ecr.checkLicensePolicy()
+}
+
+// dockerBuild runs docker build with extra arguments and returns its stderr.
+func (ecr *ECR) dockerBuild(extra ...string) (string, error) {
+	if ecr.buildUsesRegistry() {
+		if err := ecr.dockerLogin(); err != nil {
+			return "", err
+		}
+	}
+	args := append(ecr.buildCommand(), "-t", ecr.Config.Docker.ImageName)
+	args = append(args, extra...)
+	build := exec.CommandContext(ecr.context(), "docker", append(args, ecr.buildContext())...)
+	var stderr bytes.Buffer
+	build.Stdout = ecr.output(os.Stdout)
+	build.Stderr = ecr.output(os.Stderr, &stderr)
+	err := build.Run()
+	return stderr.String(), err
+}
+
+// buildUsesRegistry reports whether the build pulls a base image or a cache
+// from the profile's registry, which needs Docker logged in to it. A
+// Dockerfile that cannot be read is assumed to.
+func (ecr *ECR) buildUsesRegistry() bool {
+	for _, entry := range append(append([]string{}, ecr.Config.Docker.CacheFrom...), ecr.Config.Docker.CacheTo) {
+		if entry == "" {
+			continue
+		}
+		ref := cacheOption(parseCacheSpec(ecr.cacheSpec(entry, false)), "ref")
+		if ref != "" && imageRegistry(ref) == ecr.registry() {
+			return true
+		}
+	}
+	d, err := ecr.localDockerfile()
+	if err != nil {
+		return true
+	}
+	for _, from := range d.bases() {
+		if imageRegistry(from.Image) == ecr.registry() {
+			return true
+		}
+	}
+	return false
 }
 
 func (ecr *ECR) tag() error {
-	fmt.Println(ColorYellow + "Tagging container" + ColorReset)
-	localImage := fmt.Sprintf("%s:%s", ecr.Config.Docker.ImageName, ecr.Config.ECR.ImageTag)
-	ecrImage := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s:%s",
-		ecr.Config.ECR.AccountID,
-		ecr.Config.ECR.Region,
-		ecr.Config.ECR.Repository,
-		ecr.Config.ECR.ImageTag,
-	)
-	tag := exec.Command("docker", "tag", localImage, ecrImage)
-	tag.Stdout = os.Stdout
-	tag.Stderr = os.Stderr
-	if err := tag.Run(); err != nil {
-		return fmt.Errorf("error al etiquetar la imagen Docker: %w", err)
+	if ecr.multiPlatform() {
+		// buildx pushes the manifest list from the build cache in the push
+		// stage; there is no local image to tag.
+		return nil
 	}
-	return nil
+	ecr.stage(ColorYellow, "Tagging container")
+	localImage := fmt.Sprintf("%s:%s", ecr.Config.Docker.ImageName, ecr.Config.ECR.ImageTag)
+	ecrImage := ecr.imageURI(ecr.Config.ECR.ImageTag)
+	return ecr.tagImage(localImage, ecrImage)
 }
 
 func (ecr *ECR) push() error {
-	fmt.Println(ColorCyan + "Pushing container" + ColorReset)
-	ecrImage := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s:%s",
-		ecr.Config.ECR.AccountID,
-		ecr.Config.ECR.Region,
-		ecr.Config.ECR.Repository,
-		ecr.Config.ECR.ImageTag,
-	)
-	push := exec.Command("docker", "push", ecrImage)
-	push.Stdout = os.Stdout
-	push.Stderr = os.Stderr
-	if err := push.Run(); err != nil {
-		return fmt.Errorf("error al empujar la imagen Docker: %w", err)
+	aliases, err := ecr.aliasTags()
+	if err != nil {
+		return err
+	}
+	if err := ecr.ensureRepository(); err != nil {
+		return err
+	}
+	if ecr.Config.ECR.PushByDigest {
+		if err := ecr.pushByDigest(); err != nil {
+			return err
+		}
+		return ecr.afterPush(aliases)
+	}
+	if ecr.multiPlatform() {
+		if err := ecr.pushMultiPlatform(); err != nil {
+			return err
+		}
+		return ecr.afterPush(aliases)
+	}
+	ecr.stage(ColorCyan, "Pushing container")
+	ecrImage := ecr.imageURI(ecr.Config.ECR.ImageTag)
+	if err := checkWritable("docker push " + ecrImage); err != nil {
+		return err
+	}
+	var digest string
+	pushed := false
+	if ecr.Config.ECR.MetadataOnlyPush {
+		if digest, pushed, err = ecr.pushMetadataOnly(ecrImage); err != nil {
+			return err
+		}
+	}
+	if !pushed {
+		if digest, err = ecr.pushImage(ecrImage); err != nil {
+			return err
+		}
+	}
+	if digest == "" {
+		// Older daemons do not report it in the push stream.
+		if digest, err = ecr.imageDigest(ecr.Config.ECR.ImageTag); err != nil {
+			return classify(ErrCodePushFailed, err.Error(), errorf(KeyPushDigestFailed, err))
+		}
+	}
+	ecr.Digest = digest
+	if digest != "" {
+		fmt.Println(ColorGreen + "Pushed " + ecr.repositoryURI() + "@" + digest + ColorReset)
 	}
+	if err := ecr.afterPush(aliases); err != nil {
+		return err
+	}
+	ecr.cleanupLocalImages()
 	return nil
 }
+
+// afterPush points the extra, alias and channel tags at the pushed image,
+// updates the catalog data of a public repository and copies the image to the
+// other regions of ecr.regions.
+func (ecr *ECR) afterPush(aliases map[string]string) error {
+	if err := ecr.pushExtraTags(); err != nil {
+		return err
+	}
+	if err := ecr.pushAliases(aliases); err != nil {
+		return err
+	}
+	if err := ecr.assignPushChannel(); err != nil {
+		return err
+	}
+	if err := ecr.putCatalogData(); err != nil {
+		return err
+	}
+	return ecr.pushRegions(aliases)
+}
+
+// registry returns the hostname of the profile's private ECR registry,
+// public.ecr.aws with ecr.public, or PUSHECR_REGISTRY when it is set.
+func (ecr *ECR) registry() string {
+	switch {
+	case registryOverride != "":
+		return registryOverride
+	case ecr.Config.ECR.Public:
+		return publicRegistry
+	}
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", ecr.Config.ECR.AccountID, ecr.Config.ECR.Region)
+}
+
+// repositoryURI returns the reference of the profile's repository, without
+// tag or digest. Public repositories are under the registry alias.
+func (ecr *ECR) repositoryURI() string {
+	if ecr.Config.ECR.Public {
+		return ecr.registry() + "/" + ecr.Config.ECR.PublicAlias + "/" + ecr.Config.ECR.Repository
+	}
+	return ecr.registry() + "/" + ecr.Config.ECR.Repository
+}
+
+// imageURI returns the fully qualified ECR reference for tag.
+func (ecr *ECR) imageURI(tag string) string {
+	return ecr.repositoryURI() + ":" + tag
+}
+
+// stage prints a stage heading and records it in the run log.
+func (ecr *ECR) stage(color, message string) {
+	fmt.Println(color + message + ColorReset)
+	fmt.Fprintf(&ecr.logs, "==> %s\n", message)
+}
+
+// output duplicates command output into the run log so it can be attached
+// to a diagnostics bundle if the run fails, and into any extra writers.
+func (ecr *ECR) output(w io.Writer, extra ...io.Writer) io.Writer {
+	return io.MultiWriter(append([]io.Writer{w, &ecr.logs}, extra...)...)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ManifestConfig enables the promotion manifest: the digest each profile, and
+// each channel of a profile, currently points to, updated by every push and
+// channel promotion and shown by pushecr status. Unlike the run history it
+// holds one entry per environment, replaced on every change.
+type ManifestConfig struct {
+	Backend string `mapstructure:"backend"` // local, s3 or dynamodb; empty disables it
+	Path    string `mapstructure:"path"`    // local, default .pushecr/manifest.json
+	Bucket  string `mapstructure:"bucket"`  // s3
+	Prefix  string `mapstructure:"prefix"`  // s3, default pushecr/manifest
+	Table   string `mapstructure:"table"`   // dynamodb, with a string partition key "id"
+	Region  string `mapstructure:"region"`
+}
+
+// deployment is the manifest entry of a profile or one of its channels.
+type deployment struct {
+	Profile    string    `json:"profile"`
+	Channel    string    `json:"channel,omitempty"`
+	Repository string    `json:"repository"`
+	Image      string    `json:"image"`
+	Digest     string    `json:"digest"`
+	Commit     string    `json:"commit,omitempty"`
+	Source     string    `json:"source"` // "push" or "promote <from channel>"
+	User       string    `json:"user"`
+	RunID      string    `json:"run_id,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// key identifies the environment of d: the profile, or profile@channel.
+func (d deployment) key() string {
+	if d.Channel != "" {
+		return d.Profile + "@" + d.Channel
+	}
+	return d.Profile
+}
+
+func (m ManifestConfig) enabled() bool {
+	return m.Backend != "" && m.Backend != "none"
+}
+
+func (m ManifestConfig) validate() error {
+	switch m.Backend {
+	case "", "none", "local":
+	case "s3":
+		if m.Bucket == "" || m.Region == "" {
+			return fmt.Errorf("manifest.backend s3 needs manifest.bucket and manifest.region")
+		}
+	case "dynamodb":
+		if m.Table == "" || m.Region == "" {
+			return fmt.Errorf("manifest.backend dynamodb needs manifest.table and manifest.region")
+		}
+	default:
+		return fmt.Errorf("manifest.backend '%s' is not supported (local, s3, dynamodb)", m.Backend)
+	}
+	return nil
+}
+
+// recordDeployment updates the manifest after a successful run that pushed
+// an image: the entry of the profile and, with channels.push, the entry of
+// that channel. Like recordRun, failing to update it never fails the run.
+func recordDeployment(m ManifestConfig, ecr *ECR, err error) {
+	stages := pipeline
+	if ecr.stages != nil {
+		stages = ecr.stages
+	}
+	if !m.enabled() || err != nil || ecr.upToDate || !contains(stageNamesOf(stages), "push") {
+		return
+	}
+	digest := ecr.Digest
+	if digest == "" {
+		digest, err = ecr.imageDigest(ecr.Config.ECR.ImageTag)
+	}
+	if err == nil {
+		d := ecr.newDeployment(digest, git("rev-parse", "HEAD"), "push")
+		err = m.update(d)
+		if channel := ecr.Config.Channels.Push; err == nil && channel != "" {
+			d.Channel = channel
+			err = m.update(d)
+		}
+	}
+	if err != nil {
+		fmt.Println(ColorYellow + "Could not update the promotion manifest: " + err.Error() + ColorReset)
+	}
+}
+
+// recordPromotion updates the manifest entry of a channel after a promotion.
+// The commit is taken from the entry that already points to the digest.
+func recordPromotion(m ManifestConfig, ecr *ECR, from, to string) error {
+	if !m.enabled() {
+		return nil
+	}
+	digest, err := ecr.imageDigest(to)
+	if err != nil {
+		return err
+	}
+	entries, err := m.list()
+	if err != nil {
+		return err
+	}
+	d := ecr.newDeployment(digest, "", "promote "+from)
+	d.Channel = to
+	for _, entry := range entries {
+		if entry.Profile == ecr.Profile && entry.Digest == digest && entry.Commit != "" {
+			d.Commit = entry.Commit
+			break
+		}
+	}
+	return m.update(d)
+}
+
+func (ecr *ECR) newDeployment(digest, commit, source string) deployment {
+	return deployment{
+		Profile:    ecr.Profile,
+		Repository: ecr.Config.ECR.Repository,
+		Image:      ecr.pushedImageURI(),
+		Digest:     digest,
+		Commit:     commit,
+		Source:     source,
+		User:       orDefault(ecr.actor, currentUser()),
+		RunID:      ecr.runID,
+		UpdatedAt:  time.Now().UTC(),
+	}
+}
+
+func (m ManifestConfig) update(d deployment) error {
+	switch m.Backend {
+	case "local":
+		return m.updateLocal(d)
+	case "s3":
+		return m.updateS3(d)
+	case "dynamodb":
+		return m.updateDynamoDB(d)
+	}
+	return m.validate()
+}
+
+// list returns the entries sorted by profile and channel.
+func (m ManifestConfig) list() ([]deployment, error) {
+	var entries []deployment
+	var err error
+	switch m.Backend {
+	case "local":
+		entries, err = m.listLocal()
+	case "s3":
+		entries, err = m.listS3()
+	case "dynamodb":
+		entries, err = m.listDynamoDB()
+	default:
+		if err := m.validate(); err != nil {
+			return nil, err
+		}
+		return nil, withCode(ErrCodeConfigInvalid, fmt.Errorf("the promotion manifest is not enabled (manifest.backend)"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key() < entries[j].key() })
+	return entries, nil
+}
+
+func (m ManifestConfig) path() string {
+	return orDefault(m.Path, statePath("manifest.json"))
+}
+
+func (m ManifestConfig) readLocal() (map[string]deployment, error) {
+	entries := map[string]deployment{}
+	data, err := os.ReadFile(m.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errorf(KeyFileReadFailed, m.path(), err)
+	}
+	return entries, nil
+}
+
+func (m ManifestConfig) updateLocal(d deployment) error {
+	return withStateLock("manifest", func() error {
+		entries, err := m.readLocal()
+		if err != nil {
+			return err
+		}
+		entries[d.key()] = d
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(m.path(), append(data, '\n'))
+	})
+}
+
+func (m ManifestConfig) listLocal() ([]deployment, error) {
+	entries, err := m.readLocal()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]deployment, 0, len(entries))
+	for _, d := range entries {
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// The S3 backend keeps one object per environment under the prefix, so runs
+// of different profiles never overwrite each other's entries.
+func (m ManifestConfig) objectKey(key string) string {
+	return path.Join(orDefault(m.Prefix, "pushecr/manifest"), key+".json")
+}
+
+func (m ManifestConfig) updateS3(d deployment) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "pushecr-manifest-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = runAWS(m.Region, io.Discard, "s3api", "put-object",
+		"--bucket", m.Bucket,
+		"--key", m.objectKey(d.key()),
+		"--body", tmp.Name(),
+		"--content-type", "application/json",
+	)
+	return err
+}
+
+func (m ManifestConfig) listS3() ([]deployment, error) {
+	prefix := strings.TrimSuffix(orDefault(m.Prefix, "pushecr/manifest"), "/") + "/"
+	out, err := runAWS(m.Region, io.Discard, "s3api", "list-objects-v2", "--bucket", m.Bucket, "--prefix", prefix)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Contents []struct {
+			Key string `json:"Key"`
+		} `json:"Contents"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, errorf(KeyAWSBadResponse, "list-objects-v2", err)
+	}
+	tmp, err := os.CreateTemp("", "pushecr-manifest-*.json")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	var entries []deployment
+	for _, object := range result.Contents {
+		if !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+		if _, err := runAWS(m.Region, io.Discard, "s3api", "get-object", "--bucket", m.Bucket, "--key", object.Key, tmp.Name()); err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return nil, err
+		}
+		var d deployment
+		if err := json.Unmarshal(data, &d); err == nil {
+			entries = append(entries, d)
+		}
+	}
+	return entries, nil
+}
+
+// DynamoDB items are keyed by the environment, with the entry as a JSON
+// document, like the run history.
+func (m ManifestConfig) updateDynamoDB(d deployment) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	item, err := json.Marshal(map[string]map[string]string{
+		"id":    {"S": d.key()},
+		"entry": {"S": string(data)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = runAWS(m.Region, io.Discard, "dynamodb", "put-item", "--table-name", m.Table, "--item", string(item))
+	return err
+}
+
+func (m ManifestConfig) listDynamoDB() ([]deployment, error) {
+	out, err := runAWS(m.Region, io.Discard, "dynamodb", "scan", "--table-name", m.Table, "--projection-expression", "entry")
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Items []struct {
+			Entry struct {
+				S string `json:"S"`
+			} `json:"entry"`
+		} `json:"Items"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, errorf(KeyAWSBadResponse, "dynamodb scan", err)
+	}
+	var entries []deployment
+	for _, item := range result.Items {
+		var d deployment
+		if err := json.Unmarshal([]byte(item.Entry.S), &d); err == nil {
+			entries = append(entries, d)
+		}
+	}
+	return entries, nil
+}
+
+func runStatus(args []string) {
+	fs, configPath, profile := commandFlags("status", "status [-config deploy.yml] [-profile prod]")
+	fs.Parse(args)
+	// Every environment is shown unless -profile is given.
+	filter := false
+	fs.Visit(func(f *flag.Flag) { filter = filter || f.Name == "profile" })
+
+	config, err := loadConfig(*configPath)
+	exitOnError("Error loading configuration", err)
+	exitOnError("Could not assume the workspace role", config.assumeWorkspaceRole())
+	entries, err := config.Manifest.list()
+	exitOnError("Could not read the promotion manifest", err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tDIGEST\tCOMMIT\tIMAGE\tSOURCE\tUPDATED\tUSER")
+	for _, d := range entries {
+		if filter && d.Profile != *profile {
+			continue
+		}
+		commit := orDefault(d.Commit, "-")
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.key(),
+			shortDigest(d.Digest),
+			commit,
+			d.Image,
+			d.Source,
+			d.UpdatedAt.Local().Format("2006-01-02 15:04"),
+			d.User,
+		)
+	}
+	w.Flush()
+}
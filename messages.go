@@ -0,0 +1,658 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrorKey is a stable English identifier of an error message. The message
+// itself is localized (see errorLanguage), so automation matches on the key,
+// or on the ErrorCode for the class of failure, never on the text. Like
+// codes, existing keys must never be renamed.
+type ErrorKey string
+
+const (
+	KeyConfigFetchFailed          ErrorKey = "config.fetch_failed"
+	KeyConfigReadFailed           ErrorKey = "config.read_failed"
+	KeyConfigParseFailed          ErrorKey = "config.parse_failed"
+	KeyConfigExtendsFailed        ErrorKey = "config.extends_failed"
+	KeyConfigEnvMissing           ErrorKey = "config.env_missing"
+	KeyAuthFailed                 ErrorKey = "auth.failed"
+	KeyTokenFailed                ErrorKey = "auth.token_failed"
+	KeyTokenDecodeFailed          ErrorKey = "auth.token_decode_failed"
+	KeyPublicTokenFailed          ErrorKey = "auth.public_token_failed"
+	KeyTokenBadResponse           ErrorKey = "auth.unexpected_token_response"
+	KeyAWSConfigFailed            ErrorKey = "aws.config_failed"
+	KeyAssumeRoleFailed           ErrorKey = "aws.assume_role_failed"
+	KeyWorkspaceRoleFailed        ErrorKey = "workspace.assume_role_failed"
+	KeyDockerClientFailed         ErrorKey = "docker.client_failed"
+	KeyBuildFailed                ErrorKey = "build.failed"
+	KeyBuildMirrorFailed          ErrorKey = "build.mirror_rewrite_failed"
+	KeyTagFailed                  ErrorKey = "tag.failed"
+	KeyTagGuardLookupFailed       ErrorKey = "tag_guard.lookup_failed"
+	KeyTagGuardBackupFailed       ErrorKey = "tag_guard.backup_failed"
+	KeyTagGuardLogFailed          ErrorKey = "tag_guard.log_failed"
+	KeyPolicySignersMissing       ErrorKey = "policy.signers_missing"
+	KeyPolicyBaseUnresolved       ErrorKey = "policy.base_unresolved"
+	KeyPolicyBaseUnpinned         ErrorKey = "policy.base_unpinned"
+	KeyPolicyBaseUnsigned         ErrorKey = "policy.base_unsigned"
+	KeyPolicyPinFailed            ErrorKey = "policy.pin_failed"
+	KeyApprovalLookupFailed       ErrorKey = "approval.lookup_failed"
+	KeyApprovalBadResponse        ErrorKey = "approval.unexpected_response"
+	KeyRepoDescribeFailed         ErrorKey = "repository.describe_failed"
+	KeyRepoCreateFailed           ErrorKey = "repository.create_failed"
+	KeyPushFailed                 ErrorKey = "push.failed"
+	KeyPushBuildxFailed           ErrorKey = "push.buildx_failed"
+	KeyPushNoDigest               ErrorKey = "push.digest_missing"
+	KeyPushDigestFailed           ErrorKey = "push.digest_lookup_failed"
+	KeyImageNotFound              ErrorKey = "image.not_found"
+	KeyImageRemoveFailed          ErrorKey = "image.remove_failed"
+	KeyPullFailed                 ErrorKey = "image.pull_failed"
+	KeyDigestResolveFailed        ErrorKey = "image.digest_resolve_failed"
+	KeyRegionTagFailed            ErrorKey = "regions.tag_failed"
+	KeyScanManifestInvalid        ErrorKey = "scan.manifest_invalid"
+	KeyScanFailed                 ErrorKey = "scan.failed"
+	KeyScanTimedOut               ErrorKey = "scan.timed_out"
+	KeyScanVulnerabilities        ErrorKey = "scan.vulnerabilities_found"
+	KeySignFailed                 ErrorKey = "sign.failed"
+	KeyStageTimeout               ErrorKey = "stage.timed_out"
+	KeyStateLockFailed            ErrorKey = "state.lock_failed"
+	KeyRunLockFailed              ErrorKey = "state.run_lock_failed"
+	KeyWorkerFetchFailed          ErrorKey = "worker.fetch_failed"
+	KeyWorkerInvalidRef           ErrorKey = "worker.invalid_ref"
+	KeySlackBadResponse           ErrorKey = "slack.unexpected_response"
+	KeyFaultInjected              ErrorKey = "fault.injected"
+	KeyFileReadFailed             ErrorKey = "file.read_failed"
+	KeyFileWriteFailed            ErrorKey = "file.write_failed"
+	KeyAWSBadResponse             ErrorKey = "aws.unexpected_response"
+	KeyCallerIdentityFailed       ErrorKey = "aws.caller_identity_failed"
+	KeyCallerBadResponse          ErrorKey = "aws.unexpected_caller_identity"
+	KeyAccountIDInvalid           ErrorKey = "config.account_id_invalid"
+	KeyConfigSaveFailed           ErrorKey = "config.save_failed"
+	KeyConfigURLInvalid           ErrorKey = "config.url_invalid"
+	KeyConfigDownloadFailed       ErrorKey = "config.download_failed"
+	KeyConfigBadResponse          ErrorKey = "config.unexpected_response"
+	KeyConfigCloneFailed          ErrorKey = "config.clone_failed"
+	KeyDockerQueryFailed          ErrorKey = "docker.query_failed"
+	KeyBuildxFailed               ErrorKey = "build.buildx_failed"
+	KeyBuilderInspectFailed       ErrorKey = "build.builder_inspect_failed"
+	KeyEmulatorInstallFailed      ErrorKey = "build.emulator_install_failed"
+	KeyMirrorNoBases              ErrorKey = "build.mirror_no_bases"
+	KeyPrebuiltTemplateReadFailed ErrorKey = "build.prebuilt_template_read_failed"
+	KeyPrebuiltTemplateInvalid    ErrorKey = "build.prebuilt_template_invalid"
+	KeyAliasTemplateInvalid       ErrorKey = "alias.template_invalid"
+	KeyAliasTagInvalid            ErrorKey = "alias.tag_invalid"
+	KeyAliasFailed                ErrorKey = "alias.failed"
+	KeyTagLookupFailed            ErrorKey = "preflight.tag_lookup_failed"
+	KeyRepoTemplateInvalid        ErrorKey = "repository.template_invalid"
+	KeyRepoTemplateEmpty          ErrorKey = "repository.template_empty"
+	KeyLocalImageNotFound         ErrorKey = "image.local_not_found"
+	KeyLocalImageInspectFailed    ErrorKey = "image.local_inspect_failed"
+	KeyImageConfigInvalid         ErrorKey = "image.config_invalid"
+	KeyManifestInvalid            ErrorKey = "image.manifest_invalid"
+	KeyImagePlatformMissing       ErrorKey = "image.platform_missing"
+	KeyBlobDownloadFailed         ErrorKey = "image.blob_download_failed"
+	KeyDigestUnexpected           ErrorKey = "image.digest_unexpected"
+	KeyManifestPushFailed         ErrorKey = "push.manifest_failed"
+	KeyConfigUploadFailed         ErrorKey = "push.config_upload_failed"
+	KeyRegistryRejected           ErrorKey = "registry.rejected"
+	KeyRegistryBadResponse        ErrorKey = "registry.unexpected_response"
+	KeyMountFailed                ErrorKey = "mount.failed"
+	KeyMountConfigMismatch        ErrorKey = "mount.config_mismatch"
+	KeyCatalogUpdateFailed        ErrorKey = "public.catalog_update_failed"
+	KeyChannelLookupFailed        ErrorKey = "channel.lookup_failed"
+	KeyChannelMoveFailed          ErrorKey = "channel.move_failed"
+	KeyChannelLogFailed           ErrorKey = "channel.log_failed"
+	KeyCopyFailed                 ErrorKey = "migrate.copy_failed"
+	KeyAttestFailed               ErrorKey = "attest.failed"
+	KeySBOMFailed                 ErrorKey = "licenses.sbom_failed"
+	KeySBOMInvalid                ErrorKey = "sbom.invalid"
+	KeySecretScannerFailed        ErrorKey = "secrets.scanner_failed"
+	KeyImageExportFailed          ErrorKey = "secrets.export_failed"
+	KeyImageExportReadFailed      ErrorKey = "secrets.export_read_failed"
+	KeyLayerFileReadFailed        ErrorKey = "secrets.layer_read_failed"
+	KeyHistoryReadFailed          ErrorKey = "history.read_failed"
+	KeyBuildCachePruneFailed      ErrorKey = "cache.prune_failed"
+	KeyDanglingPruneFailed        ErrorKey = "cleanup.dangling_prune_failed"
+	KeyDiagnosticsWriteFailed     ErrorKey = "diagnostics.write_failed"
+	KeyHookFailed                 ErrorKey = "hook.failed"
+	KeyTaskDefRegisterFailed      ErrorKey = "deploy.register_failed"
+	KeyTaskDefReadFailed          ErrorKey = "deploy.task_definition_read_failed"
+	KeyServiceReadFailed          ErrorKey = "deploy.service_read_failed"
+	KeyServiceUpdateFailed        ErrorKey = "deploy.service_update_failed"
+	KeyLambdaReadFailed           ErrorKey = "deploy.lambda_read_failed"
+	KeyLambdaUpdateFailed         ErrorKey = "deploy.lambda_update_failed"
+	KeyLifecyclePreviewFailed     ErrorKey = "lifecycle.preview_failed"
+	KeyLifecyclePreviewTimedOut   ErrorKey = "lifecycle.preview_timed_out"
+	KeyRunImageFailed             ErrorKey = "run.failed"
+	KeyRunLogFailed               ErrorKey = "run.log_failed"
+	KeyToolVersionFailed          ErrorKey = "tools.version_failed"
+	KeyToolVersionUnreadable      ErrorKey = "tools.version_unreadable"
+)
+
+// errorLanguages are the languages of the error messages, the default first.
+var errorLanguages = []string{"es", "en"}
+
+// errorMessages holds the fmt.Errorf format of every key in every language,
+// with the same verbs in the same order.
+var errorMessages = map[ErrorKey]map[string]string{
+	KeyConfigFetchFailed: {
+		"es": "error obteniendo la configuración de %s: %w",
+		"en": "error fetching the configuration from %s: %w",
+	},
+	KeyConfigReadFailed: {
+		"es": "error leyendo el archivo de configuración: %w",
+		"en": "error reading the configuration file: %w",
+	},
+	KeyConfigParseFailed: {
+		"es": "error parseando la configuración: %w",
+		"en": "error parsing the configuration: %w",
+	},
+	KeyConfigExtendsFailed: {
+		"es": "error resolviendo extends: %w",
+		"en": "error resolving extends: %w",
+	},
+	KeyConfigEnvMissing: {
+		"es": "%s: la variable de entorno %s no está definida",
+		"en": "%s: environment variable %s is not set",
+	},
+	KeyAuthFailed: {
+		"es": "error durante la autenticación con ECR: %w",
+		"en": "error authenticating with ECR: %w",
+	},
+	KeyTokenFailed: {
+		"es": "error obteniendo el token de autorización de ECR: %w",
+		"en": "error getting the ECR authorization token: %w",
+	},
+	KeyTokenDecodeFailed: {
+		"es": "respuesta inesperada de GetAuthorizationToken: %w",
+		"en": "unexpected GetAuthorizationToken response: %w",
+	},
+	KeyPublicTokenFailed: {
+		"es": "error obteniendo el token de autorización de ECR Public: %w",
+		"en": "error getting the ECR Public authorization token: %w",
+	},
+	KeyTokenBadResponse: {
+		"es": "respuesta inesperada de GetAuthorizationToken",
+		"en": "unexpected GetAuthorizationToken response",
+	},
+	KeyAWSConfigFailed: {
+		"es": "error cargando la configuración de AWS: %w",
+		"en": "error loading the AWS configuration: %w",
+	},
+	KeyAssumeRoleFailed: {
+		"es": "error asumiendo el rol %s: %w",
+		"en": "error assuming the role %s: %w",
+	},
+	KeyWorkspaceRoleFailed: {
+		"es": "error asumiendo el rol del workspace %s: %w",
+		"en": "error assuming the role of workspace %s: %w",
+	},
+	KeyDockerClientFailed: {
+		"es": "error creando el cliente de Docker: %w",
+		"en": "error creating the Docker client: %w",
+	},
+	KeyBuildFailed: {
+		"es": "error al construir la imagen Docker: %w",
+		"en": "error building the Docker image: %w",
+	},
+	KeyBuildMirrorFailed: {
+		"es": "error reescribiendo el Dockerfile para el mirror: %w",
+		"en": "error rewriting the Dockerfile for the mirror: %w",
+	},
+	KeyTagFailed: {
+		"es": "error al etiquetar la imagen Docker: %w",
+		"en": "error tagging the Docker image: %w",
+	},
+	KeyTagGuardLookupFailed: {
+		"es": "error consultando el tag actual en ECR: %w",
+		"en": "error looking up the current tag in ECR: %w",
+	},
+	KeyTagGuardBackupFailed: {
+		"es": "error creando el tag de respaldo %s: %w",
+		"en": "error creating the backup tag %s: %w",
+	},
+	KeyTagGuardLogFailed: {
+		"es": "error escribiendo el log del tag guard: %w",
+		"en": "error writing the tag guard log: %w",
+	},
+	KeyApprovalLookupFailed: {
+		"es": "error consultando la aprobación %s: %w",
+		"en": "error checking the approval %s: %w",
+	},
+	KeyApprovalBadResponse: {
+		"es": "respuesta inesperada de ssm get-parameter: no trae el parámetro",
+		"en": "unexpected ssm get-parameter response: no parameter",
+	},
+	KeyRepoDescribeFailed: {
+		"es": "error consultando el repositorio %s: %w",
+		"en": "error describing the repository %s: %w",
+	},
+	KeyRepoCreateFailed: {
+		"es": "error creando el repositorio %s: %w",
+		"en": "error creating the repository %s: %w",
+	},
+	KeyPushFailed: {
+		"es": "error al empujar la imagen Docker: %w",
+		"en": "error pushing the Docker image: %w",
+	},
+	KeyPushBuildxFailed: {
+		"es": "error al empujar la imagen con buildx: %w",
+		"en": "error pushing the image with buildx: %w",
+	},
+	KeyPushNoDigest: {
+		"es": "buildx no informó el digest de la imagen subida",
+		"en": "buildx did not report the digest of the pushed image",
+	},
+	KeyPushDigestFailed: {
+		"es": "error obteniendo el digest publicado: %w",
+		"en": "error getting the pushed digest: %w",
+	},
+	KeyImageNotFound: {
+		"es": "%s no existe en el repositorio %s",
+		"en": "%s does not exist in the repository %s",
+	},
+	KeyImageRemoveFailed: {
+		"es": "error eliminando la imagen local %s: %w",
+		"en": "error removing the local image %s: %w",
+	},
+	KeyPullFailed: {
+		"es": "error al descargar la imagen %s: %w",
+		"en": "error pulling the image %s: %w",
+	},
+	KeyDigestResolveFailed: {
+		"es": "error resolviendo el digest de %s: %w",
+		"en": "error resolving the digest of %s: %w",
+	},
+	KeyRegionTagFailed: {
+		"es": "error asignando el tag %s: %w",
+		"en": "error assigning the tag %s: %w",
+	},
+	KeyScanManifestInvalid: {
+		"es": "manifest inválido para %s: %w",
+		"en": "invalid manifest for %s: %w",
+	},
+	KeyScanFailed: {
+		"es": "el escaneo de %s terminó con estado %s: %s",
+		"en": "the scan of %s ended with status %s: %s",
+	},
+	KeyScanTimedOut: {
+		"es": "el escaneo de %s no terminó en %s (último estado: %s)",
+		"en": "the scan of %s did not complete in %s (last status: %s)",
+	},
+	KeyScanVulnerabilities: {
+		"es": "la imagen tiene %d hallazgo(s) de severidad %s o mayor",
+		"en": "the image has %d finding(s) of severity %s or above",
+	},
+	KeySignFailed: {
+		"es": "error firmando la imagen con cosign: %w",
+		"en": "error signing the image with cosign: %w",
+	},
+	KeyStageTimeout: {
+		"es": "la etapa %s superó el tiempo límite de %s\n%s",
+		"en": "the %s stage ran past its timeout of %s\n%s",
+	},
+	KeyPolicySignersMissing: {
+		"es": "policy.base_images.require_signature necesita al menos una entrada en policy.base_images.signers",
+		"en": "policy.base_images.require_signature needs at least one entry in policy.base_images.signers",
+	},
+	KeyPolicyBaseUnresolved: {
+		"es": "imágenes base que dependen de ARG sin valor: %v",
+		"en": "base images that reference ARGs without a value: %v",
+	},
+	KeyPolicyBaseUnpinned: {
+		"es": "imágenes base no fijadas a un digest en el Dockerfile (ejecuta pushecr pin-bases): %v",
+		"en": "base images not pinned to a digest in the Dockerfile (run pushecr pin-bases): %v",
+	},
+	KeyPolicyBaseUnsigned: {
+		"es": "imágenes base sin una firma válida: %v",
+		"en": "base images without a valid signature: %v",
+	},
+	KeyPolicyPinFailed: {
+		"es": "error fijando las imágenes base verificadas en el Dockerfile: %w",
+		"en": "error pinning the verified base images in the Dockerfile: %w",
+	},
+	KeyStateLockFailed: {
+		"es": "error bloqueando %s: %w",
+		"en": "error locking %s: %w",
+	},
+	KeyRunLockFailed: {
+		"es": "error bloqueando la ejecución del perfil %s: %w",
+		"en": "error locking the run of profile %s: %w",
+	},
+	KeyWorkerFetchFailed: {
+		"es": "error obteniendo %s con git %s: %w",
+		"en": "error getting %s with git %s: %w",
+	},
+	KeyWorkerInvalidRef: {
+		"es": "git_ref %q no es un hash de commit ni un nombre de ref válido",
+		"en": "git_ref %q is not a commit hash or a valid ref name",
+	},
+	KeySlackBadResponse: {
+		"es": "respuesta inesperada de Slack: %s",
+		"en": "unexpected Slack response: %s",
+	},
+	KeyFaultInjected: {
+		"es": "fallo inyectado en la etapa %s (-fault-inject)",
+		"en": "injected failure in the %s stage (-fault-inject)",
+	},
+	KeyFileReadFailed: {
+		"es": "error leyendo %s: %w",
+		"en": "error reading %s: %w",
+	},
+	KeyFileWriteFailed: {
+		"es": "error escribiendo %s: %w",
+		"en": "error writing %s: %w",
+	},
+	KeyAWSBadResponse: {
+		"es": "respuesta inesperada de %s: %w",
+		"en": "unexpected %s response: %w",
+	},
+	KeyCallerIdentityFailed: {
+		"es": "error consultando la identidad de AWS: %w",
+		"en": "error looking up the AWS identity: %w",
+	},
+	KeyCallerBadResponse: {
+		"es": "respuesta inesperada de sts get-caller-identity: no trae el ARN",
+		"en": "unexpected sts get-caller-identity response: no ARN",
+	},
+	KeyAccountIDInvalid: {
+		"es": "ecr.account_id debe ser una cadena de 12 dígitos",
+		"en": "ecr.account_id must be a string of 12 digits",
+	},
+	KeyConfigSaveFailed: {
+		"es": "error guardando la configuración descargada: %w",
+		"en": "error saving the downloaded configuration: %w",
+	},
+	KeyConfigURLInvalid: {
+		"es": "URL de configuración inválida: %w",
+		"en": "invalid configuration URL: %w",
+	},
+	KeyConfigDownloadFailed: {
+		"es": "error descargando la configuración: %w",
+		"en": "error downloading the configuration: %w",
+	},
+	KeyConfigBadResponse: {
+		"es": "respuesta inesperada de %s: %s",
+		"en": "unexpected response from %s: %s",
+	},
+	KeyConfigCloneFailed: {
+		"es": "error clonando %s: %w",
+		"en": "error cloning %s: %w",
+	},
+	KeyDockerQueryFailed: {
+		"es": "error consultando el daemon de Docker: %w",
+		"en": "error querying the Docker daemon: %w",
+	},
+	KeyBuildxFailed: {
+		"es": "error en docker buildx %s: %w",
+		"en": "docker buildx %s failed: %w",
+	},
+	KeyBuilderInspectFailed: {
+		"es": "error inspeccionando el builder: %w",
+		"en": "error inspecting the builder: %w",
+	},
+	KeyEmulatorInstallFailed: {
+		"es": "error registrando los emuladores QEMU: %w",
+		"en": "error registering the QEMU emulators: %w",
+	},
+	KeyMirrorNoBases: {
+		"es": "%s no tiene imágenes base de Docker Hub para reemplazar",
+		"en": "%s has no Docker Hub base images to replace",
+	},
+	KeyPrebuiltTemplateReadFailed: {
+		"es": "error leyendo build.prebuilt.template: %w",
+		"en": "error reading build.prebuilt.template: %w",
+	},
+	KeyPrebuiltTemplateInvalid: {
+		"es": "build.prebuilt.template inválido: %w",
+		"en": "invalid build.prebuilt.template: %w",
+	},
+	KeyAliasTemplateInvalid: {
+		"es": "%s inválido: %w",
+		"en": "invalid %s: %w",
+	},
+	KeyAliasTagInvalid: {
+		"es": "%s produjo un tag inválido: '%s'",
+		"en": "%s produced an invalid tag: '%s'",
+	},
+	KeyAliasFailed: {
+		"es": "error asignando el alias %s (%s): %w",
+		"en": "error assigning the alias %s (%s): %w",
+	},
+	KeyTagLookupFailed: {
+		"es": "error consultando el tag %s: %w",
+		"en": "error looking up the tag %s: %w",
+	},
+	KeyRepoTemplateInvalid: {
+		"es": "ecr.repository_template inválido: %w",
+		"en": "invalid ecr.repository_template: %w",
+	},
+	KeyRepoTemplateEmpty: {
+		"es": "ecr.repository_template produjo un repositorio vacío en alguna parte: '%s'",
+		"en": "ecr.repository_template produced an empty part of the repository: '%s'",
+	},
+	KeyLocalImageNotFound: {
+		"es": "la imagen local %s no existe",
+		"en": "the local image %s does not exist",
+	},
+	KeyLocalImageInspectFailed: {
+		"es": "error inspeccionando la imagen local: %w",
+		"en": "error inspecting the local image: %w",
+	},
+	KeyImageConfigInvalid: {
+		"es": "config inválida %s: %w",
+		"en": "invalid config %s: %w",
+	},
+	KeyManifestInvalid: {
+		"es": "manifest inválido para %s: %w",
+		"en": "invalid manifest for %s: %w",
+	},
+	KeyImagePlatformMissing: {
+		"es": "%s no tiene una imagen para la plataforma %s",
+		"en": "%s has no image for the platform %s",
+	},
+	KeyBlobDownloadFailed: {
+		"es": "error descargando %s: %w",
+		"en": "error downloading %s: %w",
+	},
+	KeyDigestUnexpected: {
+		"es": "digest inesperado para %s: %q",
+		"en": "unexpected digest for %s: %q",
+	},
+	KeyManifestPushFailed: {
+		"es": "error al empujar el manifest: %w",
+		"en": "error pushing the manifest: %w",
+	},
+	KeyConfigUploadFailed: {
+		"es": "error subiendo el config: %w",
+		"en": "error uploading the config: %w",
+	},
+	KeyRegistryRejected: {
+		"es": "el registro respondió %s",
+		"en": "the registry answered %s",
+	},
+	KeyRegistryBadResponse: {
+		"es": "respuesta inesperada del registro: %w",
+		"en": "unexpected registry response: %w",
+	},
+	KeyMountFailed: {
+		"es": "error montando la capa: %w",
+		"en": "error mounting the layer: %w",
+	},
+	KeyMountConfigMismatch: {
+		"es": "la config %s no coincide con las capas del manifest",
+		"en": "config %s does not match the layers of the manifest",
+	},
+	KeyCatalogUpdateFailed: {
+		"es": "error actualizando el catálogo de %s: %w",
+		"en": "error updating the catalog data of %s: %w",
+	},
+	KeyChannelLookupFailed: {
+		"es": "error consultando el canal %s: %w",
+		"en": "error looking up the channel %s: %w",
+	},
+	KeyChannelMoveFailed: {
+		"es": "error moviendo el canal %s: %w",
+		"en": "error moving the channel %s: %w",
+	},
+	KeyChannelLogFailed: {
+		"es": "error escribiendo el log de canales: %w",
+		"en": "error writing the channel log: %w",
+	},
+	KeyCopyFailed: {
+		"es": "error copiando %s: %w",
+		"en": "error copying %s: %w",
+	},
+	KeyAttestFailed: {
+		"es": "error adjuntando la attestation con cosign: %w",
+		"en": "error attaching the attestation with cosign: %w",
+	},
+	KeySBOMFailed: {
+		"es": "error generando el SBOM: %w",
+		"en": "error generating the SBOM: %w",
+	},
+	KeySBOMInvalid: {
+		"es": "SBOM inválido: %w",
+		"en": "invalid SBOM: %w",
+	},
+	KeySecretScannerFailed: {
+		"es": "error en el scanner de secretos %s: %w",
+		"en": "the secret scanner %s failed: %w",
+	},
+	KeyImageExportFailed: {
+		"es": "error exportando la imagen: %w",
+		"en": "error exporting the image: %w",
+	},
+	KeyImageExportReadFailed: {
+		"es": "error leyendo la imagen exportada: %w",
+		"en": "error reading the exported image: %w",
+	},
+	KeyLayerFileReadFailed: {
+		"es": "error leyendo %s en la capa %s: %w",
+		"en": "error reading %s in layer %s: %w",
+	},
+	KeyHistoryReadFailed: {
+		"es": "error leyendo el historial de ejecuciones: %w",
+		"en": "error reading the run history: %w",
+	},
+	KeyBuildCachePruneFailed: {
+		"es": "error limpiando la caché de build: %w",
+		"en": "error pruning the build cache: %w",
+	},
+	KeyDanglingPruneFailed: {
+		"es": "error eliminando imágenes sin tag: %w",
+		"en": "error removing untagged images: %w",
+	},
+	KeyDiagnosticsWriteFailed: {
+		"es": "error escribiendo el bundle de diagnóstico: %w",
+		"en": "error writing the diagnostics bundle: %w",
+	},
+	KeyHookFailed: {
+		"es": "el hook %s_%s '%s' falló: %w",
+		"en": "the %s_%s hook '%s' failed: %w",
+	},
+	KeyTaskDefRegisterFailed: {
+		"es": "error al registrar la task definition: %w",
+		"en": "error registering the task definition: %w",
+	},
+	KeyTaskDefReadFailed: {
+		"es": "error al leer la task definition %s: %w",
+		"en": "error reading the task definition %s: %w",
+	},
+	KeyServiceReadFailed: {
+		"es": "error al leer el servicio %s: %w",
+		"en": "error reading the service %s: %w",
+	},
+	KeyServiceUpdateFailed: {
+		"es": "error al actualizar el servicio %s: %w",
+		"en": "error updating the service %s: %w",
+	},
+	KeyLambdaReadFailed: {
+		"es": "error al leer la función %s: %w",
+		"en": "error reading the function %s: %w",
+	},
+	KeyLambdaUpdateFailed: {
+		"es": "error al actualizar la función %s: %w",
+		"en": "error updating the function %s: %w",
+	},
+	KeyLifecyclePreviewFailed: {
+		"es": "la vista previa de la lifecycle policy terminó con estado %s",
+		"en": "the lifecycle policy preview ended with status %s",
+	},
+	KeyLifecyclePreviewTimedOut: {
+		"es": "la vista previa de la lifecycle policy no terminó a tiempo",
+		"en": "the lifecycle policy preview did not complete in time",
+	},
+	KeyRunImageFailed: {
+		"es": "error ejecutando la imagen: %w",
+		"en": "error running the image: %w",
+	},
+	KeyRunLogFailed: {
+		"es": "error creando el log de la ejecución: %w",
+		"en": "error creating the run log: %w",
+	},
+	KeyToolVersionFailed: {
+		"es": "error obteniendo la versión de %s: %w",
+		"en": "error getting the version of %s: %w",
+	},
+	KeyToolVersionUnreadable: {
+		"es": "no se pudo leer la versión de %s en: %s",
+		"en": "could not read the version of %s in: %s",
+	},
+}
+
+// errorLanguage is the language of error messages: PUSHECR_LANG (es or en,
+// also as a locale such as en_US.UTF-8), Spanish by default.
+var errorLanguage = func() string {
+	lang, _, _ := strings.Cut(strings.ToLower(os.Getenv("PUSHECR_LANG")), "_")
+	if contains(errorLanguages, lang) {
+		return lang
+	}
+	return errorLanguages[0]
+}()
+
+// keyedError is an error created with errorf: a stable key and its message in
+// errorLanguage.
+type keyedError struct {
+	Key ErrorKey
+	Err error
+}
+
+func (e *keyedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *keyedError) Unwrap() error {
+	return e.Err
+}
+
+// errorf creates the error of key, formatting its localized message with args
+// like fmt.Errorf, %w included.
+func errorf(key ErrorKey, args ...any) error {
+	messages, ok := errorMessages[key]
+	if !ok {
+		panic("errorf: no messages for key " + string(key))
+	}
+	format, ok := messages[errorLanguage]
+	if !ok {
+		format = messages[errorLanguages[0]]
+	}
+	return &keyedError{Key: key, Err: fmt.Errorf(format, args...)}
+}
+
+// errorKey returns the key of the outermost error of err created with errorf.
+// Errors without one get the key of their code: PUSHECR_CONFIG_INVALID has
+// error.config_invalid. A nil error has no key.
+func errorKey(err error) ErrorKey {
+	if err == nil {
+		return ""
+	}
+	var keyed *keyedError
+	if errors.As(err, &keyed) {
+		return keyed.Key
+	}
+	return ErrorKey("error." + strings.ToLower(strings.TrimPrefix(string(errorCode(err)), "PUSHECR_")))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var formatVerb = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+func TestErrorMessagesHaveEveryLanguage(t *testing.T) {
+	for key, messages := range errorMessages {
+		want := formatVerb.FindAllString(messages[errorLanguages[0]], -1)
+		for _, lang := range errorLanguages {
+			format, ok := messages[lang]
+			if !ok {
+				t.Errorf("%s has no %s message", key, lang)
+				continue
+			}
+			if verbs := formatVerb.FindAllString(format, -1); !slices.Equal(verbs, want) {
+				t.Errorf("%s: the %s message has the verbs %v, want %v", key, lang, verbs, want)
+			}
+		}
+	}
+}
+
+func TestErrorfUsesTheErrorLanguage(t *testing.T) {
+	previous := errorLanguage
+	t.Cleanup(func() { errorLanguage = previous })
+	cause := errors.New("boom")
+
+	for _, test := range []struct {
+		lang string
+		want string
+	}{
+		{"es", "error descargando sha256:0: boom"},
+		{"en", "error downloading sha256:0: boom"},
+	} {
+		errorLanguage = test.lang
+		err := withCode(ErrCodePushFailed, errorf(KeyBlobDownloadFailed, "sha256:0", cause))
+		if err.Error() != test.want {
+			t.Errorf("%s: error = %q, want %q", test.lang, err.Error(), test.want)
+		}
+		if key := errorKey(err); key != KeyBlobDownloadFailed {
+			t.Errorf("%s: errorKey() = %s, want %s", test.lang, key, KeyBlobDownloadFailed)
+		}
+		if !errors.Is(err, cause) {
+			t.Errorf("%s: the error does not wrap its cause", test.lang)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// pushMetadataOnly handles ecr.metadata_only_push: when the local image ref
+// has the same layers and runtime configuration as the image the primary tag
+// points to in ECR, and only its labels or creation time changed, it uploads
+// a new config blob and puts a manifest referencing the existing layers,
+// instead of pushing the image. It returns false, without error, when a
+// regular push is needed.
+func (ecr *ECR) pushMetadataOnly(ref string) (string, bool, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return "", false, err
+	}
+	defer cli.Close()
+	local, _, err := cli.ImageInspectWithRaw(ecr.context(), ref)
+	if client.IsErrNotFound(err) {
+		return "", false, withCode(ErrCodeImageNotFound, errorf(KeyLocalImageNotFound, ref))
+	}
+	if err != nil {
+		return "", false, classify(ErrCodeDockerUnavailable, "", errorf(KeyLocalImageInspectFailed, err))
+	}
+
+	current, err := ecr.batchGetImage(ecr.Config.ECR.ImageTag)
+	if errorCode(err) == ErrCodeImageNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	var m manifest
+	if err := json.Unmarshal([]byte(current.Manifest), &m); err != nil || m.isIndex() {
+		return "", false, nil
+	}
+	data, err := ecr.blob(m.Config.Digest)
+	if err != nil {
+		return "", false, err
+	}
+	var remote struct {
+		Architecture string            `json:"architecture"`
+		OS           string            `json:"os"`
+		Config       *container.Config `json:"config"`
+		RootFS       struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(data, &remote); err != nil {
+		return "", false, errorf(KeyImageConfigInvalid, m.Config.Digest, err)
+	}
+	if !slices.Equal(local.RootFS.Layers, remote.RootFS.DiffIDs) ||
+		local.Architecture != remote.Architecture || local.Os != remote.OS ||
+		runtimeConfig(local.Config) != runtimeConfig(remote.Config) {
+		return "", false, nil
+	}
+
+	// The new config is the current one with the local labels and date;
+	// every other value, the history included, is kept as it is.
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", false, errorf(KeyImageConfigInvalid, m.Config.Digest, err)
+	}
+	settings := map[string]json.RawMessage{}
+	json.Unmarshal(config["config"], &settings)
+	var labels map[string]string
+	if local.Config != nil {
+		labels = local.Config.Labels
+	}
+	settings["Labels"], _ = json.Marshal(labels)
+	if config["config"], err = json.Marshal(settings); err != nil {
+		return "", false, err
+	}
+	if local.Created != "" {
+		config["created"], _ = json.Marshal(local.Created)
+	}
+	newConfig, err := json.Marshal(config)
+	if err != nil {
+		return "", false, err
+	}
+	sum := sha256.Sum256(newConfig)
+	configDigest := "sha256:" + hex.EncodeToString(sum[:])
+
+	if configDigest != m.Config.Digest {
+		if err := ecr.uploadBlob(configDigest, newConfig); err != nil {
+			return "", false, err
+		}
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(current.Manifest), &raw); err != nil {
+		return "", false, errorf(KeyManifestInvalid, ecr.Config.ECR.ImageTag, err)
+	}
+	configDescriptor := map[string]json.RawMessage{}
+	json.Unmarshal(raw["config"], &configDescriptor)
+	configDescriptor["digest"], _ = json.Marshal(configDigest)
+	configDescriptor["size"], _ = json.Marshal(len(newConfig))
+	if raw["config"], err = json.Marshal(configDescriptor); err != nil {
+		return "", false, err
+	}
+	newManifest, err := json.Marshal(raw)
+	if err != nil {
+		return "", false, err
+	}
+
+	digest, err := ecr.putImage(ecr.Config.ECR.ImageTag, string(newManifest), current.MediaType)
+	if isAWSError(err, "ImageAlreadyExistsException") {
+		// Nothing changed at all: the tag already points to this image.
+		fmt.Printf("Image unchanged since %s, nothing to push\n", shortDigest(current.Digest))
+		return current.Digest, true, nil
+	}
+	if err != nil {
+		return "", false, classify(ErrCodePushFailed, err.Error(), errorf(KeyManifestPushFailed, err))
+	}
+	fmt.Printf(ColorGreen+"Layers unchanged since %s: pushed the new config and manifest only (%s)"+ColorReset+"\n",
+		shortDigest(current.Digest), shortDigest(digest))
+	return digest, true, nil
+}
+
+// runtimeConfig returns the parts of an image's runtime configuration that
+// decide how its containers run, as JSON to compare them: everything but the
+// labels and the fields the builder fills in.
+func runtimeConfig(c *container.Config) string {
+	if c == nil {
+		c = &container.Config{}
+	}
+	normalized := *c
+	normalized.Labels, normalized.Image, normalized.Hostname, normalized.Domainname = nil, "", "", ""
+	data, _ := json.Marshal(normalized)
+	return string(data)
+}
+
+// uploadBlob uploads data as a monolithic blob through the registry API.
+func (ecr *ECR) uploadBlob(digest string, data []byte) error {
+	token, err := ecr.registryToken()
+	if err != nil {
+		return err
+	}
+	endpoint := ecr.registryURL("/v2/" + ecr.Config.ECR.Repository + "/blobs/uploads/")
+	req, err := http.NewRequestWithContext(ecr.context(), http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Basic "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return classify(ErrCodePushFailed, "", errorf(KeyConfigUploadFailed, err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return classify(ErrCodePushFailed, resp.Status, errorf(KeyConfigUploadFailed, errorf(KeyRegistryRejected, resp.Status)))
+	}
+
+	location, err := url.Parse(resolveLocation(endpoint, resp.Header.Get("Location")))
+	if err != nil {
+		return errorf(KeyRegistryBadResponse, err)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+	req, err = http.NewRequestWithContext(ecr.context(), http.MethodPut, location.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Basic "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		return classify(ErrCodePushFailed, "", errorf(KeyConfigUploadFailed, err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return classify(ErrCodePushFailed, resp.Status, errorf(KeyConfigUploadFailed, errorf(KeyRegistryRejected, resp.Status)))
+	}
+	fmt.Fprintf(&ecr.logs, "uploaded config %s (%d bytes)\n", digest, len(data))
+	return nil
+}
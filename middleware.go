@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"lpmg.xyz/goscripts/chain"
+)
+
+// stage is one step of the build and push pipeline.
+type stage = chain.Stage[*ECR]
+
+// middleware wraps a stage with behaviour shared by every stage (see package
+// chain). Stage events, resource usage, checkpoints, timeouts, hooks and
+// retries are middlewares; an embedder such as serve or worker adds its own
+// logging, metrics or checks to ecr.middleware with Use instead of changing
+// runStages.
+type middleware = chain.Middleware[*ECR]
+
+// defaultMiddleware wraps every stage of a run, outermost first.
+var defaultMiddleware = chain.Chain[*ECR]{withEvents, withUsage, withCheckpoints, withTimeouts, withHooks, withRetries}
+
+// wrap applies the default middleware and ecr's to s.
+func (ecr *ECR) wrap(s stage) stage {
+	return append(append(chain.Chain[*ECR]{}, defaultMiddleware...), ecr.middleware...).Wrap(s)
+}
+
+// stageFunc returns s with Run replaced by run, which receives the original.
+func stageFunc(s stage, run func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error) stage {
+	return chain.Func(s, run)
+}
+
+// stageMethod adapts a stage method of ECR to a stage's Run. The method and
+// the helpers it calls reach the stage's context through ecr.context, to run
+// their commands and API calls with it.
+func stageMethod(run func(*ECR) error) func(context.Context, *ECR) error {
+	return func(ctx context.Context, ecr *ECR) error {
+		previous := ecr.ctx
+		ecr.ctx = ctx
+		defer func() { ecr.ctx = previous }()
+		return run(ecr)
+	}
+}
+
+// context returns the context of the running stage, canceled at its hard
+// timeout, or context.Background outside a stage.
+func (ecr *ECR) context() context.Context {
+	if ecr.ctx == nil {
+		return context.Background()
+	}
+	return ecr.ctx
+}
+
+// withEvents reports the stage starting and finishing to the run's observer.
+func withEvents(s stage) stage {
+	return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+		label := ecr.stageLabel(s.Name)
+		ecr.notify(stageEvent{Stage: label, Status: runRunning})
+		err := next(ctx, ecr)
+		if err != nil {
+			ecr.notify(stageEvent{Stage: label, Status: runFailed, Error: err.Error(), ErrorCode: errorCode(err), ErrorKey: errorKey(err)})
+		} else {
+			ecr.notify(stageEvent{Stage: label, Status: runSucceeded})
+		}
+		return err
+	})
+}
+
+// withUsage measures the CPU time and memory the stage used.
+func withUsage(s stage) stage {
+	return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+		meter := startUsage(ecr.stageLabel(s.Name))
+		err := next(ctx, ecr)
+		ecr.usage = append(ecr.usage, meter.stop())
+		return err
+	})
+}
+
+// withCheckpoints writes the stage's checkpoint when it starts and ends.
+func withCheckpoints(s stage) stage {
+	return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+		started := time.Now()
+		ecr.writeCheckpoint(s.Name, started, runRunning, nil)
+		err := next(ctx, ecr)
+		if err != nil {
+			ecr.writeCheckpoint(s.Name, started, runFailed, err)
+		} else {
+			ecr.writeCheckpoint(s.Name, started, runSucceeded, nil)
+		}
+		return err
+	})
+}
+
+// withHooks runs the profile's pre_ and post_ hooks of the stage.
+func withHooks(s stage) stage {
+	return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+		if err := ecr.runHooks(ctx, s.Name, "pre"); err != nil {
+			return err
+		}
+		if err := next(ctx, ecr); err != nil {
+			return err
+		}
+		return ecr.runHooks(ctx, s.Name, "post")
+	})
+}
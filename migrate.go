@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func runMigrateRepo(args []string) {
+	fs := flag.NewFlagSet("migrate-repo", flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	from := fs.String("from", "", "Profile whose repository is copied")
+	to := fs.String("to", "", "Profile whose repository receives the images")
+	tags := fs.String("tags", "", "Comma-separated glob patterns of tags to copy (default: every tag)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s migrate-repo [-config deploy.yml] -from profileA -to profileB [-tags 'v*,latest']\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *from == "" || *to == "" {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("-from and -to are required")))
+	}
+
+	src, dst := repoPair(*configPath, *from, *to)
+	exitOnError("Migration refused", checkWritable("migrate-repo to "+dst.registry()))
+
+	var patterns []string
+	if *tags != "" {
+		patterns = strings.Split(*tags, ",")
+	}
+	d, err := dst.drift(src, patterns)
+	exitOnError("Could not compare repositories", err)
+	failed := dst.reconcile(src, d)
+
+	fmt.Printf("Copied %d tag(s), %d already up to date, %d failed\n", len(d.Missing)+len(d.Changed)-failed, d.InSync, failed)
+	if failed > 0 {
+		exitOnError("Migration incomplete", withCode(ErrCodePushFailed, fmt.Errorf("%d tag(s) could not be copied to %s", failed, dst.Config.ECR.Repository)))
+	}
+}
+
+// copyImage copies digest from src's repository to tag in ecr's repository
+// registry to registry, keeping multi-arch indexes intact. It logs Docker in
+// to both registries first.
+func (ecr *ECR) copyImage(src *ECR, digest, tag string) error {
+	for _, registry := range []*ECR{src, ecr} {
+		if err := registry.dockerLogin(); err != nil {
+			return err
+		}
+	}
+	from := src.repositoryURI() + "@" + digest
+	cmd := exec.CommandContext(ecr.context(), "docker", "buildx", "imagetools", "create", "--tag", ecr.imageURI(tag), from)
+	var stderr bytes.Buffer
+	cmd.Stdout = &ecr.logs
+	cmd.Stderr = ecr.output(&stderr)
+	if err := cmd.Run(); err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return classify(ErrCodePushFailed, stderr.String(), errorf(KeyCopyFailed, from, errors.New(line)))
+		}
+		return classify(ErrCodePushFailed, stderr.String(), errorf(KeyCopyFailed, from, err))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isRateLimited reports whether docker output shows a registry rate limit,
+// as returned by Docker Hub for anonymous and free-tier pulls.
+func isRateLimited(output string) bool {
+	return strings.Contains(output, "toomanyrequests")
+}
+
+// mirrorDockerfile writes a copy of the Dockerfile at path with every Docker
+// Hub base image pointed at the configured mirror (a registry mirror or an ECR
+// pull-through cache prefix) and returns the copy's path.
+func (ecr *ECR) mirrorDockerfile(path string) (string, error) {
+	d, err := readDockerfile(path)
+	if err != nil {
+		return "", err
+	}
+
+	mirror := strings.TrimSuffix(ecr.Config.Docker.Mirror, "/")
+	substituted := 0
+	for _, from := range d.bases() {
+		if imageRegistry(from.Image) != "docker.io" {
+			continue
+		}
+		image := mirror + "/" + imagePath(from.Image)
+		d.setBase(from.Line, image)
+		substituted++
+		fmt.Printf(ColorYellow+"  %s → %s"+ColorReset+"\n", from.Image, image)
+		fmt.Fprintf(&ecr.logs, "mirror: %s -> %s\n", from.Image, image)
+	}
+	if substituted == 0 {
+		return "", errorf(KeyMirrorNoBases, path)
+	}
+	return d.writeTemp()
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecrapi "github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// mountLayers checks, before the push, which layers of the local image the
+// profile's repository already has (BatchCheckLayerAvailability), mounts the
+// missing ones that other repositories of the registry hold, the ecr.mount_from
+// base images, and reports how much is left to upload. Docker then finds the
+// present and mounted layers and skips them. Multi-platform and by-digest
+// pushes have no local image to check, so only the base layers are mounted.
+// It is an optimization: failures only warn.
+func (ecr *ECR) mountLayers() error {
+	if readOnly || ecr.Config.ECR.Public {
+		return nil
+	}
+	noLocalImage := ecr.multiPlatform() || ecr.Config.ECR.PushByDigest
+	if noLocalImage && len(ecr.Config.ECR.MountFrom) == 0 {
+		return nil
+	}
+	if err := ecr.ensureRepository(); err != nil {
+		return err
+	}
+	ecr.stage(ColorCyan, "Checking layers in "+ecr.Config.ECR.Repository)
+
+	var local []localLayer
+	platform := "linux/" + runtime.GOARCH
+	if !noLocalImage {
+		var err error
+		if local, platform, err = ecr.localLayers(ecr.imageURI(ecr.Config.ECR.ImageTag)); err != nil {
+			fmt.Println(ColorYellow + "  skipped: " + err.Error() + ColorReset)
+			return nil
+		}
+	}
+	_, err := ecr.dedupLayers(local, platform)
+	return err
+}
+
+// localLayer is a layer of the local image: its diff ID and uncompressed
+// size, -1 when unknown.
+type localLayer struct {
+	DiffID string
+	Size   int64
+}
+
+// knownLayer is the compressed blob of a layer found in a repository of the
+// registry.
+type knownLayer struct {
+	descriptor
+	Repository string
+}
+
+// layerPlan is what the push of the local image needs, layer by layer.
+type layerPlan struct {
+	Present int          // layers already in the repository
+	Mount   []knownLayer // layers another repository of the registry has
+	Upload  int          // layers docker has to upload
+	// UploadSize adds up the compressed size of the layers to upload found in
+	// the registry and the uncompressed size of the others; Unsized counts
+	// those whose size is unknown.
+	UploadSize int64
+	Unsized    int
+}
+
+// localLayers returns the layers of the local image ref, oldest first, and
+// its platform. Their sizes come from the image history, whose entries with
+// a size are the layers; when they do not add up to the layers (a layer can
+// be empty) the sizes are left unknown.
+func (ecr *ECR) localLayers(ref string) ([]localLayer, string, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return nil, "", err
+	}
+	defer cli.Close()
+	local, _, err := cli.ImageInspectWithRaw(ecr.context(), ref)
+	if err != nil {
+		return nil, "", err
+	}
+	history, err := cli.ImageHistory(ecr.context(), ref)
+	if err != nil {
+		return nil, "", err
+	}
+	var sizes []int64
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Size > 0 {
+			sizes = append(sizes, history[i].Size)
+		}
+	}
+
+	layers := make([]localLayer, len(local.RootFS.Layers))
+	for i, diffID := range local.RootFS.Layers {
+		layers[i] = localLayer{DiffID: diffID, Size: -1}
+		if len(sizes) == len(layers) {
+			layers[i].Size = sizes[i]
+		}
+	}
+	return layers, local.Os + "/" + local.Architecture, nil
+}
+
+// dedupLayers plans the push of the local layers (see planLayers), mounts
+// the layers other repositories have and prints the plan. Without local
+// layers every missing layer of the ecr.mount_from images is mounted.
+func (ecr *ECR) dedupLayers(local []localLayer, platform string) (*layerPlan, error) {
+	token, err := ecr.registryToken()
+	if err != nil {
+		fmt.Println(ColorYellow + "  skipped: " + err.Error() + ColorReset)
+		return nil, nil
+	}
+	known := ecr.knownLayers(platform)
+	var plan *layerPlan
+	if local == nil {
+		plan, err = ecr.planBaseLayers(known)
+	} else {
+		plan, err = ecr.planLayers(local, known)
+	}
+	if err != nil {
+		fmt.Println(ColorYellow + "  skipped: " + err.Error() + ColorReset)
+		return nil, nil
+	}
+
+	mounted, unsupported := 0, false
+	for _, layer := range plan.Mount {
+		ok, err := ecr.mountBlob(token, layer.Digest, layer.Repository)
+		if err != nil {
+			fmt.Println(ColorYellow + "  " + shortDigest(layer.Digest) + ": " + err.Error() + ColorReset)
+			continue
+		}
+		if !ok {
+			unsupported = true
+			break
+		}
+		mounted++
+	}
+
+	if local != nil {
+		size := formatBytes(plan.UploadSize)
+		if plan.Unsized > 0 {
+			size += fmt.Sprintf(", %d of unknown size", plan.Unsized)
+		}
+		fmt.Printf("  %d layer(s): %d already present, %d to mount from other repositories, %d to upload (%s)\n",
+			plan.Present+len(plan.Mount)+plan.Upload, plan.Present, len(plan.Mount), plan.Upload, size)
+	}
+	if unsupported {
+		fmt.Println(ColorYellow + "  the registry did not mount layers; enable it with: aws ecr put-account-setting --name BLOB_MOUNTING --value ENABLED" + ColorReset)
+	}
+	if mounted > 0 {
+		fmt.Printf(ColorGreen+"  mounted %d layer(s) instead of uploading them"+ColorReset+"\n", mounted)
+	}
+	return plan, nil
+}
+
+// knownLayers maps the diff IDs of the layers of the image the primary tag
+// points to and of the ecr.mount_from images, for platform, to their
+// compressed blobs, preferring the profile's repository. Images that cannot
+// be read are skipped with a warning.
+func (ecr *ECR) knownLayers(platform string) map[string]knownLayer {
+	refs := append([]string{ecr.Config.ECR.Repository + ":" + ecr.Config.ECR.ImageTag}, ecr.Config.ECR.MountFrom...)
+	known := map[string]knownLayer{}
+	for i, ref := range refs {
+		repository, tag, _ := strings.Cut(ref, ":")
+		layers, err := ecr.remoteLayers(repository, orDefault(tag, "latest"), platform)
+		if err != nil {
+			// The primary tag does not exist before the first push.
+			if i > 0 || errorCode(err) != ErrCodeImageNotFound {
+				fmt.Println(ColorYellow + "  " + ref + ": " + err.Error() + ColorReset)
+			}
+			continue
+		}
+		for diffID, layer := range layers {
+			if _, ok := known[diffID]; !ok {
+				known[diffID] = knownLayer{layer, repository}
+			}
+		}
+	}
+	return known
+}
+
+// remoteLayers maps the diff IDs of the layers of repository:tag to their
+// compressed blobs, read from the image config.
+func (ecr *ECR) remoteLayers(repository, tag, platform string) (map[string]descriptor, error) {
+	source := *ecr.Config
+	source.ECR.Repository = repository
+	image := &ECR{Profile: ecr.Profile, Config: &source, ctx: ecr.ctx}
+	m, _, err := image.resolveManifest(tag, platform)
+	if err != nil {
+		return nil, err
+	}
+	config, err := image.fetchConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.RootFS.DiffIDs) != len(m.Layers) {
+		return nil, errorf(KeyMountConfigMismatch, shortDigest(m.Config.Digest))
+	}
+	layers := map[string]descriptor{}
+	for i, layer := range m.Layers {
+		layers[config.RootFS.DiffIDs[i]] = layer
+	}
+	return layers, nil
+}
+
+// planLayers checks which of the local layers the repository has, by the
+// compressed digests known puts them at, and plans mounting the missing ones
+// another repository has. The others are left to docker to upload.
+func (ecr *ECR) planLayers(local []localLayer, known map[string]knownLayer) (*layerPlan, error) {
+	var digests []string
+	for _, layer := range local {
+		if k, ok := known[layer.DiffID]; ok && !contains(digests, k.Digest) {
+			digests = append(digests, k.Digest)
+		}
+	}
+	missing, err := ecr.missingLayers(digests)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &layerPlan{}
+	seen := map[string]bool{}
+	for _, layer := range local {
+		if seen[layer.DiffID] {
+			continue
+		}
+		seen[layer.DiffID] = true
+		k, ok := known[layer.DiffID]
+		switch {
+		case ok && !contains(missing, k.Digest):
+			plan.Present++
+		case ok && k.Repository != ecr.Config.ECR.Repository:
+			plan.Mount = append(plan.Mount, k)
+		case ok:
+			plan.Upload++
+			plan.UploadSize += k.Size
+		default:
+			plan.Upload++
+			if layer.Size < 0 {
+				plan.Unsized++
+			} else {
+				plan.UploadSize += layer.Size
+			}
+		}
+	}
+	return plan, nil
+}
+
+// planBaseLayers plans mounting every layer of the ecr.mount_from images the
+// repository does not have yet.
+func (ecr *ECR) planBaseLayers(known map[string]knownLayer) (*layerPlan, error) {
+	var base []knownLayer
+	var digests []string
+	for _, layer := range known {
+		if layer.Repository != ecr.Config.ECR.Repository {
+			base = append(base, layer)
+			digests = append(digests, layer.Digest)
+		}
+	}
+	missing, err := ecr.missingLayers(digests)
+	if err != nil {
+		return nil, err
+	}
+	plan := &layerPlan{}
+	for _, layer := range base {
+		if contains(missing, layer.Digest) {
+			plan.Mount = append(plan.Mount, layer)
+		} else {
+			plan.Present++
+		}
+	}
+	return plan, nil
+}
+
+// missingLayers returns the digests not yet present in the repository.
+func (ecr *ECR) missingLayers(digests []string) ([]string, error) {
+	if len(digests) == 0 {
+		return nil, nil
+	}
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return nil, err
+	}
+	var out *ecrapi.BatchCheckLayerAvailabilityOutput
+	if err := ecr.callAWS("ecr batch-check-layer-availability", func(ctx context.Context) (err error) {
+		out, err = client.BatchCheckLayerAvailability(ctx, &ecrapi.BatchCheckLayerAvailabilityInput{
+			RepositoryName: aws.String(ecr.Config.ECR.Repository),
+			LayerDigests:   digests,
+		})
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, layer := range out.Layers {
+		if layer.LayerAvailability != ecrtypes.LayerAvailabilityAvailable {
+			missing = append(missing, aws.ToString(layer.LayerDigest))
+		}
+	}
+	for _, failure := range out.Failures {
+		missing = append(missing, aws.ToString(failure.LayerDigest))
+	}
+	return missing, nil
+}
+
+// mountBlob asks the registry to mount digest from another repository. It
+// returns false when the registry answered with a regular upload instead,
+// which it does when blob mounting is disabled.
+func (ecr *ECR) mountBlob(token, digest, from string) (bool, error) {
+	endpoint := ecr.registryURL(fmt.Sprintf("/v2/%s/blobs/uploads/?mount=%s&from=%s",
+		ecr.Config.ECR.Repository, url.QueryEscape(digest), url.QueryEscape(from)))
+	req, err := http.NewRequestWithContext(ecr.context(), http.MethodPost, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Basic "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, errorf(KeyMountFailed, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		fmt.Fprintf(&ecr.logs, "mounted %s from %s\n", digest, from)
+		return true, nil
+	case http.StatusAccepted:
+		// An upload session was opened instead; cancel it.
+		if location := resp.Header.Get("Location"); location != "" {
+			if cancel, err := http.NewRequestWithContext(ecr.context(), http.MethodDelete, resolveLocation(endpoint, location), nil); err == nil {
+				cancel.Header.Set("Authorization", "Basic "+token)
+				if resp, err := http.DefaultClient.Do(cancel); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, errorf(KeyRegistryRejected, resp.Status)
+}
+
+func resolveLocation(base, location string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return location
+	}
+	l, err := b.Parse(location)
+	if err != nil {
+		return location
+	}
+	return l.String()
+}
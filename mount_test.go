@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"lpmg.xyz/goscripts/ecrtest"
+)
+
+// putTestImage pushes to srv an image whose layers have the given diff IDs
+// and content, and returns its layer descriptors.
+func putTestImage(t *testing.T, srv *ecrtest.Server, repository, tag string, layers map[string]string) []descriptor {
+	t.Helper()
+	var diffIDs []string
+	for diffID := range layers {
+		diffIDs = append(diffIDs, diffID)
+	}
+	slices.Sort(diffIDs)
+	config, _ := json.Marshal(map[string]any{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": diffIDs},
+	})
+	m := manifest{
+		MediaType: "application/vnd.docker.distribution.manifest.v2+json",
+		Config:    descriptor{MediaType: "application/vnd.docker.container.image.v1+json", Digest: digestOf(config), Size: int64(len(config))},
+	}
+	blobs := [][]byte{config}
+	for _, diffID := range diffIDs {
+		data := []byte(layers[diffID])
+		m.Layers = append(m.Layers, descriptor{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Digest: digestOf(data), Size: int64(len(data))})
+		blobs = append(blobs, data)
+	}
+	data, _ := json.Marshal(map[string]any{"schemaVersion": 2, "mediaType": m.MediaType, "config": m.Config, "layers": m.Layers})
+	if _, err := srv.PutImage(repository, tag, data, blobs...); err != nil {
+		t.Fatal(err)
+	}
+	return m.Layers
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestDedupLayers(t *testing.T) {
+	srv := startECR(t)
+	srv.CreateRepository("base", false)
+	current := putTestImage(t, srv, testRepository, "v1", map[string]string{"sha256:d0": "app layer"})
+	base := putTestImage(t, srv, "base", "1.0", map[string]string{"sha256:d1": "base layer 1", "sha256:d2": "base layer 2"})
+
+	ecr := testRun(t, "mount", func(c *ProfileConfig) {
+		c.ECR.MountFrom = []string{"base:1.0"}
+	})
+	local := []localLayer{
+		{DiffID: "sha256:d1", Size: 1000},
+		{DiffID: "sha256:d2", Size: 2000},
+		{DiffID: "sha256:d0", Size: 3000},
+		{DiffID: "sha256:d3", Size: 4000},
+		{DiffID: "sha256:d4", Size: -1},
+	}
+	plan, err := ecr.dedupLayers(local, "linux/amd64")
+	if err != nil || plan == nil {
+		t.Fatalf("dedupLayers() = %v, %v", plan, err)
+	}
+	if plan.Present != 1 || len(plan.Mount) != 2 || plan.Upload != 2 || plan.UploadSize != 4000 || plan.Unsized != 1 {
+		t.Errorf("plan = %+v, want 1 present, 2 to mount, 2 to upload of 4000 bytes and 1 of unknown size", *plan)
+	}
+
+	digests := []string{current[0].Digest}
+	for _, layer := range base {
+		digests = append(digests, layer.Digest)
+	}
+	if missing, err := ecr.missingLayers(digests); err != nil || len(missing) > 0 {
+		t.Errorf("missingLayers() after mounting = %v, %v, want none", missing, err)
+	}
+}
+
+func TestDedupLayersWithoutLocalImage(t *testing.T) {
+	srv := startECR(t)
+	srv.CreateRepository("base", false)
+	base := putTestImage(t, srv, "base", "1.0", map[string]string{"sha256:d1": "base layer 1", "sha256:d2": "base layer 2"})
+
+	// Multi-platform pushes have no local image: every base layer is mounted.
+	ecr := testRun(t, "mount", func(c *ProfileConfig) {
+		c.ECR.MountFrom = []string{"base:1.0"}
+	})
+	plan, err := ecr.dedupLayers(nil, "linux/amd64")
+	if err != nil || plan == nil {
+		t.Fatalf("dedupLayers() = %v, %v", plan, err)
+	}
+	if len(plan.Mount) != len(base) || plan.Present != 0 {
+		t.Errorf("plan = %+v, want the %d base layers to mount", *plan, len(base))
+	}
+	if missing, err := ecr.missingLayers([]string{base[0].Digest, base[1].Digest}); err != nil || len(missing) > 0 {
+		t.Errorf("missingLayers() after mounting = %v, %v, want none", missing, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// profileNames expands the -profile flag: a profile, a comma-separated list
+// or "all" for every profile in the configuration, sorted.
+func (c *Config) profileNames(flag string) ([]string, error) {
+	if flag == "all" {
+		names := make([]string, 0, len(c.Profiles))
+		for name := range c.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, withCode(ErrCodeProfileNotFound, fmt.Errorf("the configuration defines no profiles"))
+		}
+		return names, nil
+	}
+	var names []string
+	for _, name := range strings.Split(flag, ",") {
+		if name = strings.TrimSpace(name); name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, withCode(ErrCodeProfileNotFound, fmt.Errorf("no profile given"))
+	}
+	return names, nil
+}
+
+// profileResult is the outcome of one profile of a multi-profile run.
+type profileResult struct {
+	Profile  string
+	Status   string
+	Duration time.Duration
+	Image    string
+	Err      error
+
+	run *ECR // nil when the profile could not be prepared
+}
+
+// runProfiles runs the pipeline of every profile, at most concurrency at a
+// time, and returns their results in the order of names. prepare returns the
+// run of a profile with its configuration resolved and validated. Output of
+// profiles running at the same time is interleaved; the run history and the
+// summary keep them apart.
+func runProfiles(config *Config, names []string, concurrency int, prepare func(profile string) (*ECR, error)) []profileResult {
+	results := make([]profileResult, len(names))
+	slots := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = runProfileOnce(config, name, prepare)
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+func runProfileOnce(config *Config, name string, prepare func(profile string) (*ECR, error)) profileResult {
+	started := time.Now()
+	result := profileResult{Profile: name, Status: runFailed}
+	ecr, err := prepare(name)
+	if err != nil {
+		fmt.Println(ColorRed + "Profile " + name + ": " + err.Error() + ColorReset)
+		result.Err, result.Duration = err, time.Since(started)
+		return result
+	}
+	fmt.Println(ColorCyan + "Profile " + name + ColorReset)
+	result.run = ecr
+	err = ecr.runPipeline()
+	recordRun(config.History, newRunEntry(ecr.runID, "cli", ecr, started, err))
+	recordDeployment(config.Manifest, ecr, err)
+	if err == nil && contains(stageNamesOf(ecr.stages), "push") && !ecr.upToDate {
+		err = ecr.writeCodeBuildOutputs()
+	}
+	result.Duration = time.Since(started)
+	result.Image = ecr.pushedImageURI()
+	switch {
+	case err != nil:
+		result.Err = err
+		fmt.Println(ColorRed + "Profile " + name + " failed: " + err.Error() + ColorReset)
+	case ecr.upToDate:
+		result.Status = "up to date"
+	default:
+		result.Status = runSucceeded
+	}
+	return result
+}
+
+// printProfileResults prints the summary of a multi-profile run and returns
+// an error naming the failed profiles, with the code of the first failure.
+func printProfileResults(results []profileResult) error {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tSTATUS\tDURATION\tIMAGE / ERROR")
+	var failed []string
+	var first error
+	for _, r := range results {
+		detail := r.Image
+		if r.Err != nil {
+			detail = string(errorCode(r.Err)) + ": " + r.Err.Error()
+			failed = append(failed, r.Profile)
+			if first == nil {
+				first = r.Err
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Profile, r.Status, r.Duration.Round(time.Second), detail)
+	}
+	w.Flush()
+	if first != nil {
+		return withCode(errorCode(first), fmt.Errorf("%d of %d profiles failed: %s", len(failed), len(results), strings.Join(failed, ", ")))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func runPinBases(args []string) {
+	fs, configPath, profile := commandFlags("pin-bases", "pin-bases [-config deploy.yml] [-profile dev] [-update]")
+	update := fs.Bool("update", false, "Re-resolve bases that are already pinned to the current digest of their tag")
+	fs.Parse(args)
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	d, err := ecr.localDockerfile()
+	exitOnError("Could not read Dockerfile", err)
+
+	changed := 0
+	for _, from := range d.bases() {
+		name, digest := splitDigest(from.Image)
+		if digest != "" && !*update {
+			fmt.Printf("  %s (already pinned)\n", from.Image)
+			continue
+		}
+		resolved, err := ecr.resolveDigest(name)
+		exitOnError("Could not resolve base image", err)
+		if resolved == digest {
+			fmt.Printf("  %s (up to date)\n", from.Image)
+			continue
+		}
+		pinned := name + "@" + resolved
+		d.setBase(from.Line, pinned)
+		changed++
+		fmt.Println(ColorYellow + "  " + from.Image + " → " + pinned + ColorReset)
+	}
+
+	if changed == 0 {
+		fmt.Println(ColorGreen + "All base images are pinned" + ColorReset)
+		return
+	}
+	exitOnError("Could not write Dockerfile", os.WriteFile(d.Path, []byte(d.String()), 0o644))
+	fmt.Printf(ColorGreen+"Pinned %d base image(s) in %s"+ColorReset+"\n", changed, d.Path)
+}
+
+// splitDigest separates "image:tag@sha256:..." into the reference without the
+// digest and the digest ("" if the reference is not pinned).
+func splitDigest(ref string) (string, string) {
+	name, digest, _ := strings.Cut(ref, "@")
+	return name, digest
+}
+
+// resolveDigest returns the current manifest digest of ref from its registry
+// without pulling it. For multi-platform images this is the index digest.
+func (ecr *ECR) resolveDigest(ref string) (string, error) {
+	digest, err := ecr.distributionDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", errorf(KeyDigestUnexpected, ref, digest)
+	}
+	return digest, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pipeline lists the stages of a run in execution order.
+var pipeline = []stage{
+	{Name: "auth", Failure: "Authentication failed", Run: stageMethod((*ECR).login)},
+	{Name: "policy", Failure: "Policy check failed", Run: stageMethod((*ECR).checkPolicies)},
+	{Name: "build", Failure: "Build failed", Run: stageMethod((*ECR).build)},
+	{Name: "tag", Failure: "Tag failed", Run: stageMethod((*ECR).tag)},
+	{Name: "approval", Failure: "Approval failed", Run: stageMethod((*ECR).approve)},
+	{Name: "guard", Failure: "Tag guard failed", Run: stageMethod((*ECR).guardTag)},
+	{Name: "mount", Failure: "Layer mount failed", Run: stageMethod((*ECR).mountLayers)},
+	{Name: "push", Failure: "Push failed", Run: stageMethod((*ECR).push)},
+	{Name: "scan", Failure: "Vulnerability scan failed", Run: stageMethod((*ECR).scanGate)},
+	{Name: "sign", Failure: "Signing failed", Run: stageMethod((*ECR).signImage)},
+	{Name: "deploy", Failure: "Deploy failed", Run: stageMethod((*ECR).deploy)},
+}
+
+// selectStages returns the pipeline stages left after applying the
+// comma-separated -only and -skip lists, keeping pipeline order.
+func selectStages(only, skip string) ([]stage, error) {
+	if only != "" && skip != "" {
+		return nil, fmt.Errorf("-only and -skip cannot be used together")
+	}
+	names := map[string]bool{}
+	for _, list := range []string{only, skip} {
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if !isStage(name) {
+				return nil, fmt.Errorf("unknown stage '%s' (expected one of %s)", name, strings.Join(stageNames(), ", "))
+			}
+			names[name] = true
+		}
+	}
+
+	var stages []stage
+	for _, s := range pipeline {
+		if only != "" && !names[s.Name] || skip != "" && names[s.Name] {
+			continue
+		}
+		stages = append(stages, s)
+	}
+	return stages, nil
+}
+
+func stageNames() []string {
+	return stageNamesOf(pipeline)
+}
+
+func stageNamesOf(stages []stage) []string {
+	names := make([]string, len(stages))
+	for i, s := range stages {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func isStage(name string) bool {
+	return contains(stageNames(), name)
+}
+
+// stageError records which stage of the pipeline failed.
+type stageError struct {
+	Stage stage
+	Err   error
+}
+
+func (e *stageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage.Failure, e.Err)
+}
+
+func (e *stageError) Unwrap() error {
+	return e.Err
+}
+
+// stageEvent reports a stage starting or finishing.
+type stageEvent struct {
+	Stage  string    `json:"stage"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+	ErrorKey  ErrorKey  `json:"error_key,omitempty"`
+}
+
+// runPipeline runs the selected stages (every stage unless ecr.stages is set)
+// in order and stops at the first failure. With ecr.rebuildIfBaseUpdated the
+// run is skipped, setting ecr.upToDate, when no base image changed since the
+// last successful build, and with ecr.skipIfExists when the tag is already in
+// ECR (see checkExistingTags).
+func (ecr *ECR) runPipeline() error {
+	lock, err := ecr.lockRun()
+	if err != nil {
+		return &stageError{Stage: stage{Name: "lock", Failure: "Could not lock the run"}, Err: err}
+	}
+	defer lock.unlock()
+	defer ecr.removePinnedDockerfile()
+
+	stages := pipeline
+	if ecr.stages != nil {
+		stages = ecr.stages
+	}
+	if err := ecr.checkExistingTags(stages); err != nil {
+		return &stageError{Stage: stage{Name: "preflight", Failure: "Pre-flight check failed"}, Err: err}
+	}
+	if ecr.upToDate {
+		return nil
+	}
+
+	var bases map[string]string
+	if ecr.rebuildIfBaseUpdated {
+		updated, digests, err := ecr.basesUpdated()
+		if err != nil {
+			return &stageError{Stage: stage{Name: "freshness", Failure: "Base image check failed"}, Err: err}
+		}
+		if !updated {
+			ecr.upToDate = true
+			ecr.stage(ColorGreen, "Base images unchanged, skipping rebuild")
+			return nil
+		}
+		bases = digests
+	}
+
+	if err := ecr.runStages(stages); err != nil {
+		return err
+	}
+	if err := ecr.runVariants(stages); err != nil {
+		return err
+	}
+	printUsage(ecr.usage)
+	if bases != nil {
+		if err := ecr.saveBaseDigests(bases); err != nil {
+			fmt.Println(ColorYellow + "Could not record base image digests: " + err.Error() + ColorReset)
+		}
+	}
+	return nil
+}
+
+// runStages runs the selected stages in pipeline order, each wrapped by the
+// run's middleware. Variants skip authentication and approval, which the
+// main image already did, and deployment.
+func (ecr *ECR) runStages(stages []stage) error {
+	for _, s := range pipeline {
+		if !contains(stageNamesOf(stages), s.Name) {
+			if ecr.variant == nil {
+				ecr.stage(ColorYellow, "Skipping stage "+s.Name)
+			}
+			continue
+		}
+		if ecr.variant != nil && mainImageOnly(s.Name) {
+			continue
+		}
+		if err := ecr.wrap(s).Run(context.Background(), ecr); err != nil {
+			if ecr.variant != nil {
+				err = fmt.Errorf("variant %s: %w", ecr.variant.Name, err)
+			}
+			return &stageError{Stage: s, Err: err}
+		}
+	}
+	return nil
+}
+
+// notify passes a stage event to the run's observer, if any.
+func (ecr *ECR) notify(event stageEvent) {
+	if ecr.onStage == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	ecr.onStage(event)
+}
+
+// overrides are per-run changes to a profile, accepted by the serve API and
+// worker job messages.
+type overrides struct {
+	ImageTag   string `json:"image_tag,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Region     string `json:"region,omitempty"`
+	ImageName  string `json:"image_name,omitempty"`
+}
+
+func (o *overrides) apply(config *ProfileConfig) {
+	if o == nil {
+		return
+	}
+	if o.ImageTag != "" {
+		// An explicit tag replaces the configured ones.
+		config.ECR.ImageTag, config.ECR.ImageTags = o.ImageTag, nil
+	}
+	if o.Repository != "" {
+		config.ECR.Repository = o.Repository
+	}
+	if o.Region != "" {
+		config.ECR.Region = o.Region
+	}
+	if o.ImageName != "" {
+		config.Docker.ImageName = o.ImageName
+	}
+}
+
+// runProfile resolves ecr.Profile from config, applies o and runs the
+// pipeline. It is used by the long-running modes (serve, worker).
+func runProfile(config *Config, ecr *ECR, o *overrides) error {
+	profileConfig, err := config.profile(ecr.Profile)
+	if err != nil {
+		return err
+	}
+	o.apply(profileConfig)
+	if err := validateConfig(profileConfig); err != nil {
+		return withCode(ErrCodeConfigInvalid, err)
+	}
+	ecr.Config = profileConfig
+	if err := config.assumeWorkspaceRole(); err != nil {
+		return err
+	}
+	return ecr.runPipeline()
+}
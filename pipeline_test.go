@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lpmg.xyz/goscripts/ecrtest"
+)
+
+// testRepository is the repository the pipeline tests push to.
+const testRepository = "app"
+
+// startECR starts a fake ECR for the test and points pushecr and the AWS SDK
+// at it, from a temporary working directory that holds the run's state.
+func startECR(t *testing.T) *ecrtest.Server {
+	t.Helper()
+	srv, err := ecrtest.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	srv.CreateRepository(testRepository, false)
+
+	for _, variable := range append(srv.Env(), "AWS_REGION=us-east-1", "AWS_PROFILE=", "AWS_CONFIG_FILE="+filepath.Join(t.TempDir(), "config")) {
+		name, value, _ := strings.Cut(variable, "=")
+		t.Setenv(name, value)
+	}
+	previous := registryOverride
+	registryOverride = srv.Addr()
+	t.Cleanup(func() { registryOverride = previous })
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return srv
+}
+
+// testRun returns a run of the only stages of a profile for the fake ECR,
+// with config applied to it. Docker is not needed: stages that would call it
+// are replaced with stage middleware (see replaceStage).
+func testRun(t *testing.T, only string, config func(*ProfileConfig)) *ECR {
+	t.Helper()
+	profile := &ProfileConfig{}
+	profile.ECR.AccountID = "000000000000"
+	profile.ECR.Region = "us-east-1"
+	profile.ECR.Repository = testRepository
+	profile.ECR.ImageTag = "v1"
+	profile.Docker.ImageName = testRepository
+	if config != nil {
+		config(profile)
+	}
+	stages, err := selectStages(only, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ECR{Profile: "test", Config: profile, stages: stages, force: true}
+}
+
+// replaceStage runs run instead of the named stage, as a stage method inside
+// the default middleware like any stage of the pipeline.
+func replaceStage(ecr *ECR, name string, run func(*ECR) error) {
+	ecr.middleware.Use(func(s stage) stage {
+		if s.Name != name {
+			return s
+		}
+		return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+			return stageMethod(run)(ctx, ecr)
+		})
+	})
+}
+
+// registryPush starts a blob upload in the profile's repository with the
+// cached registry token, the first request of a docker push.
+func registryPush(ecr *ECR) error {
+	user, password, err := ecr.registryCredentials()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ecr.context(), http.MethodPost, ecr.registryURL("/v2/"+ecr.Config.ECR.Repository+"/blobs/uploads/"), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(user, password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return classify(ErrCodePushFailed, string(body), errorf(KeyPushFailed, fmt.Errorf("%s", resp.Status)))
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+type PolicyConfig struct {
+	BaseImages BaseImagePolicy  `mapstructure:"base_images"`
+	Repository RepositoryPolicy `mapstructure:"repository"`
+	Tags       TagPolicy        `mapstructure:"tags"`
+	Commands   []CommandPolicy  `mapstructure:"commands"`
+	Secrets    SecretsPolicy    `mapstructure:"secrets"`
+	Licenses   LicensePolicy    `mapstructure:"licenses"`
+	AuditLog   string           `mapstructure:"audit_log"` // default .pushecr/audit.jsonl
+}
+
+type BaseImagePolicy struct {
+	RequireSignature bool                 `mapstructure:"require_signature"`
+	RequirePinned    bool                 `mapstructure:"require_pinned"`
+	Signers          []CosignVerifyConfig `mapstructure:"signers"`
+	Exempt           []string             `mapstructure:"exempt"`
+}
+
+// checkPolicies runs the policy checks configured for the profile.
+func (ecr *ECR) checkPolicies() error {
+	if err := ecr.checkRepositoryPolicy(); err != nil {
+		return err
+	}
+	if err := ecr.checkTagPolicy(); err != nil {
+		return err
+	}
+	return ecr.checkBaseImagePolicy()
+}
+
+// checkBaseImagePolicy verifies, before building, that every base image in
+// the Dockerfile is pinned to a digest and/or signed by one of the configured
+// signers. Images in FROM lines are resolved from the build args and ARG
+// defaults first, and one that cannot be resolved fails the check. The
+// verified digests are pinned in the Dockerfile the build uses (see
+// pinBases), so the build cannot pull a different image by the same tag.
+func (ecr *ECR) checkBaseImagePolicy() error {
+	ecr.removePinnedDockerfile()
+	policy := ecr.Config.Policy.BaseImages
+	if !policy.RequireSignature && !policy.RequirePinned {
+		return nil
+	}
+	if policy.RequireSignature && len(policy.Signers) == 0 {
+		return withCode(ErrCodeConfigInvalid, errorf(KeyPolicySignersMissing))
+	}
+
+	d, err := ecr.localDockerfile()
+	if err != nil {
+		return err
+	}
+	bases, err := ecr.policyBases(d)
+	if err != nil {
+		return err
+	}
+
+	if policy.RequirePinned {
+		ecr.stage(ColorCyan, "Checking that base images are pinned")
+		if err := checkPinnedBases(bases, policy.Exempt, true); err != nil {
+			return err
+		}
+	}
+	if !policy.RequireSignature {
+		return nil
+	}
+
+	ecr.stage(ColorCyan, "Verifying base image signatures")
+	var violations []string
+	verified := map[int]string{}
+	for _, from := range bases {
+		if matchesAny(from.Image, policy.Exempt) {
+			fmt.Printf("  %s (exempt)\n", from.Image)
+			continue
+		}
+		ref, signer, err := ecr.verifyBaseImage(from.Image, policy.Signers)
+		if err != nil {
+			fmt.Println(ColorRed + "✘ " + from.Image + ": " + err.Error() + ColorReset)
+			violations = append(violations, from.Image)
+			continue
+		}
+		fmt.Println(ColorGreen + "✔ " + ref + " signed by " + signer.String() + ColorReset)
+		verified[from.Line] = ref
+	}
+	if len(violations) > 0 {
+		return withCode(ErrCodePolicyViolation, errorf(KeyPolicyBaseUnsigned, violations))
+	}
+	return ecr.pinBases(d, verified)
+}
+
+// policyBases returns the base images of the Dockerfile resolved for the
+// image being built, failing on a FROM line it cannot resolve.
+func (ecr *ECR) policyBases(d *dockerfile) ([]dockerfileFrom, error) {
+	bases, unresolved := d.resolvedBases(ecr.buildArgValues())
+	for _, ref := range unresolved {
+		fmt.Println(ColorRed + "✘ " + ref + ": references an ARG without a value" + ColorReset)
+	}
+	if len(unresolved) > 0 {
+		return nil, withCode(ErrCodePolicyViolation, errorf(KeyPolicyBaseUnresolved, unresolved))
+	}
+	return bases, nil
+}
+
+// checkPinnedBases fails on base images that are not pinned to a digest in
+// the Dockerfile itself. An image that comes from an ARG is not pinned even
+// if its value is, since any build arg can replace it. print reports each
+// image as it is checked.
+func checkPinnedBases(bases []dockerfileFrom, exempt []string, print bool) error {
+	var unpinned []string
+	for _, from := range bases {
+		if matchesAny(from.Image, exempt) {
+			continue
+		}
+		reason := ""
+		if _, digest := splitDigest(from.Image); digest == "" {
+			reason = "not pinned to a digest"
+		} else if from.Ref != "" {
+			reason = "comes from an ARG (" + from.Ref + ")"
+		}
+		if reason == "" {
+			continue
+		}
+		if print {
+			fmt.Println(ColorRed + "✘ " + from.Image + ": " + reason + ColorReset)
+		}
+		unpinned = append(unpinned, from.Image)
+	}
+	if len(unpinned) > 0 {
+		return withCode(ErrCodePolicyViolation, errorf(KeyPolicyBaseUnpinned, unpinned))
+	}
+	return nil
+}
+
+// verifyBaseImage resolves image to its current digest and returns that
+// reference with the first signer whose signature verifies on it. Verifying
+// the digest rather than the tag is what lets the build be pinned to the
+// image that was verified.
+func (ecr *ECR) verifyBaseImage(image string, signers []CosignVerifyConfig) (string, CosignVerifyConfig, error) {
+	name, digest := splitDigest(image)
+	if digest == "" {
+		var err error
+		if digest, err = ecr.resolveDigest(name); err != nil {
+			return "", CosignVerifyConfig{}, err
+		}
+	}
+	ref := name + "@" + digest
+	var lastErr error
+	for _, signer := range signers {
+		args := append([]string{"verify"}, signer.args()...)
+		if lastErr = ecr.runCheck("cosign", append(args, ref)...); lastErr == nil {
+			return ref, signer, nil
+		}
+	}
+	return "", CosignVerifyConfig{}, lastErr
+}
+
+// pinBases writes a copy of the Dockerfile with the FROM lines in pinned set
+// to their verified references, for the build to use instead of the original.
+func (ecr *ECR) pinBases(d *dockerfile, pinned map[int]string) error {
+	if len(pinned) == 0 {
+		return nil
+	}
+	for line, ref := range pinned {
+		d.setBase(line, ref)
+	}
+	path, err := d.writeTemp()
+	if err != nil {
+		return errorf(KeyPolicyPinFailed, err)
+	}
+	ecr.pinnedDockerfile = path
+	return nil
+}
+
+// removePinnedDockerfile deletes the Dockerfile written by pinBases, if any.
+func (ecr *ECR) removePinnedDockerfile() {
+	if ecr.pinnedDockerfile != "" {
+		os.Remove(ecr.pinnedDockerfile)
+		ecr.pinnedDockerfile = ""
+	}
+}
+
+// matchesAny reports whether value matches one of the glob patterns.
+func matchesAny(value string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
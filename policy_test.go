@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBaseImagePolicyFailsClosedOnUnresolvedFrom(t *testing.T) {
+	for _, policy := range []BaseImagePolicy{
+		{RequirePinned: true},
+		{RequireSignature: true, Signers: []CosignVerifyConfig{{Key: "cosign.pub"}}},
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(dir+"/Dockerfile", []byte("ARG BASE\nFROM ${BASE}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ecr := &ECR{Config: &ProfileConfig{}}
+		ecr.Config.Docker.Context = dir
+		ecr.Config.Policy.BaseImages = policy
+
+		if err := ecr.checkBaseImagePolicy(); errorCode(err) != ErrCodePolicyViolation {
+			t.Errorf("checkBaseImagePolicy() with %+v = %v, want %s", policy, err, ErrCodePolicyViolation)
+		}
+	}
+}
+
+func TestCheckPinnedBases(t *testing.T) {
+	const digest = "@sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"
+	for _, test := range []struct {
+		name       string
+		dockerfile string
+		args       map[string]string
+		exempt     []string
+		pinned     bool
+	}{
+		{"pinned", "FROM alpine:3.19" + digest, nil, nil, true},
+		{"tag", "FROM alpine:3.19", nil, nil, false},
+		{"ARG default latest", "ARG BASE=alpine:latest\nFROM $BASE", nil, nil, false},
+		{"ARG default pinned", "ARG BASE=alpine:3.19" + digest + "\nFROM ${BASE}", nil, nil, false},
+		{"ARG from a build arg", "ARG BASE\nFROM ${BASE}", map[string]string{"base": "alpine" + digest}, nil, false},
+		{"exempt", "FROM registry.internal/base:latest", nil, []string{"registry.internal/*"}, true},
+		{"later stage", "FROM golang:1.23" + digest + " AS build\nFROM build", nil, nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := &dockerfile{Lines: strings.Split(test.dockerfile, "\n")}
+			bases, _ := d.resolvedBases(test.args)
+			err := checkPinnedBases(bases, test.exempt, false)
+			if test.pinned && err != nil {
+				t.Errorf("checkPinnedBases() = %v, want no violation", err)
+			}
+			if !test.pinned && errorCode(err) != ErrCodePolicyViolation {
+				t.Errorf("checkPinnedBases() = %v, want %s", err, ErrCodePolicyViolation)
+			}
+		})
+	}
+}
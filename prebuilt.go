@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// BuildConfig holds how the image is produced.
+type BuildConfig struct {
+	Prebuilt PrebuiltConfig `mapstructure:"prebuilt"`
+}
+
+// PrebuiltConfig packages artifacts compiled elsewhere (e.g. by an earlier CI
+// step) instead of compiling inside Docker. The artifacts directory is the
+// build context and the Dockerfile is generated from Template.
+type PrebuiltConfig struct {
+	Artifacts  string   `mapstructure:"artifacts"`
+	Base       string   `mapstructure:"base"`    // default gcr.io/distroless/static-debian12
+	Workdir    string   `mapstructure:"workdir"` // default /app
+	User       string   `mapstructure:"user"`    // default nonroot
+	Entrypoint []string `mapstructure:"entrypoint"`
+	Template   string   `mapstructure:"template"` // custom Dockerfile template file
+}
+
+// prebuiltDockerfilePath is where the generated Dockerfile is written, one
+// per profile so runs of different profiles do not overwrite each other's.
+func (ecr *ECR) prebuiltDockerfilePath() string {
+	return statePath("build", ecr.Profile, "Dockerfile.prebuilt")
+}
+
+const defaultPrebuiltTemplate = `FROM {{.Base}}
+WORKDIR {{.Workdir}}
+COPY . {{.Workdir}}/
+{{- if .User}}
+USER {{.User}}
+{{- end}}
+{{- if .Entrypoint}}
+ENTRYPOINT {{.Entrypoint}}
+{{- end}}
+`
+
+func (p PrebuiltConfig) enabled() bool {
+	return p.Artifacts != ""
+}
+
+// writePrebuiltDockerfile renders the Dockerfile for the artifacts.
+func (ecr *ECR) writePrebuiltDockerfile() error {
+	p := ecr.Config.Build.Prebuilt
+	if info, err := os.Stat(p.Artifacts); err != nil || !info.IsDir() {
+		return withCode(ErrCodeConfigInvalid, fmt.Errorf("build.prebuilt.artifacts %s is not a directory", p.Artifacts))
+	}
+
+	text := defaultPrebuiltTemplate
+	if p.Template != "" {
+		data, err := os.ReadFile(p.Template)
+		if err != nil {
+			return withCode(ErrCodeConfigInvalid, errorf(KeyPrebuiltTemplateReadFailed, err))
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("build.prebuilt.template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return withCode(ErrCodeConfigInvalid, errorf(KeyPrebuiltTemplateInvalid, err))
+	}
+
+	entrypoint := ""
+	if len(p.Entrypoint) > 0 {
+		data, _ := json.Marshal(p.Entrypoint)
+		entrypoint = string(data)
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, map[string]string{
+		"Base":       orDefault(p.Base, "gcr.io/distroless/static-debian12"),
+		"Workdir":    orDefault(p.Workdir, "/app"),
+		"User":       orDefault(p.User, "nonroot"),
+		"Entrypoint": entrypoint,
+		"Artifacts":  p.Artifacts,
+	})
+	if err != nil {
+		return withCode(ErrCodeConfigInvalid, fmt.Errorf("build.prebuilt.template: %w", err))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ecr.prebuiltDockerfilePath()), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(ecr.prebuiltDockerfilePath(), out.Bytes(), 0o644)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ecrapi "github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+// checkExistingTags runs before any stage of a run that pushes, so a long
+// build is not wasted on a push that cannot or need not happen:
+//
+//   - with -skip-if-exists, a run whose image_tag is already in ECR is
+//     skipped, setting ecr.upToDate; meant for tags unique to a commit;
+//   - otherwise, when the repository has immutable tags and one of the tags
+//     to push exists, the run fails with PUSHECR_TAG_IMMUTABLE.
+//
+// -force skips the check. Runs that push by digest have no tag to check.
+func (ecr *ECR) checkExistingTags(stages []stage) error {
+	c := ecr.Config.ECR
+	if ecr.force || c.PushByDigest || !contains(stageNamesOf(stages), "push") {
+		return nil
+	}
+	if ecr.skipIfExists {
+		digest, err := ecr.imageDigest(c.ImageTag)
+		if err != nil {
+			return errorf(KeyTagLookupFailed, c.ImageTag, err)
+		}
+		if digest != "" {
+			ecr.upToDate = true
+			ecr.stage(ColorGreen, fmt.Sprintf("Tag %s already exists in ECR (%s), skipping the run", c.ImageTag, shortDigest(digest)))
+		}
+		return nil
+	}
+
+	immutable, err := ecr.repositoryImmutable()
+	if err != nil || !immutable {
+		// Without ecr:DescribeRepositories, or before the repository is
+		// created, the push itself reports the conflict.
+		return nil
+	}
+	for _, tag := range append([]string{c.ImageTag}, ecr.extraTags()...) {
+		digest, err := ecr.imageDigest(tag)
+		if err != nil {
+			return errorf(KeyTagLookupFailed, tag, err)
+		}
+		if digest != "" {
+			return withCode(ErrCodeTagImmutable, fmt.Errorf("%s already exists (%s) and %s has immutable tags; use a new tag, or -skip-if-exists to skip the run",
+				ecr.imageURI(tag), shortDigest(digest), c.Repository))
+		}
+	}
+	return nil
+}
+
+// repositoryImmutable reports whether the repository's tags are immutable.
+// Public repositories have no such setting.
+func (ecr *ECR) repositoryImmutable() (bool, error) {
+	if ecr.Config.ECR.Public {
+		return false, ecr.describePublicRepository(ecr.Config.ECR.Repository)
+	}
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return false, err
+	}
+	var out *ecrapi.DescribeRepositoriesOutput
+	if err := ecr.callAWS("ecr describe-repositories", func(ctx context.Context) (err error) {
+		out, err = client.DescribeRepositories(ctx, &ecrapi.DescribeRepositoriesInput{RepositoryNames: []string{ecr.Config.ECR.Repository}})
+		return err
+	}); err != nil {
+		return false, err
+	}
+	return len(out.Repositories) > 0 && strings.HasPrefix(string(out.Repositories[0].ImageTagMutability), "IMMUTABLE"), nil
+}
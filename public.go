@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	publictypes "github.com/aws/aws-sdk-go-v2/service/ecrpublic/types"
+)
+
+// ECR Public has a single registry host and its API only in us-east-1; a
+// repository is published as public.ecr.aws/<alias>/<repository>.
+const (
+	publicRegistry = "public.ecr.aws"
+	publicRegion   = "us-east-1"
+)
+
+// CatalogDataConfig is the gallery entry of a public repository, set with
+// put-repository-catalog-data after every push when any field is set.
+type CatalogDataConfig struct {
+	Description      string   `mapstructure:"description"`
+	About            string   `mapstructure:"about"` // markdown
+	Usage            string   `mapstructure:"usage"` // markdown
+	Architectures    []string `mapstructure:"architectures"`
+	OperatingSystems []string `mapstructure:"operating_systems"`
+}
+
+func (c CatalogDataConfig) enabled() bool {
+	return c.Description != "" || c.About != "" || c.Usage != "" || len(c.Architectures) > 0 || len(c.OperatingSystems) > 0
+}
+
+// input returns the catalog data as the input of PutRepositoryCatalogData.
+func (c CatalogDataConfig) input() *publictypes.RepositoryCatalogDataInput {
+	input := &publictypes.RepositoryCatalogDataInput{Architectures: c.Architectures, OperatingSystems: c.OperatingSystems}
+	if c.Description != "" {
+		input.Description = aws.String(c.Description)
+	}
+	if c.About != "" {
+		input.AboutText = aws.String(c.About)
+	}
+	if c.Usage != "" {
+		input.UsageText = aws.String(c.Usage)
+	}
+	return input
+}
+
+// describePublicRepository fails with RepositoryNotFoundException if the
+// public repository does not exist.
+func (ecr *ECR) describePublicRepository(repository string) error {
+	client, err := ecr.ecrPublicClient()
+	if err != nil {
+		return err
+	}
+	return ecr.callAWS("ecr-public describe-repositories", func(ctx context.Context) error {
+		_, err := client.DescribeRepositories(ctx, &ecrpublic.DescribeRepositoriesInput{RepositoryNames: []string{repository}})
+		return err
+	})
+}
+
+// createPublicRepository creates a public repository. They have no
+// mutability, scanning or encryption settings; their catalog data is set
+// after the push.
+func (ecr *ECR) createPublicRepository(repository string) error {
+	client, err := ecr.ecrPublicClient()
+	if err != nil {
+		return err
+	}
+	return ecr.callAWS("ecr-public create-repository", func(ctx context.Context) error {
+		_, err := client.CreateRepository(ctx, &ecrpublic.CreateRepositoryInput{RepositoryName: aws.String(repository)})
+		return err
+	})
+}
+
+// validatePublic checks ecr.public against the settings ECR Public has no
+// API for.
+func (c ECRConfig) validatePublic() error {
+	if !c.Public {
+		if c.PublicAlias != "" || c.CatalogData.enabled() {
+			return fmt.Errorf("ecr.public_alias and ecr.catalog_data need ecr.public: true")
+		}
+		return nil
+	}
+	if c.PublicAlias == "" {
+		return fmt.Errorf("ecr.public needs ecr.public_alias, the registry alias shown in the ECR Public console")
+	}
+	unsupported := []struct {
+		name string
+		set  bool
+	}{
+		{"ecr.metadata_only_push", c.MetadataOnlyPush},
+		{"ecr.mount_from", len(c.MountFrom) > 0},
+		{"ecr.lifecycle_policy", c.LifecyclePolicy != ""},
+		{"ecr.tag_guard.source_check", c.TagGuard.SourceCheck != ""},
+		{"ecr.create (tag_immutability, scan_on_push, encryption)", c.Create != (CreateRepositoryConfig{})},
+	}
+	for _, setting := range unsupported {
+		if setting.set {
+			return fmt.Errorf("%s is not supported by ECR Public (ecr.public)", setting.name)
+		}
+	}
+	return nil
+}
+
+// publicToken calls GetAuthorizationToken of ECR Public through the SDK, in
+// us-east-1, the only region of its API.
+func (ecr *ECR) publicToken() (cachedToken, error) {
+	ctx := ecr.context()
+	cfg, err := ecr.awsConfig(ctx, publicRegion)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	if err := awsLimiter.wait(ctx); err != nil {
+		return cachedToken{}, err
+	}
+	out, err := ecrpublic.NewFromConfig(cfg).GetAuthorizationToken(ctx, &ecrpublic.GetAuthorizationTokenInput{})
+	if err != nil {
+		return cachedToken{}, classify(ErrCodeAuthFailed, err.Error(), errorf(KeyPublicTokenFailed, err))
+	}
+	awsLimiter.succeeded()
+	data := out.AuthorizationData
+	if data == nil || data.AuthorizationToken == nil {
+		return cachedToken{}, errorf(KeyTokenBadResponse)
+	}
+	token := cachedToken{token: *data.AuthorizationToken, expires: time.Now().Add(12 * time.Hour)}
+	if data.ExpiresAt != nil {
+		token.expires = *data.ExpiresAt
+	}
+	return token, nil
+}
+
+// putCatalogData sets the gallery entry of a public repository.
+func (ecr *ECR) putCatalogData() error {
+	c := ecr.Config.ECR
+	if !c.Public || !c.CatalogData.enabled() {
+		return nil
+	}
+	client, err := ecr.ecrPublicClient()
+	if err != nil {
+		return err
+	}
+	if err := ecr.callAWS("ecr-public put-repository-catalog-data", func(ctx context.Context) error {
+		_, err := client.PutRepositoryCatalogData(ctx, &ecrpublic.PutRepositoryCatalogDataInput{
+			RepositoryName: aws.String(c.Repository),
+			CatalogData:    c.CatalogData.input(),
+		})
+		return err
+	}); err != nil {
+		return errorf(KeyCatalogUpdateFailed, c.Repository, err)
+	}
+	fmt.Println("Updated the catalog data of " + ecr.repositoryURI())
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func runPull(args []string) {
+	fs, configPath, profile := commandFlags("pull", "pull [-config deploy.yml] [-profile dev] [-platform linux/amd64] [tag|digest]")
+	platform := fs.String("platform", "", "Platform to pull from a multi-arch image (default: the local platform)")
+	fs.Parse(args)
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	ref := profileConfig.ECR.ImageTag
+	if fs.NArg() > 0 {
+		ref = fs.Arg(0)
+	}
+
+	exitOnError("Authentication failed", ecr.authenticate())
+	image, err := ecr.pull(ref, *platform)
+	exitOnError("Pull failed", err)
+	fmt.Println(ColorGreen + "Pulled " + image + ColorReset)
+}
+
+// pull pulls a tag or sha256 digest of the profile's repository and returns
+// the pulled image reference.
+func (ecr *ECR) pull(ref, platform string) (string, error) {
+	image := ecr.imageURI(ref)
+	if strings.HasPrefix(ref, "sha256:") {
+		image = ecr.repositoryURI() + "@" + ref
+	}
+	ecr.stage(ColorCyan, "Pulling "+image)
+	if err := ecr.pullImage(image, platform); err != nil {
+		return "", err
+	}
+	if d := ecr.deprecation(image); d != nil {
+		d.warn(image)
+	}
+	return image, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// AWSAPIConfig limits how fast pushecr calls AWS APIs, so runs that touch
+// many accounts, regions or repositories do not trip API throttling.
+type AWSAPIConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	MaxRetries        int     `mapstructure:"max_retries"`
+}
+
+const (
+	defaultRequestsPerSecond = 10
+	defaultMaxRetries        = 5
+	minRequestsPerSecond     = 0.5
+)
+
+// awsLimiter paces every aws CLI call made through runAWS. Its rate adapts:
+// it halves when AWS throttles a call and recovers slowly on success.
+var awsLimiter = &rateLimiter{limit: defaultRequestsPerSecond, rate: defaultRequestsPerSecond}
+
+var awsMaxRetries = defaultMaxRetries
+
+// configureAWSAPI applies the aws_api settings of the configuration.
+func configureAWSAPI(c AWSAPIConfig) {
+	if c.RequestsPerSecond > 0 {
+		awsLimiter.mu.Lock()
+		awsLimiter.limit = c.RequestsPerSecond
+		awsLimiter.rate = c.RequestsPerSecond
+		awsLimiter.mu.Unlock()
+	}
+	if c.MaxRetries > 0 {
+		awsMaxRetries = c.MaxRetries
+	}
+}
+
+type rateLimiter struct {
+	mu    sync.Mutex
+	limit float64
+	rate  float64
+	next  time.Time
+}
+
+// wait blocks until the next call is allowed, or returns ctx's error if it
+// is done first. Slots are spread with ±20% jitter so concurrent runs do not
+// fire in lockstep.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	interval := float64(time.Second) / l.rate
+	l.next = l.next.Add(time.Duration(interval * (0.8 + 0.4*rand.Float64())))
+	l.mu.Unlock()
+	return sleepContext(ctx, delay)
+}
+
+func (l *rateLimiter) throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = max(l.rate/2, minRequestsPerSecond)
+}
+
+func (l *rateLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = min(l.rate+l.limit/20, l.limit)
+}
+
+// backoff returns the wait before retry attempt n (starting at 1): full
+// jitter over an exponential ceiling of 500ms, 1s, 2s... capped at 20s.
+func backoff(attempt int) time.Duration {
+	ceiling := min(500*time.Millisecond<<min(attempt-1, 6), 20*time.Second)
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitStopsWithContext(t *testing.T) {
+	l := &rateLimiter{limit: minRequestsPerSecond, rate: minRequestsPerSecond}
+	l.wait(context.Background()) // the first call is free and books the next slot 2s later
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("wait() returned after %s, past its context", elapsed)
+	}
+}
+
+func TestRegistryRequestsStopWithContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	previous := registryOverride
+	registryOverride = strings.TrimPrefix(srv.URL, "http://")
+	defer func() { registryOverride = previous }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ecr := &ECR{Config: &ProfileConfig{}, ctx: ctx}
+	ecr.Config.ECR.Repository = testRepository
+	started := time.Now()
+	if _, err := ecr.mountBlob("token", "sha256:0", "base"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("mountBlob() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("mountBlob() returned after %s, past its context", elapsed)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readOnly is set with -read-only (or PUSHECR_READ_ONLY=1) on any command.
+// In read-only mode pushecr refuses every call that could change a registry
+// or other AWS resource, so inspection commands can run with read-only
+// credentials and in audit contexts.
+var readOnly = os.Getenv("PUSHECR_READ_ONLY") == "1" || os.Getenv("PUSHECR_READ_ONLY") == "true"
+
+const readOnlyUsage = "Refuse any operation that modifies a registry or AWS resource"
+
+// readOnlyAWSOperations are the aws CLI operations allowed in read-only mode,
+// by prefix. assume-role only issues credentials.
+var readOnlyAWSOperations = []string{"describe-", "list-", "get-", "batch-get-", "batch-check-", "scan", "query", "assume-role"}
+
+// checkWritable returns an error in read-only mode naming the operation that
+// was refused.
+func checkWritable(operation string) error {
+	if !readOnly {
+		return nil
+	}
+	return withCode(ErrCodeReadOnly, fmt.Errorf("%s refused: pushecr is running in read-only mode", operation))
+}
+
+// checkAWSWritable refuses aws CLI operations that are not known to be reads.
+func checkAWSWritable(args []string) error {
+	if !readOnly || len(args) < 2 {
+		return nil
+	}
+	for _, prefix := range readOnlyAWSOperations {
+		if strings.HasPrefix(args[1], prefix) {
+			return nil
+		}
+	}
+	return checkWritable("aws " + args[0] + " " + args[1])
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// regionPattern matches AWS region names such as eu-west-1 or us-gov-west-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// validateRegions checks ecr.regions. The other regions get a copy of the
+// pushed tags, so there must be tags and a private registry per region.
+func (c ECRConfig) validateRegions() error {
+	if len(c.Regions) == 0 {
+		return nil
+	}
+	for _, region := range c.Regions {
+		if !regionPattern.MatchString(region) {
+			return fmt.Errorf("ecr.regions entry '%s' is not an AWS region (e.g. eu-west-1)", region)
+		}
+	}
+	if c.Public {
+		return fmt.Errorf("ecr.regions cannot be used with ecr.public, which is a single global registry")
+	}
+	if c.PushByDigest {
+		return fmt.Errorf("ecr.regions copies the pushed tags and cannot be used with ecr.push_by_digest")
+	}
+	return nil
+}
+
+// replicaRegions returns the regions of ecr.regions other than ecr.region,
+// without repeats.
+func (c ECRConfig) replicaRegions() []string {
+	var regions []string
+	for _, region := range c.Regions {
+		if region != c.Region && !contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// replicas returns a run of the profile for each of its replica regions, with
+// the same settings in that region.
+func (ecr *ECR) replicas() []*ECR {
+	var replicas []*ECR
+	for _, region := range ecr.Config.ECR.replicaRegions() {
+		config := *ecr.Config
+		config.ECR.Region = region
+		config.ECR.Regions = nil
+		replicas = append(replicas, &ECR{Profile: ecr.Profile, Config: &config, runID: ecr.runID})
+	}
+	return replicas
+}
+
+// login authenticates Docker with the profile's registry and, with
+// ecr.regions, with the registry of every replica region, fetching their
+// tokens concurrently.
+func (ecr *ECR) login() error {
+	replicas := ecr.replicas()
+	if len(replicas) == 0 {
+		return ecr.authenticate()
+	}
+	all := append([]*ECR{ecr}, replicas...)
+	if err := prefetchRegistryTokens(all...); err != nil {
+		return errorf(KeyAuthFailed, err)
+	}
+	for _, run := range all {
+		if err := run.authenticate(); err != nil {
+			return fmt.Errorf("%s: %w", run.Config.ECR.Region, err)
+		}
+	}
+	return nil
+}
+
+// pushRegions copies the pushed image, with its image_tag, image_tags and
+// alias tags, to the repository of every replica region at the same time,
+// registry to registry, creating the repository first with create_if_missing.
+// A failing region does not stop the others; the result of each one is
+// reported and the push fails if any of them did.
+func (ecr *ECR) pushRegions(aliases map[string]string) error {
+	replicas := ecr.replicas()
+	if len(replicas) == 0 {
+		return nil
+	}
+	digest := ecr.Digest
+	if digest == "" {
+		var err error
+		if digest, err = ecr.imageDigest(ecr.Config.ECR.ImageTag); err != nil {
+			return err
+		}
+	}
+	tags := append([]string{ecr.Config.ECR.ImageTag}, ecr.extraTags()...)
+	for _, alias := range sortedKeys(aliases) {
+		if !contains(tags, aliases[alias]) {
+			tags = append(tags, aliases[alias])
+		}
+	}
+
+	ecr.stage(ColorCyan, "Copying the image to "+strings.Join(ecr.Config.ECR.replicaRegions(), ", "))
+	errs := make([]error, len(replicas))
+	var wg sync.WaitGroup
+	for i, replica := range replicas {
+		wg.Add(1)
+		go func(i int, replica *ECR) {
+			defer wg.Done()
+			errs[i] = replica.copyTags(ecr, digest, tags)
+		}(i, replica)
+	}
+	wg.Wait()
+
+	var failed []string
+	var first error
+	for i, replica := range replicas {
+		ecr.logs.Write(replica.logs.Bytes())
+		region := replica.Config.ECR.Region
+		if errs[i] != nil {
+			fmt.Println(ColorRed + "✘ " + region + ": " + errs[i].Error() + ColorReset)
+			failed = append(failed, region)
+			if first == nil {
+				first = errs[i]
+			}
+			continue
+		}
+		fmt.Println(ColorGreen + "✔ " + region + ": " + replica.repositoryURI() + "@" + digest + ColorReset)
+	}
+	if first != nil {
+		return withCode(errorCode(first), fmt.Errorf("%d of %d regions could not be pushed (%s): %w", len(failed), len(replicas), strings.Join(failed, ", "), first))
+	}
+	return nil
+}
+
+// copyTags copies digest from src's repository to the first of tags in ecr's
+// and points the rest at it.
+func (ecr *ECR) copyTags(src *ECR, digest string, tags []string) error {
+	if err := ecr.ensureRepository(); err != nil {
+		return err
+	}
+	if err := ecr.copyImage(src, digest, tags[0]); err != nil {
+		return err
+	}
+	for _, tag := range tags[1:] {
+		if err := ecr.putImageTag(digest, tag); err != nil {
+			return errorf(KeyRegionTagFailed, tag, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecrapi "github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	publictypes "github.com/aws/aws-sdk-go-v2/service/ecrpublic/types"
+)
+
+// manifestMediaTypes are the manifest formats requested from ECR so that
+// single-arch images and manifest lists are both returned verbatim.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// imageDigest returns the digest tag currently points to in the profile's
+// repository, or "" if the tag does not exist.
+func (ecr *ECR) imageDigest(tag string) (string, error) {
+	images, err := ecr.describeImages(tag)
+	if isAWSError(err, "ImageNotFoundException") {
+		return "", nil
+	}
+	if err != nil || len(images) == 0 {
+		return "", err
+	}
+	return images[0].Digest, nil
+}
+
+// imageDetail describes an image of the repository as listed by ECR.
+type imageDetail struct {
+	Digest   string    `json:"imageDigest"`
+	Tags     []string  `json:"imageTags"`
+	Size     int64     `json:"imageSizeInBytes"`
+	PushedAt time.Time `json:"imagePushedAt"`
+}
+
+// listImages returns the images of the profile's repository, most recently
+// pushed first.
+func (ecr *ECR) listImages() ([]imageDetail, error) {
+	images, err := ecr.describeImages()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].PushedAt.After(images[j].PushedAt)
+	})
+	return images, nil
+}
+
+// describeImages returns the images of the profile's repository with the
+// given tags or digests, or every image when refs is empty, from ECR or ECR
+// Public.
+func (ecr *ECR) describeImages(refs ...string) ([]imageDetail, error) {
+	repository := aws.String(ecr.Config.ECR.Repository)
+	var images []imageDetail
+	if ecr.Config.ECR.Public {
+		client, err := ecr.ecrPublicClient()
+		if err != nil {
+			return nil, err
+		}
+		input := &ecrpublic.DescribeImagesInput{RepositoryName: repository}
+		for _, ref := range refs {
+			id := imageID(ref)
+			input.ImageIds = append(input.ImageIds, publictypes.ImageIdentifier{ImageDigest: id.ImageDigest, ImageTag: id.ImageTag})
+		}
+		pages := ecrpublic.NewDescribeImagesPaginator(client, input)
+		for pages.HasMorePages() {
+			var page *ecrpublic.DescribeImagesOutput
+			if err := ecr.callAWS("ecr-public describe-images", func(ctx context.Context) (err error) {
+				page, err = pages.NextPage(ctx)
+				return err
+			}); err != nil {
+				return nil, err
+			}
+			for _, d := range page.ImageDetails {
+				images = append(images, imageDetail{Digest: aws.ToString(d.ImageDigest), Tags: d.ImageTags, Size: aws.ToInt64(d.ImageSizeInBytes), PushedAt: aws.ToTime(d.ImagePushedAt)})
+			}
+		}
+		return images, nil
+	}
+
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return nil, err
+	}
+	input := &ecrapi.DescribeImagesInput{RepositoryName: repository}
+	for _, ref := range refs {
+		input.ImageIds = append(input.ImageIds, imageID(ref))
+	}
+	pages := ecrapi.NewDescribeImagesPaginator(client, input)
+	for pages.HasMorePages() {
+		var page *ecrapi.DescribeImagesOutput
+		if err := ecr.callAWS("ecr describe-images", func(ctx context.Context) (err error) {
+			page, err = pages.NextPage(ctx)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		for _, d := range page.ImageDetails {
+			images = append(images, imageDetail{Digest: aws.ToString(d.ImageDigest), Tags: d.ImageTags, Size: aws.ToInt64(d.ImageSizeInBytes), PushedAt: aws.ToTime(d.ImagePushedAt)})
+		}
+	}
+	return images, nil
+}
+
+// remoteImage is a manifest as stored in ECR.
+type remoteImage struct {
+	Digest    string
+	MediaType string
+	Manifest  string
+}
+
+// imageID converts a tag or sha256 digest into an ECR image identifier.
+func imageID(ref string) ecrtypes.ImageIdentifier {
+	if strings.HasPrefix(ref, "sha256:") {
+		return ecrtypes.ImageIdentifier{ImageDigest: aws.String(ref)}
+	}
+	return ecrtypes.ImageIdentifier{ImageTag: aws.String(ref)}
+}
+
+// batchGetImage fetches the raw manifest of a tag or digest.
+func (ecr *ECR) batchGetImage(ref string) (*remoteImage, error) {
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return nil, err
+	}
+	var out *ecrapi.BatchGetImageOutput
+	if err := ecr.callAWS("ecr batch-get-image", func(ctx context.Context) (err error) {
+		out, err = client.BatchGetImage(ctx, &ecrapi.BatchGetImageInput{
+			RepositoryName:     aws.String(ecr.Config.ECR.Repository),
+			ImageIds:           []ecrtypes.ImageIdentifier{imageID(ref)},
+			AcceptedMediaTypes: manifestMediaTypes,
+		})
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if len(out.Images) == 0 {
+		return nil, withCode(ErrCodeImageNotFound, errorf(KeyImageNotFound, ref, ecr.Config.ECR.Repository))
+	}
+	image := out.Images[0]
+	return &remoteImage{
+		Digest:    aws.ToString(image.ImageId.ImageDigest),
+		MediaType: aws.ToString(image.ImageManifestMediaType),
+		Manifest:  aws.ToString(image.ImageManifest),
+	}, nil
+}
+
+// putImage puts manifest in the profile's repository under tag and returns
+// the digest of the image.
+func (ecr *ECR) putImage(tag, manifest, mediaType string) (string, error) {
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return "", err
+	}
+	var out *ecrapi.PutImageOutput
+	if err := ecr.callAWS("ecr put-image", func(ctx context.Context) (err error) {
+		out, err = client.PutImage(ctx, &ecrapi.PutImageInput{
+			RepositoryName:         aws.String(ecr.Config.ECR.Repository),
+			ImageTag:               aws.String(tag),
+			ImageManifest:          aws.String(manifest),
+			ImageManifestMediaType: aws.String(mediaType),
+		})
+		return err
+	}); err != nil {
+		return "", err
+	}
+	if out.Image == nil || out.Image.ImageId == nil {
+		return "", nil
+	}
+	return aws.ToString(out.Image.ImageId.ImageDigest), nil
+}
+
+// putImageTag points tag at an image already in the repository by re-putting
+// its manifest, so no layers are pulled or pushed.
+func (ecr *ECR) putImageTag(digest, tag string) error {
+	if ecr.Config.ECR.Public {
+		// ECR Public has no batch-get-image to read the manifest from.
+		return ecr.copyImage(ecr, digest, tag)
+	}
+	image, err := ecr.batchGetImage(digest)
+	if err != nil {
+		return err
+	}
+	_, err = ecr.putImage(tag, image.Manifest, image.MediaType)
+	if isAWSError(err, "ImageAlreadyExistsException") {
+		return nil
+	}
+	return err
+}
+
+// batchDeleteImage removes tag from the profile's repository, deleting the
+// image if it was its only tag.
+func (ecr *ECR) batchDeleteImage(tag string) error {
+	repository := aws.String(ecr.Config.ECR.Repository)
+	if ecr.Config.ECR.Public {
+		client, err := ecr.ecrPublicClient()
+		if err != nil {
+			return err
+		}
+		return ecr.callAWS("ecr-public batch-delete-image", func(ctx context.Context) error {
+			_, err := client.BatchDeleteImage(ctx, &ecrpublic.BatchDeleteImageInput{RepositoryName: repository, ImageIds: []publictypes.ImageIdentifier{{ImageTag: aws.String(tag)}}})
+			return err
+		})
+	}
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return err
+	}
+	return ecr.callAWS("ecr batch-delete-image", func(ctx context.Context) error {
+		_, err := client.BatchDeleteImage(ctx, &ecrapi.BatchDeleteImageInput{RepositoryName: repository, ImageIds: []ecrtypes.ImageIdentifier{imageID(tag)}})
+		return err
+	})
+}
+
+// descriptor references a blob or a child manifest.
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+// manifest covers both image manifests and manifest lists / OCI indexes.
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+func (m *manifest) isIndex() bool {
+	return len(m.Manifests) > 0
+}
+
+// imageConfig is the subset of the image config blob pushecr reads.
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// resolveManifest returns the image manifest for ref, descending into a
+// manifest list for the requested platform (e.g. "linux/amd64").
+func (ecr *ECR) resolveManifest(ref, platform string) (*manifest, string, error) {
+	image, err := ecr.batchGetImage(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	var m manifest
+	if err := json.Unmarshal([]byte(image.Manifest), &m); err != nil {
+		return nil, "", errorf(KeyManifestInvalid, ref, err)
+	}
+	if !m.isIndex() {
+		return &m, image.Digest, nil
+	}
+
+	for _, child := range m.Manifests {
+		if child.Platform == nil {
+			continue
+		}
+		name := child.Platform.OS + "/" + child.Platform.Architecture
+		if platform == name || platform == name+"/"+child.Platform.Variant {
+			return ecr.resolveManifest(child.Digest, platform)
+		}
+	}
+	return nil, "", errorf(KeyImagePlatformMissing, ref, platform)
+}
+
+// blob downloads a blob (layer or config) from the repository through the
+// pre-signed URL ECR hands out.
+func (ecr *ECR) blob(digest string) ([]byte, error) {
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return nil, err
+	}
+	var out *ecrapi.GetDownloadUrlForLayerOutput
+	if err := ecr.callAWS("ecr get-download-url-for-layer", func(ctx context.Context) (err error) {
+		out, err = client.GetDownloadUrlForLayer(ctx, &ecrapi.GetDownloadUrlForLayerInput{
+			RepositoryName: aws.String(ecr.Config.ECR.Repository),
+			LayerDigest:    aws.String(digest),
+		})
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ecr.context(), http.MethodGet, aws.ToString(out.DownloadUrl), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errorf(KeyBlobDownloadFailed, digest, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorf(KeyBlobDownloadFailed, digest, errors.New(resp.Status))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// fetchConfig downloads and decodes the image config referenced by m.
+func (ecr *ECR) fetchConfig(m *manifest) (*imageConfig, error) {
+	data, err := ecr.blob(m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var config imageConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, errorf(KeyImageConfigInvalid, m.Config.Digest, err)
+	}
+	return &config, nil
+}
+
+// formatBytes renders a byte count using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	suffixes := "KMGTPE"
+	i := -1
+	for (value >= unit || value <= -unit) && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, suffixes[i])
+}
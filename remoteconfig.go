@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A configuration given to -config as a URL is fetched into
+// .pushecr/config-cache and read from there. Supported locations:
+//
+//	s3://bucket/path/deploy.yml
+//	https://config.example.com/deploy.yml
+//	git::https://github.com/org/deploy-configs.git//path/deploy.yml?ref=main
+//
+// Later runs only download it again when it changed (ETag and
+// Last-Modified for S3 and HTTPS, a shallow fetch for git), and the cached
+// copy is used, with a warning, when the location cannot be reached.
+
+// remoteConfigMeta is stored next to a cached configuration.
+type remoteConfigMeta struct {
+	Location     string    `json:"location"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+var remoteConfigClient = &http.Client{Timeout: 30 * time.Second}
+
+func isRemoteConfig(location string) bool {
+	for _, prefix := range []string{"s3://", "https://", "http://", "git::"} {
+		if strings.HasPrefix(location, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchConfig fetches the configuration at location and returns the path of
+// its cached copy.
+func fetchConfig(location string) (string, error) {
+	sum := sha256.Sum256([]byte(location))
+	dir := statePath("config-cache", hex.EncodeToString(sum[:8]))
+
+	var path string
+	err := withStateLock("config-cache", func() error {
+		var err error
+		if strings.HasPrefix(location, "git::") {
+			path, err = fetchGitConfig(location, dir)
+		} else {
+			path, err = fetchFileConfig(location, dir)
+		}
+		return err
+	})
+	return path, err
+}
+
+// fetchFileConfig fetches an S3 or HTTP(S) configuration into dir.
+func fetchFileConfig(location, dir string) (string, error) {
+	path := filepath.Join(dir, "deploy.yml")
+	metaPath := filepath.Join(dir, "meta.json")
+	var meta remoteConfigMeta
+	if data, err := os.ReadFile(metaPath); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	if _, err := os.Stat(path); err != nil {
+		meta = remoteConfigMeta{}
+	}
+
+	var data []byte
+	var changed bool
+	var err error
+	if strings.HasPrefix(location, "s3://") {
+		data, changed, err = fetchS3Config(location, &meta)
+	} else {
+		data, changed, err = fetchHTTPConfig(location, &meta)
+	}
+	if err != nil {
+		if meta.FetchedAt.IsZero() || errorCode(err) == ErrCodeConfigNotFound {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, ColorYellow+"Using the configuration cached at %s: %v"+ColorReset+"\n", meta.FetchedAt.Local().Format(time.RFC3339), err)
+		return path, nil
+	}
+	if !changed {
+		return path, nil
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", errorf(KeyConfigSaveFailed, err)
+	}
+	meta.Location, meta.FetchedAt = location, time.Now().UTC()
+	out, _ := json.MarshalIndent(meta, "", "  ")
+	if err := writeFileAtomic(metaPath, out); err != nil {
+		return "", errorf(KeyConfigSaveFailed, err)
+	}
+	return path, nil
+}
+
+// fetchHTTPConfig downloads location unless it matches meta, in which case it
+// reports changed as false.
+func fetchHTTPConfig(location string, meta *remoteConfigMeta) ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, false, withCode(ErrCodeConfigNotFound, errorf(KeyConfigURLInvalid, err))
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+	resp, err := remoteConfigClient.Do(req)
+	if err != nil {
+		return nil, false, errorf(KeyConfigDownloadFailed, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, false, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, withCode(ErrCodeConfigNotFound, fmt.Errorf("%s: %s", location, resp.Status))
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, false, withCode(ErrCodeAccessDenied, fmt.Errorf("%s: %s", location, resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, errorf(KeyConfigBadResponse, location, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, errorf(KeyConfigDownloadFailed, err)
+	}
+	meta.ETag, meta.LastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return data, true, nil
+}
+
+// fetchS3Config downloads an s3:// location with aws s3api get-object unless
+// its ETag matches meta, in which case it reports changed as false. The
+// region is taken from AWS_REGION or AWS_DEFAULT_REGION.
+func fetchS3Config(location string, meta *remoteConfigMeta) ([]byte, bool, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if bucket == "" || key == "" {
+		return nil, false, withCode(ErrCodeConfigNotFound, fmt.Errorf("'%s' is not an s3://bucket/key location", location))
+	}
+	tmp, err := os.CreateTemp("", "pushecr-config-*.yml")
+	if err != nil {
+		return nil, false, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	args := []string{"s3api", "get-object", "--bucket", bucket, "--key", key}
+	if meta.ETag != "" {
+		args = append(args, "--if-none-match", meta.ETag)
+	}
+	region := orDefault(os.Getenv("AWS_REGION"), orDefault(os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"))
+	out, err := runAWS(region, io.Discard, append(args, tmp.Name())...)
+	switch {
+	case isAWSError(err, "(304)"):
+		return nil, false, nil
+	case isAWSError(err, "NoSuchKey"), isAWSError(err, "NoSuchBucket"):
+		return nil, false, withCode(ErrCodeConfigNotFound, err)
+	case err != nil:
+		return nil, false, classify(ErrCodeUnknown, err.Error(), errorf(KeyConfigDownloadFailed, err))
+	}
+	var object struct {
+		ETag         string `json:"ETag"`
+		LastModified string `json:"LastModified"`
+	}
+	if err := json.Unmarshal(out, &object); err != nil {
+		return nil, false, errorf(KeyAWSBadResponse, "get-object", err)
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, false, err
+	}
+	meta.ETag, meta.LastModified = object.ETag, object.LastModified
+	return data, true, nil
+}
+
+// fetchGitConfig checks out a git::<repository>//<path>?ref=<ref> location
+// into dir with a shallow clone, fetching only the ref on later runs.
+func fetchGitConfig(location, dir string) (string, error) {
+	repository, path, ref, err := parseGitConfigLocation(location)
+	if err != nil {
+		return "", err
+	}
+	checkout := filepath.Join(dir, "repo")
+	file := filepath.Join(checkout, filepath.FromSlash(path))
+
+	_, statErr := os.Stat(filepath.Join(checkout, ".git"))
+	cloned := statErr == nil
+	if cloned {
+		err = runGit(checkout, "fetch", "--quiet", "--depth", "1", "origin", orDefault(ref, "HEAD"))
+		if err == nil {
+			err = runGit(checkout, "checkout", "--quiet", "--detach", "FETCH_HEAD")
+		}
+	} else {
+		os.RemoveAll(checkout)
+		if err = os.MkdirAll(dir, 0o755); err == nil {
+			args := []string{"clone", "--quiet", "--depth", "1"}
+			if ref != "" {
+				args = append(args, "--branch", ref)
+			}
+			err = runGit("", append(args, "--", repository, checkout)...)
+		}
+	}
+	if err != nil {
+		if !cloned {
+			return "", errorf(KeyConfigCloneFailed, repository, err)
+		}
+		fmt.Fprintf(os.Stderr, ColorYellow+"Using the cached checkout of %s: %v"+ColorReset+"\n", repository, err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		return "", withCode(ErrCodeConfigNotFound, fmt.Errorf("%s not found in %s", path, repository))
+	}
+	return file, nil
+}
+
+// parseGitConfigLocation splits git::<repository>//<path>?ref=<ref>. The
+// // separating the path is the first one after the repository's scheme.
+func parseGitConfigLocation(location string) (repository, path, ref string, err error) {
+	rest := strings.TrimPrefix(location, "git::")
+	if i := strings.LastIndex(rest, "?ref="); i >= 0 {
+		rest, ref = rest[:i], rest[i+len("?ref="):]
+	}
+	start := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(rest[start:], "//")
+	if i < 0 {
+		return "", "", "", withCode(ErrCodeConfigNotFound, fmt.Errorf("'%s' has no //path to the configuration file (git::<repository>//<path>?ref=<ref>)", location))
+	}
+	repository, path = rest[:start+i], rest[start+i+2:]
+	if repository == "" || path == "" {
+		return "", "", "", withCode(ErrCodeConfigNotFound, fmt.Errorf("'%s' is not a git::<repository>//<path> location", location))
+	}
+	return repository, path, ref, nil
+}
+
+// runGit runs git in dir, returning its output in the error when it fails.
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderer presents a pipeline run to whoever consumes its output, selected
+// with -output. Stages print their human output themselves; a renderer gets
+// the stage events and the run summaries, so anything that reports through
+// stageEvent or runEntry reaches every format.
+type renderer interface {
+	// attach reports the stage events of ecr.
+	attach(ecr *ECR)
+	// summary reports the end of ecr's run, started at started, which ended
+	// with err.
+	summary(ecr *ECR, started time.Time, err error)
+	// finish is called once every summary was reported, before exiting.
+	finish()
+}
+
+// renderers are the -output formats.
+var renderers = map[string]func() renderer{
+	"text":   func() renderer { return textRenderer{} },
+	"json":   func() renderer { return startJSONOutput() },
+	"github": func() renderer { return newGitHubRenderer() },
+	"tap":    func() renderer { return startTAPOutput() },
+}
+
+// stdoutRenderers take stdout for themselves and move the human output to
+// stderr.
+var stdoutRenderers = []string{"json", "tap"}
+
+func rendererNames() []string {
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stageTracker times the stages of every profile from their events.
+type stageTracker struct {
+	starts map[string]time.Time
+	stages map[string][]stageSummary
+}
+
+func newStageTracker() stageTracker {
+	return stageTracker{starts: map[string]time.Time{}, stages: map[string][]stageSummary{}}
+}
+
+// record adds event of profile and returns the stage's duration in seconds
+// when it ended.
+func (t stageTracker) record(profile string, event stageEvent) float64 {
+	key := profile + "\x00" + event.Stage
+	if event.Status == runRunning {
+		t.starts[key] = event.Time
+		return 0
+	}
+	seconds := event.Time.Sub(t.starts[key]).Round(time.Millisecond).Seconds()
+	t.stages[profile] = append(t.stages[profile], stageSummary{
+		Stage:     event.Stage,
+		Status:    event.Status,
+		Seconds:   seconds,
+		ErrorCode: event.ErrorCode,
+		ErrorKey:  event.ErrorKey,
+	})
+	return seconds
+}
+
+// textRenderer is the default colored output: what the stages print is the
+// whole of it.
+type textRenderer struct{}
+
+func (textRenderer) attach(*ECR)                    {}
+func (textRenderer) summary(*ECR, time.Time, error) {}
+func (textRenderer) finish()                        {}
+
+// githubRenderer implements -output github for GitHub Actions: the output of
+// each stage goes in a collapsible group, a failed stage becomes an error
+// annotation, and each run adds a table to the job summary.
+type githubRenderer struct {
+	mu      sync.Mutex
+	tracker stageTracker
+}
+
+func newGitHubRenderer() *githubRenderer {
+	return &githubRenderer{tracker: newStageTracker()}
+}
+
+func (g *githubRenderer) attach(ecr *ECR) {
+	profile := ecr.Profile
+	ecr.onStage = func(event stageEvent) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.tracker.record(profile, event)
+		switch event.Status {
+		case runRunning:
+			fmt.Printf("::group::%s: %s\n", profile, event.Stage)
+		case runFailed:
+			fmt.Println("::endgroup::")
+			fmt.Printf("::error title=%s::%s\n",
+				githubEscape(fmt.Sprintf("%s: %s failed (%s)", profile, event.Stage, event.ErrorCode), true),
+				githubEscape(event.Error, false))
+		default:
+			fmt.Println("::endgroup::")
+		}
+	}
+}
+
+func (g *githubRenderer) summary(ecr *ECR, started time.Time, err error) {
+	entry := newRunEntry(ecr.runID, "cli", ecr, started, err)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil && entry.FailedStep == "" && len(g.tracker.stages[ecr.Profile]) == 0 {
+		// Failures before the first stage have no stage event to annotate.
+		fmt.Printf("::error title=%s::%s\n",
+			githubEscape(fmt.Sprintf("%s failed (%s)", ecr.Profile, entry.ErrorCode), true), githubEscape(entry.Error, false))
+	}
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return
+	}
+	var b strings.Builder
+	status := entry.Status
+	if ecr.upToDate {
+		status = "up to date"
+	}
+	fmt.Fprintf(&b, "### pushecr %s: %s\n\n", ecr.Profile, status)
+	if stages := g.tracker.stages[ecr.Profile]; len(stages) > 0 {
+		b.WriteString("| Stage | Status | Duration |\n| --- | --- | --- |\n")
+		for _, s := range stages {
+			status := s.Status
+			if s.ErrorCode != "" {
+				status += " (`" + string(s.ErrorCode) + "`)"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %.1fs |\n", s.Stage, status, s.Seconds)
+		}
+		b.WriteString("\n")
+	}
+	if entry.Image != "" && err == nil && !ecr.upToDate {
+		fmt.Fprintf(&b, "Image: `%s`\n\n", entry.Image)
+	}
+	f, openErr := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if openErr != nil {
+		fmt.Fprintln(os.Stderr, ColorRed+"Could not write the job summary: "+openErr.Error()+ColorReset)
+		return
+	}
+	defer f.Close()
+	f.WriteString(b.String())
+}
+
+func (g *githubRenderer) finish() {}
+
+// githubEscape escapes a workflow command message, or a property such as
+// title, which also cannot contain : or ,.
+func githubEscape(s string, property bool) string {
+	s = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+	if property {
+		s = strings.NewReplacer(":", "%3A", ",", "%2C").Replace(s)
+	}
+	return s
+}
+
+// tapOutput implements -output tap: stdout carries a TAP 13 stream with a
+// test point per finished stage, and a failed one for a run that failed
+// before any stage, and the human output goes to stderr.
+type tapOutput struct {
+	mu      sync.Mutex
+	out     *os.File
+	tracker stageTracker
+	tests   int
+	once    sync.Once
+}
+
+func startTAPOutput() *tapOutput {
+	t := &tapOutput{out: os.Stdout, tracker: newStageTracker()}
+	os.Stdout = os.Stderr
+	fmt.Fprintln(t.out, "TAP version 13")
+	return t
+}
+
+func (t *tapOutput) attach(ecr *ECR) {
+	profile := ecr.Profile
+	ecr.onStage = func(event stageEvent) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		seconds := t.tracker.record(profile, event)
+		if event.Status == runRunning {
+			return
+		}
+		t.point(event.Status != runFailed, profile+" "+event.Stage, seconds, event.ErrorCode, event.ErrorKey, event.Error)
+	}
+}
+
+func (t *tapOutput) summary(ecr *ECR, started time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case ecr.upToDate:
+		fmt.Fprintf(t.out, "# %s: up to date, nothing was pushed\n", ecr.Profile)
+	case err != nil && len(t.tracker.stages[ecr.Profile]) == 0:
+		t.point(false, ecr.Profile, time.Since(started).Seconds(), errorCode(err), errorKey(err), err.Error())
+	case err != nil:
+		fmt.Fprintf(t.out, "# %s: failed\n", ecr.Profile)
+	default:
+		fmt.Fprintf(t.out, "# %s: %s\n", ecr.Profile, ecr.pushedImageURI())
+	}
+}
+
+// point writes a test point, with a YAML block describing a failure. t.mu must
+// be held.
+func (t *tapOutput) point(ok bool, description string, seconds float64, code ErrorCode, key ErrorKey, message string) {
+	t.tests++
+	if ok {
+		fmt.Fprintf(t.out, "ok %d - %s\n", t.tests, description)
+		return
+	}
+	fmt.Fprintf(t.out, "not ok %d - %s\n", t.tests, description)
+	fmt.Fprintln(t.out, "  ---")
+	fmt.Fprintf(t.out, "  error_code: %s\n", code)
+	fmt.Fprintf(t.out, "  error_key: %s\n", key)
+	fmt.Fprintf(t.out, "  duration_seconds: %.3f\n", seconds)
+	fmt.Fprintln(t.out, "  message: |")
+	for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+		fmt.Fprintln(t.out, "    "+line)
+	}
+	fmt.Fprintln(t.out, "  ...")
+}
+
+// finish writes the plan, after the test points since their number is only
+// known at the end.
+func (t *tapOutput) finish() {
+	t.once.Do(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		fmt.Fprintf(t.out, "1..%d\n", t.tests)
+	})
+}
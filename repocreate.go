@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecrapi "github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// CreateRepositoryConfig sets up repositories created by
+// ecr.create_if_missing.
+type CreateRepositoryConfig struct {
+	TagImmutability bool   `mapstructure:"tag_immutability"`
+	ScanOnPush      bool   `mapstructure:"scan_on_push"`
+	Encryption      string `mapstructure:"encryption"` // AES256 (default) or KMS
+	KMSKey          string `mapstructure:"kms_key"`    // key ARN or alias for KMS; AWS managed key if empty
+}
+
+func (c CreateRepositoryConfig) validate() error {
+	switch c.Encryption {
+	case "", "AES256":
+		if c.KMSKey != "" {
+			return fmt.Errorf("ecr.create.kms_key needs ecr.create.encryption: KMS")
+		}
+	case "KMS":
+	default:
+		return fmt.Errorf("ecr.create.encryption must be AES256 or KMS, got '%s'", c.Encryption)
+	}
+	return nil
+}
+
+// ensureRepository creates the repository when ecr.create_if_missing is set
+// and it does not exist yet, so the first push to a new repository does not
+// fail halfway through. It is checked once per run.
+func (ecr *ECR) ensureRepository() error {
+	if !ecr.Config.ECR.CreateIfMissing || ecr.repositoryReady {
+		return nil
+	}
+	repository := ecr.Config.ECR.Repository
+	_, err := ecr.repositoryImmutable()
+	if err == nil {
+		ecr.repositoryReady = true
+		return nil
+	}
+	if !isAWSError(err, "RepositoryNotFoundException") {
+		return errorf(KeyRepoDescribeFailed, repository, err)
+	}
+
+	ecr.stage(ColorYellow, "Creating repository "+repository)
+	if ecr.Config.ECR.Public {
+		err = ecr.createPublicRepository(repository)
+	} else {
+		err = ecr.createRepository(repository)
+	}
+	if err != nil && !isAWSError(err, "RepositoryAlreadyExistsException") {
+		return errorf(KeyRepoCreateFailed, repository, err)
+	}
+	ecr.repositoryReady = true
+	return nil
+}
+
+// createRepository creates a private repository with the settings of
+// ecr.create.
+func (ecr *ECR) createRepository(repository string) error {
+	create := ecr.Config.ECR.Create
+	input := &ecrapi.CreateRepositoryInput{
+		RepositoryName:             aws.String(repository),
+		ImageTagMutability:         ecrtypes.ImageTagMutabilityMutable,
+		ImageScanningConfiguration: &ecrtypes.ImageScanningConfiguration{ScanOnPush: create.ScanOnPush},
+	}
+	if create.TagImmutability {
+		input.ImageTagMutability = ecrtypes.ImageTagMutabilityImmutable
+	}
+	if create.Encryption != "" {
+		input.EncryptionConfiguration = &ecrtypes.EncryptionConfiguration{EncryptionType: ecrtypes.EncryptionType(create.Encryption)}
+		if create.KMSKey != "" {
+			input.EncryptionConfiguration.KmsKey = aws.String(create.KMSKey)
+		}
+	}
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return err
+	}
+	return ecr.callAWS("ecr create-repository", func(ctx context.Context) error {
+		_, err := client.CreateRepository(ctx, input)
+		return err
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// RepositoryPolicy enforces the organization's repository naming convention.
+type RepositoryPolicy struct {
+	Pattern string `mapstructure:"pattern"`
+}
+
+// profile returns a copy of the named profile with its derived settings
+// (such as the repository from ecr.repository_template) resolved.
+func (c *Config) profile(name string) (*ProfileConfig, error) {
+	profileConfig, ok := c.Profiles[name]
+	if !ok {
+		return nil, withCode(ErrCodeProfileNotFound, fmt.Errorf("profile '%s' not found in configuration", name))
+	}
+	if profileConfig.ECR.RepositoryTemplate != "" && profileConfig.ECR.Repository == "" {
+		repository, err := renderRepository(profileConfig.ECR.RepositoryTemplate, repositoryValues(name, profileConfig.ECR.RepositoryValues))
+		if err != nil {
+			return nil, withCode(ErrCodeConfigInvalid, err)
+		}
+		profileConfig.ECR.Repository = repository
+	}
+	if profileConfig.ECR.Region == "" && len(profileConfig.ECR.Regions) > 0 {
+		profileConfig.ECR.Region = profileConfig.ECR.Regions[0]
+	}
+	profileConfig.resolvedAt = time.Now().UTC()
+	profileConfig.ECR.decorateTags()
+	if strings.Contains(profileConfig.ECR.ImageTag, "{{") {
+		tag, err := renderTag("ecr.image_tag", profileConfig.ECR.ImageTag, tagValues(name, &profileConfig))
+		if err != nil {
+			return nil, withCode(ErrCodeConfigInvalid, err)
+		}
+		profileConfig.ECR.ImageTag = tag
+	}
+	if err := profileConfig.resolveImageTags(name); err != nil {
+		return nil, withCode(ErrCodeConfigInvalid, err)
+	}
+	if err := profileConfig.resolveBuildArgs(); err != nil {
+		return nil, withCode(ErrCodeConfigInvalid, err)
+	}
+	return &profileConfig, nil
+}
+
+// repositoryValues builds the data available to ecr.repository_template:
+// the profile and workspace names, the git repository and branch, and every
+// entry of ecr.repository_values with its key in CamelCase (team → .Team).
+// .Service defaults to the git repository name.
+func repositoryValues(profile string, values map[string]string) map[string]string {
+	data := map[string]string{
+		"Profile":   profile,
+		"Workspace": workspace,
+		"GitRepo":   gitRepoName(),
+		"GitBranch": git("rev-parse", "--abbrev-ref", "HEAD"),
+	}
+	data["Service"] = data["GitRepo"]
+	for key, value := range values {
+		data[camelCase(key)] = value
+	}
+	return data
+}
+
+func renderRepository(text string, data map[string]string) (string, error) {
+	tmpl, err := template.New("repository_template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errorf(KeyRepoTemplateInvalid, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("ecr.repository_template: %w", err)
+	}
+	repository := strings.ToLower(out.String())
+	if strings.Contains(repository, "//") || strings.HasPrefix(repository, "/") || strings.HasSuffix(repository, "/") {
+		return "", errorf(KeyRepoTemplateEmpty, repository)
+	}
+	return repository, nil
+}
+
+// checkRepositoryPolicy rejects repositories that do not follow
+// policy.repository.pattern.
+func (ecr *ECR) checkRepositoryPolicy() error {
+	pattern := ecr.Config.Policy.Repository.Pattern
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return withCode(ErrCodeConfigInvalid, fmt.Errorf("policy.repository.pattern is not a valid regular expression: %w", err))
+	}
+	if !re.MatchString(ecr.Config.ECR.Repository) {
+		return withCode(ErrCodePolicyViolation, fmt.Errorf("repository '%s' does not follow the naming convention %s", ecr.Config.ECR.Repository, pattern))
+	}
+	return nil
+}
+
+func gitRepoName() string {
+	url := strings.TrimSuffix(git("config", "--get", "remote.origin.url"), ".git")
+	if url == "" {
+		url = git("rev-parse", "--show-toplevel")
+	}
+	if i := strings.LastIndexAny(url, ":/"); i >= 0 {
+		url = url[i+1:]
+	}
+	return url
+}
+
+// git returns the trimmed output of a git command, or "" if it fails.
+func git(args ...string) string {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// camelCase turns a config key such as "service_name" into "ServiceName".
+func camelCase(key string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(key, func(r rune) bool { return r == '_' || r == '-' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// stageUsage is the resources a pipeline stage consumed.
+type stageUsage struct {
+	Stage      string  `json:"stage"`
+	Seconds    float64 `json:"seconds"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+	// PeakMemory is the largest resident set of a child process that
+	// finished during the stage, or 0 if none exceeded an earlier peak.
+	PeakMemory int64 `json:"peak_memory_bytes,omitempty"`
+	// DiskGrowth is how much Docker's images and build cache grew; only
+	// measured for the build stage.
+	DiskGrowth int64 `json:"disk_growth_bytes,omitempty"`
+}
+
+// usageMeter measures one stage. CPU time and memory come from the child
+// processes (docker, aws, cosign CLIs) the stage waited for; the work the
+// Docker daemon does on their behalf is only visible as disk growth. When
+// the daemon runs several pipelines at once the child figures of concurrent
+// stages overlap.
+type usageMeter struct {
+	stage   string
+	started time.Time
+	before  childUsage
+	disk    int64
+}
+
+func startUsage(stage string) *usageMeter {
+	m := &usageMeter{stage: stage, started: time.Now(), before: childrenUsage(), disk: -1}
+	if stage == "build" || strings.HasPrefix(stage, "build:") {
+		m.disk = dockerDiskUsage()
+	}
+	return m
+}
+
+func (m *usageMeter) stop() stageUsage {
+	after := childrenUsage()
+	u := stageUsage{
+		Stage:      m.stage,
+		Seconds:    time.Since(m.started).Round(time.Millisecond).Seconds(),
+		CPUSeconds: (after.CPU - m.before.CPU).Round(time.Millisecond).Seconds(),
+	}
+	if after.MaxRSS > m.before.MaxRSS {
+		u.PeakMemory = after.MaxRSS
+	}
+	if m.disk >= 0 {
+		if disk := dockerDiskUsage(); disk >= 0 {
+			u.DiskGrowth = disk - m.disk
+		}
+	}
+	return u
+}
+
+func printUsage(usage []stageUsage) {
+	if len(usage) == 0 {
+		return
+	}
+	fmt.Println("Resource usage:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  STAGE\tTIME\tCPU\tPEAK MEMORY\tDISK")
+	for _, u := range usage {
+		memory, disk := "-", "-"
+		if u.PeakMemory > 0 {
+			memory = formatBytes(u.PeakMemory)
+		}
+		if u.Stage == "build" || strings.HasPrefix(u.Stage, "build:") {
+			disk = formatBytes(u.DiskGrowth)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", u.Stage, formatSeconds(u.Seconds), formatSeconds(u.CPUSeconds), memory, disk)
+	}
+	w.Flush()
+}
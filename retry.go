@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// PushConfig retries the auth and push stages when they fail with a
+// retryable error (see errorCatalog), such as throttling or an interrupted
+// blob upload, instead of failing the run on the first attempt.
+type PushConfig struct {
+	Retries    int    `mapstructure:"retries"`     // attempts after the first, default 0
+	Backoff    string `mapstructure:"backoff"`     // wait before the first retry, doubled on each one; default 2s
+	MaxBackoff string `mapstructure:"max_backoff"` // default 1m
+}
+
+func (c PushConfig) validate() error {
+	if c.Retries < 0 {
+		return fmt.Errorf("push.retries cannot be negative")
+	}
+	for name, value := range map[string]string{"push.backoff": c.Backoff, "push.max_backoff": c.MaxBackoff} {
+		if d, err := time.ParseDuration(orDefault(value, "1s")); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s '%s'", name, value)
+		}
+	}
+	return nil
+}
+
+// wait returns the jittered wait before retry n (starting at 1): a random
+// duration between half and all of backoff·2^(n-1), capped at max_backoff.
+func (c PushConfig) wait(n int) time.Duration {
+	base, _ := time.ParseDuration(orDefault(c.Backoff, "2s"))
+	ceiling, _ := time.ParseDuration(orDefault(c.MaxBackoff, "1m"))
+	d := min(base<<min(n-1, 20), ceiling)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retriedStages are the stages push.retries applies to.
+var retriedStages = []string{"auth", "push"}
+
+// withRetries runs the auth and push stages again after a retryable failure,
+// up to push.retries times. An expired authorization token during the push is
+// renewed before retrying.
+func withRetries(s stage) stage {
+	if !contains(retriedStages, s.Name) {
+		return s
+	}
+	return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+		config := ecr.Config.Push
+		for attempt := 1; ; attempt++ {
+			err := next(ctx, ecr)
+			if err == nil || attempt > config.Retries || !retryable(err) {
+				return err
+			}
+			wait := config.wait(attempt)
+			fmt.Printf(ColorYellow+"%s failed (%s), retrying in %s (attempt %d of %d): %v"+ColorReset+"\n",
+				s.Name, errorCode(err), wait.Round(100*time.Millisecond), attempt+1, config.Retries+1, err)
+			fmt.Fprintf(&ecr.logs, "retrying %s after %v\n", s.Name, err)
+			if err := sleepContext(ctx, wait); err != nil {
+				return err
+			}
+			if s.Name == "push" && errorCode(err) == ErrCodeAuthExpired {
+				// The cached token is the one that expired.
+				for _, run := range append([]*ECR{ecr}, ecr.replicas()...) {
+					run.forgetRegistryToken()
+				}
+				if err := stageMethod((*ECR).login)(ctx, ecr); err != nil {
+					return err
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestPushRetryRenewsExpiredToken(t *testing.T) {
+	srv := startECR(t)
+	ecr := testRun(t, "auth,push", func(c *ProfileConfig) {
+		c.Push = PushConfig{Retries: 1, Backoff: "10ms"}
+	})
+	attempts := 0
+	replaceStage(ecr, "push", func(ecr *ECR) error {
+		attempts++
+		if attempts == 1 {
+			// The token the auth stage cached expires before the push.
+			srv.ExpireTokens()
+		}
+		return registryPush(ecr)
+	})
+
+	if err := ecr.runPipeline(); err != nil {
+		t.Fatalf("run failed after %d push attempt(s): %v", attempts, err)
+	}
+	if attempts != 2 {
+		t.Fatalf("push ran %d times, want 2", attempts)
+	}
+}
+
+func TestPushRetryGivesUpOnExpiredToken(t *testing.T) {
+	srv := startECR(t)
+	ecr := testRun(t, "auth,push", func(c *ProfileConfig) {
+		c.Push = PushConfig{Retries: 2, Backoff: "10ms"}
+	})
+	replaceStage(ecr, "push", func(ecr *ECR) error {
+		srv.ExpireTokens()
+		return registryPush(ecr)
+	})
+
+	err := ecr.runPipeline()
+	if code := errorCode(err); code != ErrCodeAuthExpired {
+		t.Fatalf("run failed with %s (%v), want %s", code, err, ErrCodeAuthExpired)
+	}
+}
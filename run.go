@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// RunConfig holds the defaults used by pushecr run to start an image locally.
+type RunConfig struct {
+	EnvFile string            `mapstructure:"env_file"`
+	Env     map[string]string `mapstructure:"env"`
+	Ports   []string          `mapstructure:"ports"`
+}
+
+func runRun(args []string) {
+	fs, configPath, profile := commandFlags("run", "run [-config deploy.yml] [-profile dev] [-env-file .env] [-p 8080:8080] <tag|digest> [-- command...]")
+	envFile := fs.String("env-file", "", "Env file passed to the container (default run.env_file)")
+	var ports stringList
+	fs.Var(&ports, "p", "Port mapping host:container, repeatable (default run.ports)")
+	platform := fs.String("platform", "", "Platform to pull and run from a multi-arch image")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("run needs the tag or digest to run")))
+	}
+	ref, command := fs.Arg(0), fs.Args()[1:]
+	if len(command) > 0 && command[0] == "--" {
+		command = command[1:]
+	}
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	exitOnError("Authentication failed", ecr.authenticate())
+	image, err := ecr.pull(ref, *platform)
+	exitOnError("Pull failed", err)
+
+	run := profileConfig.Run
+	dockerArgs := []string{"run", "--rm"}
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		dockerArgs = append(dockerArgs, "-it")
+	}
+	if *platform != "" {
+		dockerArgs = append(dockerArgs, "--platform", *platform)
+	}
+	if file := orDefault(*envFile, run.EnvFile); file != "" {
+		dockerArgs = append(dockerArgs, "--env-file", file)
+	}
+	for _, key := range sortedKeys(run.Env) {
+		dockerArgs = append(dockerArgs, "-e", key+"="+os.ExpandEnv(run.Env[key]))
+	}
+	if len(ports) == 0 {
+		ports = run.Ports
+	}
+	for _, port := range ports {
+		dockerArgs = append(dockerArgs, "-p", port)
+	}
+	dockerArgs = append(dockerArgs, image)
+
+	ecr.stage(ColorCyan, "Running "+image)
+	cmd := exec.Command("docker", append(dockerArgs, command...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		exitOnError("Run failed", classify(ErrCodeDockerUnavailable, "", errorf(KeyRunImageFailed, err)))
+	}
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
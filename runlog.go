@@ -0,0 +1,57 @@
+package main
+
+import "sync"
+
+// runLog accumulates the output of a run. It is safe for concurrent use so
+// the daemon can stream a run's log while the pipeline is still writing it.
+type runLog struct {
+	mu      sync.Mutex
+	buf     []byte
+	closed  bool
+	changed chan struct{}
+}
+
+func (l *runLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	l.broadcast()
+	return len(p), nil
+}
+
+// Bytes returns a copy of everything written so far.
+func (l *runLog) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]byte(nil), l.buf...)
+}
+
+// Close marks the log as complete and wakes up any followers.
+func (l *runLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.broadcast()
+}
+
+// next returns the data written after offset, whether the log is complete,
+// and a channel that is closed on the next write or Close.
+func (l *runLog) next(offset int) ([]byte, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.changed == nil {
+		l.changed = make(chan struct{})
+	}
+	var data []byte
+	if offset < len(l.buf) {
+		data = append(data, l.buf[offset:]...)
+	}
+	return data, l.closed, l.changed
+}
+
+func (l *runLog) broadcast() {
+	if l.changed != nil {
+		close(l.changed)
+	}
+	l.changed = make(chan struct{})
+}
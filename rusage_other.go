@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+// childUsage is the accumulated usage of the child processes waited for.
+type childUsage struct {
+	CPU    time.Duration
+	MaxRSS int64
+}
+
+// childrenUsage is not available on this platform.
+func childrenUsage() childUsage {
+	return childUsage{}
+}
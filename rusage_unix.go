@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// childUsage is the accumulated usage of the child processes waited for.
+type childUsage struct {
+	CPU    time.Duration
+	MaxRSS int64
+}
+
+func childrenUsage() childUsage {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &ru); err != nil {
+		return childUsage{}
+	}
+	maxRSS := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		maxRSS *= 1024 // kilobytes everywhere but macOS
+	}
+	return childUsage{
+		CPU:    time.Duration(ru.Utime.Nano() + ru.Stime.Nano()),
+		MaxRSS: maxRSS,
+	}
+}
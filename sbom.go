@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// sbomPackage is a package as listed in an SPDX or CycloneDX SBOM.
+type sbomPackage struct {
+	Name     string
+	Version  string
+	Licenses []string
+}
+
+// downloadSBOM fetches the SBOM attested to ref with cosign. predicateType is
+// the cosign attestation type (spdxjson or cyclonedx).
+func (ecr *ECR) downloadSBOM(ref, predicateType string) ([]sbomPackage, error) {
+	cmd := exec.CommandContext(ecr.context(), "cosign", "download", "attestation", "--predicate-type", predicateType, ref)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = ecr.output(&stderr)
+	if err := cmd.Run(); err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return nil, fmt.Errorf("cosign download attestation: %s", line)
+		}
+		return nil, fmt.Errorf("cosign download attestation: %w", err)
+	}
+
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var envelope struct {
+			Payload string `json:"payload"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			continue
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			continue
+		}
+		var statement struct {
+			Predicate json.RawMessage `json:"predicate"`
+		}
+		if err := json.Unmarshal(payload, &statement); err != nil {
+			continue
+		}
+		return parseSBOM(statement.Predicate)
+	}
+	return nil, errors.New("no SBOM attestation found")
+}
+
+// parseSBOM extracts packages from an SPDX or CycloneDX JSON document. Older
+// cosign versions wrap the document as a string under "Data".
+func parseSBOM(data []byte) ([]sbomPackage, error) {
+	var doc struct {
+		Data     string `json:"Data"`
+		Packages []struct {
+			Name             string `json:"name"`
+			VersionInfo      string `json:"versionInfo"`
+			LicenseConcluded string `json:"licenseConcluded"`
+			LicenseDeclared  string `json:"licenseDeclared"`
+		} `json:"packages"`
+		Components []struct {
+			Name     string `json:"name"`
+			Version  string `json:"version"`
+			Licenses []struct {
+				License struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"license"`
+				Expression string `json:"expression"`
+			} `json:"licenses"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errorf(KeySBOMInvalid, err)
+	}
+	if doc.Data != "" {
+		return parseSBOM([]byte(doc.Data))
+	}
+
+	var packages []sbomPackage
+	for _, p := range doc.Packages {
+		pkg := sbomPackage{Name: p.Name, Version: p.VersionInfo}
+		for _, license := range []string{p.LicenseConcluded, p.LicenseDeclared} {
+			if license != "" && license != "NOASSERTION" && !contains(pkg.Licenses, license) {
+				pkg.Licenses = append(pkg.Licenses, license)
+			}
+		}
+		packages = append(packages, pkg)
+	}
+	for _, c := range doc.Components {
+		pkg := sbomPackage{Name: c.Name, Version: c.Version}
+		for _, l := range c.Licenses {
+			license := strings.TrimSpace(l.Expression + l.License.ID)
+			if license == "" {
+				license = l.License.Name
+			}
+			if license != "" {
+				pkg.Licenses = append(pkg.Licenses, license)
+			}
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecrapi "github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// ScanConfig gates the run on the vulnerabilities ECR finds in the pushed
+// image, with basic scanning (scan on push) or enhanced scanning (Amazon
+// Inspector), in the scan stage after the push.
+type ScanConfig struct {
+	// FailOn is the lowest severity that fails the run: CRITICAL, HIGH,
+	// MEDIUM, LOW or INFORMATIONAL. Empty disables the gate.
+	FailOn   string   `mapstructure:"fail_on"`
+	Ignore   []string `mapstructure:"ignore"`   // vulnerability IDs not counted, e.g. CVE-2023-1234
+	Timeout  string   `mapstructure:"timeout"`  // wait for the scan to complete, default 15m
+	Interval string   `mapstructure:"interval"` // default 15s
+}
+
+// severities are the ECR finding severities, lowest first. UNDEFINED and
+// UNTRIAGED findings never fail the gate.
+var severities = []string{"INFORMATIONAL", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c ScanConfig) enabled() bool {
+	return c.FailOn != ""
+}
+
+func (c ScanConfig) validate(public bool) error {
+	if !c.enabled() {
+		return nil
+	}
+	if severityRank(c.FailOn) < 0 {
+		return fmt.Errorf("scan.fail_on must be one of %s, got '%s'", strings.Join(severities, ", "), c.FailOn)
+	}
+	if public {
+		return fmt.Errorf("scan.fail_on is not supported by ECR Public (ecr.public), which does not scan images")
+	}
+	for name, value := range map[string]string{"scan.timeout": c.Timeout, "scan.interval": c.Interval} {
+		if d, err := time.ParseDuration(orDefault(value, "1s")); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s '%s'", name, value)
+		}
+	}
+	return nil
+}
+
+// scanFinding is a finding of a basic or an enhanced scan.
+type scanFinding struct {
+	ID       string
+	Severity string
+	Package  string
+}
+
+// scanGate waits for the scan of the pushed image and fails the run when it
+// has findings of scan.fail_on or above. The images of a manifest list are
+// scanned one by one.
+func (ecr *ECR) scanGate() error {
+	c := ecr.Config.Scan
+	if !c.enabled() {
+		return nil
+	}
+	digest, err := ecr.pushedDigest()
+	if err != nil {
+		return err
+	}
+	digests, err := ecr.scannedDigests(digest)
+	if err != nil {
+		return err
+	}
+
+	ecr.stage(ColorCyan, "Checking vulnerability scan findings (fail on "+c.FailOn+" or above)")
+	var blocking []scanFinding
+	for _, d := range digests {
+		findings, err := ecr.waitScanFindings(d)
+		if err != nil {
+			return err
+		}
+		counts := map[string]int{}
+		for _, f := range findings {
+			counts[f.Severity]++
+			if severityRank(f.Severity) >= severityRank(c.FailOn) && !contains(c.Ignore, f.ID) {
+				blocking = append(blocking, f)
+			}
+		}
+		var summary []string
+		for i := len(severities) - 1; i >= 0; i-- {
+			if n := counts[severities[i]]; n > 0 {
+				summary = append(summary, fmt.Sprintf("%d %s", n, severities[i]))
+			}
+		}
+		if len(summary) == 0 {
+			summary = []string{"no findings"}
+		}
+		fmt.Println(shortDigest(d) + ": " + strings.Join(summary, ", "))
+	}
+	if len(blocking) == 0 {
+		fmt.Println(ColorGreen + "No findings of " + c.FailOn + " or above" + ColorReset)
+		return nil
+	}
+
+	sort.SliceStable(blocking, func(i, j int) bool {
+		return severityRank(blocking[i].Severity) > severityRank(blocking[j].Severity)
+	})
+	const shown = 10
+	for i, f := range blocking {
+		if i == shown {
+			fmt.Printf(ColorRed+"  ... and %d more"+ColorReset+"\n", len(blocking)-shown)
+			break
+		}
+		fmt.Println(ColorRed + "  " + f.Severity + " " + f.ID + " in " + orDefault(f.Package, "unknown package") + ColorReset)
+	}
+	return withCode(ErrCodeVulnerabilities, errorf(KeyScanVulnerabilities, len(blocking), c.FailOn))
+}
+
+// scannedDigests returns the image manifests ECR scans for digest: digest
+// itself, or the platform images of a manifest list.
+func (ecr *ECR) scannedDigests(digest string) ([]string, error) {
+	image, err := ecr.batchGetImage(digest)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal([]byte(image.Manifest), &m); err != nil {
+		return nil, errorf(KeyScanManifestInvalid, digest, err)
+	}
+	if !m.isIndex() {
+		return []string{digest}, nil
+	}
+	var digests []string
+	for _, child := range m.Manifests {
+		// Attestation manifests of buildx have no platform to scan.
+		if child.Platform != nil && child.Platform.OS != "unknown" {
+			digests = append(digests, child.Digest)
+		}
+	}
+	return digests, nil
+}
+
+// waitScanFindings polls the scan of digest until it completes, starting a
+// basic scan if none was started, and returns its findings.
+func (ecr *ECR) waitScanFindings(digest string) ([]scanFinding, error) {
+	c := ecr.Config.Scan
+	timeout, _ := time.ParseDuration(orDefault(c.Timeout, "15m"))
+	interval, _ := time.ParseDuration(orDefault(c.Interval, "15s"))
+	deadline := time.Now().Add(timeout)
+	client, err := ecr.ecrClient()
+	if err != nil {
+		return nil, err
+	}
+	id := imageID(digest)
+	started := false
+	for {
+		result, err := ecr.scanFindings(client, digest)
+		status := "PENDING"
+		switch {
+		case isAWSError(err, "ScanNotFoundException"):
+			// Without scan on push nothing scans the image; start a basic
+			// scan once. Enhanced scanning starts on its own and rejects it.
+			if !started {
+				started = true
+				if err := ecr.callAWS("ecr start-image-scan", func(ctx context.Context) error {
+					_, err := client.StartImageScan(ctx, &ecrapi.StartImageScanInput{RepositoryName: aws.String(ecr.Config.ECR.Repository), ImageId: &id})
+					return err
+				}); err == nil {
+					fmt.Println("Started a basic scan of " + shortDigest(digest))
+				}
+			}
+		case err != nil:
+			return nil, err
+		default:
+			status = string(result.status.Status)
+			switch status {
+			case "COMPLETE", "ACTIVE":
+				return result.findings, nil
+			case "PENDING", "IN_PROGRESS":
+			default:
+				return nil, withCode(ErrCodeScanFailed, errorf(KeyScanFailed, shortDigest(digest), status, aws.ToString(result.status.Description)))
+			}
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return nil, withCode(ErrCodeScanFailed, errorf(KeyScanTimedOut, shortDigest(digest), timeout, status))
+		}
+		fmt.Printf("Scan of %s: %s\n", shortDigest(digest), status)
+		if err := sleepContext(ecr.context(), interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// scanResult is the status of the scan of an image and, once complete, its
+// findings: those of a basic scan, or the enhanced findings of Amazon
+// Inspector.
+type scanResult struct {
+	status   ecrtypes.ImageScanStatus
+	findings []scanFinding
+}
+
+// scanFindings returns the scan of digest with the findings of every page.
+func (ecr *ECR) scanFindings(client *ecrapi.Client, digest string) (scanResult, error) {
+	var result scanResult
+	id := imageID(digest)
+	pages := ecrapi.NewDescribeImageScanFindingsPaginator(client, &ecrapi.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String(ecr.Config.ECR.Repository),
+		ImageId:        &id,
+	})
+	for pages.HasMorePages() {
+		var page *ecrapi.DescribeImageScanFindingsOutput
+		if err := ecr.callAWS("ecr describe-image-scan-findings", func(ctx context.Context) (err error) {
+			page, err = pages.NextPage(ctx)
+			return err
+		}); err != nil {
+			return scanResult{}, err
+		}
+		if page.ImageScanStatus != nil {
+			result.status = *page.ImageScanStatus
+		}
+		if page.ImageScanFindings != nil {
+			result.findings = append(result.findings, scanFindingsOf(page.ImageScanFindings)...)
+		}
+	}
+	return result, nil
+}
+
+func scanFindingsOf(r *ecrtypes.ImageScanFindings) []scanFinding {
+	var findings []scanFinding
+	for _, f := range r.Findings {
+		finding := scanFinding{ID: aws.ToString(f.Name), Severity: string(f.Severity)}
+		var name, version string
+		for _, a := range f.Attributes {
+			switch aws.ToString(a.Key) {
+			case "package_name":
+				name = aws.ToString(a.Value)
+			case "package_version":
+				version = aws.ToString(a.Value)
+			}
+		}
+		if name != "" {
+			finding.Package = strings.TrimSuffix(name+" "+version, " ")
+		}
+		findings = append(findings, finding)
+	}
+	for _, f := range r.EnhancedFindings {
+		finding := scanFinding{Severity: aws.ToString(f.Severity)}
+		if details := f.PackageVulnerabilityDetails; details != nil {
+			finding.ID = aws.ToString(details.VulnerabilityId)
+			if len(details.VulnerablePackages) > 0 {
+				p := details.VulnerablePackages[0]
+				finding.Package = strings.TrimSuffix(aws.ToString(p.Name)+" "+aws.ToString(p.Version), " ")
+			}
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
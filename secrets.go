@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SecretsPolicy scans the built image for committed secrets before it can be
+// pushed: once in a registry a leaked key has to be rotated, as removing the
+// file in a later layer does not remove it from the image.
+type SecretsPolicy struct {
+	Scan           bool     `mapstructure:"scan"`
+	DisableBuiltin bool     `mapstructure:"disable_builtin"` // only run Commands
+	Commands       []string `mapstructure:"commands"`        // external scanners, one finding per output line
+	MaxFindings    int      `mapstructure:"max_findings"`    // findings tolerated, default 0
+	Allow          []string `mapstructure:"allow"`           // rule names, or path patterns; "dir/" allows a whole directory
+}
+
+// secretFinding is one secret a scanner found.
+type secretFinding struct {
+	Scanner string
+	Rule    string
+	Layer   string
+	Path    string
+	Line    int
+}
+
+func (f secretFinding) String() string {
+	location := f.Path
+	if f.Line > 0 {
+		location += fmt.Sprintf(":%d", f.Line)
+	}
+	if f.Layer != "" {
+		location += " (layer " + f.Layer + ")"
+	}
+	if f.Rule == "" {
+		return f.Scanner + ": " + location
+	}
+	return f.Scanner + ": " + f.Rule + " in " + location
+}
+
+// secretScanner finds secrets in a local image. The builtin scanner is
+// always available; policy.secrets.commands adds external ones.
+type secretScanner interface {
+	name() string
+	scan(ecr *ECR, image string) ([]secretFinding, error)
+}
+
+func (p SecretsPolicy) scanners() []secretScanner {
+	var scanners []secretScanner
+	if !p.DisableBuiltin {
+		scanners = append(scanners, builtinSecretScanner{})
+	}
+	for _, command := range p.Commands {
+		scanners = append(scanners, commandSecretScanner{command})
+	}
+	return scanners
+}
+
+func (p SecretsPolicy) allowed(f secretFinding) bool {
+	for _, pattern := range p.Allow {
+		switch {
+		case pattern == f.Rule:
+			return true
+		case strings.HasSuffix(pattern, "/") && strings.HasPrefix(f.Path, pattern):
+			return true
+		}
+	}
+	return matchesAny(f.Path, p.Allow)
+}
+
+// scanSecrets runs the configured scanners on the image just built and fails
+// when the findings not allowed exceed policy.secrets.max_findings.
+func (ecr *ECR) scanSecrets() error {
+	policy := ecr.Config.Policy.Secrets
+	if !policy.Scan {
+		return nil
+	}
+	if ecr.multiPlatform() {
+		fmt.Println(ColorYellow + "Skipping the secret scan: multi-platform images are not loaded into the local image store" + ColorReset)
+		return nil
+	}
+	image := ecr.Config.Docker.ImageName + ":" + ecr.Config.ECR.ImageTag
+	ecr.stage(ColorCyan, "Scanning "+image+" for secrets")
+	var findings []secretFinding
+	for _, scanner := range policy.scanners() {
+		found, err := scanner.scan(ecr, image)
+		if err != nil {
+			return errorf(KeySecretScannerFailed, scanner.name(), err)
+		}
+		for _, f := range found {
+			if !policy.allowed(f) {
+				findings = append(findings, f)
+			}
+		}
+	}
+	for _, f := range findings {
+		fmt.Println(ColorRed + "✘ " + f.String() + ColorReset)
+	}
+	if len(findings) > policy.MaxFindings {
+		return withCode(ErrCodePolicyViolation, fmt.Errorf("%d possible secret(s) in %s (policy.secrets.max_findings is %d); remove them from the build or list them in policy.secrets.allow",
+			len(findings), image, policy.MaxFindings))
+	}
+	fmt.Printf(ColorGreen+"Secret scan passed (%d finding(s), %d allowed)"+ColorReset+"\n", len(findings), policy.MaxFindings)
+	return nil
+}
+
+// secretRules are the patterns of the builtin scanner.
+var secretRules = []struct {
+	Name    string
+	Pattern *regexp.Regexp
+}{
+	{"aws-access-key-id", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-access-key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+]{40}([^A-Za-z0-9/+]|$)`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN ((RSA|EC|DSA|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`)},
+	{"github-token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"gitlab-token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20}\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{"npm-token", regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`)},
+	{"docker-auth", regexp.MustCompile(`"auth"\s*:\s*"[A-Za-z0-9+/]{16,}={0,2}"`)},
+}
+
+// maxScannedFile is the largest file the builtin scanner reads; secrets live
+// in configuration and source files, not in large binaries.
+const maxScannedFile = 1 << 20
+
+// builtinSecretScanner matches secretRules against the text files of every
+// layer of the image, as exported by docker save, deleted files included.
+type builtinSecretScanner struct{}
+
+func (builtinSecretScanner) name() string { return "builtin" }
+
+func (builtinSecretScanner) scan(ecr *ECR, image string) ([]secretFinding, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	archive, err := cli.ImageSave(ecr.context(), []string{image})
+	if err != nil {
+		return nil, classify(ErrCodeDockerUnavailable, "", errorf(KeyImageExportFailed, err))
+	}
+	defer archive.Close()
+
+	// Layers are the tar files inside the archive, <id>/layer.tar or
+	// blobs/sha256/<digest> depending on the Docker version; the other
+	// entries (configs, manifests) are not tars and are skipped.
+	var findings []secretFinding
+	outer := tar.NewReader(archive)
+	for {
+		header, err := outer.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errorf(KeyImageExportReadFailed, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		layer := path.Base(path.Dir(header.Name))
+		if strings.HasPrefix(header.Name, "blobs/") {
+			layer = path.Base(header.Name)
+		}
+		if len(layer) > 12 {
+			layer = layer[:12]
+		}
+		found, err := scanLayer(tar.NewReader(outer), layer)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+// scanLayer scans the files of one layer. A reader that is not a tar gives
+// no findings.
+func scanLayer(layer *tar.Reader, id string) ([]secretFinding, error) {
+	var findings []secretFinding
+	for {
+		header, err := layer.Next()
+		if err != nil {
+			return findings, nil // the end of the layer, or not a layer
+		}
+		if header.Typeflag != tar.TypeReg || header.Size == 0 || header.Size > maxScannedFile {
+			continue
+		}
+		data, err := io.ReadAll(layer)
+		if err != nil {
+			return nil, errorf(KeyLayerFileReadFailed, header.Name, id, err)
+		}
+		if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			continue // binary
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		for number, line := range bytes.Split(data, []byte("\n")) {
+			for _, rule := range secretRules {
+				if rule.Pattern.Match(line) {
+					findings = append(findings, secretFinding{Scanner: "builtin", Rule: rule.Name, Layer: id, Path: name, Line: number + 1})
+				}
+			}
+		}
+	}
+}
+
+// commandSecretScanner runs an external scanner such as trufflehog or
+// gitleaks with PUSHECR_LOCAL_IMAGE set; every line it prints is a finding.
+type commandSecretScanner struct {
+	command string
+}
+
+func (s commandSecretScanner) name() string { return s.command }
+
+func (s commandSecretScanner) scan(ecr *ECR, image string) ([]secretFinding, error) {
+	cmd := shellCommand(ecr.context(), s.command)
+	cmd.Env = append(os.Environ(), "PUSHECR_LOCAL_IMAGE="+image)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = ecr.output(os.Stderr)
+	err := cmd.Run()
+	var findings []secretFinding
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			findings = append(findings, secretFinding{Scanner: strings.Fields(s.command)[0], Path: line})
+		}
+	}
+	// Scanners commonly exit with an error when they find something; only a
+	// failure without findings is an error.
+	if err != nil && len(findings) == 0 {
+		return nil, err
+	}
+	return findings, nil
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"google.golang.org/grpc"
+)
+
+type ServeConfig struct {
+	Listen        string      `mapstructure:"listen"`
+	GRPCListen    string      `mapstructure:"grpc_listen"`
+	Slack         SlackConfig `mapstructure:"slack"`
+	WebhookSecret string      `mapstructure:"webhook_secret"`
+	APITokens     []string    `mapstructure:"api_tokens"`
+	History       int         `mapstructure:"history"`
+	Jobs          []ServeJob  `mapstructure:"jobs"`
+}
+
+type ServeJob struct {
+	Name                 string `mapstructure:"name"`
+	Profile              string `mapstructure:"profile"`
+	Schedule             string `mapstructure:"schedule"`
+	RebuildIfBaseUpdated bool   `mapstructure:"rebuild_if_base_updated"`
+}
+
+const (
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+)
+
+// runRecord is the outcome of one pipeline execution started by the daemon.
+type runRecord struct {
+	ID         string       `json:"id"`
+	Job        string       `json:"job,omitempty"`
+	Profile    string       `json:"profile"`
+	Trigger    string       `json:"trigger"`
+	User       string       `json:"user,omitempty"`
+	Status     string       `json:"status"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	ErrorCode  ErrorCode    `json:"error_code,omitempty"`
+	ErrorKey   ErrorKey     `json:"error_key,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Overrides  *overrides   `json:"overrides,omitempty"`
+	Stages     []stageEvent `json:"stages,omitempty"`
+
+	ecr  *ECR
+	done chan struct{} // closed once the final status is recorded
+}
+
+// server runs scheduled and webhook-triggered jobs one at a time and keeps an
+// in-memory history of the most recent runs.
+type server struct {
+	config  *Config
+	history int
+
+	mu   sync.Mutex
+	runs []*runRecord
+
+	exec sync.Mutex
+}
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	listen := fs.String("listen", "", "Address to listen on (default serve.listen, or :8080)")
+	grpcListen := fs.String("grpc-listen", "", "Address for the gRPC API (default serve.grpc_listen; disabled if empty)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s serve [-config deploy.yml] [-listen :8080]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	exitOnError("Error loading configuration", err)
+	exitOnError("Tool requirements not met", config.Tools.check())
+
+	s := &server{config: config, history: config.Serve.History}
+	if s.history <= 0 {
+		s.history = 100
+	}
+
+	scheduler := cron.New()
+	for _, job := range config.Serve.Jobs {
+		if _, ok := config.Profiles[job.Profile]; !ok {
+			exitOnError("Invalid configuration", withCode(ErrCodeProfileNotFound, fmt.Errorf("job '%s': profile '%s' not found in configuration", job.Name, job.Profile)))
+		}
+		if job.Schedule == "" {
+			continue
+		}
+		job := job
+		if _, err := scheduler.AddFunc(job.Schedule, func() { s.trigger(job.Name, job.Profile, "schedule", "", nil) }); err != nil {
+			exitOnError("Invalid configuration", withCode(ErrCodeConfigInvalid, fmt.Errorf("job '%s': invalid schedule '%s': %w", job.Name, job.Schedule, err)))
+		}
+		fmt.Printf(ColorCyan+"Scheduled job '%s' (profile %s): %s"+ColorReset+"\n", job.Name, job.Profile, job.Schedule)
+	}
+
+	addr := orDefault(*listen, orDefault(config.Serve.Listen, ":8080"))
+	grpcAddr := orDefault(*grpcListen, config.Serve.GRPCListen)
+	for _, a := range []string{addr, grpcAddr} {
+		if a != "" {
+			exitOnError("Invalid configuration", config.Serve.checkExposure(a))
+		}
+	}
+	httpServer := &http.Server{Addr: addr, Handler: s.routes()}
+
+	scheduler.Start()
+	go func() {
+		fmt.Println(ColorGreen + "pushecr serve listening on " + addr + ColorReset)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			exitOnError("Server failed", err)
+		}
+	}()
+
+	var grpcServer *grpc.Server
+	if addr := grpcAddr; addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		exitOnError("Server failed", err)
+		grpcServer = s.grpcServer()
+		go func() {
+			fmt.Println(ColorGreen + "pushecr gRPC API listening on " + addr + ColorReset)
+			if err := grpcServer.Serve(listener); err != nil {
+				exitOnError("Server failed", err)
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	fmt.Println(ColorYellow + "Shutting down, waiting for running jobs" + ColorReset)
+	<-scheduler.Stop().Done()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	httpServer.Shutdown(ctx)
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	s.exec.Lock()
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /{$}", s.authorize(s.handleDashboard))
+	mux.HandleFunc("GET /ui/runs/{id}", s.authorize(s.handleDashboardRun))
+	mux.HandleFunc("GET /ui/repositories", s.authorize(s.handleDashboardRepositories))
+	mux.HandleFunc("GET /runs", s.authorize(s.handleRuns))
+	mux.HandleFunc("GET /runs/{id}", s.authorize(s.handleRun))
+	mux.HandleFunc("GET /runs/{id}/logs", s.authorize(s.handleRunLogs))
+	mux.HandleFunc("POST /build", s.authorize(s.handleBuild))
+	mux.HandleFunc("POST /hooks/{job}", s.handleHook)
+	mux.HandleFunc("POST /slack", s.handleSlack)
+	return mux
+}
+
+// authorize requires a bearer token from serve.api_tokens. Without tokens
+// configured, which serve only allows on a loopback address (see
+// checkExposure), the read-only endpoints stay open and POST /build is
+// disabled.
+func (s *server) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch s.checkToken(r.Header.Get("Authorization"), r.Method != http.MethodGet) {
+		case errAPIDisabled:
+			http.Error(w, errAPIDisabled.Error(), http.StatusForbidden)
+		case errUnauthorized:
+			w.Header().Add("WWW-Authenticate", "Bearer")
+			w.Header().Add("WWW-Authenticate", `Basic realm="pushecr"`)
+			http.Error(w, errUnauthorized.Error(), http.StatusUnauthorized)
+		default:
+			next(w, r)
+		}
+	}
+}
+
+var (
+	errAPIDisabled  = errors.New("the API is disabled (serve.api_tokens is not set)")
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// checkToken validates an "Authorization: Bearer <token>" value against
+// serve.api_tokens. Basic auth with the token as password is accepted too so
+// the dashboard works from a browser. Without tokens configured only reads
+// are allowed.
+func (s *server) checkToken(authorization string, mutating bool) error {
+	tokens := s.config.Serve.tokens()
+	if len(tokens) == 0 {
+		if mutating {
+			return errAPIDisabled
+		}
+		return nil
+	}
+
+	given, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		r := http.Request{Header: http.Header{"Authorization": {authorization}}}
+		_, given, ok = r.BasicAuth()
+	}
+	for _, token := range tokens {
+		if ok && hmac.Equal([]byte(given), []byte(token)) {
+			return nil
+		}
+	}
+	return errUnauthorized
+}
+
+// tokens returns serve.api_tokens with environment variables expanded,
+// leaving out the empty ones.
+func (c ServeConfig) tokens() []string {
+	var tokens []string
+	for _, token := range c.APITokens {
+		if token = os.ExpandEnv(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// checkExposure refuses to serve the API on addr without serve.api_tokens
+// unless addr is a loopback address: without tokens the runs, their logs and
+// the dashboard can be read by anyone who reaches the port.
+func (c ServeConfig) checkExposure(addr string) error {
+	if len(c.tokens()) > 0 {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return withCode(ErrCodeConfigInvalid, fmt.Errorf("invalid listen address '%s': %w", addr, err))
+	}
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return withCode(ErrCodeConfigInvalid, fmt.Errorf("serve.api_tokens is required to listen on %s, which is not a loopback address: "+
+		"without tokens anyone who reaches it can read the runs and their logs (listen on 127.0.0.1 for local use)", addr))
+}
+
+// handleBuild starts a run of a profile with optional overrides:
+//
+//	{"profile": "prod", "overrides": {"image_tag": "v1.4.2"}}
+func (s *server) handleBuild(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Profile   string     `json:"profile"`
+		Overrides *overrides `json:"overrides"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&request); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.config.Profiles[request.Profile]; !ok {
+		http.Error(w, fmt.Sprintf("profile '%s' not found in configuration", request.Profile), http.StatusNotFound)
+		return
+	}
+	run := s.trigger("", request.Profile, "api", "", request.Overrides)
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func (s *server) handleRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.run(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleRunLogs streams the log of a run as plain text until it finishes.
+func (s *server) handleRunLogs(w http.ResponseWriter, r *http.Request) {
+	logs := s.logs(r.PathValue("id"))
+	if logs == nil {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+	offset := 0
+	for {
+		data, done, changed := logs.next(offset)
+		if len(data) > 0 {
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			offset += len(data)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// run returns a snapshot of the run with the given ID.
+func (s *server) run(id string) (runRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs {
+		if run.ID == id {
+			return run.snapshot(), true
+		}
+	}
+	return runRecord{}, false
+}
+
+// logs returns the log of the run with the given ID, or nil.
+func (s *server) logs(id string) *runLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs {
+		if run.ID == id {
+			return &run.ecr.logs
+		}
+	}
+	return nil
+}
+
+// snapshot copies the record so it can be used without holding s.mu.
+func (r *runRecord) snapshot() runRecord {
+	c := *r
+	c.Stages = append([]stageEvent(nil), r.Stages...)
+	return c
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+func (s *server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.list())
+}
+
+// list returns snapshots of the runs in history, most recent first.
+func (s *server) list() []runRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]runRecord, 0, len(s.runs))
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		runs = append(runs, s.runs[i].snapshot())
+	}
+	return runs
+}
+
+// handleHook triggers a job. Webhooks are disabled unless serve.webhook_secret
+// is set; requests must carry an HMAC-SHA256 of the body in
+// X-Pushecr-Signature (or GitHub's X-Hub-Signature-256) as "sha256=<hex>".
+func (s *server) handleHook(w http.ResponseWriter, r *http.Request) {
+	secret := os.ExpandEnv(s.config.Serve.WebhookSecret)
+	if secret == "" {
+		http.Error(w, "webhooks are disabled (serve.webhook_secret is not set)", http.StatusForbidden)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	signature := r.Header.Get("X-Pushecr-Signature")
+	if signature == "" {
+		signature = r.Header.Get("X-Hub-Signature-256")
+	}
+	if !validSignature(secret, body, signature) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	name := r.PathValue("job")
+	for _, job := range s.config.Serve.Jobs {
+		if job.Name == name {
+			writeJSON(w, http.StatusAccepted, s.trigger(job.Name, job.Profile, "webhook", "", nil))
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("job '%s' not found", name), http.StatusNotFound)
+}
+
+func validSignature(secret string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// trigger records a new run of profile and executes it in the background.
+// user names who asked for the run when it is not the server itself.
+func (s *server) trigger(job, profile, trigger, user string, o *overrides) runRecord {
+	run := &runRecord{
+		ID:        newRunID(),
+		Job:       job,
+		Profile:   profile,
+		Trigger:   trigger,
+		User:      user,
+		Status:    runRunning,
+		StartedAt: time.Now().UTC(),
+		Overrides: o,
+		ecr:       &ECR{Profile: profile, actor: user, apiMode: true},
+		done:      make(chan struct{}),
+	}
+	for _, j := range s.config.Serve.Jobs {
+		if j.Name == job && job != "" {
+			run.ecr.rebuildIfBaseUpdated = j.RebuildIfBaseUpdated
+		}
+	}
+	run.ecr.onStage = func(event stageEvent) {
+		s.mu.Lock()
+		run.Stages = append(run.Stages, event)
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.runs = append(s.runs, run)
+	if len(s.runs) > s.history {
+		s.runs = s.runs[len(s.runs)-s.history:]
+	}
+	snapshot := run.snapshot()
+	s.mu.Unlock()
+
+	go s.execute(run)
+	return snapshot
+}
+
+func (s *server) execute(run *runRecord) {
+	s.exec.Lock()
+	defer s.exec.Unlock()
+	// Followers treat a closed log as the end of the run, so it is closed
+	// only after the final status has been recorded.
+	defer run.ecr.logs.Close()
+
+	fmt.Printf(ColorCyan+"Run %s: profile %s (%s)"+ColorReset+"\n", run.ID, run.Profile, run.Trigger)
+	err := runProfile(s.config, run.ecr, run.Overrides)
+	recordRun(s.config.History, newRunEntry(run.ID, "serve:"+run.Trigger, run.ecr, run.StartedAt, err))
+	recordDeployment(s.config.Manifest, run.ecr, err)
+
+	s.mu.Lock()
+	defer close(run.done)
+	defer s.mu.Unlock()
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	if err != nil {
+		run.Status = runFailed
+		run.Error = err.Error()
+		run.ErrorCode = errorCode(err)
+		run.ErrorKey = errorKey(err)
+		fmt.Printf(ColorRed+"Run %s failed: %v"+ColorReset+"\n", run.ID, err)
+		return
+	}
+	run.Status = runSucceeded
+	if run.ecr.upToDate {
+		fmt.Printf(ColorGreen+"Run %s: base images unchanged, nothing to rebuild"+ColorReset+"\n", run.ID)
+		return
+	}
+	fmt.Printf(ColorGreen+"Run %s succeeded"+ColorReset+"\n", run.ID)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckExposure(t *testing.T) {
+	for _, test := range []struct {
+		addr   string
+		tokens []string
+		ok     bool
+	}{
+		{"127.0.0.1:8080", nil, true},
+		{"[::1]:8080", nil, true},
+		{"localhost:8080", nil, true},
+		{":8080", nil, false},
+		{"0.0.0.0:8080", nil, false},
+		{"10.0.0.5:9090", nil, false},
+		{"10.0.0.5:9090", []string{"${PUSHECR_TEST_UNSET_TOKEN}"}, false},
+		{":8080", []string{"secret"}, true},
+		{"8080", nil, false},
+	} {
+		err := ServeConfig{APITokens: test.tokens}.checkExposure(test.addr)
+		if (err == nil) != test.ok {
+			t.Errorf("checkExposure(%q) with tokens %v = %v, want ok %v", test.addr, test.tokens, err, test.ok)
+		}
+		if err != nil && errorCode(err) != ErrCodeConfigInvalid {
+			t.Errorf("checkExposure(%q) code = %s, want %s", test.addr, errorCode(err), ErrCodeConfigInvalid)
+		}
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	const secret, body = "hook-secret", `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	signed := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, test := range []struct {
+		name   string
+		secret string
+		header string
+		value  string
+		status int
+	}{
+		// A valid signature reaches the job lookup; the job does not exist so
+		// no run starts.
+		{"pushecr header", secret, "X-Pushecr-Signature", signed, http.StatusNotFound},
+		{"GitHub header", secret, "X-Hub-Signature-256", signed, http.StatusNotFound},
+		{"no sha256= prefix", secret, "X-Pushecr-Signature", strings.TrimPrefix(signed, "sha256="), http.StatusNotFound},
+		{"other secret", "other", "X-Pushecr-Signature", signed, http.StatusUnauthorized},
+		{"not hex", secret, "X-Pushecr-Signature", "sha256=zz", http.StatusUnauthorized},
+		{"no signature", secret, "", "", http.StatusUnauthorized},
+		{"webhooks disabled", "", "X-Pushecr-Signature", signed, http.StatusForbidden},
+	} {
+		s := &server{config: &Config{Serve: ServeConfig{WebhookSecret: test.secret}}}
+		r := httptest.NewRequest(http.MethodPost, "/hooks/unknown", strings.NewReader(body))
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, w.Code, test.status)
+		}
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	t.Setenv("PUSHECR_TEST_API_TOKEN", "env-token")
+	tokens := []string{"token-1", "${PUSHECR_TEST_API_TOKEN}"}
+
+	for _, test := range []struct {
+		name          string
+		tokens        []string
+		method, path  string
+		authorization string
+		status        int
+	}{
+		{"bearer token", tokens, http.MethodGet, "/runs", "Bearer token-1", http.StatusOK},
+		{"token from the environment", tokens, http.MethodGet, "/runs", "Bearer env-token", http.StatusOK},
+		{"basic auth", tokens, http.MethodGet, "/runs/unknown/logs", "Basic dXNlcjp0b2tlbi0x", http.StatusNotFound},
+		{"no token", tokens, http.MethodGet, "/runs", "", http.StatusUnauthorized},
+		{"wrong token", tokens, http.MethodGet, "/runs/unknown", "Bearer token-2", http.StatusUnauthorized},
+		{"token prefix", tokens, http.MethodGet, "/runs", "Bearer token-", http.StatusUnauthorized},
+		{"unexpanded variable", tokens, http.MethodGet, "/runs", "Bearer ${PUSHECR_TEST_API_TOKEN}", http.StatusUnauthorized},
+		// A valid token reaches the profile lookup; the profile does not
+		// exist so no run starts.
+		{"build", tokens, http.MethodPost, "/build", "Bearer token-1", http.StatusNotFound},
+		{"build without token", tokens, http.MethodPost, "/build", "", http.StatusUnauthorized},
+		{"reads without tokens", nil, http.MethodGet, "/runs", "", http.StatusOK},
+		{"build without tokens", nil, http.MethodPost, "/build", "Bearer token-1", http.StatusForbidden},
+	} {
+		s := &server{config: &Config{Serve: ServeConfig{APITokens: test.tokens}}}
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(`{"profile": "missing"}`))
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: %s %s status %d, want %d", test.name, test.method, test.path, w.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SignConfig signs the pushed image in the sign stage, after the scan, so
+// only images that passed the scan gate carry a signature.
+type SignConfig struct {
+	Cosign CosignSignConfig `mapstructure:"cosign"`
+}
+
+// CosignSignConfig signs with cosign using exactly one of a key file, an AWS
+// KMS key or a keyless certificate of the CI's OIDC identity. The signature
+// is stored next to the image in its ECR repository.
+type CosignSignConfig struct {
+	Key       string `mapstructure:"key"`         // private key file, its password in COSIGN_PASSWORD
+	KMSKeyARN string `mapstructure:"kms_key_arn"` // key ARN, or alias/<name> in ecr.region
+	Keyless   bool   `mapstructure:"keyless"`     // Fulcio certificate of the ambient OIDC token
+
+	// SkipTLog does not upload the signature to the public Rekor
+	// transparency log, which would publish the digest of a private image.
+	// Keyless signatures cannot skip it.
+	SkipTLog bool `mapstructure:"skip_tlog"`
+}
+
+func (c CosignSignConfig) enabled() bool {
+	return c.Key != "" || c.KMSKeyARN != "" || c.Keyless
+}
+
+func (c SignConfig) validate(public bool) error {
+	s := c.Cosign
+	if !s.enabled() {
+		return nil
+	}
+	set := 0
+	for _, on := range []bool{s.Key != "", s.KMSKeyARN != "", s.Keyless} {
+		if on {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("sign.cosign takes only one of key, kms_key_arn and keyless")
+	}
+	if s.KMSKeyARN != "" && !strings.HasPrefix(s.KMSKeyARN, "arn:") && !strings.HasPrefix(s.KMSKeyARN, "alias/") {
+		return fmt.Errorf("sign.cosign.kms_key_arn must be a KMS key ARN or alias/<name>, got '%s'", s.KMSKeyARN)
+	}
+	if s.Keyless && s.SkipTLog {
+		return fmt.Errorf("sign.cosign.skip_tlog cannot be used with keyless signing, which is verified against the transparency log")
+	}
+	if public {
+		return fmt.Errorf("sign.cosign is not supported by ECR Public (ecr.public), which does not store signatures")
+	}
+	return nil
+}
+
+// keyRef returns the --key of cosign sign, or "" for keyless signing.
+func (c CosignSignConfig) keyRef() string {
+	if c.KMSKeyARN != "" {
+		return "awskms:///" + c.KMSKeyARN
+	}
+	return c.Key
+}
+
+// pushedDigest returns the digest of the pushed image, looking up
+// ecr.image_tag when the push did not record it.
+func (ecr *ECR) pushedDigest() (string, error) {
+	if ecr.Digest != "" {
+		return ecr.Digest, nil
+	}
+	digest, err := ecr.imageDigest(ecr.Config.ECR.ImageTag)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		return "", withCode(ErrCodeImageNotFound, errorf(KeyImageNotFound, ecr.Config.ECR.ImageTag, ecr.Config.ECR.Repository))
+	}
+	return digest, nil
+}
+
+// signImage signs the digest of the pushed image with cosign, in the profile's
+// repository and the repository of every replica region, which each keep
+// their own copy of the signature.
+func (ecr *ECR) signImage() error {
+	c := ecr.Config.Sign.Cosign
+	if !c.enabled() {
+		return nil
+	}
+	digest, err := ecr.pushedDigest()
+	if err != nil {
+		return err
+	}
+	refs := []string{ecr.repositoryURI() + "@" + digest}
+	for _, replica := range ecr.replicas() {
+		refs = append(refs, replica.repositoryURI()+"@"+digest)
+	}
+	if err := checkWritable("cosign sign " + strings.Join(refs, " ")); err != nil {
+		return err
+	}
+	for _, registry := range append([]*ECR{ecr}, ecr.replicas()...) {
+		if err := registry.dockerLogin(); err != nil {
+			return err
+		}
+	}
+
+	method := "keyless"
+	if c.Key != "" || c.KMSKeyARN != "" {
+		method = c.keyRef()
+	}
+	ecr.stage(ColorCyan, "Signing "+shortDigest(digest)+" with cosign ("+method+")")
+	cosignArgs := []string{"sign", "--yes"}
+	if key := c.keyRef(); key != "" {
+		cosignArgs = append(cosignArgs, "--key", key)
+	}
+	if c.SkipTLog {
+		cosignArgs = append(cosignArgs, "--tlog-upload=false")
+	}
+	cmd := exec.CommandContext(ecr.context(), "cosign", append(cosignArgs, refs...)...)
+	if c.KMSKeyARN != "" {
+		// cosign reaches KMS with the profile's AWS credentials.
+		env, err := ecr.awsEnv()
+		if err != nil {
+			return err
+		}
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = append(env, "AWS_REGION="+ecr.Config.ECR.Region)
+	}
+	var stderr strings.Builder
+	cmd.Stdout = ecr.output(os.Stdout)
+	cmd.Stderr = ecr.output(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			err = fmt.Errorf("%s", line)
+		}
+		return withCode(ErrCodeSignFailed, errorf(KeySignFailed, err))
+	}
+	for _, ref := range refs {
+		fmt.Println(ColorGreen + "Signed " + ref + ColorReset)
+	}
+	return nil
+}
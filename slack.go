@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlackConfig enables chatops from Slack: a slash command (or buttons whose
+// value is a command) pointed at POST /slack on the daemon. Only the users
+// listed can run commands, each limited to some actions and profiles.
+type SlackConfig struct {
+	SigningSecret string      `mapstructure:"signing_secret"`
+	Users         []SlackUser `mapstructure:"users"`
+}
+
+type SlackUser struct {
+	ID       string   `mapstructure:"id"`       // Slack member ID, e.g. U012ABCDEF
+	Name     string   `mapstructure:"name"`     // recorded as the user of the run
+	Actions  []string `mapstructure:"actions"`  // deploy, promote
+	Profiles []string `mapstructure:"profiles"` // empty for every profile
+}
+
+const slackUsage = "Usage: `/pushecr deploy <profile> [image_tag]` or `/pushecr promote <profile> <from> <to>`"
+
+// slackMaxSkew is how old a request timestamp may be, to reject replays.
+const slackMaxSkew = 5 * time.Minute
+
+// handleSlack runs a slash command or an interactive button. Slack needs an
+// answer within three seconds, so the work is done in the background and the
+// outcome is posted to the request's response_url.
+func (s *server) handleSlack(w http.ResponseWriter, r *http.Request) {
+	secret := os.ExpandEnv(s.config.Serve.Slack.SigningSecret)
+	if secret == "" {
+		http.Error(w, "Slack is disabled (serve.slack.signing_secret is not set)", http.StatusForbidden)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validSlackSignature(secret, r.Header.Get("X-Slack-Request-Timestamp"), body, r.Header.Get("X-Slack-Signature")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, text, responseURL := form.Get("user_id"), form.Get("text"), form.Get("response_url")
+	if payload := form.Get("payload"); payload != "" {
+		var action struct {
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+			Actions []struct {
+				Value string `json:"value"`
+			} `json:"actions"`
+			ResponseURL string `json:"response_url"`
+		}
+		if err := json.Unmarshal([]byte(payload), &action); err != nil || len(action.Actions) == 0 {
+			http.Error(w, "invalid interactive payload", http.StatusBadRequest)
+			return
+		}
+		userID, text, responseURL = action.User.ID, action.Actions[0].Value, action.ResponseURL
+	}
+
+	writeJSON(w, http.StatusOK, s.slackCommand(userID, strings.Fields(text), responseURL))
+}
+
+// slackMessage is a message in Slack's response format.
+type slackMessage struct {
+	ResponseType string `json:"response_type"` // in_channel or ephemeral
+	Text         string `json:"text"`
+}
+
+func ephemeral(format string, args ...interface{}) slackMessage {
+	return slackMessage{ResponseType: "ephemeral", Text: fmt.Sprintf(format, args...)}
+}
+
+// slackCommand checks that userID may run the command and starts it.
+func (s *server) slackCommand(userID string, args []string, responseURL string) slackMessage {
+	if len(args) < 2 {
+		return ephemeral(slackUsage)
+	}
+	action, profile := args[0], args[1]
+	if (action != "deploy" || len(args) > 3) && (action != "promote" || len(args) != 4) {
+		return ephemeral(slackUsage)
+	}
+	user, ok := s.slackUser(userID)
+	if !ok {
+		return ephemeral("You are not allowed to use pushecr (add your member ID %s to serve.slack.users)", userID)
+	}
+	if !contains(user.Actions, action) || (len(user.Profiles) > 0 && !contains(user.Profiles, profile)) {
+		return ephemeral("You are not allowed to %s profile %s", action, profile)
+	}
+	profileConfig, err := s.config.profile(profile)
+	if err != nil {
+		return ephemeral("%v", err)
+	}
+	actor := orDefault(user.Name, "slack:"+user.ID)
+
+	switch action {
+	case "deploy":
+		var o *overrides
+		if len(args) == 3 {
+			o = &overrides{ImageTag: args[2]}
+		}
+		run := s.trigger("", profile, "slack", actor, o)
+		go func() {
+			<-run.done
+			final, _ := s.run(run.ID)
+			text := fmt.Sprintf(":white_check_mark: Run `%s` of %s succeeded", final.ID, profile)
+			if final.Status == runFailed {
+				text = fmt.Sprintf(":x: Run `%s` of %s failed: %s", final.ID, profile, final.Error)
+			}
+			postSlack(responseURL, text)
+		}()
+		return slackMessage{ResponseType: "in_channel", Text: fmt.Sprintf("<@%s> started run `%s` of %s", userID, run.ID, profile)}
+
+	default:
+		from, to := args[2], args[3]
+		go func() {
+			ecr := &ECR{Profile: profile, Config: profileConfig, actor: actor}
+			text := fmt.Sprintf(":white_check_mark: %s: channel %s promoted to %s", profile, from, to)
+			if err := ecr.promote(from, to); err != nil {
+				text = fmt.Sprintf(":x: %s: promotion of %s to %s failed: %v", profile, from, to, err)
+			}
+			postSlack(responseURL, text)
+		}()
+		return slackMessage{ResponseType: "in_channel", Text: fmt.Sprintf("<@%s> is promoting %s to %s on %s", userID, from, to, profile)}
+	}
+}
+
+func (s *server) slackUser(id string) (SlackUser, bool) {
+	for _, user := range s.config.Serve.Slack.Users {
+		if user.ID == id && id != "" {
+			return user, true
+		}
+	}
+	return SlackUser{}, false
+}
+
+// validSlackSignature checks Slack's v0 request signature: an HMAC-SHA256 of
+// "v0:<timestamp>:<body>" sent as "v0=<hex>".
+func validSlackSignature(secret, timestamp string, body []byte, signature string) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(seconds, 0)).Abs() > slackMaxSkew {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "v0="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// postSlack posts a follow-up message to a response_url. Failures are only
+// logged: the command itself already ran.
+func postSlack(responseURL, text string) {
+	if responseURL == "" {
+		return
+	}
+	body, _ := json.Marshal(slackMessage{ResponseType: "in_channel", Text: text})
+	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = errorf(KeySlackBadResponse, resp.Status)
+		}
+	}
+	if err != nil {
+		fmt.Println(ColorYellow + "Could not post to Slack: " + err.Error() + ColorReset)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// slackSignature signs body like Slack does for a request sent at timestamp.
+func slackSignature(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSlackSignature(t *testing.T) {
+	const secret, body = "8f742231b10e8888abcd99yyyzzz85a5", "token=xyz&command=%2Fpushecr&text=deploy+prod"
+	at := func(offset time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(offset).Unix(), 10)
+	}
+	now := at(0)
+
+	for _, test := range []struct {
+		name      string
+		timestamp string
+		body      string
+		signature string
+		want      bool
+	}{
+		{"valid", now, body, slackSignature(secret, now, body), true},
+		{"within the skew", at(-4 * time.Minute), body, slackSignature(secret, at(-4*time.Minute), body), true},
+		{"replayed", at(-6 * time.Minute), body, slackSignature(secret, at(-6*time.Minute), body), false},
+		{"from the future", at(6 * time.Minute), body, slackSignature(secret, at(6*time.Minute), body), false},
+		{"other secret", now, body, slackSignature("other", now, body), false},
+		{"tampered body", now, body + "&x=1", slackSignature(secret, now, body), false},
+		{"other timestamp", now, body, slackSignature(secret, at(-time.Minute), body), false},
+		{"timestamp not a number", "now", body, slackSignature(secret, "now", body), false},
+		{"signature not hex", now, body, "v0=zz", false},
+		{"no signature", now, body, "", false},
+	} {
+		if got := validSlackSignature(secret, test.timestamp, []byte(test.body), test.signature); got != test.want {
+			t.Errorf("%s: validSlackSignature() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Labels recording where an image was built from. The source and revision
+// are the standard OCI annotations; OCI has no key for the branch.
+const (
+	labelSource   = "org.opencontainers.image.source"
+	labelRevision = "org.opencontainers.image.revision"
+	labelBranch   = "xyz.lpmg.pushecr.branch"
+)
+
+// sourceLabels returns the git origin, commit and branch of the working
+// directory as image labels. Outside a git repository it is empty.
+func sourceLabels() map[string]string {
+	labels := map[string]string{}
+	if source := normalizeGitURL(git("config", "--get", "remote.origin.url")); source != "" {
+		labels[labelSource] = source
+	}
+	if revision := git("rev-parse", "HEAD"); revision != "" {
+		labels[labelRevision] = revision
+	}
+	if branch := git("rev-parse", "--abbrev-ref", "HEAD"); branch != "" && branch != "HEAD" {
+		labels[labelBranch] = branch
+	}
+	return labels
+}
+
+// sourceLabelArgs returns the --label flags for sourceLabels.
+func sourceLabelArgs() []string {
+	labels := sourceLabels()
+	var args []string
+	for _, key := range sortedKeys(labels) {
+		args = append(args, "--label", key+"="+labels[key])
+	}
+	return args
+}
+
+// normalizeGitURL turns the forms a git remote can take (scp-like ssh,
+// ssh://, https with credentials, with or without .git) into
+// https://host/path, so the same repository always compares equal.
+func normalizeGitURL(url string) string {
+	url = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(url), "/"), ".git")
+	var hostPath string
+	if scheme, rest, ok := strings.Cut(url, "://"); ok {
+		if scheme == "file" {
+			return ""
+		}
+		hostPath = rest
+		if at := strings.Index(hostPath, "@"); at >= 0 && at < strings.Index(hostPath+"/", "/") {
+			hostPath = hostPath[at+1:] // drop credentials
+		}
+	} else if host, path, ok := strings.Cut(url, ":"); ok && len(host) > 1 && !strings.ContainsAny(host, `/\`) {
+		// scp-like syntax: [user@]host:path
+		if _, h, ok := strings.Cut(host, "@"); ok {
+			host = h
+		}
+		hostPath = host + "/" + strings.TrimPrefix(path, "/")
+	} else {
+		// A local path: nothing another machine could compare.
+		return ""
+	}
+	host, path, _ := strings.Cut(hostPath, "/")
+	host, _, _ = strings.Cut(host, ":") // drop ports
+	if host == "" || path == "" {
+		return ""
+	}
+	return "https://" + strings.ToLower(host) + "/" + path
+}
+
+// checkSource compares the labels of the image tag currently points to with
+// the source of this build. An image from another git repository means two
+// projects share the ECR repository: depending on tag_guard.source_check the
+// push warns or fails. A different branch only warns.
+func (ecr *ECR) checkSource(tag string) error {
+	mode := ecr.Config.ECR.TagGuard.SourceCheck
+	if mode == "" {
+		return nil
+	}
+	current := sourceLabels()
+	if current[labelSource] == "" {
+		fmt.Println(ColorYellow + "Not in a git repository with an origin remote, skipping the source check" + ColorReset)
+		return nil
+	}
+
+	platform := "linux/" + runtime.GOARCH
+	if platforms := ecr.Config.Docker.Platforms; len(platforms) > 0 {
+		platform = platforms[0]
+	}
+	m, _, err := ecr.resolveManifest(tag, platform)
+	if err == nil {
+		var config *imageConfig
+		if config, err = ecr.fetchConfig(m); err == nil {
+			return ecr.compareSource(tag, config.Config.Labels, current, mode)
+		}
+	}
+	fmt.Println(ColorYellow + "Could not read the labels of tag " + tag + ": " + err.Error() + ColorReset)
+	return nil
+}
+
+func (ecr *ECR) compareSource(tag string, remote, current map[string]string, mode string) error {
+	source := normalizeGitURL(remote[labelSource])
+	if source == "" {
+		fmt.Printf("Tag '%s' has no %s label, skipping the source check\n", tag, labelSource)
+		return nil
+	}
+	if source != current[labelSource] {
+		err := fmt.Errorf("tag '%s' in %s was built from %s, but this build comes from %s: two projects may be sharing the repository",
+			tag, ecr.Config.ECR.Repository, source, current[labelSource])
+		if mode == "fail" {
+			return withCode(ErrCodePolicyViolation, err)
+		}
+		fmt.Println(ColorYellow + "Warning: " + err.Error() + ColorReset)
+		return nil
+	}
+	if branch := remote[labelBranch]; branch != "" && current[labelBranch] != "" && branch != current[labelBranch] {
+		fmt.Printf(ColorYellow+"Warning: tag '%s' was built from branch %s, this build comes from %s"+ColorReset+"\n", tag, branch, current[labelBranch])
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stateDir holds pushecr's local state: run history, audit logs, recorded
+// base image digests, generated files and locks. Several invocations may
+// share it, so every read-modify-write goes through a file lock.
+const stateDir = ".pushecr"
+
+// statePath returns a path inside the state directory.
+func statePath(elem ...string) string {
+	return filepath.Join(append([]string{stateDir}, elem...)...)
+}
+
+// fileLock is an exclusive advisory lock held on an open file.
+type fileLock struct {
+	f *os.File
+}
+
+// lockPath opens (creating it if needed) the lock file at path and locks it,
+// waiting for other holders when wait is set. It returns nil without error
+// when the lock is busy and wait is false.
+func lockPath(path string, wait bool) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockFile(f, wait)
+	if err != nil || !locked {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) unlock() {
+	unlockFile(l.f)
+	l.f.Close()
+}
+
+// withStateLock runs fn holding the named lock of the state directory.
+func withStateLock(name string, fn func() error) error {
+	lock, err := lockPath(statePath("locks", name+".lock"), true)
+	if err != nil {
+		return errorf(KeyStateLockFailed, name, err)
+	}
+	defer lock.unlock()
+	return fn()
+}
+
+// writeFileAtomic replaces path with data through a temporary file, so
+// readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lockRun serializes runs of the same profile in this directory, so two
+// invocations do not overwrite each other's generated files or state.
+func (ecr *ECR) lockRun() (*fileLock, error) {
+	name := "run-" + strings.NewReplacer("/", "_", "\\", "_").Replace(ecr.Profile) + ".lock"
+	path := statePath("locks", name)
+	lock, err := lockPath(path, false)
+	if err == nil && lock == nil {
+		ecr.stage(ColorYellow, "Waiting for another run of profile "+ecr.Profile+" in this directory")
+		lock, err = lockPath(path, true)
+	}
+	if err != nil {
+		return nil, errorf(KeyRunLockFailed, ecr.Profile, err)
+	}
+	return lock, nil
+}
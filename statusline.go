@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// statusLine renders a pipeline run as a single line that is redrawn in
+// place, for embedding pushecr in the output of other tools. Everything the
+// run would normally print goes to a log file instead.
+type statusLine struct {
+	terminal *os.File
+	stderr   *os.File
+	log      *os.File
+	total    int
+	started  time.Time
+
+	mu      sync.Mutex
+	done    int
+	current string
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// startStatusLine redirects stdout and stderr to a log file in logDir and
+// starts drawing the status of ecr's stages on the original stdout.
+func startStatusLine(ecr *ECR, logDir string) (*statusLine, error) {
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s.log", time.Now().Format("20060102-150405"), ecr.Profile)
+	log, err := os.Create(filepath.Join(logDir, name))
+	if err != nil {
+		return nil, errorf(KeyRunLogFailed, err)
+	}
+
+	s := &statusLine{
+		terminal: os.Stdout,
+		stderr:   os.Stderr,
+		log:      log,
+		total:    ecr.plannedStages(),
+		started:  time.Now(),
+		current:  "starting",
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	os.Stdout, os.Stderr = log, log
+	ecr.onStage = s.update
+
+	go func() {
+		defer close(s.stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			s.draw(spinner[frame%len(spinner)])
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+func (s *statusLine) update(event stageEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch event.Status {
+	case runRunning:
+		s.current = event.Stage
+	case runSucceeded:
+		s.done++
+	}
+}
+
+func (s *statusLine) draw(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	percent := 100
+	if s.total > 0 {
+		percent = s.done * 100 / s.total
+	}
+	elapsed := time.Since(s.started).Round(time.Second)
+	fmt.Fprintf(s.terminal, "\r\033[K%s %s (%d/%d) %3d%% %s", prefix, s.current, s.done, s.total, percent, elapsed)
+}
+
+// finish stops redrawing, restores stdout and stderr and leaves a final line
+// with the outcome and the path of the full log.
+func (s *statusLine) finish(err error) {
+	close(s.stop)
+	<-s.stopped
+	os.Stdout, os.Stderr = s.terminal, s.stderr
+	s.log.Close()
+
+	if err != nil {
+		s.draw(ColorRed + "✘" + ColorReset)
+		fmt.Fprintf(s.terminal, " — log: %s\n", s.log.Name())
+		return
+	}
+	s.mu.Lock()
+	s.current = "done"
+	s.mu.Unlock()
+	s.draw(ColorGreen + "✔" + ColorReset)
+	fmt.Fprintf(s.terminal, " — log: %s\n", s.log.Name())
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// repoDrift lists how a target repository differs from its source.
+type repoDrift struct {
+	Missing map[string]string // tag → source digest, tag absent in target
+	Changed map[string]string // tag → source digest, target points elsewhere
+	Extra   []string          // tags only in target, never deleted
+	InSync  int
+}
+
+func (d repoDrift) empty() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0
+}
+
+// drift compares the tags matching patterns (all tags if empty) of src's
+// repository with ecr's.
+func (ecr *ECR) drift(src *ECR, patterns []string) (repoDrift, error) {
+	d := repoDrift{Missing: map[string]string{}, Changed: map[string]string{}}
+	sourceImages, err := src.listImages()
+	if err != nil {
+		return d, err
+	}
+	targetImages, err := ecr.listImages()
+	if err != nil {
+		return d, err
+	}
+
+	source := tagDigests(sourceImages, patterns)
+	target := tagDigests(targetImages, patterns)
+	for tag, digest := range source {
+		switch target[tag] {
+		case digest:
+			d.InSync++
+		case "":
+			d.Missing[tag] = digest
+		default:
+			d.Changed[tag] = digest
+		}
+	}
+	for tag := range target {
+		if _, ok := source[tag]; !ok {
+			d.Extra = append(d.Extra, tag)
+		}
+	}
+	sort.Strings(d.Extra)
+	return d, nil
+}
+
+func tagDigests(images []imageDetail, patterns []string) map[string]string {
+	tags := map[string]string{}
+	for _, image := range images {
+		for _, tag := range image.Tags {
+			if len(patterns) == 0 || matchesAny(tag, patterns) {
+				tags[tag] = image.Digest
+			}
+		}
+	}
+	return tags
+}
+
+// reconcile copies the missing and changed tags of d from src into ecr's
+// repository and returns how many copies failed.
+func (ecr *ECR) reconcile(src *ECR, d repoDrift) int {
+	failed := 0
+	for _, tags := range []map[string]string{d.Missing, d.Changed} {
+		for _, tag := range sortedKeys(tags) {
+			if err := ecr.copyImage(src, tags[tag], tag); err != nil {
+				failed++
+				fmt.Println(ColorRed + "✘ " + tag + ": " + err.Error() + ColorReset)
+				continue
+			}
+			fmt.Println(ColorGreen + "✔ " + tag + " " + shortDigest(tags[tag]) + ColorReset)
+		}
+	}
+	return failed
+}
+
+func (d repoDrift) print() {
+	for _, tag := range sortedKeys(d.Missing) {
+		fmt.Println(ColorYellow + "  missing  " + tag + " " + shortDigest(d.Missing[tag]) + ColorReset)
+	}
+	for _, tag := range sortedKeys(d.Changed) {
+		fmt.Println(ColorYellow + "  changed  " + tag + " → " + shortDigest(d.Changed[tag]) + ColorReset)
+	}
+	for _, tag := range d.Extra {
+		fmt.Println("  extra    " + tag + " (only in target)")
+	}
+	fmt.Printf("%d in sync, %d missing, %d changed, %d only in target\n", d.InSync, len(d.Missing), len(d.Changed), len(d.Extra))
+}
+
+// repoPair loads the source and target profiles of migrate-repo and sync and
+// logs Docker in to both registries, fetching their tokens concurrently.
+func repoPair(configPath, from, to string) (*ECR, *ECR) {
+	source, err := loadProfile(configPath, from)
+	exitOnError("Invalid configuration", err)
+	target, err := loadProfile(configPath, to)
+	exitOnError("Invalid configuration", err)
+	src := &ECR{Profile: from, Config: source}
+	dst := &ECR{Profile: to, Config: target}
+	exitOnError("Authentication failed", prefetchRegistryTokens(src, dst))
+	exitOnError("Authentication failed", src.authenticate())
+	exitOnError("Authentication failed", dst.authenticate())
+	return src, dst
+}
+
+func runSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	from := fs.String("from", "", "Profile whose repository is the source of truth")
+	to := fs.String("to", "", "Profile whose repository is kept in sync")
+	tags := fs.String("tags", "", "Comma-separated glob patterns of tags to sync (default: every tag)")
+	check := fs.Bool("check", false, "Only report drift; exit with an error if the repositories differ")
+	interval := fs.Duration("interval", 0, "Keep running and reconcile at this interval (e.g. 10m)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s sync [-config deploy.yml] -from prod -to prod-dr [-tags 'v*'] [-check] [-interval 10m]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *from == "" || *to == "" {
+		fs.Usage()
+		exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("-from and -to are required")))
+	}
+	var patterns []string
+	if *tags != "" {
+		patterns = strings.Split(*tags, ",")
+	}
+
+	src, dst := repoPair(*configPath, *from, *to)
+	if !*check {
+		exitOnError("Sync refused", checkWritable("sync to "+dst.registry()))
+	}
+
+	syncOnce := func() error {
+		fmt.Printf(ColorCyan+"Comparing %s (%s) → %s (%s)"+ColorReset+"\n", src.Config.ECR.Repository, src.Config.ECR.Region, dst.Config.ECR.Repository, dst.Config.ECR.Region)
+		d, err := dst.drift(src, patterns)
+		if err != nil {
+			return err
+		}
+		d.print()
+		if d.empty() {
+			return nil
+		}
+		if *check {
+			return withCode(ErrCodeVerifyFailed, fmt.Errorf("%s differs from %s", dst.Config.ECR.Repository, src.Config.ECR.Repository))
+		}
+		if failed := dst.reconcile(src, d); failed > 0 {
+			return withCode(ErrCodePushFailed, fmt.Errorf("%d tag(s) could not be copied to %s", failed, dst.Config.ECR.Repository))
+		}
+		return nil
+	}
+
+	if *interval <= 0 {
+		exitOnError("Sync failed", syncOnce())
+		return
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		if err := syncOnce(); err != nil {
+			fmt.Println(ColorRed + "Sync failed: " + err.Error() + ColorReset)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		// ECR login tokens last 12 hours, so log in again every round; the
+		// cached tokens are renewed once they get close to expiring.
+		for _, ecr := range []*ECR{src, dst} {
+			if err := ecr.authenticate(); err != nil {
+				fmt.Println(ColorRed + "Authentication failed: " + err.Error() + ColorReset)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// tagGuardEntry is one line of the tag guard log.
+type tagGuardEntry struct {
+	Time           time.Time `json:"time"`
+	Profile        string    `json:"profile"`
+	Repository     string    `json:"repository"`
+	Tag            string    `json:"tag"`
+	PreviousDigest string    `json:"previous_digest"`
+	BackupTag      string    `json:"backup_tag,omitempty"`
+}
+
+// guardTag records the digest every tag the push writes (image_tag, the
+// extra image_tags and the aliases) points to before it is overwritten, and
+// optionally keeps it reachable under previous-<tag>.
+func (ecr *ECR) guardTag() error {
+	guard := ecr.Config.ECR.TagGuard
+	if !guard.Enabled && guard.SourceCheck == "" {
+		return nil
+	}
+	tags, err := ecr.pushTags()
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+
+	if err := ecr.ensureRepository(); err != nil {
+		return err
+	}
+	ecr.stage(ColorYellow, "Checking current digests of "+strings.Join(tags, ", "))
+	for _, tag := range tags {
+		if err := ecr.guardOneTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guardOneTag runs the tag guard on one of the tags the push writes.
+func (ecr *ECR) guardOneTag(tag string) error {
+	guard := ecr.Config.ECR.TagGuard
+	digest, err := ecr.imageDigest(tag)
+	if err != nil {
+		return errorf(KeyTagGuardLookupFailed, err)
+	}
+	if digest == "" {
+		fmt.Printf("Tag '%s' does not exist yet in %s\n", tag, ecr.Config.ECR.Repository)
+		return nil
+	}
+	fmt.Printf(ColorYellow+"Tag '%s' currently points to %s"+ColorReset+"\n", tag, digest)
+	if err := ecr.checkSource(tag); err != nil {
+		return err
+	}
+	if !guard.Enabled {
+		return nil
+	}
+
+	entry := tagGuardEntry{
+		Time:           time.Now().UTC(),
+		Profile:        ecr.Profile,
+		Repository:     ecr.Config.ECR.Repository,
+		Tag:            tag,
+		PreviousDigest: digest,
+	}
+
+	if guard.Backup {
+		backup := "previous-" + tag
+		if err := ecr.putImageTag(digest, backup); err != nil {
+			return errorf(KeyTagGuardBackupFailed, backup, err)
+		}
+		entry.BackupTag = backup
+		fmt.Printf(ColorYellow+"Previous image kept as '%s'"+ColorReset+"\n", backup)
+	}
+
+	if guard.LogFile != "" {
+		if err := appendJSONLine(guard.LogFile, entry); err != nil {
+			return errorf(KeyTagGuardLogFailed, err)
+		}
+	}
+	return nil
+}
+
+// appendJSONLine appends v as a single JSON line to path.
+func appendJSONLine(path string, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Long lines are not written atomically; lock so concurrent
+	// invocations do not interleave them.
+	if _, err := lockFile(f, true); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestGuardTagCoversEveryPushedTag(t *testing.T) {
+	srv := startECR(t)
+	putTestImage(t, srv, testRepository, "v1", map[string]string{"sha256:d1": "v1 layer"})
+	putTestImage(t, srv, testRepository, "stable", map[string]string{"sha256:d2": "stable layer"})
+	putTestImage(t, srv, testRepository, "latest", map[string]string{"sha256:d3": "latest layer"})
+	before := srv.Tags(testRepository)
+
+	ecr := testRun(t, "guard", func(c *ProfileConfig) {
+		c.ECR.ImageTags = []string{"v1", "stable", "v1.0"}
+		c.ECR.TagAliases = map[string]string{"latest": "latest", "same": "stable"}
+		c.ECR.TagGuard = TagGuardConfig{Enabled: true, Backup: true, LogFile: "guard.log"}
+	})
+	if err := ecr.runPipeline(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	tags := srv.Tags(testRepository)
+	for _, tag := range []string{"v1", "stable", "latest"} {
+		if got := tags["previous-"+tag]; got != before[tag] {
+			t.Errorf("previous-%s = %q, want %q", tag, got, before[tag])
+		}
+	}
+	if _, ok := tags["previous-v1.0"]; ok {
+		t.Error("previous-v1.0 was created for a tag that did not exist")
+	}
+
+	f, err := os.Open("guard.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	logged := map[string]string{}
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var entry tagGuardEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := logged[entry.Tag]; ok {
+			t.Errorf("tag %s logged twice", entry.Tag)
+		}
+		logged[entry.Tag] = entry.PreviousDigest
+	}
+	if len(logged) != 3 || logged["v1"] != before["v1"] || logged["stable"] != before["stable"] || logged["latest"] != before["latest"] {
+		t.Errorf("log = %v, want the previous digests of v1, stable and latest", logged)
+	}
+}
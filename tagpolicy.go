@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TagPolicy restricts the tags a profile may push. Every rule is optional.
+type TagPolicy struct {
+	Pattern   string   `mapstructure:"pattern"`    // regular expression the whole tag must match
+	Semver    bool     `mapstructure:"semver"`     // require v1.2.3 or 1.2.3[-prerelease]
+	MaxLength int      `mapstructure:"max_length"` // registries allow 128
+	Forbidden []string `mapstructure:"forbidden"`  // case-insensitive words the tag may not contain
+}
+
+// semverTag matches semantic versions as they can appear in a tag (no build
+// metadata: "+" is not allowed in tags).
+var semverTag = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?$`)
+
+// checkTagPolicy validates the tags the push will create (image_tag, the
+// extra image_tags and the resolved aliases) before anything is built.
+func (ecr *ECR) checkTagPolicy() error {
+	tags, err := ecr.pushTags()
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := ecr.Config.Policy.Tags.check(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p TagPolicy) check(tag string) error {
+	violation := func(format string, args ...any) error {
+		return withCode(ErrCodePolicyViolation, fmt.Errorf("tag '%s' "+format, append([]any{tag}, args...)...))
+	}
+	if !tagPattern.MatchString(tag) {
+		return violation("is not a valid tag: use letters, digits, '_', '.' and '-', at most 128 characters, not starting with '.' or '-'")
+	}
+	if p.MaxLength > 0 && len(tag) > p.MaxLength {
+		return violation("is %d characters long, more than policy.tags.max_length (%d)", len(tag), p.MaxLength)
+	}
+	if p.Semver && !semverTag.MatchString(tag) {
+		return violation("is not a semantic version (e.g. v1.2.3 or 1.2.3-rc.1)")
+	}
+	if p.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+		if err != nil {
+			return withCode(ErrCodeConfigInvalid, fmt.Errorf("policy.tags.pattern is not a valid regular expression: %w", err))
+		}
+		if !re.MatchString(tag) {
+			return violation("does not match policy.tags.pattern %s", p.Pattern)
+		}
+	}
+	for _, word := range p.Forbidden {
+		if word != "" && strings.Contains(strings.ToLower(tag), strings.ToLower(word)) {
+			return violation("contains the forbidden word '%s'", word)
+		}
+	}
+	return nil
+}
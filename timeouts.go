@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// StageTimeout limits how long a stage runs, retries and hooks included. Past
+// Soft the state of Docker and the builder is captured while the stage is
+// still stuck; past Hard the stage is killed and fails with
+// PUSHECR_STAGE_TIMEOUT and the captured state. Either may be empty.
+type StageTimeout struct {
+	Soft string `mapstructure:"soft"`
+	Hard string `mapstructure:"hard"`
+}
+
+// diagnosticsCommandTimeout bounds each command of a timeout's diagnostics,
+// which must not hang on the same stuck daemon as the stage.
+const diagnosticsCommandTimeout = 30 * time.Second
+
+// stageStopTimeout bounds the wait for a stage canceled at its hard timeout to
+// return, for the odd call that does not honor its context.
+const stageStopTimeout = 30 * time.Second
+
+func (t StageTimeout) durations() (soft, hard time.Duration) {
+	soft, _ = time.ParseDuration(orDefault(t.Soft, "0s"))
+	hard, _ = time.ParseDuration(orDefault(t.Hard, "0s"))
+	return soft, hard
+}
+
+// validateTimeouts checks the timeouts section: known stages and positive
+// durations, with soft shorter than hard.
+func validateTimeouts(timeouts map[string]StageTimeout) error {
+	for name := range timeouts {
+		if !isStage(name) {
+			return fmt.Errorf("timeouts.%s is not a stage (expected one of %s)", name, strings.Join(stageNames(), ", "))
+		}
+	}
+	for _, name := range stageNames() {
+		t, ok := timeouts[name]
+		if !ok {
+			continue
+		}
+		for _, setting := range [][2]string{{"soft", t.Soft}, {"hard", t.Hard}} {
+			if d, err := time.ParseDuration(orDefault(setting[1], "1s")); err != nil || d <= 0 {
+				return fmt.Errorf("invalid timeouts.%s.%s '%s'", name, setting[0], setting[1])
+			}
+		}
+		if soft, hard := t.durations(); soft > 0 && hard > 0 && soft >= hard {
+			return fmt.Errorf("timeouts.%s.soft must be shorter than timeouts.%s.hard", name, name)
+		}
+	}
+	return nil
+}
+
+// withTimeouts enforces the stage's entry of the timeouts section. At the hard
+// timeout the stage's context is canceled, which kills the commands it runs
+// and aborts its Engine API and AWS SDK calls, and the stage is waited for, so
+// nothing it started outlives the failed run.
+func withTimeouts(s stage) stage {
+	return stageFunc(s, func(ctx context.Context, ecr *ECR, next func(context.Context, *ECR) error) error {
+		timeout, ok := ecr.Config.Timeouts[s.Name]
+		if !ok {
+			return next(ctx, ecr)
+		}
+		soft, hard := timeout.durations()
+		started := time.Now()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() { done <- next(ctx, ecr) }()
+
+		var softTimeout, hardTimeout <-chan time.Time
+		if soft > 0 {
+			timer := time.NewTimer(soft)
+			defer timer.Stop()
+			softTimeout = timer.C
+		}
+		if hard > 0 {
+			timer := time.NewTimer(hard)
+			defer timer.Stop()
+			hardTimeout = timer.C
+		}
+		var diagnostics string
+		for {
+			select {
+			case err := <-done:
+				return err
+			case <-softTimeout:
+				fmt.Printf(ColorYellow+"%s is taking longer than %s, capturing diagnostics"+ColorReset+"\n", s.Name, soft)
+				diagnostics = ecr.stageDiagnostics(s.Name, time.Since(started))
+				fmt.Fprint(&ecr.logs, diagnostics)
+			case <-hardTimeout:
+				if diagnostics == "" {
+					diagnostics = ecr.stageDiagnostics(s.Name, time.Since(started))
+					fmt.Fprint(&ecr.logs, diagnostics)
+				}
+				fmt.Printf(ColorRed+"%s ran past %s, stopping it"+ColorReset+"\n", s.Name, hard)
+				cancel()
+				select {
+				case <-done:
+				case <-time.After(stageStopTimeout):
+					fmt.Fprintf(&ecr.logs, "%s did not stop %s after it was canceled\n", s.Name, stageStopTimeout)
+				}
+				return withCode(ErrCodeStageTimeout, errorf(KeyStageTimeout, s.Name, hard, strings.TrimRight(diagnostics, "\n")))
+			}
+		}
+	})
+}
+
+// stageDiagnostics captures the state of Docker and the builder while a stage
+// is stuck, and the goroutines of pushecr when it serves the API, where the
+// stage shares the process with everything else.
+func (ecr *ECR) stageDiagnostics(name string, elapsed time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- diagnostics of %s after %s ---\n", name, elapsed.Round(time.Second))
+	commands := [][]string{{"docker", "ps", "--no-trunc"}, {"docker", "buildx", "ls"}}
+	if builder := ecr.Config.Docker.Builder.Name; builder != "" {
+		commands = append(commands, []string{"docker", "buildx", "inspect", builder})
+	}
+	for _, args := range commands {
+		fmt.Fprintf(&b, "$ %s\n", strings.Join(args, " "))
+		ctx, cancel := context.WithTimeout(context.Background(), diagnosticsCommandTimeout)
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		cancel()
+		b.Write(out)
+		if err != nil {
+			fmt.Fprintf(&b, "(error: %v)\n", err)
+		}
+	}
+	if ecr.apiMode {
+		var goroutines bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&goroutines, 2)
+		b.WriteString("$ goroutines\n")
+		b.Write(goroutines.Bytes())
+	}
+	return b.String()
+}
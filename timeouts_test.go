@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestHardTimeoutKillsStage(t *testing.T) {
+	startECR(t)
+	ecr := testRun(t, "auth,push", func(c *ProfileConfig) {
+		c.Timeouts = map[string]StageTimeout{"push": {Hard: "200ms"}}
+	})
+	stopped := make(chan error, 1)
+	replaceStage(ecr, "push", func(ecr *ECR) error {
+		// A push that hangs, like one stuck on an unresponsive daemon.
+		err := exec.CommandContext(ecr.context(), "sleep", "30").Run()
+		stopped <- ecr.context().Err()
+		return err
+	})
+
+	started := time.Now()
+	err := ecr.runPipeline()
+	if code := errorCode(err); code != ErrCodeStageTimeout {
+		t.Fatalf("run ended with %s (%v), want %s", code, err, ErrCodeStageTimeout)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("run took %s to fail at a 200ms timeout", elapsed)
+	}
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("the stage's context ended with %v, want it canceled", err)
+		}
+	default:
+		t.Fatal("the run returned before the stage stopped")
+	}
+}
+
+func TestStageWithinTimeout(t *testing.T) {
+	startECR(t)
+	ecr := testRun(t, "auth,push", func(c *ProfileConfig) {
+		c.Timeouts = map[string]StageTimeout{"push": {Hard: "10s"}}
+	})
+	replaceStage(ecr, "push", registryPush)
+
+	if err := ecr.runPipeline(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+}
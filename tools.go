@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ToolsConfig struct {
+	Require map[string]ToolRequirement `mapstructure:"require"`
+}
+
+// ToolRequirement constrains an external binary pushecr runs.
+type ToolRequirement struct {
+	MinVersion string   `mapstructure:"min_version"`
+	SHA256     []string `mapstructure:"sha256"`
+}
+
+// toolVersionArgs are the commands that print the version of known tools.
+var toolVersionArgs = map[string][]string{
+	"aws":      {"--version"},
+	"docker":   {"version", "--format", "{{.Client.Version}}"},
+	"cosign":   {"version"},
+	"notation": {"version"},
+	"git":      {"--version"},
+}
+
+var versionPattern = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// check validates tools.require at startup, so a run fails fast on an
+// outdated or unexpectedly modified binary.
+func (c ToolsConfig) check() error {
+	names := make([]string, 0, len(c.Require))
+	for name := range c.Require {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		requirement := c.Require[name]
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return withCode(ErrCodeToolRequirement, fmt.Errorf("%s is required by tools.require but was not found in PATH", name))
+		}
+
+		if len(requirement.SHA256) > 0 {
+			sum, err := fileSHA256(path)
+			if err != nil {
+				return err
+			}
+			if !contains(requirement.SHA256, sum) {
+				return withCode(ErrCodeToolRequirement, fmt.Errorf("%s (%s) has sha256 %s, which is not in tools.require.%s.sha256", name, path, sum, name))
+			}
+		}
+
+		if requirement.MinVersion != "" {
+			args, ok := toolVersionArgs[name]
+			if !ok {
+				args = []string{"--version"}
+			}
+			out, err := exec.Command(path, args...).CombinedOutput()
+			if err != nil {
+				return withCode(ErrCodeToolRequirement, errorf(KeyToolVersionFailed, name, err))
+			}
+			version := versionPattern.FindString(string(out))
+			if version == "" {
+				return withCode(ErrCodeToolRequirement, errorf(KeyToolVersionUnreadable, name, strings.TrimSpace(string(out))))
+			}
+			if compareVersions(version, requirement.MinVersion) < 0 {
+				return withCode(ErrCodeToolRequirement, fmt.Errorf("%s %s is older than the required %s", name, version, requirement.MinVersion))
+			}
+		}
+	}
+	return nil
+}
+
+// fileSHA256 hashes the binary behind path, following symlinks.
+func fileSHA256(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errorf(KeyFileReadFailed, resolved, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
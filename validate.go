@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+func runValidate(args []string) {
+	fs, configPath, profile := commandFlags("validate", "validate [-config deploy.yml] [-profile dev | -all]")
+	all := fs.Bool("all", false, "Validate every profile in the configuration")
+	fs.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	exitOnError("Error loading configuration", err)
+	exitOnError("Tool requirements not met", config.Tools.check())
+
+	names := []string{*profile}
+	if *all {
+		names = names[:0]
+		for name := range config.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	failed := 0
+	for _, name := range names {
+		if err := validateProfile(config, name); err != nil {
+			failed++
+			fmt.Println(ColorRed + "✘ " + name + ": " + err.Error() + ColorReset)
+			continue
+		}
+		fmt.Println(ColorGreen + "✔ " + name + ColorReset)
+	}
+	if failed > 0 {
+		exitOnError("Validation failed", withCode(ErrCodeConfigInvalid, fmt.Errorf("%d of %d profile(s) are invalid", failed, len(names))))
+	}
+}
+
+// validateProfile runs the checks that need neither AWS nor Docker: the
+// profile's settings, the repository and tag policies and that the Dockerfile
+// (or the prebuilt template) can be read.
+func validateProfile(config *Config, name string) error {
+	profileConfig, err := config.profile(name)
+	if err != nil {
+		return err
+	}
+	if err := validateConfig(profileConfig); err != nil {
+		return err
+	}
+	ecr := &ECR{Profile: name, Config: profileConfig}
+	if err := ecr.checkRepositoryPolicy(); err != nil {
+		return err
+	}
+	if err := ecr.checkTagPolicy(); err != nil {
+		return err
+	}
+	if ecr.remoteContext() {
+		return nil
+	}
+	_, err = ecr.localDockerfile()
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VariantConfig is an extra flavor of the image built and pushed in the same
+// run, such as a debug image with a shell on top of a distroless base. Its
+// tags are the profile's tags with "-<name>" appended.
+type VariantConfig struct {
+	Name      string            `mapstructure:"name"`
+	Target    string            `mapstructure:"target"`     // Dockerfile stage to build
+	BuildArgs map[string]string `mapstructure:"build_args"` // e.g. a different BASE image
+}
+
+func validateVariants(variants []VariantConfig) error {
+	seen := map[string]bool{}
+	for _, v := range variants {
+		if v.Name == "" || !tagPattern.MatchString("x-"+v.Name) {
+			return fmt.Errorf("variants: '%s' is not a valid variant name", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variants: '%s' is defined twice", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
+
+// withVariant returns a copy of the profile that builds and pushes v.
+func (c *ProfileConfig) withVariant(v VariantConfig) *ProfileConfig {
+	config := *c
+	suffix := "-" + v.Name
+	config.ECR.ImageTag += suffix
+	config.ECR.ImageTags = nil
+	for _, tag := range c.ECR.ImageTags {
+		config.ECR.ImageTags = append(config.ECR.ImageTags, tag+suffix)
+	}
+	config.Docker.ImageName += suffix
+	config.ECR.TagAliases = map[string]string{}
+	for alias, tmpl := range c.ECR.TagAliases {
+		config.ECR.TagAliases[alias] = tmpl + suffix
+	}
+	// Channels track the main image only.
+	config.Channels.Push = ""
+	config.Variants = nil
+	return &config
+}
+
+// runVariants runs the selected stages again for every variant, reusing the
+// run's log and observers. Authentication is not repeated (see mainImageOnly).
+func (ecr *ECR) runVariants(stages []stage) error {
+	base, digest := ecr.Config, ecr.Digest
+	defer func() { ecr.Config, ecr.Digest, ecr.variant = base, digest, nil }()
+	for _, v := range base.Variants {
+		ecr.Config, ecr.Digest, ecr.variant = base.withVariant(v), "", &v
+		ecr.stage(ColorCyan, "Variant "+v.Name)
+		if err := ecr.runStages(stages); err != nil {
+			return err
+		}
+		ecr.variants = append(ecr.variants, variantResult{Name: v.Name, Image: ecr.imageURI(ecr.Config.ECR.ImageTag), Digest: ecr.Digest})
+	}
+	return nil
+}
+
+// variantResult is what a variant pushed.
+type variantResult struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// variantArgs returns the build options of the variant being built; its
+// build arguments are merged into buildArgs.
+func (ecr *ECR) variantArgs() []string {
+	if ecr.variant == nil || ecr.variant.Target == "" {
+		return nil
+	}
+	return []string{"--target", ecr.variant.Target}
+}
+
+// stageLabel names a stage in events and usage reports, qualified with the
+// variant being built.
+func (ecr *ECR) stageLabel(name string) string {
+	if ecr.variant == nil {
+		return name
+	}
+	return name + ":" + ecr.variant.Name
+}
+
+// mainImageOnly reports whether variants skip the stage: authentication and
+// approval are done once per run, and only the main image is deployed.
+func mainImageOnly(name string) bool {
+	return name == "auth" || name == "approval" || name == "deploy"
+}
+
+// plannedStages counts the stages the run will execute, variants included.
+func (ecr *ECR) plannedStages() int {
+	perVariant := 0
+	for _, s := range ecr.stages {
+		if !mainImageOnly(s.Name) {
+			perVariant++
+		}
+	}
+	return len(ecr.stages) + perVariant*len(ecr.Config.Variants)
+}
+
+func variantNames(variants []variantResult) string {
+	names := make([]string, len(variants))
+	for i, v := range variants {
+		names[i] = v.Name
+	}
+	return strings.Join(names, ", ")
+}
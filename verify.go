@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+type VerifyConfig struct {
+	Require          []string             `mapstructure:"require"`
+	ProvenanceType   string               `mapstructure:"provenance_type"`
+	SBOMType         string               `mapstructure:"sbom_type"`
+	AttestationTypes map[string]string    `mapstructure:"attestation_types"`
+	Cosign           CosignVerifyConfig   `mapstructure:"cosign"`
+	Notation         NotationVerifyConfig `mapstructure:"notation"`
+}
+
+type CosignVerifyConfig struct {
+	Key                       string `mapstructure:"key"`
+	CertificateIdentity       string `mapstructure:"certificate_identity"`
+	CertificateIdentityRegexp string `mapstructure:"certificate_identity_regexp"`
+	CertificateOIDCIssuer     string `mapstructure:"certificate_oidc_issuer"`
+}
+
+type NotationVerifyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// verifyChecks are the checks understood by -require, in the order they run.
+// Custom attestations are required as "attestation:<name>".
+var verifyChecks = []string{"signature", "provenance", "sbom"}
+
+func runVerify(args []string) {
+	fs, configPath, profile := commandFlags("verify", "verify [-config deploy.yml] [-profile dev] [-require signature,provenance,sbom,attestation:<name>] [tag]")
+	require := fs.String("require", "", "Comma-separated checks that must pass: signature, provenance, sbom, attestation:<name> (default from verify.require, or signature)")
+	fs.Parse(args)
+
+	profileConfig, err := loadProfile(*configPath, *profile)
+	exitOnError("Invalid configuration", err)
+	ecr := &ECR{Profile: *profile, Config: profileConfig}
+
+	tag := profileConfig.ECR.ImageTag
+	if fs.NArg() > 0 {
+		tag = fs.Arg(0)
+	}
+
+	checks := profileConfig.Verify.Require
+	if *require != "" {
+		checks = strings.Split(*require, ",")
+	}
+	if len(checks) == 0 {
+		checks = []string{"signature"}
+	}
+	for _, check := range checks {
+		if name, ok := strings.CutPrefix(check, "attestation:"); ok && name != "" {
+			continue
+		}
+		if !contains(verifyChecks, check) {
+			exitOnError("Invalid arguments", withCode(ErrCodeConfigInvalid, fmt.Errorf("unknown check '%s' (expected one of %s, attestation:<name>)", check, strings.Join(verifyChecks, ", "))))
+		}
+	}
+
+	exitOnError("Authentication failed", ecr.dockerLogin())
+
+	digest, err := ecr.imageDigest(tag)
+	exitOnError("Could not resolve tag", err)
+	if digest == "" {
+		exitOnError("Could not resolve tag", withCode(ErrCodeImageNotFound, fmt.Errorf("tag '%s' not found in %s", tag, profileConfig.ECR.Repository)))
+	}
+	ref := ecr.repositoryURI() + "@" + digest
+	ecr.stage(ColorCyan, "Verifying "+ref)
+
+	failed := 0
+	for _, check := range checks {
+		var err error
+		switch check {
+		case "signature":
+			err = ecr.verifySignature(ref)
+		case "provenance":
+			err = ecr.verifyAttestation(ref, orDefault(profileConfig.Verify.ProvenanceType, "slsaprovenance"))
+		case "sbom":
+			err = ecr.verifyAttestation(ref, orDefault(profileConfig.Verify.SBOMType, "spdxjson"))
+		default:
+			name := strings.TrimPrefix(check, "attestation:")
+			err = ecr.verifyAttestation(ref, profileConfig.Verify.attestationType(name))
+		}
+		if err != nil {
+			failed++
+			fmt.Println(ColorRed + "✘ " + check + ": " + err.Error() + ColorReset)
+			continue
+		}
+		fmt.Println(ColorGreen + "✔ " + check + ColorReset)
+	}
+
+	if failed > 0 {
+		exitOnError("Verification failed", withCode(ErrCodeVerifyFailed, fmt.Errorf("%d of %d checks failed for %s", failed, len(checks), ref)))
+	}
+	fmt.Println(ColorGreen + "Image " + ref + " verified" + ColorReset)
+}
+
+// verifySignature checks the image against every configured verifier.
+func (ecr *ECR) verifySignature(ref string) error {
+	verify := ecr.Config.Verify
+	verified := false
+	if verify.Cosign.configured() {
+		args := append([]string{"verify"}, verify.Cosign.args()...)
+		if err := ecr.runCheck("cosign", append(args, ref)...); err != nil {
+			return fmt.Errorf("cosign: %w", err)
+		}
+		verified = true
+	}
+	if verify.Notation.Enabled {
+		if err := ecr.runCheck("notation", "verify", ref); err != nil {
+			return fmt.Errorf("notation: %w", err)
+		}
+		verified = true
+	}
+	if !verified {
+		return errors.New("no signature verifier configured (verify.cosign or verify.notation)")
+	}
+	return nil
+}
+
+// verifyAttestation checks that a cosign attestation of the given predicate
+// type is attached to the image and signed by the configured identity.
+func (ecr *ECR) verifyAttestation(ref, predicateType string) error {
+	cosign := ecr.Config.Verify.Cosign
+	if !cosign.configured() {
+		return errors.New("attestations are verified with cosign; configure verify.cosign")
+	}
+	args := append([]string{"verify-attestation", "--type", predicateType}, cosign.args()...)
+	if err := ecr.runCheck("cosign", append(args, ref)...); err != nil {
+		return fmt.Errorf("%s attestation: %w", predicateType, err)
+	}
+	return nil
+}
+
+func (c CosignVerifyConfig) configured() bool {
+	return c.Key != "" || c.CertificateIdentity != "" || c.CertificateIdentityRegexp != ""
+}
+
+func (c CosignVerifyConfig) args() []string {
+	if c.Key != "" {
+		return []string{"--key", c.Key}
+	}
+	if c.CertificateIdentityRegexp != "" {
+		return []string{
+			"--certificate-identity-regexp", c.CertificateIdentityRegexp,
+			"--certificate-oidc-issuer", c.CertificateOIDCIssuer,
+		}
+	}
+	return []string{
+		"--certificate-identity", c.CertificateIdentity,
+		"--certificate-oidc-issuer", c.CertificateOIDCIssuer,
+	}
+}
+
+// String describes the signer for log messages.
+func (c CosignVerifyConfig) String() string {
+	switch {
+	case c.Key != "":
+		return "key " + c.Key
+	case c.CertificateIdentityRegexp != "":
+		return "identity ~" + c.CertificateIdentityRegexp
+	default:
+		return "identity " + c.CertificateIdentity
+	}
+}
+
+// runCheck runs a verification tool, keeping its output in the run log only.
+// On failure the tool's last stderr line is returned as the error.
+func (ecr *ECR) runCheck(name string, args ...string) error {
+	cmd := exec.CommandContext(ecr.context(), name, args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = &ecr.logs
+	cmd.Stderr = io.MultiWriter(&ecr.logs, &stderr)
+	if err := cmd.Run(); err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return errors.New(line)
+		}
+		return err
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type WorkerConfig struct {
+	QueueURL          string `mapstructure:"queue_url"`
+	Region            string `mapstructure:"region"`
+	ResultQueueURL    string `mapstructure:"result_queue_url"`
+	ResultTopicARN    string `mapstructure:"result_topic_arn"`
+	VisibilityTimeout int    `mapstructure:"visibility_timeout"`
+}
+
+// workerJob is the body of a job message:
+//
+//	{"id": "build-42", "profile": "prod", "git_ref": "v1.4.2", "overrides": {"image_tag": "v1.4.2"}}
+type workerJob struct {
+	ID                   string     `json:"id,omitempty"`
+	Profile              string     `json:"profile"`
+	GitRef               string     `json:"git_ref,omitempty"`
+	Overrides            *overrides `json:"overrides,omitempty"`
+	RebuildIfBaseUpdated bool       `json:"rebuild_if_base_updated,omitempty"`
+}
+
+// workerResult is published for every job the worker executes.
+type workerResult struct {
+	ID         string    `json:"id,omitempty"`
+	Profile    string    `json:"profile"`
+	GitRef     string    `json:"git_ref,omitempty"`
+	Status     string    `json:"status"`
+	Image      string    `json:"image,omitempty"`
+	ErrorCode  ErrorCode `json:"error_code,omitempty"`
+	ErrorKey   ErrorKey  `json:"error_key,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type sqsMessage struct {
+	MessageID     string `json:"MessageId"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+	Body          string `json:"Body"`
+}
+
+func runWorker(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	configPath := fs.String("config", "deploy.yml", "Path to the configuration YAML file")
+	fs.StringVar(&workspace, "workspace", workspace, workspaceUsage)
+	fs.BoolVar(&readOnly, "read-only", readOnly, readOnlyUsage)
+	once := fs.Bool("once", false, "Process at most one message and exit")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s worker [-config deploy.yml] [-once]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	exitOnError("Error loading configuration", err)
+	exitOnError("Tool requirements not met", config.Tools.check())
+	worker := config.Worker
+	if worker.QueueURL == "" {
+		exitOnError("Invalid configuration", withCode(ErrCodeConfigInvalid, fmt.Errorf("worker.queue_url is required")))
+	}
+	if worker.Region == "" {
+		exitOnError("Invalid configuration", withCode(ErrCodeConfigInvalid, fmt.Errorf("worker.region is required")))
+	}
+	if worker.VisibilityTimeout <= 0 {
+		worker.VisibilityTimeout = 3600
+	}
+
+	var stopping atomic.Bool
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		fmt.Println(ColorYellow + "Stopping after the current job" + ColorReset)
+		stopping.Store(true)
+	}()
+
+	fmt.Println(ColorGreen + "pushecr worker polling " + worker.QueueURL + ColorReset)
+	for !stopping.Load() {
+		message, err := worker.receive()
+		if err != nil {
+			fmt.Println(ColorRed + "Could not receive messages: " + err.Error() + ColorReset)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		if message == nil {
+			continue
+		}
+
+		var job workerJob
+		if err := json.Unmarshal([]byte(message.Body), &job); err != nil || job.Profile == "" {
+			// Invalid messages are left on the queue so the redrive policy
+			// moves them to the dead-letter queue.
+			fmt.Printf(ColorRed+"Ignoring invalid job message %s: %s"+ColorReset+"\n", message.MessageID, message.Body)
+		} else {
+			result := executeJob(config, job)
+			if err := worker.publish(result); err != nil {
+				fmt.Println(ColorRed + "Could not publish job result: " + err.Error() + ColorReset)
+			}
+			if err := worker.delete(message); err != nil {
+				fmt.Println(ColorRed + "Could not delete job message: " + err.Error() + ColorReset)
+			}
+		}
+		if *once {
+			return
+		}
+	}
+}
+
+func executeJob(config *Config, job workerJob) workerResult {
+	result := workerResult{ID: job.ID, Profile: job.Profile, GitRef: job.GitRef, StartedAt: time.Now().UTC()}
+	fmt.Printf(ColorCyan+"Job %s: profile %s %s"+ColorReset+"\n", job.ID, job.Profile, job.GitRef)
+
+	ecr := &ECR{Profile: job.Profile, rebuildIfBaseUpdated: job.RebuildIfBaseUpdated}
+	err := checkoutRef(job.GitRef)
+	if err == nil {
+		err = runProfile(config, ecr, job.Overrides)
+	}
+	recordRun(config.History, newRunEntry(orDefault(job.ID, newRunID()), "worker", ecr, result.StartedAt, err))
+	recordDeployment(config.Manifest, ecr, err)
+	config.autoPrune()
+
+	result.FinishedAt = time.Now().UTC()
+	if err != nil {
+		result.Status = runFailed
+		result.Error = err.Error()
+		result.ErrorCode = errorCode(err)
+		result.ErrorKey = errorKey(err)
+		fmt.Printf(ColorRed+"Job %s failed: %v"+ColorReset+"\n", job.ID, err)
+		return result
+	}
+	result.Status = runSucceeded
+	result.Image = ecr.imageURI(ecr.Config.ECR.ImageTag)
+	fmt.Printf(ColorGreen+"Job %s pushed %s"+ColorReset+"\n", job.ID, result.Image)
+	return result
+}
+
+// checkoutRef fetches ref from origin and checks it out in the working
+// directory, so a job builds exactly the commit it names.
+func checkoutRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if err := validateRef(ref); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"fetch", "--quiet", "origin", "--", ref},
+		{"checkout", "--quiet", "--detach", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return errorf(KeyWorkerFetchFailed, ref, args[0], err)
+		}
+	}
+	return nil
+}
+
+// commitHash matches a full or abbreviated SHA-1 or SHA-256 commit hash.
+var commitHash = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+// validateRef accepts a git_ref that is a commit hash or a well-formed ref
+// name. The ref comes from a message anyone allowed to send to the queue can
+// write, so one that git could take for an option, like --upload-pack=<cmd>,
+// never reaches it.
+func validateRef(ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return withCode(ErrCodeConfigInvalid, errorf(KeyWorkerInvalidRef, ref))
+	}
+	if commitHash.MatchString(ref) {
+		return nil
+	}
+	if err := exec.Command("git", "check-ref-format", "--allow-onelevel", ref).Run(); err != nil {
+		return withCode(ErrCodeConfigInvalid, errorf(KeyWorkerInvalidRef, ref))
+	}
+	return nil
+}
+
+// receive long-polls the job queue and returns nil when no message arrived.
+func (w WorkerConfig) receive() (*sqsMessage, error) {
+	out, err := runAWS(w.Region, os.Stderr, "sqs", "receive-message",
+		"--queue-url", w.QueueURL,
+		"--max-number-of-messages", "1",
+		"--wait-time-seconds", "20",
+		"--visibility-timeout", strconv.Itoa(w.VisibilityTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var result struct {
+		Messages []sqsMessage `json:"Messages"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, errorf(KeyAWSBadResponse, "receive-message", err)
+	}
+	if len(result.Messages) == 0 {
+		return nil, nil
+	}
+	return &result.Messages[0], nil
+}
+
+func (w WorkerConfig) delete(message *sqsMessage) error {
+	_, err := runAWS(w.Region, os.Stderr, "sqs", "delete-message",
+		"--queue-url", w.QueueURL,
+		"--receipt-handle", message.ReceiptHandle,
+	)
+	return err
+}
+
+// publish sends the result to the result queue and/or SNS topic.
+func (w WorkerConfig) publish(result workerResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if w.ResultQueueURL != "" {
+		if _, err := runAWS(w.Region, os.Stderr, "sqs", "send-message",
+			"--queue-url", w.ResultQueueURL,
+			"--message-body", string(body),
+		); err != nil {
+			return err
+		}
+	}
+	if w.ResultTopicARN != "" {
+		if _, err := runAWS(w.Region, os.Stderr, "sns", "publish",
+			"--topic-arn", w.ResultTopicARN,
+			"--subject", fmt.Sprintf("pushecr %s %s", result.Profile, result.Status),
+			"--message", string(body),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
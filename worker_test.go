@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestValidateRef(t *testing.T) {
+	for _, test := range []struct {
+		ref   string
+		valid bool
+	}{
+		{"v1.4.2", true},
+		{"main", true},
+		{"refs/heads/release/2024", true},
+		{"3f2c1a9", true},
+		{"3f2c1a9d0b8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a", true},
+		{"--upload-pack=touch /tmp/pwned", false},
+		{"-b", false},
+		{"a..b", false},
+		{"main~1", false},
+		{"topic branch", false},
+		{"refs/heads/x.lock", false},
+	} {
+		err := validateRef(test.ref)
+		if test.valid && err != nil {
+			t.Errorf("validateRef(%q) = %v, want it accepted", test.ref, err)
+		}
+		if !test.valid && errorCode(err) != ErrCodeConfigInvalid {
+			t.Errorf("validateRef(%q) = %v, want %s", test.ref, err, ErrCodeConfigInvalid)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WorkspaceConfig groups the profiles of one team. The workspace's region and
+// repository prefix apply to each of its profiles, and its role is assumed
+// before talking to AWS.
+type WorkspaceConfig struct {
+	RoleARN          string                   `mapstructure:"role_arn"`
+	Region           string                   `mapstructure:"region"`
+	RepositoryPrefix string                   `mapstructure:"repository_prefix"`
+	Profiles         map[string]ProfileConfig `mapstructure:"profiles"`
+}
+
+// workspace is the workspace selected with -workspace (or PUSHECR_WORKSPACE).
+// Every command registers the flag and loadConfig applies it.
+var workspace = os.Getenv("PUSHECR_WORKSPACE")
+
+const workspaceUsage = "Workspace whose profiles to use (default $PUSHECR_WORKSPACE)"
+
+// useWorkspace replaces the top-level profiles with those of the named
+// workspace, with the workspace defaults applied.
+func (c *Config) useWorkspace(name string) error {
+	ws, ok := c.Workspaces[name]
+	if !ok {
+		names := make([]string, 0, len(c.Workspaces))
+		for n := range c.Workspaces {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return withCode(ErrCodeProfileNotFound, fmt.Errorf("workspace '%s' not found in configuration (available: %s)", name, strings.Join(names, ", ")))
+	}
+
+	profiles := make(map[string]ProfileConfig, len(ws.Profiles))
+	for profileName, profile := range ws.Profiles {
+		if profile.ECR.Region == "" {
+			profile.ECR.Region = ws.Region
+		}
+		if ws.RepositoryPrefix != "" && !strings.HasPrefix(profile.ECR.Repository, ws.RepositoryPrefix) {
+			profile.ECR.Repository = ws.RepositoryPrefix + profile.ECR.Repository
+		}
+		profiles[profileName] = profile
+	}
+	c.Profiles = profiles
+	c.role = ws.RoleARN
+	c.roleRegion = ws.Region
+	return nil
+}
+
+// workspaceCredentials caches the temporary credentials of the workspace
+// role, and the caller's own credentials they replaced in the environment.
+var workspaceCredentials struct {
+	mu         sync.Mutex
+	expiration time.Time
+	original   map[string]*string
+}
+
+var credentialVariables = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"}
+
+// assumeWorkspaceRole exports temporary credentials of the workspace role to
+// the environment, so the aws and docker commands pushecr runs use them.
+// Credentials are reused until five minutes before they expire.
+func (c *Config) assumeWorkspaceRole() error {
+	workspaceCredentials.mu.Lock()
+	defer workspaceCredentials.mu.Unlock()
+	if c.role == "" || time.Until(workspaceCredentials.expiration) > 5*time.Minute {
+		return nil
+	}
+
+	// Assume the role with the caller's credentials, not a previous session.
+	if original := workspaceCredentials.original; original != nil {
+		for name, value := range original {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+	} else {
+		workspaceCredentials.original = map[string]*string{}
+		for _, name := range credentialVariables {
+			if value, ok := os.LookupEnv(name); ok {
+				workspaceCredentials.original[name] = &value
+			} else {
+				workspaceCredentials.original[name] = nil
+			}
+		}
+	}
+
+	creds, err := assumeRole(context.Background(), "", orDefault(c.roleRegion, "us-east-1"), c.role, "pushecr-"+workspace, "")
+	if err != nil {
+		return classify(ErrCodeAccessDenied, err.Error(), errorf(KeyWorkspaceRoleFailed, workspace, err))
+	}
+	os.Setenv("AWS_ACCESS_KEY_ID", creds.AccessKeyID)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey)
+	os.Setenv("AWS_SESSION_TOKEN", creds.SessionToken)
+	workspaceCredentials.expiration = creds.Expiration
+	return nil
+}